@@ -5,7 +5,9 @@ package main
 //go:generate swag init --parseDepth 1 -g ./../../pkg/api/api.go -d ./../../pkg/api,./../../pkg/docs/model,./../../pkg/docs/service/processing,./../../pkg/user/model  -o ./../../pkg/api/docs
 
 import (
+	"context"
 	"flag"
+	"log"
 
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/api"
 	_ "github.com/bsn-si/IPEHR-gateway/src/pkg/api/docs"
@@ -29,8 +31,13 @@ func main() {
 
 	defer infra.Close()
 
-	a := api.New(cfg, infra).Build()
-	if err = a.Run(cfg.Host); err != nil {
+	a := api.New(cfg, infra)
+
+	if err = a.RestoreTreeIndex(context.Background()); err != nil {
+		log.Printf("Tree index restore error: %v", err)
+	}
+
+	if err = a.Build().Run(cfg.Host); err != nil {
 		panic(err)
 	}
 }
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 
@@ -10,6 +11,7 @@ import (
 	ginSwagger "github.com/swaggo/gin-swagger"
 	"github.com/swaggo/gin-swagger/swaggerFiles"
 
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/common"
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/config"
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/service"
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/service/composition"
@@ -20,6 +22,7 @@ import (
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/service/query"
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/service/template"
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/infrastructure"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/storage/treeindex"
 	userService "github.com/bsn-si/IPEHR-gateway/src/pkg/user/service"
 )
 
@@ -50,6 +53,8 @@ type API struct {
 	Request      *RequestHandler
 	User         *UserHandler
 	Contribution *ContributionHandler
+
+	compositionService *composition.Service
 }
 
 func New(cfg *config.Config, infra *infrastructure.Infra) *API {
@@ -58,7 +63,7 @@ func New(cfg *config.Config, infra *infrastructure.Infra) *API {
 	groupAccessService := groupAccess.NewService(docService, cfg.DefaultGroupAccessID, cfg.DefaultUserID)
 
 	templateService := template.NewService(docService)
-	queryService := query.NewService(docService, query.NewQueryExecuterService(infra.AqlDB))
+	queryService := query.NewService(docService, query.NewQueryExecuterService(infra.AqlDB, common.QueryExecutionWorkers, common.QueryUserConcurrency))
 	userSvc := userService.NewService(infra, docService.Proc)
 	contribution := contributionService.NewService(docService)
 	directory := directoryService.NewService(infra, docService.Proc)
@@ -84,7 +89,18 @@ func New(cfg *config.Config, infra *infrastructure.Infra) *API {
 		User:         NewUserHandler(userSvc),
 		Contribution: NewContributionHandler(contribution, userSvc, templateService, compositionService, cfg.BaseURL),
 		Directory:    NewDirectoryHandler(directory, userSvc, docService.Infra.Index, cfg.BaseURL),
+
+		compositionService: compositionService,
+	}
+}
+
+// RestoreTreeIndex reconciles the AQL tree index, loaded from the local snapshot, with the stored EHRs and compositions.
+func (a *API) RestoreTreeIndex(ctx context.Context) error {
+	if err := a.Ehr.service.RestoreTreeIndex(ctx, common.EhrSystemID, a.compositionService); err != nil {
+		return err
 	}
+
+	return treeindex.DefaultEHRIndex.Snapshot()
 }
 
 func (a *API) Build() *gin.Engine {
@@ -219,7 +235,10 @@ func (a *API) buildQueryAPI() handlerBuilder {
 		r.Use(ehrSystemID)
 		r.GET("/:qualified_query_name", a.Query.ExecStoredQuery)
 		r.POST("/:qualified_query_name", a.Query.PostExecStoredQuery)
+		r.GET("/:qualified_query_name/:version", a.Query.ExecStoredQuery)
+		r.POST("/:qualified_query_name/:version", a.Query.PostExecStoredQuery)
 		r.POST("/aql", a.Query.ExecPostQuery)
+		r.POST("/aql/explain", a.Query.ExplainPostQuery)
 	}
 }
 
@@ -6,11 +6,12 @@ package mocks
 
 import (
 	context "context"
+	aqlquerier "github.com/bsn-si/IPEHR-gateway/src/pkg/aqlquerier"
 	model "github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model"
 	base "github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model/base"
+	query "github.com/bsn-si/IPEHR-gateway/src/pkg/docs/service/query"
 	reflect "reflect"
 
-	gin "github.com/gin-gonic/gin"
 	gomock "github.com/golang/mock/gomock"
 )
 
@@ -38,48 +39,48 @@ func (m *MockQueryService) EXPECT() *MockQueryServiceMockRecorder {
 }
 
 // ExecQuery mocks base method.
-func (m *MockQueryService) ExecQuery(ctx context.Context, query *model.QueryRequest) (*model.QueryResponse, error) {
+func (m *MockQueryService) ExecQuery(ctx context.Context, userID, systemID string, query *model.QueryRequest) (*model.QueryResponse, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ExecQuery", ctx, query)
+	ret := m.ctrl.Call(m, "ExecQuery", ctx, userID, systemID, query)
 	ret0, _ := ret[0].(*model.QueryResponse)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // ExecQuery indicates an expected call of ExecQuery.
-func (mr *MockQueryServiceMockRecorder) ExecQuery(ctx, query interface{}) *gomock.Call {
+func (mr *MockQueryServiceMockRecorder) ExecQuery(ctx, userID, systemID, query interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExecQuery", reflect.TypeOf((*MockQueryService)(nil).ExecQuery), ctx, query)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExecQuery", reflect.TypeOf((*MockQueryService)(nil).ExecQuery), ctx, userID, systemID, query)
 }
 
-// ExecQueryWithTimeout mocks base method.
-func (m *MockQueryService) ExecQueryWithTimeout(ctx *gin.Context, query *model.QueryRequest) (*model.QueryResponse, error) {
+// ExecStoredQuery mocks base method.
+func (m *MockQueryService) ExecStoredQuery(ctx context.Context, userID, systemID, qualifiedQueryName, version string, query *model.QueryRequest) (*model.QueryResponse, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ExecQueryWithTimeout", ctx, query)
+	ret := m.ctrl.Call(m, "ExecStoredQuery", ctx, userID, systemID, qualifiedQueryName, version, query)
 	ret0, _ := ret[0].(*model.QueryResponse)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// ExecQueryWithTimeout indicates an expected call of ExecQueryWithTimeout.
-func (mr *MockQueryServiceMockRecorder) ExecQueryWithTimeout(ctx, query interface{}) *gomock.Call {
+// ExecStoredQuery indicates an expected call of ExecStoredQuery.
+func (mr *MockQueryServiceMockRecorder) ExecStoredQuery(ctx, userID, systemID, qualifiedQueryName, version, query interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExecQueryWithTimeout", reflect.TypeOf((*MockQueryService)(nil).ExecQueryWithTimeout), ctx, query)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExecStoredQuery", reflect.TypeOf((*MockQueryService)(nil).ExecStoredQuery), ctx, userID, systemID, qualifiedQueryName, version, query)
 }
 
-// ExecStoredQuery mocks base method.
-func (m *MockQueryService) ExecStoredQuery(ctx context.Context, userID, systemID, qualifiedQueryName string, query *model.QueryRequest) (*model.QueryResponse, error) {
+// ExplainQuery mocks base method.
+func (m *MockQueryService) ExplainQuery(ctx context.Context, userID, systemID string, query *model.QueryRequest) (*aqlquerier.Plan, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ExecStoredQuery", ctx, userID, systemID, qualifiedQueryName, query)
-	ret0, _ := ret[0].(*model.QueryResponse)
+	ret := m.ctrl.Call(m, "ExplainQuery", ctx, userID, systemID, query)
+	ret0, _ := ret[0].(*aqlquerier.Plan)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// ExecStoredQuery indicates an expected call of ExecStoredQuery.
-func (mr *MockQueryServiceMockRecorder) ExecStoredQuery(ctx, userID, systemID, qualifiedQueryName, query interface{}) *gomock.Call {
+// ExplainQuery indicates an expected call of ExplainQuery.
+func (mr *MockQueryServiceMockRecorder) ExplainQuery(ctx, userID, systemID, query interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExecStoredQuery", reflect.TypeOf((*MockQueryService)(nil).ExecStoredQuery), ctx, userID, systemID, qualifiedQueryName, query)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExplainQuery", reflect.TypeOf((*MockQueryService)(nil).ExplainQuery), ctx, userID, systemID, query)
 }
 
 // GetByVersion mocks base method.
@@ -112,6 +113,21 @@ func (mr *MockQueryServiceMockRecorder) List(ctx, userID, systemID, qualifiedQue
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockQueryService)(nil).List), ctx, userID, systemID, qualifiedQueryName)
 }
 
+// ResolveVersion mocks base method.
+func (m *MockQueryService) ResolveVersion(ctx context.Context, userID, systemID, name, version string) (*model.StoredQuery, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResolveVersion", ctx, userID, systemID, name, version)
+	ret0, _ := ret[0].(*model.StoredQuery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ResolveVersion indicates an expected call of ResolveVersion.
+func (mr *MockQueryServiceMockRecorder) ResolveVersion(ctx, userID, systemID, name, version interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResolveVersion", reflect.TypeOf((*MockQueryService)(nil).ResolveVersion), ctx, userID, systemID, name, version)
+}
+
 // Store mocks base method.
 func (m *MockQueryService) Store(ctx context.Context, userID, systemID, reqID, qType, name, q string) (*model.StoredQuery, error) {
 	m.ctrl.T.Helper()
@@ -142,11 +158,25 @@ func (mr *MockQueryServiceMockRecorder) StoreVersion(ctx, userID, systemID, reqI
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StoreVersion", reflect.TypeOf((*MockQueryService)(nil).StoreVersion), ctx, userID, systemID, reqID, qType, name, version, q)
 }
 
+// StreamQuery mocks base method.
+func (m *MockQueryService) StreamQuery(ctx context.Context, userID, systemID string, query *model.QueryRequest, w query.ResultWriter) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StreamQuery", ctx, userID, systemID, query, w)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StreamQuery indicates an expected call of StreamQuery.
+func (mr *MockQueryServiceMockRecorder) StreamQuery(ctx, userID, systemID, query, w interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StreamQuery", reflect.TypeOf((*MockQueryService)(nil).StreamQuery), ctx, userID, systemID, query, w)
+}
+
 // Validate mocks base method.
-func (m *MockQueryService) Validate(data []byte) bool {
+func (m *MockQueryService) Validate(data []byte) error {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "Validate", data)
-	ret0, _ := ret[0].(bool)
+	ret0, _ := ret[0].(error)
 	return ret0
 }
 
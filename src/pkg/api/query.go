@@ -1,6 +1,7 @@
 package api
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"log"
@@ -10,22 +11,27 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/aqlprocessor"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/aqlquerier"
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/common"
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model"
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model/base"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/service/query"
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/errors"
 )
 
 type QueryService interface {
 	List(ctx context.Context, userID, systemID, qualifiedQueryName string) ([]*model.StoredQuery, error)
 	GetByVersion(ctx context.Context, userID, systemID, name string, version *base.VersionTreeID) (*model.StoredQuery, error)
-	Validate(data []byte) bool
+	ResolveVersion(ctx context.Context, userID, systemID, name, version string) (*model.StoredQuery, error)
+	Validate(data []byte) error
 	Store(ctx context.Context, userID, systemID, reqID, qType, name, q string) (*model.StoredQuery, error)
 	StoreVersion(ctx context.Context, userID, systemID, reqID, qType, name string, version *base.VersionTreeID, q string) (*model.StoredQuery, error)
 
-	ExecQuery(ctx context.Context, query *model.QueryRequest) (*model.QueryResponse, error)
-	ExecQueryWithTimeout(ctx *gin.Context, query *model.QueryRequest) (*model.QueryResponse, error)
-	ExecStoredQuery(ctx context.Context, userID, systemID, qualifiedQueryName string, query *model.QueryRequest) (*model.QueryResponse, error)
+	ExecQuery(ctx context.Context, userID, systemID string, query *model.QueryRequest) (*model.QueryResponse, error)
+	StreamQuery(ctx context.Context, userID, systemID string, query *model.QueryRequest, w query.ResultWriter) error
+	ExecStoredQuery(ctx context.Context, userID, systemID, qualifiedQueryName, version string, query *model.QueryRequest) (*model.QueryResponse, error)
+	ExplainQuery(ctx context.Context, userID, systemID string, query *model.QueryRequest) (*aqlquerier.Plan, error)
 }
 
 type QueryHandler struct {
@@ -44,6 +50,10 @@ func NewQueryHandler(queryService QueryService, baseURL string) *QueryHandler {
 // @Summary      Execute ad-hoc (non-stored) AQL query
 // @Description  Execute ad-hoc query, supplied by q attribute, fetching {fetch} numbers of rows from {offset} and passing {query_parameters} to the underlying query engine.
 // @Description  See also details on usage of [query parameters](https://specifications.openehr.org/releases/ITS-REST/Release-1.0.2/query.html#requirements-common-headers-and-query-parameters).
+// @Description  The rows are streamed as chunked JSON while the query reads them.
+// @Description  With {fetch} the response has the `continuation_token` if there are more rows. Post the same query with the token to get the next page,
+// @Description  the rows after the first page are kept with the token, so the compositions committed meanwhile do not shift the next pages. The token expires with its rows.
+// @Description  If the query fails after the rows are started, the response ends with the `error` member instead of the `continuation_token`.
 // @Description
 // @Tags     QUERY
 // @Accept   json
@@ -53,7 +63,7 @@ func NewQueryHandler(queryService QueryService, baseURL string) *QueryHandler {
 // @Param    Request        body      model.QueryRequest  true  "Query Request"
 // @Success  200            {object}  model.QueryResponse
 // @Header   201            {string}  ETag  "A unique identifier of the resultSet. Example: cdbb5db1-e466-4429-a9e5-bf80a54e120b"
-// @Failure  400            "Is returned when the server was unable to execute the query due to invalid input, e.g. a request with missing `q` parameter or an invalid query syntax."
+// @Failure  400            {object}  api.SyntaxErrorResponse  "Is returned when the server was unable to execute the query due to invalid input, e.g. a request with missing `q` parameter or an invalid query syntax."
 // @Failure  408            "Is returned when there is a query execution timeout (i.e. maximum query execution time reached, therefore the server aborted the execution of the query)."
 // @Failure  500            "Is returned when an unexpected error occurs while processing a request"
 // @Router   /query/aql [post]
@@ -77,27 +87,217 @@ func (h QueryHandler) ExecPostQuery(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c.Request.Context(), common.QueryExecutionTimeout)
 	defer cancel()
 
-	c.Request = c.Request.WithContext(ctx)
+	userID := c.GetString("userID")
+	systemID := c.GetString("ehrSystemID")
 
-	resp, err := h.service.ExecQueryWithTimeout(c, &req)
+	w := &queryStreamWriter{c: c}
+
+	err := h.service.StreamQuery(ctx, userID, systemID, &req, w)
 	if err != nil {
 		log.Printf("cannot exec query: %v", err)
 
+		// the status is sent with the first rows, the response is completed with the error member instead of the footer
+		if w.started {
+			message := "internal server error"
+			if errors.Is(err, errors.ErrTimeout) {
+				message = "timeout exceeded"
+			}
+
+			if err := w.WriteError(message); err != nil {
+				log.Printf("cannot write query error: %v", err)
+			}
+
+			c.Abort()
+
+			return
+		}
+
+		if abortWithSyntaxErrors(c, err) {
+			return
+		}
+
+		switch {
+		case errors.Is(err, errors.ErrTimeout):
+			c.JSON(http.StatusRequestTimeout, gin.H{"error": "timeout exceeded"})
+		case req.ContinuationToken != "" && (errors.Is(err, errors.ErrNotFound) || errors.Is(err, errors.ErrIncorrectRequest)):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "continuation token is expired or invalid"})
+		case errors.Is(err, errors.ErrNotFound), errors.Is(err, errors.ErrIncorrectRequest):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}
+	}
+}
+
+// queryStreamWriter writes the query response as chunked JSON, the rows are flushed while they are read.
+type queryStreamWriter struct {
+	c        *gin.Context
+	started  bool
+	finished bool
+	rows     int
+}
+
+const queryStreamFlushRows = 100
+
+func (w *queryStreamWriter) WriteHeader(resp *model.QueryResponse) error {
+	resp.Rows = nil
+	resp.ContinuationToken = ""
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal response header")
+	}
+
+	// the rows are the last field of the response, they are written one by one instead of null
+	data = bytes.TrimSuffix(data, []byte("null}"))
+
+	w.c.Header("Content-Type", "application/json; charset=utf-8")
+	w.c.Status(http.StatusOK)
+
+	w.started = true
+
+	if _, err := w.c.Writer.Write(append(data, '[')); err != nil {
+		return errors.Wrap(err, "cannot write response header")
+	}
+
+	w.c.Writer.Flush()
+
+	return nil
+}
+
+func (w *queryStreamWriter) WriteRow(row any) error {
+	data, err := json.Marshal(row)
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal row")
+	}
+
+	if w.rows > 0 {
+		data = append([]byte{','}, data...)
+	}
+
+	if _, err := w.c.Writer.Write(data); err != nil {
+		return errors.Wrap(err, "cannot write row")
+	}
+
+	w.rows++
+
+	if w.rows%queryStreamFlushRows == 0 {
+		w.c.Writer.Flush()
+	}
+
+	return nil
+}
+
+func (w *queryStreamWriter) WriteFooter(continuationToken string) error {
+	footer := []byte{']'}
+
+	if continuationToken != "" {
+		token, err := json.Marshal(continuationToken)
+		if err != nil {
+			return errors.Wrap(err, "cannot marshal continuation token")
+		}
+
+		footer = append(footer, `,"continuation_token":`...)
+		footer = append(footer, token...)
+	}
+
+	footer = append(footer, '}')
+
+	return w.writeEnd(footer)
+}
+
+// WriteError completes the response with the error member after the rows written so far, so the body stays valid JSON
+// and the client tells the incomplete result by the error.
+func (w *queryStreamWriter) WriteError(message string) error {
+	if w.finished {
+		return nil
+	}
+
+	data, err := json.Marshal(message)
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal error message")
+	}
+
+	footer := append([]byte(`],"error":`), data...)
+	footer = append(footer, '}')
+
+	return w.writeEnd(footer)
+}
+
+// writeEnd writes the end of the response once.
+func (w *queryStreamWriter) writeEnd(data []byte) error {
+	w.finished = true
+
+	if _, err := w.c.Writer.Write(data); err != nil {
+		return errors.Wrap(err, "cannot write response footer")
+	}
+
+	w.c.Writer.Flush()
+
+	return nil
+}
+
+// ExplainPostQuery
+// @Summary      Explain ad-hoc AQL query
+// @Description  Executes the ad-hoc query and returns its plan instead of the rows: the parsed query, the FROM containment with the predicates of every source and the number of rows left after every stage.
+// @Description  It shows whether the parsing, the containment or the WHERE conditions dropped the rows of the query.
+// @Tags     QUERY
+// @Accept   json
+// @Produce  json
+// @Param    Authorization  header    string              true  "Bearer AccessToken"
+// @Param    AuthUserId     header    string              true  "UserId UUID"
+// @Param    Request        body      model.QueryRequest  true  "Query Request"
+// @Success  200            {object}  aqlquerier.Plan
+// @Failure  400            {object}  api.SyntaxErrorResponse  "Is returned when the request has invalid input, e.g. a missing `q` parameter or an invalid query syntax."
+// @Failure  408            "Is returned when there is a query execution timeout"
+// @Failure  500            "Is returned when an unexpected error occurs while processing a request"
+// @Router   /query/aql/explain [post]
+func (h QueryHandler) ExplainPostQuery(c *gin.Context) {
+	req := model.QueryRequest{
+		QueryParameters: map[string]interface{}{},
+	}
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		log.Printf("cannot parse request body: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "body bad format"})
+		return
+	}
+	defer c.Request.Body.Close()
+
+	if !req.Validate() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Request validation error"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), common.QueryExecutionTimeout)
+	defer cancel()
+
+	userID := c.GetString("userID")
+	systemID := c.GetString("ehrSystemID")
+
+	plan, err := h.service.ExplainQuery(ctx, userID, systemID, &req)
+	if err != nil {
+		log.Printf("cannot explain query: %v", err)
+
 		if errors.Is(err, errors.ErrTimeout) {
 			c.JSON(http.StatusRequestTimeout, gin.H{"error": "timeout exceeded"})
 			return
 		}
 
+		if abortWithSyntaxErrors(c, err) {
+			return
+		}
+
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
 		return
 	}
 
-	c.JSON(http.StatusOK, resp)
+	c.JSON(http.StatusOK, plan)
 }
 
 // Get
 // @Summary      Execute stored AQL
-// @Description  Execute a stored query, identified by the supplied qualified_query_name (at latest version), fetching fetch numbers of rows from offset and passing query_parameters to the underlying query engine.
+// @Description  Execute a stored query, identified by the supplied qualified_query_name (at the given or latest version), fetching fetch numbers of rows from offset and passing query_parameters to the underlying query engine.
 // @Description  See also details on usage of [query parameters](https://specifications.openehr.org/releases/ITS-REST/latest/query.html#tag/Request/Common-Headers-and-Query-Parameters).
 // @Description  Queries can be stored or, once stored, their definition can be retrieved using the [definition endpoint](https://specifications.openehr.org/releases/ITS-REST/latest/definition.html#tag/Query).
 // @Description  https://specifications.openehr.org/releases/ITS-REST/latest/query.html#tag/Query/operation/query_execute_stored_query
@@ -107,16 +307,18 @@ func (h QueryHandler) ExecPostQuery(c *gin.Context) {
 // @Param        Authorization         header    string              true  "Bearer AccessToken"
 // @Param        AuthUserId            header    string              true  "UserId UUID"
 // @Param        qualified_query_name  path      string  true   "If pattern should given be in the format of [{namespace}::]{query-name},  and  when  is       empty,  it       will     be  treated  as    "wildcard"  in       the  search."
+// @Param        version               path      string  false  "A version number of the stored query, exact (e.g. 1.2.3) or the prefix (e.g. 1 or 1.2), the latest matching version is executed. The latest version if omitted or `latest`."
 // @Param        ehr_id            	   query     string  false  "An optional parameter to execute the query within an EHR context."
 // @Param        offset            	   query     string  false  "The row number in result-set to start result-set from (0-based), default is 0."
 // @Param        fetch            	   query     string  false  "Number of rows to fetch (the default depends on the implementation)."
-// @Param        query_parameters      query     any  false  "Query parameters (can appear multiple times)."
+// @Param        query_parameters      query     any  false  "Query parameters (can appear multiple times). The values of the number parameters are converted into numbers, the other values are kept as text."
 // @Success      200                   {object}  model.QueryResponse
 // @Header       200                   {string}  ETag  "A unique identifier of the resultSet. Example: cdbb5db1-e466-4429-a9e5-bf80a54e120b"
 // @Failure      400                   "Is returned when the server was unable to execute the query due to invalid input, e.g. a required parameter is missing, or at least one of the parameters has invalid syntax"
 // @Failure      404                   "Is returned when a stored query with qualified_query_name does not exists."
 // @Failure      408                   "Is returned when there is a query execution timeout"
 // @Router       /query/{qualified_query_name} [get]
+// @Router       /query/{qualified_query_name}/{version} [get]
 func (h QueryHandler) ExecStoredQuery(c *gin.Context) {
 	userID := c.GetString("userID")
 	systemID := c.GetString("ehrSystemID")
@@ -185,13 +387,17 @@ func (h QueryHandler) ExecStoredQuery(c *gin.Context) {
 			continue
 		}
 
-		req.QueryParameters[key] = val
+		req.QueryParameters[key] = model.QueryParameterText(val)
 	}
 
-	resp, err := h.service.ExecStoredQuery(c, userID, systemID, qualifiedQueryName, req)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), common.QueryExecutionTimeout)
+	defer cancel()
+
+	resp, err := h.service.ExecStoredQuery(ctx, userID, systemID, qualifiedQueryName, c.Param("version"), req)
 	if err != nil {
 		log.Printf("cannot exec stored query: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		abortWithStoredQueryError(c, err)
+
 		return
 	}
 
@@ -200,7 +406,7 @@ func (h QueryHandler) ExecStoredQuery(c *gin.Context) {
 
 // Post
 // @Summary      Execute stored AQL (POST)
-// @Description  Execute a stored query, identified by the supplied {qualified_query_name} (at latest version).
+// @Description  Execute a stored query, identified by the supplied {qualified_query_name} (at the given or latest version).
 // @Description  See also details on usage of [query parameters](https://specifications.openehr.org/releases/ITS-REST/latest/query.html#tag/Request/Common-Headers-and-Query-Parameters).
 // @Description  Queries can be stored or, once stored, their definition can be retrieved using the [definition endpoint](https://specifications.openehr.org/releases/ITS-REST/latest/definition.html#tag/Query).
 // @Description  https://specifications.openehr.org/releases/ITS-REST/latest/query.html#tag/Query/operation/query_execute_stored_query
@@ -210,6 +416,7 @@ func (h QueryHandler) ExecStoredQuery(c *gin.Context) {
 // @Param        Authorization         header    string              true  "Bearer AccessToken"
 // @Param        AuthUserId            header    string              true  "UserId UUID"
 // @Param        qualified_query_name  path      string  true   "If pattern should given be in the format of [{namespace}::]{query-name},  and  when  is       empty,  it       will     be  treated  as    "wildcard"  in       the  search."
+// @Param        version               path      string  false  "A version number of the stored query, exact (e.g. 1.2.3) or the prefix (e.g. 1 or 1.2), the latest matching version is executed. The latest version if omitted or `latest`."
 // @Param    	 Request               body      model.QueryRequest  true  "Query Request"
 // @Success      200                   {object}  model.QueryResponse
 // @Header       200                   {string}  ETag  "A unique identifier of the resultSet. Example: cdbb5db1-e466-4429-a9e5-bf80a54e120b"
@@ -217,6 +424,7 @@ func (h QueryHandler) ExecStoredQuery(c *gin.Context) {
 // @Failure      404                   "Is returned when a stored query with qualified_query_name does not exists."
 // @Failure      408                   "Is returned when there is a query execution timeout"
 // @Router       /query/{qualified_query_name} [post]
+// @Router       /query/{qualified_query_name}/{version} [post]
 func (h QueryHandler) PostExecStoredQuery(c *gin.Context) {
 	userID := c.GetString("userID")
 	systemID := c.GetString("ehrSystemID")
@@ -235,12 +443,53 @@ func (h QueryHandler) PostExecStoredQuery(c *gin.Context) {
 
 	defer c.Request.Body.Close()
 
-	resp, err := h.service.ExecStoredQuery(c, userID, systemID, qualifiedQueryName, &req)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), common.QueryExecutionTimeout)
+	defer cancel()
+
+	resp, err := h.service.ExecStoredQuery(ctx, userID, systemID, qualifiedQueryName, c.Param("version"), &req)
 	if err != nil {
 		log.Printf("cannot exec stored query: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		abortWithStoredQueryError(c, err)
+
 		return
 	}
 
 	c.JSON(http.StatusOK, resp)
 }
+
+// abortWithStoredQueryError responds with the status of the stored query execution error:
+// 404 for the unknown query and 400 for the missing or ill-typed parameters.
+func abortWithStoredQueryError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errors.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "stored query is not found"})
+	case errors.Is(err, errors.ErrIncorrectRequest):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, errors.ErrTimeout):
+		c.JSON(http.StatusRequestTimeout, gin.H{"error": "timeout exceeded"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+	}
+}
+
+// SyntaxErrorResponse is the body of the 400 response for the query with syntax errors.
+type SyntaxErrorResponse struct {
+	Error        string                    `json:"error"`
+	SyntaxErrors aqlprocessor.SyntaxErrors `json:"syntax_errors"`
+}
+
+// abortWithSyntaxErrors responds with the syntax errors of the AQL query if the error has them.
+// It returns false for any other error, the caller responds then.
+func abortWithSyntaxErrors(c *gin.Context, err error) bool {
+	var syntaxErrors aqlprocessor.SyntaxErrors
+	if !errors.As(err, &syntaxErrors) {
+		return false
+	}
+
+	c.JSON(http.StatusBadRequest, SyntaxErrorResponse{
+		Error:        "AQL syntax error",
+		SyntaxErrors: syntaxErrors,
+	})
+
+	return true
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -9,7 +10,10 @@ import (
 	"testing"
 
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/api/mocks"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/aqlprocessor"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/aqlquerier"
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/service/query"
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/errors"
 
 	"github.com/golang/mock/gomock"
@@ -27,6 +31,7 @@ func TestQueryHandler_ExecStoredQuery(t *testing.T) {
 
 	tests := []struct {
 		name        string
+		version     string
 		queryParams string
 		prepare     func(svc *mocks.MockQueryService)
 		wantStatus  int
@@ -34,6 +39,7 @@ func TestQueryHandler_ExecStoredQuery(t *testing.T) {
 	}{
 		{
 			"1. invalid ehr_id",
+			"",
 			"ehr_id=invalid_ehr",
 			func(svc *mocks.MockQueryService) {},
 			400,
@@ -41,6 +47,7 @@ func TestQueryHandler_ExecStoredQuery(t *testing.T) {
 		},
 		{
 			"2. invalid offset",
+			"",
 			"offset=invalid_offset",
 			func(svc *mocks.MockQueryService) {},
 			400,
@@ -48,6 +55,7 @@ func TestQueryHandler_ExecStoredQuery(t *testing.T) {
 		},
 		{
 			"3. invalid limit",
+			"",
 			"fetch=invalid",
 			func(svc *mocks.MockQueryService) {},
 			400,
@@ -55,6 +63,7 @@ func TestQueryHandler_ExecStoredQuery(t *testing.T) {
 		},
 		{
 			"4. error on get data",
+			"",
 			"ehr_id=7d44b88c-4199-4bad-97dc-d78268e01398&offset=1&fetch=10&some_val1=1&some_val2=some_str",
 			func(svc *mocks.MockQueryService) {
 				r := &model.QueryRequest{
@@ -62,18 +71,19 @@ func TestQueryHandler_ExecStoredQuery(t *testing.T) {
 					Fetch:  10,
 					QueryParameters: map[string]interface{}{
 						"ehr_id":    ehrID,
-						"some_val1": "1",
-						"some_val2": "some_str",
+						"some_val1": model.QueryParameterText("1"),
+						"some_val2": model.QueryParameterText("some_str"),
 					},
 				}
 
-				svc.EXPECT().ExecStoredQuery(gomock.Any(), userID, systemID, queryName, r).Return(nil, errors.New("some error"))
+				svc.EXPECT().ExecStoredQuery(gomock.Any(), userID, systemID, queryName, "", r).Return(nil, errors.New("some error"))
 			},
 			500,
 			`{"error":"internal server error"}`,
 		},
 		{
 			"5. success",
+			"",
 			"ehr_id=7d44b88c-4199-4bad-97dc-d78268e01398&offset=1&fetch=10&some_val1=1&some_val2=some_str",
 			func(svc *mocks.MockQueryService) {
 				r := &model.QueryRequest{
@@ -81,17 +91,97 @@ func TestQueryHandler_ExecStoredQuery(t *testing.T) {
 					Fetch:  10,
 					QueryParameters: map[string]interface{}{
 						"ehr_id":    ehrID,
-						"some_val1": "1",
-						"some_val2": "some_str",
+						"some_val1": model.QueryParameterText("1"),
+						"some_val2": model.QueryParameterText("some_str"),
 					},
 				}
 				resp := &model.QueryResponse{}
 
-				svc.EXPECT().ExecStoredQuery(gomock.Any(), userID, systemID, queryName, r).Return(resp, nil)
+				svc.EXPECT().ExecStoredQuery(gomock.Any(), userID, systemID, queryName, "", r).Return(resp, nil)
 			},
 			200,
 			`{"meta":{"_href":"","_type":"","_schema_version":"","_created":"","_generator":"","_executed_aql":""},"name":"","q":"","columns":null,"rows":null}`,
 		},
+		{
+			"6. missing parameter",
+			"",
+			"some_val1=1",
+			func(svc *mocks.MockQueryService) {
+				r := &model.QueryRequest{
+					QueryParameters: map[string]interface{}{"some_val1": model.QueryParameterText("1")},
+				}
+				err := fmt.Errorf("%w: query parameter some_val2 is missing", errors.ErrIncorrectRequest)
+
+				svc.EXPECT().ExecStoredQuery(gomock.Any(), userID, systemID, queryName, "", r).Return(nil, err)
+			},
+			400,
+			`{"error":"Request is incorrect: query parameter some_val2 is missing"}`,
+		},
+		{
+			"7. stored query not found",
+			"",
+			"",
+			func(svc *mocks.MockQueryService) {
+				r := &model.QueryRequest{
+					QueryParameters: map[string]interface{}{},
+				}
+
+				svc.EXPECT().ExecStoredQuery(gomock.Any(), userID, systemID, queryName, "", r).Return(nil, errors.ErrNotFound)
+			},
+			404,
+			`{"error":"stored query is not found"}`,
+		},
+		{
+			"8. success at version",
+			"1.2",
+			"some_val1=1",
+			func(svc *mocks.MockQueryService) {
+				r := &model.QueryRequest{
+					QueryParameters: map[string]interface{}{"some_val1": model.QueryParameterText("1")},
+				}
+				resp := &model.QueryResponse{}
+
+				svc.EXPECT().ExecStoredQuery(gomock.Any(), userID, systemID, queryName, "1.2", r).Return(resp, nil)
+			},
+			200,
+			`{"meta":{"_href":"","_type":"","_schema_version":"","_created":"","_generator":"","_executed_aql":""},"name":"","q":"","columns":null,"rows":null}`,
+		},
+		{
+			"9. success at the latest version",
+			"latest",
+			"",
+			func(svc *mocks.MockQueryService) {
+				r := &model.QueryRequest{
+					QueryParameters: map[string]interface{}{},
+				}
+				resp := &model.QueryResponse{}
+
+				svc.EXPECT().ExecStoredQuery(gomock.Any(), userID, systemID, queryName, "latest", r).Return(resp, nil)
+			},
+			200,
+			`{"meta":{"_href":"","_type":"","_schema_version":"","_created":"","_generator":"","_executed_aql":""},"name":"","q":"","columns":null,"rows":null}`,
+		},
+		{
+			"10. timeout",
+			"",
+			"",
+			func(svc *mocks.MockQueryService) {
+				r := &model.QueryRequest{
+					QueryParameters: map[string]interface{}{},
+				}
+
+				svc.EXPECT().ExecStoredQuery(gomock.Any(), userID, systemID, queryName, "", r).
+					DoAndReturn(func(ctx context.Context, _, _, _, _ string, _ *model.QueryRequest) (*model.QueryResponse, error) {
+						if _, ok := ctx.Deadline(); !ok {
+							return nil, errors.New("query context has no timeout")
+						}
+
+						return nil, errors.ErrTimeout
+					})
+			},
+			408,
+			`{"error":"timeout exceeded"}`,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -112,7 +202,12 @@ func TestQueryHandler_ExecStoredQuery(t *testing.T) {
 
 			router := api.setupRouter(api.buildQueryAPI())
 
-			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/v1/query/%s?%s", queryName, tt.queryParams), nil)
+			path := queryName
+			if tt.version != "" {
+				path += "/" + tt.version
+			}
+
+			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/v1/query/%s?%s", path, tt.queryParams), nil)
 			req.Header.Set("Authorization", "Bearer AccessKey")
 			req.Header.Set("AuthUserId", userID)
 			req.Header.Set("EhrSystemId", systemID)
@@ -171,7 +266,7 @@ func TestQueryHandler_PostExecStoredQuery(t *testing.T) {
 					},
 				}
 
-				svc.EXPECT().ExecStoredQuery(gomock.Any(), userID, systemID, queryName, r).Return(nil, errors.New("some error"))
+				svc.EXPECT().ExecStoredQuery(gomock.Any(), userID, systemID, queryName, "", r).Return(nil, errors.New("some error"))
 			},
 			500,
 			`{"error":"internal server error"}`,
@@ -189,7 +284,7 @@ func TestQueryHandler_PostExecStoredQuery(t *testing.T) {
 				}
 				resp := &model.QueryResponse{}
 
-				svc.EXPECT().ExecStoredQuery(gomock.Any(), userID, systemID, queryName, r).Return(resp, nil)
+				svc.EXPECT().ExecStoredQuery(gomock.Any(), userID, systemID, queryName, "", r).Return(resp, nil)
 			},
 			200,
 			`{"meta":{"_href":"","_type":"","_schema_version":"","_created":"","_generator":"","_executed_aql":""},"name":"","q":"","columns":null,"rows":null}`,
@@ -280,7 +375,7 @@ func TestQueryHandler_ExecPostQuery(t *testing.T) {
 					},
 				}
 
-				svc.EXPECT().ExecQueryWithTimeout(gomock.Any(), r).Return(nil, errors.New("some error"))
+				svc.EXPECT().StreamQuery(gomock.Any(), userID, systemID, r, gomock.Any()).Return(errors.New("some error"))
 			},
 			http.StatusInternalServerError,
 			`{"error":"internal server error"}`,
@@ -298,7 +393,7 @@ func TestQueryHandler_ExecPostQuery(t *testing.T) {
 					},
 				}
 
-				svc.EXPECT().ExecQueryWithTimeout(gomock.Any(), r).Return(nil, errors.ErrTimeout)
+				svc.EXPECT().StreamQuery(gomock.Any(), userID, systemID, r, gomock.Any()).Return(errors.ErrTimeout)
 			},
 			http.StatusRequestTimeout,
 			`{"error":"timeout exceeded"}`,
@@ -315,12 +410,111 @@ func TestQueryHandler_ExecPostQuery(t *testing.T) {
 						"key": 1.0,
 					},
 				}
-				resp := &model.QueryResponse{}
 
-				svc.EXPECT().ExecQueryWithTimeout(gomock.Any(), r).Return(resp, nil)
+				svc.EXPECT().StreamQuery(gomock.Any(), userID, systemID, r, gomock.Any()).DoAndReturn(
+					func(_ context.Context, _, _ string, _ *model.QueryRequest, w query.ResultWriter) error {
+						resp := &model.QueryResponse{
+							Query:   "SELECT 1",
+							Columns: []model.QueryColumn{{Name: "#0"}},
+						}
+
+						_ = w.WriteHeader(resp)
+						_ = w.WriteRow([]any{1})
+						_ = w.WriteRow([]any{2})
+
+						return w.WriteFooter("token")
+					})
 			},
 			200,
-			`{"meta":{"_href":"","_type":"","_schema_version":"","_created":"","_generator":"","_executed_aql":""},"name":"","q":"","columns":null,"rows":null}`,
+			`{"meta":{"_href":"","_type":"","_schema_version":"","_created":"","_generator":"","_executed_aql":""},"name":"","q":"SELECT 1","columns":[{"name":"#0","path":""}],"rows":[[1],[2]],"continuation_token":"token"}`,
+		},
+		{
+			"6. syntax error",
+			[]byte(`{"q":"SELECT 1 FROM"}`),
+			func(svc *mocks.MockQueryService) {
+				r := &model.QueryRequest{
+					Query:           "SELECT 1 FROM",
+					QueryParameters: map[string]interface{}{},
+				}
+				syntaxErrors := aqlprocessor.SyntaxErrors{
+					{Line: 1, Column: 13, OffendingToken: "<EOF>", Expected: []string{"EHR"}, Message: "mismatched input '<EOF>'"},
+				}
+
+				svc.EXPECT().StreamQuery(gomock.Any(), userID, systemID, r, gomock.Any()).Return(errors.Wrap(syntaxErrors, "cannot exec query"))
+			},
+			http.StatusBadRequest,
+			`{"error":"AQL syntax error","syntax_errors":[{"line":1,"column":13,"offending_token":"\u003cEOF\u003e","expected":["EHR"],"message":"mismatched input '\u003cEOF\u003e'"}]}`,
+		},
+		{
+			"7. expired continuation token",
+			[]byte(`{"q":"SELECT 1", "fetch":10, "continuation_token":"token"}`),
+			func(svc *mocks.MockQueryService) {
+				r := &model.QueryRequest{
+					Query:             "SELECT 1",
+					Fetch:             10,
+					QueryParameters:   map[string]interface{}{},
+					ContinuationToken: "token",
+				}
+
+				svc.EXPECT().StreamQuery(gomock.Any(), userID, systemID, r, gomock.Any()).Return(errors.ErrNotFound)
+			},
+			http.StatusBadRequest,
+			`{"error":"continuation token is expired or invalid"}`,
+		},
+		{
+			"8. incorrect parameter without continuation token",
+			[]byte(`{"q":"SELECT 1"}`),
+			func(svc *mocks.MockQueryService) {
+				r := &model.QueryRequest{
+					Query:           "SELECT 1",
+					QueryParameters: map[string]interface{}{},
+				}
+
+				err := fmt.Errorf("%w: LIKE pattern must be a string, got int64", errors.ErrIncorrectRequest)
+
+				svc.EXPECT().StreamQuery(gomock.Any(), userID, systemID, r, gomock.Any()).Return(errors.Wrap(err, "cannot exec query"))
+			},
+			http.StatusBadRequest,
+			`{"error":"cannot exec query: Request is incorrect: LIKE pattern must be a string, got int64"}`,
+		},
+		{
+			"9. error after the rows are streamed",
+			[]byte(`{"q":"SELECT 1"}`),
+			func(svc *mocks.MockQueryService) {
+				r := &model.QueryRequest{
+					Query:           "SELECT 1",
+					QueryParameters: map[string]interface{}{},
+				}
+
+				svc.EXPECT().StreamQuery(gomock.Any(), userID, systemID, r, gomock.Any()).DoAndReturn(
+					func(_ context.Context, _, _ string, _ *model.QueryRequest, w query.ResultWriter) error {
+						_ = w.WriteHeader(&model.QueryResponse{})
+						_ = w.WriteRow([]any{1})
+
+						return errors.New("some error")
+					})
+			},
+			http.StatusOK,
+			`{"meta":{"_href":"","_type":"","_schema_version":"","_created":"","_generator":"","_executed_aql":""},"name":"","q":"","columns":null,"rows":[[1]],"error":"internal server error"}`,
+		},
+		{
+			"10. timeout after the header is streamed",
+			[]byte(`{"q":"SELECT 1"}`),
+			func(svc *mocks.MockQueryService) {
+				r := &model.QueryRequest{
+					Query:           "SELECT 1",
+					QueryParameters: map[string]interface{}{},
+				}
+
+				svc.EXPECT().StreamQuery(gomock.Any(), userID, systemID, r, gomock.Any()).DoAndReturn(
+					func(_ context.Context, _, _ string, _ *model.QueryRequest, w query.ResultWriter) error {
+						_ = w.WriteHeader(&model.QueryResponse{})
+
+						return errors.Wrap(errors.ErrTimeout, "cannot exec query")
+					})
+			},
+			http.StatusOK,
+			`{"meta":{"_href":"","_type":"","_schema_version":"","_created":"","_generator":"","_executed_aql":""},"name":"","q":"","columns":null,"rows":[],"error":"timeout exceeded"}`,
 		},
 	}
 	for _, tt := range tests {
@@ -360,3 +554,114 @@ func TestQueryHandler_ExecPostQuery(t *testing.T) {
 		})
 	}
 }
+
+func TestQueryHandler_ExplainPostQuery(t *testing.T) {
+	var (
+		userID   = "5d44b88c-4199-4bad-97dc-d78268e01398"
+		systemID = "6d44b88c-4199-4bad-97dc-d78268e01398"
+	)
+
+	tests := []struct {
+		name       string
+		body       []byte
+		prepare    func(svc *mocks.MockQueryService)
+		wantStatus int
+		want       string
+	}{
+		{
+			"1. invalid body",
+			[]byte(`{"offset":"invalid_offset"}`),
+			func(svc *mocks.MockQueryService) {},
+			http.StatusBadRequest,
+			`{"error":"body bad format"}`,
+		},
+		{
+			"2. false because query is empty",
+			[]byte(`{"offset":1}`),
+			func(svc *mocks.MockQueryService) {},
+			http.StatusBadRequest,
+			`{"error":"Request validation error"}`,
+		},
+		{
+			"3. error on explain",
+			[]byte(`{"q":"SELECT 1"}`),
+			func(svc *mocks.MockQueryService) {
+				r := &model.QueryRequest{
+					Query:           "SELECT 1",
+					QueryParameters: map[string]interface{}{},
+				}
+
+				svc.EXPECT().ExplainQuery(gomock.Any(), userID, systemID, r).Return(nil, errors.New("some error"))
+			},
+			http.StatusInternalServerError,
+			`{"error":"internal server error"}`,
+		},
+		{
+			"4. timeout on explain",
+			[]byte(`{"q":"SELECT 1"}`),
+			func(svc *mocks.MockQueryService) {
+				r := &model.QueryRequest{
+					Query:           "SELECT 1",
+					QueryParameters: map[string]interface{}{},
+				}
+
+				svc.EXPECT().ExplainQuery(gomock.Any(), userID, systemID, r).Return(nil, errors.Wrap(errors.ErrTimeout, "cannot explain query"))
+			},
+			http.StatusRequestTimeout,
+			`{"error":"timeout exceeded"}`,
+		},
+		{
+			"5. success",
+			[]byte(`{"q":"SELECT 1"}`),
+			func(svc *mocks.MockQueryService) {
+				r := &model.QueryRequest{
+					Query:           "SELECT 1",
+					QueryParameters: map[string]interface{}{},
+				}
+				plan := &aqlquerier.Plan{
+					Stages: []aqlquerier.PlanStage{{Name: aqlquerier.StageFrom, Rows: 2}},
+				}
+
+				svc.EXPECT().ExplainQuery(gomock.Any(), userID, systemID, r).Return(plan, nil)
+			},
+			http.StatusOK,
+			`{"query":null,"containment":null,"stages":[{"name":"FROM","rows":2}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			userSvc := mocks.NewMockUserService(ctrl)
+			querySvc := mocks.NewMockQueryService(ctrl)
+
+			userSvc.EXPECT().VerifyAccess(userID, "Bearer AccessKey").Return(nil)
+
+			tt.prepare(querySvc)
+
+			api := API{
+				User:  NewUserHandler(userSvc),
+				Query: NewQueryHandler(querySvc, "base_url"),
+			}
+
+			router := api.setupRouter(api.buildQueryAPI())
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/query/aql/explain", bytes.NewBuffer(tt.body))
+			req.Header.Set("Authorization", "Bearer AccessKey")
+			req.Header.Set("AuthUserId", userID)
+			req.Header.Set("EhrSystemId", systemID)
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			resp := recorder.Result()
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+
+			respBody, _ := io.ReadAll(resp.Body)
+			assert.Equal(t, tt.want, string(respBody))
+		})
+	}
+}
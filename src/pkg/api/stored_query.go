@@ -9,6 +9,7 @@ import (
 
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model"
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model/base"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/service/query"
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/errors"
 )
 
@@ -62,7 +63,7 @@ func (h *QueryHandler) ListStored(c *gin.Context) {
 // @Tags         DEFINITION
 // @Produce      json
 // @Param        qualified_query_name  path      string  false  "If pattern should given be in the format of [{namespace}::]{query-name},  and  when  is       empty,  it       will     be  treated  as    "wildcard"  in       the  search."
-// @Param        version               path      string  false  "A SEMVER version number. This can be a an exact version (e.g. 1.7.1),     or   a     pattern  as      partial  prefix,  in  a        form  of          {major}  or   {major}.{minor}  (e.g. 1 or 1.0),  in  which  case  the  highest  (latest)  version  matching  the  prefix  will  be  considered."
+// @Param        version               path      string  false  "A SEMVER version number. This can be a an exact version (e.g. 1.7.1),     or   a     pattern  as      partial  prefix,  in  a        form  of          {major}  or   {major}.{minor}  (e.g. 1 or 1.0),  in  which  case  the  highest  (latest)  version  matching  the  prefix  will  be  considered, or `latest` for the latest version."
 // @Param        Authorization         header    string  true   "Bearer AccessToken"
 // @Param        AuthUserId            header    string  true   "UserId"
 // @Param        EhrSystemId           header    string  true   "The identifier of the system, typically a reverse domain identifier"
@@ -82,8 +83,7 @@ func (h *QueryHandler) GetStoredByVersion(c *gin.Context) {
 
 	version := c.Param("version")
 
-	v, err := base.NewVersionTreeID(version)
-	if err != nil {
+	if _, err := base.NewVersionTreeID(version); err != nil && version != query.LatestVersion {
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
@@ -94,9 +94,13 @@ func (h *QueryHandler) GetStoredByVersion(c *gin.Context) {
 		return
 	}
 
-	sq, err := h.service.GetByVersion(c, userID, systemID, qName, v)
+	sq, err := h.service.ResolveVersion(c, userID, systemID, qName, version)
 	if err != nil {
-		if errors.Is(err, errors.ErrNotFound) {
+		switch {
+		case errors.Is(err, errors.ErrIncorrectRequest):
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		case errors.Is(err, errors.ErrNotFound):
 			c.AbortWithStatus(http.StatusNotFound)
 			return
 		}
@@ -124,7 +128,7 @@ func (h *QueryHandler) GetStoredByVersion(c *gin.Context) {
 // @Param        EhrSystemId           header    string    true  "The identifier of the system, typically a reverse domain identifier"
 // @Header       200                   {string}  Location  "{baseUrl}/definition/query/org.openehr::compositions/1.0.1"
 // @Success      200                   "Is returned when the query was successfully stored."
-// @Failure      400                   "Is returned when the server was unable to store the query. This could be due to incorrect request body (could not be parsed, etc), unknown query type, etc."
+// @Failure      400                   {object}  api.SyntaxErrorResponse  "Is returned when the server was unable to store the query. This could be due to incorrect request body (could not be parsed, etc), unknown query type, etc."
 // @Failure      500                   "Is returned when an unexpected error occurs while processing a request"
 // @Router       /definition/query/{qualified_query_name} [put]
 func (h *QueryHandler) Store(c *gin.Context) {
@@ -159,8 +163,11 @@ func (h *QueryHandler) Store(c *gin.Context) {
 		return
 	}
 
-	if !h.service.Validate(data) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Request validation error"})
+	if err := h.service.Validate(data); err != nil {
+		if !abortWithSyntaxErrors(c, err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Request validation error"})
+		}
+
 		return
 	}
 
@@ -193,7 +200,7 @@ func (h *QueryHandler) Store(c *gin.Context) {
 // @Param        AuthUserId            header    string    true  "UserId UUID"
 // @Header       200                   {string}  Location  "{baseUrl}/definition/query/org.openehr::compositions/1.0.1"
 // @Success      200                   "Is returned when the query was successfully stored"
-// @Failure      400                   "Is returned when the server was unable to store the query. This could be due to incorrect request body (could not be parsed, etc),  unknown  query  type,  etc"
+// @Failure      400                   {object}  api.SyntaxErrorResponse  "Is returned when the server was unable to store the query. This could be due to incorrect request body (could not be parsed, etc),  unknown  query  type,  etc"
 // @Failure      409                   "Is returned when a query with the given 'qualified_query_name' and 'version' already exists on the server"
 // @Failure      500                   "Is returned when an unexpected error occurs while processing a request"
 // @Router       /definition/query/{qualified_query_name}/{version} [put]
@@ -250,8 +257,11 @@ func (h *QueryHandler) StoreVersion(c *gin.Context) {
 		return
 	}
 
-	if !h.service.Validate(data) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Request validation error"})
+	if err := h.service.Validate(data); err != nil {
+		if !abortWithSyntaxErrors(c, err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Request validation error"})
+		}
+
 		return
 	}
 
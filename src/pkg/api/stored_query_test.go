@@ -14,6 +14,7 @@ import (
 	"github.com/google/uuid"
 
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/api/mocks"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/aqlprocessor"
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model"
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/errors"
 )
@@ -157,7 +158,7 @@ func TestStoredQueryHandler_GetByVersion(t *testing.T) {
 			"notexist",
 			sqM.Version,
 			func(gaSvc *mocks.MockQueryService) {
-				gaSvc.EXPECT().GetByVersion(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, errors.ErrNotFound)
+				gaSvc.EXPECT().ResolveVersion(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, errors.ErrNotFound)
 			},
 			http.StatusNotFound,
 			"",
@@ -167,7 +168,7 @@ func TestStoredQueryHandler_GetByVersion(t *testing.T) {
 			sqM.Name,
 			"999.999.999",
 			func(gaSvc *mocks.MockQueryService) {
-				gaSvc.EXPECT().GetByVersion(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, errors.ErrNotFound)
+				gaSvc.EXPECT().ResolveVersion(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, errors.ErrNotFound)
 			},
 			http.StatusNotFound,
 			"",
@@ -177,7 +178,27 @@ func TestStoredQueryHandler_GetByVersion(t *testing.T) {
 			sqM.Name,
 			sqM.Version,
 			func(gaSvc *mocks.MockQueryService) {
-				gaSvc.EXPECT().GetByVersion(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(sqM, nil)
+				gaSvc.EXPECT().ResolveVersion(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(sqM, nil)
+			},
+			http.StatusOK,
+			string(sqJSON),
+		},
+		{
+			"6. success result of the latest version matching the prefix",
+			sqM.Name,
+			"1",
+			func(gaSvc *mocks.MockQueryService) {
+				gaSvc.EXPECT().ResolveVersion(gomock.Any(), gomock.Any(), gomock.Any(), sqM.Name, "1").Return(sqM, nil)
+			},
+			http.StatusOK,
+			string(sqJSON),
+		},
+		{
+			"7. success result of the latest version",
+			sqM.Name,
+			"latest",
+			func(gaSvc *mocks.MockQueryService) {
+				gaSvc.EXPECT().ResolveVersion(gomock.Any(), gomock.Any(), gomock.Any(), sqM.Name, "latest").Return(sqM, nil)
 			},
 			http.StatusOK,
 			string(sqJSON),
@@ -265,7 +286,7 @@ func TestStoredQueryHandler_Put(t *testing.T) {
 			sqM.Name,
 			sqM.Query,
 			func(gaSvc *mocks.MockQueryService) {
-				gaSvc.EXPECT().Validate(gomock.Any()).Return(true)
+				gaSvc.EXPECT().Validate(gomock.Any()).Return(nil)
 				gaSvc.EXPECT().Store(
 					gomock.Any(),
 					gomock.Any(),
@@ -279,6 +300,16 @@ func TestStoredQueryHandler_Put(t *testing.T) {
 			http.StatusOK,
 			urlPath + "/" + sqM.Name + "/" + sqM.Version,
 		},
+		{
+			"3. bad request because query has syntax errors",
+			sqM.Name,
+			"SELECT 1 FROM",
+			func(gaSvc *mocks.MockQueryService) {
+				gaSvc.EXPECT().Validate(gomock.Any()).Return(aqlprocessor.SyntaxErrors{{Line: 1, Column: 13, Message: "mismatched input"}})
+			},
+			http.StatusBadRequest,
+			"",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -401,7 +432,7 @@ func TestStoredQueryHandler_PutByVer(t *testing.T) {
 			sqM.Name,
 			sqM.Query,
 			func(gaSvc *mocks.MockQueryService) {
-				gaSvc.EXPECT().Validate(gomock.Any()).Return(true)
+				gaSvc.EXPECT().Validate(gomock.Any()).Return(nil)
 				gaSvc.EXPECT().StoreVersion(
 					gomock.Any(),
 					gomock.Any(),
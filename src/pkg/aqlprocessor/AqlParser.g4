@@ -147,6 +147,7 @@ functionCall:
 	terminologyFunction
 	| name = (
 		STRING_FUNCTION_ID
+		| CONTAINS // the keyword token wins over STRING_FUNCTION_ID in the lexer
 		| NUMERIC_FUNCTION_ID
 		| DATE_TIME_FUNCTION_ID
 		| IDENTIFIER
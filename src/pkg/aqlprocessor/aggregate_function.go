@@ -0,0 +1,51 @@
+package aqlprocessor
+
+import (
+	"fmt"
+
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/aqlprocessor/aqlparser"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/errors"
+)
+
+type AggregateFunctionName string
+
+const (
+	CountAggregateFunction AggregateFunctionName = "COUNT"
+	MinAggregateFunction   AggregateFunctionName = "MIN"
+	MaxAggregateFunction   AggregateFunctionName = "MAX"
+	SumAggregateFunction   AggregateFunctionName = "SUM"
+	AvgAggregateFunction   AggregateFunctionName = "AVG"
+)
+
+func getAggregateFunctionCall(ctx *aqlparser.AggregateFunctionCallContext) (*AggregateFunctionCallSelectValue, error) {
+	result := AggregateFunctionCallSelectValue{}
+
+	switch {
+	case ctx.COUNT() != nil:
+		result.Name = CountAggregateFunction
+	case ctx.MIN() != nil:
+		result.Name = MinAggregateFunction
+	case ctx.MAX() != nil:
+		result.Name = MaxAggregateFunction
+	case ctx.SUM() != nil:
+		result.Name = SumAggregateFunction
+	case ctx.AVG() != nil:
+		result.Name = AvgAggregateFunction
+	default:
+		return nil, fmt.Errorf("unexpected aggregate function: %v", ctx.GetText()) //nolint
+	}
+
+	result.Distinct = ctx.DISTINCT() != nil
+	result.Asterisk = ctx.SYM_ASTERISK() != nil
+
+	if ctx.IdentifiedPath() != nil {
+		ip, err := getIdentifiedPath(ctx.IdentifiedPath().(*aqlparser.IdentifiedPathContext))
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot get AggregateFunctionCall.IdentifiedPath")
+		}
+
+		result.IdentifiedPath = &ip
+	}
+
+	return &result, nil
+}
@@ -0,0 +1,91 @@
+package aqlprocessor
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestProcessor_SelectAggregateFunction(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    Select
+		wantErr bool
+	}{
+		{
+			"1. COUNT(*)",
+			`SELECT COUNT(*) AS total FROM EHR e`,
+			Select{
+				SelectExprs: []SelectExpr{{
+					Path:      "COUNT(*)",
+					AliasName: "total",
+					Value: &AggregateFunctionCallSelectValue{
+						Name:     CountAggregateFunction,
+						Asterisk: true,
+					},
+				}},
+			},
+			false,
+		},
+		{
+			"2. COUNT(DISTINCT path)",
+			`SELECT COUNT(DISTINCT e/ehr_id/value) FROM EHR e`,
+			Select{
+				SelectExprs: []SelectExpr{{
+					Path: "COUNT(DISTINCTe/ehr_id/value)",
+					Value: &AggregateFunctionCallSelectValue{
+						Name:     CountAggregateFunction,
+						Distinct: true,
+						IdentifiedPath: &IdentifiedPath{
+							Identifier: "e",
+							ObjectPath: &ObjectPath{
+								Paths: []PartPath{{Identifier: "ehr_id"}, {Identifier: "value"}},
+							},
+						},
+					},
+				}},
+			},
+			false,
+		},
+		{
+			"3. MIN, MAX, SUM, AVG",
+			`SELECT MIN(o/value), MAX(o/value), SUM(o/value), AVG(o/value) FROM EHR e CONTAINS OBSERVATION o`,
+			Select{
+				SelectExprs: func() []SelectExpr {
+					result := []SelectExpr{}
+					for _, name := range []AggregateFunctionName{MinAggregateFunction, MaxAggregateFunction, SumAggregateFunction, AvgAggregateFunction} {
+						result = append(result, SelectExpr{
+							Path: string(name) + "(o/value)",
+							Value: &AggregateFunctionCallSelectValue{
+								Name: name,
+								IdentifiedPath: &IdentifiedPath{
+									Identifier: "o",
+									ObjectPath: &ObjectPath{
+										Paths: []PartPath{{Identifier: "value"}},
+									},
+								},
+							},
+						})
+					}
+					return result
+				}(),
+			},
+			false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewAqlProcessor(tt.query).Process()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Process() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if diff := cmp.Diff(tt.want, got.Select); diff != "" {
+				t.Errorf("Process() mismatch {+want;-got}\n\t%s", diff)
+			}
+		})
+	}
+}
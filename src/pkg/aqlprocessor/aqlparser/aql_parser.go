@@ -114,7 +114,8 @@ func aqlparserParserInit() {
 		4, 6, 8, 10, 12, 14, 16, 18, 20, 22, 24, 26, 28, 30, 32, 34, 36, 38, 40,
 		42, 44, 46, 48, 50, 52, 54, 56, 58, 60, 62, 64, 66, 0, 8, 1, 0, 10, 13,
 		2, 0, 56, 56, 60, 60, 1, 0, 57, 58, 3, 0, 56, 58, 62, 62, 72, 72, 2, 0,
-		56, 56, 72, 72, 2, 0, 32, 34, 61, 61, 1, 0, 51, 54, 1, 0, 22, 23, 447,
+		56, 56, 72, 72, 3, 0, 24, 24, 32, 34, 61, 61, 1, 0, 51, 54, 1, 0, 22,
+		23, 447,
 		0, 68, 1, 0, 0, 0, 2, 84, 1, 0, 0, 0, 4, 99, 1, 0, 0, 0, 6, 102, 1, 0,
 		0, 0, 8, 105, 1, 0, 0, 0, 10, 115, 1, 0, 0, 0, 12, 121, 1, 0, 0, 0, 14,
 		126, 1, 0, 0, 0, 16, 136, 1, 0, 0, 0, 18, 149, 1, 0, 0, 0, 20, 157, 1,
@@ -5963,7 +5964,7 @@ func (p *AqlParser) FunctionCall() (localctx IFunctionCallContext) {
 			p.TerminologyFunction()
 		}
 
-	case AqlParserSTRING_FUNCTION_ID, AqlParserNUMERIC_FUNCTION_ID, AqlParserDATE_TIME_FUNCTION_ID, AqlParserIDENTIFIER:
+	case AqlParserCONTAINS, AqlParserSTRING_FUNCTION_ID, AqlParserNUMERIC_FUNCTION_ID, AqlParserDATE_TIME_FUNCTION_ID, AqlParserIDENTIFIER:
 		p.EnterOuterAlt(localctx, 2)
 		{
 			p.SetState(357)
@@ -5974,7 +5975,7 @@ func (p *AqlParser) FunctionCall() (localctx IFunctionCallContext) {
 
 			_la = p.GetTokenStream().LA(1)
 
-			if !((int64(_la) & ^0x3f) == 0 && ((int64(1)<<_la)&2305843039278465024) != 0) {
+			if !((int64(_la) & ^0x3f) == 0 && ((int64(1)<<_la)&2305843039295242240) != 0) {
 				var _ri = p.GetErrorHandler().RecoverInline(p)
 
 				localctx.(*FunctionCallContext).name = _ri
@@ -5991,7 +5992,7 @@ func (p *AqlParser) FunctionCall() (localctx IFunctionCallContext) {
 		p.GetErrorHandler().Sync(p)
 		_la = p.GetTokenStream().LA(1)
 
-		if (int64(_la) & ^0x3f) == 0 && ((int64(1)<<_la)&2413929430336405504) != 0 || (int64((_la-64)) & ^0x3f) == 0 && ((int64(1)<<(_la-64))&4194815) != 0 {
+		if (int64(_la) & ^0x3f) == 0 && ((int64(1)<<_la)&2413929430353182720) != 0 || (int64((_la-64)) & ^0x3f) == 0 && ((int64(1)<<(_la-64))&4194815) != 0 {
 			{
 				p.SetState(359)
 				p.Terminal()
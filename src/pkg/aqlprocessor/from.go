@@ -81,7 +81,10 @@ func getContainsExpr(ctx *aqlparser.ContainsExprContext) (*ContainsExpr, error)
 			{
 				vce := VersionClassExpr{}
 				vce.Version = ctx.VERSION().GetText()
-				vce.Variable = toRef(ctx.IDENTIFIER().GetText())
+				if ctx.IDENTIFIER() != nil {
+					vce.Variable = toRef(ctx.IDENTIFIER().GetText())
+				}
+
 				if ctx.VersionPredicate() != nil {
 					pp, err := getVersionPredicate(ctx.VersionPredicate().(*aqlparser.VersionPredicateContext))
 					if err != nil {
@@ -125,6 +128,15 @@ func getContainsExpr(ctx *aqlparser.ContainsExprContext) (*ContainsExpr, error)
 }
 
 func getVersionPredicate(ctx *aqlparser.VersionPredicateContext) (PathPredicate, error) {
+	switch {
+	case ctx.LATEST_VERSION() != nil:
+		return PathPredicate{Type: LatestVersionPredicate}, nil
+	case ctx.ALL_VERSIONS() != nil:
+		return PathPredicate{Type: AllVersionsPredicate}, nil
+	case ctx.StandardPredicate() == nil:
+		return PathPredicate{}, fmt.Errorf("unknown version predicate type: %s", ctx.GetText()) //nolint
+	}
+
 	sp, err := getStandartPredicate(ctx.StandardPredicate().(*aqlparser.StandardPredicateContext))
 	if err != nil {
 		return PathPredicate{}, errors.Wrap(err, "cannot get VersionPredicate.StandardPredicate")
@@ -242,6 +242,94 @@ func TestProcessor_From(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"9. FROM with VERSION and LATEST_VERSION predicate",
+			"SELECT val FROM EHR e CONTAINS VERSION v[LATEST_VERSION] CONTAINS COMPOSITION c",
+			From{
+				ContainsExpr: ContainsExpr{
+					Operand: ClassExpression{
+						Identifiers: []string{"EHR", "e"},
+					},
+					Contains: []*ContainsExpr{
+						{
+							Operand: VersionClassExpr{
+								Version:          "VERSION",
+								Variable:         toRef("v"),
+								VersionPredicate: &PathPredicate{Type: LatestVersionPredicate},
+							},
+							Contains: []*ContainsExpr{
+								{
+									Operand: ClassExpression{
+										Identifiers: []string{"COMPOSITION", "c"},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			false,
+		},
+		{
+			"10. FROM with VERSION and ALL_VERSIONS predicate",
+			"SELECT val FROM VERSION v[ALL_VERSIONS]",
+			From{
+				ContainsExpr: ContainsExpr{
+					Operand: VersionClassExpr{
+						Version:          "VERSION",
+						Variable:         toRef("v"),
+						VersionPredicate: &PathPredicate{Type: AllVersionsPredicate},
+					},
+				},
+			},
+			false,
+		},
+		{
+			"11. FROM with VERSION and standard predicate",
+			"SELECT val FROM VERSION v[commit_audit/change_type/value='creation']",
+			From{
+				ContainsExpr: ContainsExpr{
+					Operand: VersionClassExpr{
+						Version:  "VERSION",
+						Variable: toRef("v"),
+						VersionPredicate: &PathPredicate{
+							Type: StandartPathPredicate,
+							StandartPredicate: &StandartPredicate{
+								ObjectPath: &ObjectPath{
+									Paths: []PartPath{
+										{Identifier: "commit_audit"},
+										{Identifier: "change_type"},
+										{Identifier: "value"},
+									},
+								},
+								CMPOperator: SymEQ,
+								Operand: &PathPredicateOperand{
+									Primitive: &Primitive{Val: "creation"},
+								},
+							},
+						},
+					},
+				},
+			},
+			false,
+		},
+		{
+			"12. FROM with VERSION without variable",
+			"SELECT val FROM EHR e CONTAINS VERSION",
+			From{
+				ContainsExpr: ContainsExpr{
+					Operand: ClassExpression{
+						Identifiers: []string{"EHR", "e"},
+					},
+					Contains: []*ContainsExpr{
+						{
+							Operand: VersionClassExpr{Version: "VERSION"},
+						},
+					},
+				},
+			},
+			false,
+		},
 	}
 
 	for _, tt := range tests {
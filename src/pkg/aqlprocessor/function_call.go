@@ -0,0 +1,39 @@
+package aqlprocessor
+
+import (
+	"strings"
+
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/aqlprocessor/aqlparser"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/errors"
+)
+
+type FunctionCall struct {
+	Name string
+	Args []*Terminal
+}
+
+func getFunctionCall(ctx *aqlparser.FunctionCallContext) (*FunctionCall, error) {
+	if ctx.TerminologyFunction() != nil {
+		return nil, errors.New("TERMINOLOGY function not implemented")
+	}
+
+	if ctx.GetName() == nil {
+		return nil, errors.New("function name is empty")
+	}
+
+	result := FunctionCall{
+		Name: strings.ToUpper(ctx.GetName().GetText()),
+		Args: make([]*Terminal, 0, len(ctx.AllTerminal())),
+	}
+
+	for _, t := range ctx.AllTerminal() {
+		arg, err := getTerminal(t.(*aqlparser.TerminalContext))
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot get FunctionCall.Terminal")
+		}
+
+		result.Args = append(result.Args, arg)
+	}
+
+	return &result, nil
+}
@@ -0,0 +1,142 @@
+package aqlprocessor
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestProcessor_FunctionCall(t *testing.T) {
+	ehrIDPath := &IdentifiedPath{
+		Identifier: "e",
+		ObjectPath: &ObjectPath{
+			Paths: []PartPath{{Identifier: "ehr_id"}, {Identifier: "value"}},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		want    *Query
+		wantErr bool
+	}{
+		{
+			"1. function calls in SELECT",
+			`SELECT LENGTH(e/ehr_id/value), round(1.25, 1), NOW() FROM EHR e`,
+			&Query{
+				Select: Select{
+					SelectExprs: []SelectExpr{
+						{
+							Path: "LENGTH(e/ehr_id/value)",
+							Value: &FunctionCallSelectValue{
+								Val: FunctionCall{
+									Name: "LENGTH",
+									Args: []*Terminal{{IdentifiedPath: ehrIDPath}},
+								},
+							},
+						},
+						{
+							Path: "round(1.25,1)",
+							Value: &FunctionCallSelectValue{
+								Val: FunctionCall{
+									Name: "ROUND",
+									Args: []*Terminal{
+										{Primitive: &Primitive{Val: 1.25}},
+										{Primitive: &Primitive{Val: 1}},
+									},
+								},
+							},
+						},
+						{
+							Path: "NOW()",
+							Value: &FunctionCallSelectValue{
+								Val: FunctionCall{
+									Name: "NOW",
+									Args: []*Terminal{},
+								},
+							},
+						},
+					},
+				},
+			},
+			false,
+		},
+		{
+			"2. function calls in WHERE",
+			`SELECT e/ehr_id/value FROM EHR e WHERE POSITION('-', e/ehr_id/value) = ABS($pos)`,
+			&Query{
+				Where: &Where{
+					IdentifiedExpr: &IdentifiedExpr{
+						FunctionCall: &FunctionCall{
+							Name: "POSITION",
+							Args: []*Terminal{
+								{Primitive: &Primitive{Val: "-"}},
+								{IdentifiedPath: ehrIDPath},
+							},
+						},
+						ComparisonOperator: toRef(SymEQ),
+						Terminal: &Terminal{
+							FunctionCall: &FunctionCall{
+								Name: "ABS",
+								Args: []*Terminal{{Parameter: toRef(Parameter("pos"))}},
+							},
+						},
+					},
+				},
+			},
+			false,
+		},
+		{
+			"3. CONTAINS function call",
+			`SELECT e/ehr_id/value FROM EHR e CONTAINS COMPOSITION c WHERE contains(e/ehr_id/value, '-') = $found`,
+			&Query{
+				Where: &Where{
+					IdentifiedExpr: &IdentifiedExpr{
+						FunctionCall: &FunctionCall{
+							Name: "CONTAINS",
+							Args: []*Terminal{
+								{IdentifiedPath: ehrIDPath},
+								{Primitive: &Primitive{Val: "-"}},
+							},
+						},
+						ComparisonOperator: toRef(SymEQ),
+						Terminal:           &Terminal{Parameter: toRef(Parameter("found"))},
+					},
+				},
+			},
+			false,
+		},
+		{
+			"4. TERMINOLOGY function is not supported",
+			`SELECT e/ehr_id/value FROM EHR e WHERE e/ehr_id/value = TERMINOLOGY('expand', 'hl7.org/fhir/4.0', 'url=http://snomed.info/sct')`,
+			nil,
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewAqlProcessor(tt.query).Process()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Process() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if tt.want.Where == nil {
+				if diff := cmp.Diff(tt.want.Select, got.Select); diff != "" {
+					t.Errorf("Process() mismatch {+want;-got}\n\t%s", diff)
+				}
+
+				return
+			}
+
+			if diff := cmp.Diff(tt.want.Where, got.Where); diff != "" {
+				t.Errorf("Process() mismatch {+want;-got}\n\t%s", diff)
+			}
+		})
+	}
+}
@@ -47,6 +47,10 @@ func getAtCode(tn antlr.TerminalNode) (AtCode, error) {
 
 type IDCode string
 
+func (code IDCode) ToString() string {
+	return fmt.Sprintf("id%v", code)
+}
+
 func getIDCode(tn antlr.TerminalNode) (IDCode, error) {
 	return getCode[IDCode](tn, "id")
 }
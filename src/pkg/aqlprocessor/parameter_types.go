@@ -0,0 +1,236 @@
+package aqlprocessor
+
+// ParameterType is the type of the query parameter inferred from its usage in the query.
+type ParameterType string
+
+const (
+	// ParameterTypeAny is the parameter compared with the value of unknown type, e.g. e/ehr_id/value = $ehrID
+	ParameterTypeAny    ParameterType = "any"
+	ParameterTypeString ParameterType = "string"
+	ParameterTypeNumber ParameterType = "number"
+)
+
+// numberAttributes are the RM attributes of the numeric data values.
+var numberAttributes = map[string]bool{
+	"magnitude":   true,
+	"precision":   true,
+	"accuracy":    true,
+	"numerator":   true,
+	"denominator": true,
+}
+
+// ParameterTypes returns the types of the parameters of the query.
+// The parameters of the archetype and node predicates and of LIKE are strings, the parameters compared with the numeric
+// attributes, e.g. o/data[at0001]/.../value/magnitude > $systolic, are numbers and the rest are of any primitive type.
+// The parameter used as the values of different types is of any type as well.
+func (q *Query) ParameterTypes() map[string]ParameterType {
+	pt := parameterTypes{
+		types: make(map[string]ParameterType, len(q.Parameters)),
+		mixed: map[string]bool{},
+	}
+
+	for name := range q.Parameters {
+		pt.types[name] = ParameterTypeAny
+	}
+
+	for _, se := range q.Select.SelectExprs {
+		switch v := se.Value.(type) {
+		case *IdentifiedPathSelectValue:
+			pt.identifiedPath(&v.Val)
+		case *AggregateFunctionCallSelectValue:
+			pt.identifiedPath(v.IdentifiedPath)
+		case *FunctionCallSelectValue:
+			pt.functionCall(&v.Val)
+		}
+	}
+
+	pt.containsExpr(&q.From.ContainsExpr)
+	pt.where(q.Where)
+
+	if q.Order != nil {
+		for i := range q.Order.Orders {
+			pt.identifiedPath(&q.Order.Orders[i].IdentifierPath)
+		}
+	}
+
+	return pt.types
+}
+
+type parameterTypes struct {
+	types map[string]ParameterType
+	mixed map[string]bool
+}
+
+func (pt parameterTypes) set(p *Parameter, typ ParameterType) {
+	if p == nil || typ == ParameterTypeAny {
+		return
+	}
+
+	name := string(*p)
+
+	switch cur := pt.types[name]; {
+	case pt.mixed[name] || cur == typ:
+	case cur == "" || cur == ParameterTypeAny:
+		pt.types[name] = typ
+	default:
+		pt.types[name] = ParameterTypeAny
+		pt.mixed[name] = true
+	}
+}
+
+func (pt parameterTypes) containsExpr(ce *ContainsExpr) {
+	if ce == nil {
+		return
+	}
+
+	switch operand := ce.Operand.(type) {
+	case ClassExpression:
+		pt.pathPredicate(operand.PathPredicate)
+	case VersionClassExpr:
+		pt.pathPredicate(operand.VersionPredicate)
+	}
+
+	for _, next := range ce.Contains {
+		pt.containsExpr(next)
+	}
+}
+
+func (pt parameterTypes) where(w *Where) {
+	if w == nil {
+		return
+	}
+
+	pt.identifiedExpr(w.IdentifiedExpr)
+
+	for _, next := range w.Next {
+		pt.where(next)
+	}
+}
+
+func (pt parameterTypes) identifiedExpr(ie *IdentifiedExpr) {
+	if ie == nil {
+		return
+	}
+
+	pt.identifiedExpr(ie.Next)
+	pt.identifiedPath(ie.IdentifiedPath)
+	pt.functionCall(ie.FunctionCall)
+
+	if ie.IdentifiedPath != nil {
+		pt.terminal(ie.Terminal, pathParameterType(ie.IdentifiedPath.ObjectPath))
+	} else {
+		pt.terminal(ie.Terminal, ParameterTypeAny)
+	}
+
+	pt.terminal(ie.Like, ParameterTypeString)
+
+	for _, t := range ie.Matches {
+		pt.terminal(t, ParameterTypeAny)
+	}
+}
+
+func (pt parameterTypes) terminal(t *Terminal, typ ParameterType) {
+	if t == nil {
+		return
+	}
+
+	pt.set(t.Parameter, typ)
+	pt.identifiedPath(t.IdentifiedPath)
+	pt.functionCall(t.FunctionCall)
+}
+
+func (pt parameterTypes) functionCall(fc *FunctionCall) {
+	if fc == nil {
+		return
+	}
+
+	for _, arg := range fc.Args {
+		pt.terminal(arg, ParameterTypeAny)
+	}
+}
+
+func (pt parameterTypes) identifiedPath(ip *IdentifiedPath) {
+	if ip == nil {
+		return
+	}
+
+	pt.pathPredicate(ip.PathPredicate)
+	pt.objectPath(ip.ObjectPath)
+}
+
+func (pt parameterTypes) objectPath(op *ObjectPath) {
+	if op == nil {
+		return
+	}
+
+	for i := range op.Paths {
+		pt.pathPredicate(op.Paths[i].PathPredicate)
+	}
+}
+
+func (pt parameterTypes) pathPredicate(pp *PathPredicate) {
+	if pp == nil {
+		return
+	}
+
+	if sp := pp.StandartPredicate; sp != nil {
+		pt.objectPath(sp.ObjectPath)
+		pt.predicateOperand(sp.Operand, pathParameterType(sp.ObjectPath))
+	}
+
+	pt.nodePredicate(pp.NodePredicate)
+
+	if pp.Archetype != nil {
+		pt.set(pp.Archetype.Parameter, ParameterTypeString)
+	}
+}
+
+func (pt parameterTypes) nodePredicate(np *NodePredicate) {
+	if np == nil {
+		return
+	}
+
+	// the archetype id, the at-code or the name of the node
+	pt.set(np.Parameter, ParameterTypeString)
+
+	if np.AdditionalData != nil {
+		pt.set(np.AdditionalData.Parameter, ParameterTypeString)
+	}
+
+	pt.objectPath(np.ObjectPath)
+	pt.predicateOperand(np.PathPredicateOperand, pathParameterType(np.ObjectPath))
+
+	for _, next := range np.Next {
+		pt.nodePredicate(next)
+	}
+}
+
+func (pt parameterTypes) predicateOperand(operand *PathPredicateOperand, typ ParameterType) {
+	if operand == nil {
+		return
+	}
+
+	pt.set(operand.Parameter, typ)
+	pt.objectPath(operand.ObjectPath)
+}
+
+// pathParameterType returns the type of the values of the path known by its last attributes.
+func pathParameterType(op *ObjectPath) ParameterType {
+	if op == nil || len(op.Paths) == 0 {
+		return ParameterTypeAny
+	}
+
+	parts := op.Paths
+	last := parts[len(parts)-1].Identifier
+
+	switch {
+	case numberAttributes[last]:
+		return ParameterTypeNumber
+	case last == "archetype_node_id",
+		last == "code_string",
+		last == "value" && len(parts) > 1 && parts[len(parts)-2].Identifier == "name":
+		return ParameterTypeString
+	default:
+		return ParameterTypeAny
+	}
+}
@@ -0,0 +1,75 @@
+package aqlprocessor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuery_ParameterTypes(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  map[string]ParameterType
+	}{
+		{
+			"1. no parameters",
+			`SELECT e/ehr_id/value FROM EHR e`,
+			map[string]ParameterType{},
+		},
+		{
+			"2. compared with the value of unknown type",
+			`SELECT c/uid/value FROM EHR e CONTAINS COMPOSITION c WHERE e/ehr_id/value = $ehrID`,
+			map[string]ParameterType{"ehrID": ParameterTypeAny},
+		},
+		{
+			"3. archetype and node predicates",
+			`SELECT o/data[$node]/events[at0006, $eventName]/time/value
+			FROM EHR e CONTAINS OBSERVATION o[$archetype]`,
+			map[string]ParameterType{
+				"node":      ParameterTypeString,
+				"eventName": ParameterTypeString,
+				"archetype": ParameterTypeString,
+			},
+		},
+		{
+			"4. numeric attributes and LIKE",
+			`SELECT o/data[at0001]/events[at0006]/data[at0003]/items[at0004]/value/magnitude
+			FROM EHR e CONTAINS COMPOSITION c[name/value = $cmpName] CONTAINS OBSERVATION o
+			WHERE o/data[at0001]/events[at0006]/data[at0003]/items[at0004]/value/magnitude >= $systolic
+				AND c/name/value LIKE $pattern`,
+			map[string]ParameterType{
+				"cmpName":  ParameterTypeString,
+				"systolic": ParameterTypeNumber,
+				"pattern":  ParameterTypeString,
+			},
+		},
+		{
+			"5. version predicate and function arguments",
+			`SELECT v/uid/value FROM EHR e CONTAINS VERSION v[commit_audit/change_type/value = $changeType]
+			WHERE LENGTH(v/uid/value) > $length`,
+			map[string]ParameterType{
+				"changeType": ParameterTypeAny,
+				"length":     ParameterTypeAny,
+			},
+		},
+		{
+			"6. parameter of different types",
+			`SELECT o/data[at0001]/events[at0006]/data[at0003]/items[at0004]/value/magnitude
+			FROM EHR e CONTAINS OBSERVATION o
+			WHERE o/data[at0001]/events[at0006]/data[at0003]/items[at0004]/value/magnitude = $x
+				AND o/name/value = $x`,
+			map[string]ParameterType{"x": ParameterTypeAny},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := NewAqlProcessor(tt.query).Process()
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.want, q.ParameterTypes())
+		})
+	}
+}
@@ -15,6 +15,8 @@ const (
 	StandartPathPredicate   PredicateType = "STANDARD_PREDICATE"
 	ArchetypedPathPredicate PredicateType = "ARCHETYPED_PREDICATE"
 	NodePathPredicate       PredicateType = "NODE_PREDICATE"
+	LatestVersionPredicate  PredicateType = "LATEST_VERSION"
+	AllVersionsPredicate    PredicateType = "ALL_VERSIONS"
 )
 
 type PathPredicate struct {
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/aqlprocessor/aqlparser"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/common/iso8601"
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/errors"
 
 	"golang.org/x/exp/constraints"
@@ -19,7 +20,26 @@ type Primitive struct {
 	Val any
 }
 
+// Compare checks the comparison of the value with the primitive, e.g. val > p.Val.
+// The date/times, the times and the ISO 8601 durations are compared by the moments and the lengths they denote,
+// both as the parsed literals and as the strings of DV_DATE_TIME, DV_TIME, DV_DURATION and other values.
 func (p Primitive) Compare(val any, cmpSymbl ComparisionSymbol) bool {
+	switch pv := p.Val.(type) {
+	case time.Time:
+		t, ok := toTime(val)
+		if !ok {
+			return false
+		}
+
+		return compare(compareTimes(t, pv), 0, cmpSymbl)
+	case string:
+		if s, ok := val.(string); ok {
+			if c, ok := compareTemporalStrings(s, pv); ok {
+				return compare(c, 0, cmpSymbl)
+			}
+		}
+	}
+
 	x := reflect.ValueOf(p.Val)
 	y := reflect.ValueOf(val)
 
@@ -41,6 +61,62 @@ func (p Primitive) Compare(val any, cmpSymbl ComparisionSymbol) bool {
 	return false
 }
 
+func toTime(val any) (time.Time, bool) {
+	switch v := val.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		if t, ok := iso8601.ParseDateTime(v); ok {
+			return t, true
+		}
+
+		return iso8601.ParseTime(v)
+	default:
+		return time.Time{}, false
+	}
+}
+
+// compareTemporalStrings compares the strings of the same temporal kind: date/times, times or durations.
+func compareTemporalStrings(x, y string) (int, bool) {
+	if tx, ok := iso8601.ParseDateTime(x); ok {
+		if ty, ok := iso8601.ParseDateTime(y); ok {
+			return compareTimes(tx, ty), true
+		}
+	}
+
+	if tx, ok := iso8601.ParseTime(x); ok {
+		if ty, ok := iso8601.ParseTime(y); ok {
+			return compareTimes(tx, ty), true
+		}
+	}
+
+	if dx, ok := iso8601.ParseDuration(x); ok {
+		if dy, ok := iso8601.ParseDuration(y); ok {
+			switch {
+			case dx < dy:
+				return -1, true
+			case dx > dy:
+				return 1, true
+			default:
+				return 0, true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+func compareTimes(x, y time.Time) int {
+	switch {
+	case x.Before(y):
+		return -1
+	case x.After(y):
+		return 1
+	default:
+		return 0
+	}
+}
+
 func compare[T constraints.Ordered](x, y T, cmpSymbl ComparisionSymbol) bool {
 	switch cmpSymbl {
 	case SymLT:
@@ -84,36 +160,20 @@ func (p *Primitive) processTerminalNode(terminal *antlr.TerminalNodeImpl) error
 	switch tokenType {
 	case aqlparser.AqlLexerSTRING:
 		p.Val = trimString(terminal.String())
-	case aqlparser.AqlLexerDATE:
-		{
-			const layout = "2006-01-02"
-			t, err := parseDateByLayout(layout, terminal.String())
-			if err != nil {
-				return err
-			}
-
-			p.Val = t
+	case aqlparser.AqlLexerDATE, aqlparser.AqlLexerDATETIME:
+		t, ok := iso8601.ParseDateTime(trimString(terminal.String()))
+		if !ok {
+			return fmt.Errorf("%w: cannot parse date/time %s", errors.ErrIncorrectRequest, terminal.String())
 		}
-	case aqlparser.AqlLexerTIME:
-		{
-			const layout = "15:04:05.999"
-			t, err := parseDateByLayout(layout, terminal.String())
-			if err != nil {
-				return err
-			}
 
-			p.Val = t
+		p.Val = t
+	case aqlparser.AqlLexerTIME:
+		t, ok := iso8601.ParseTime(trimString(terminal.String()))
+		if !ok {
+			return fmt.Errorf("%w: cannot parse time %s", errors.ErrIncorrectRequest, terminal.String())
 		}
-	case aqlparser.AqlLexerDATETIME:
-		{
-			const layout = "2006-01-02T15:04:05.999"
-			t, err := parseDateByLayout(layout, terminal.String())
-			if err != nil {
-				return err
-			}
 
-			p.Val = t
-		}
+		p.Val = t
 	case aqlparser.AqlLexerBOOLEAN:
 		p.Val = strings.ToLower(terminal.String()) == "true"
 	case aqlparser.AqlLexerNULL:
@@ -159,17 +219,6 @@ func (p *Primitive) processNumericPrimitive(numeric *aqlparser.NumericPrimitiveC
 	return nil
 }
 
-func parseDateByLayout(layout, str string) (time.Time, error) {
-	strDate := trimString(str)
-
-	date, err := time.Parse(layout, strDate)
-	if err != nil {
-		return time.Time{}, errors.Wrap(err, "cannot parse date by layout")
-	}
-
-	return date, nil
-}
-
 func trimString(str string) string {
 	if str[0] == '\'' {
 		str = strings.Trim(str, "'")
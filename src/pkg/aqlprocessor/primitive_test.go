@@ -273,6 +273,32 @@ func TestProcessor_SelectDates(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"4. date_time with time zone",
+			`SELECT '2020-10-11T23:58:58+02:00' FROM EHR`,
+			Select{
+				SelectExprs: []SelectExpr{
+					{
+						Path:  "'2020-10-11T23:58:58+02:00'",
+						Value: &PrimitiveSelectValue{Val: Primitive{time.Date(2020, 10, 11, 21, 58, 58, 0, time.UTC)}},
+					},
+				},
+			},
+			false,
+		},
+		{
+			"5. compact date",
+			`SELECT '20201011' FROM EHR`,
+			Select{
+				SelectExprs: []SelectExpr{
+					{
+						Path:  "'20201011'",
+						Value: &PrimitiveSelectValue{Val: Primitive{date}},
+					},
+				},
+			},
+			false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -321,6 +347,14 @@ func TestPrimitive_Compare(t *testing.T) {
 		{"16. 123.1 <= 100.1", Primitive{Val: 123.1}, 100.1, SymLE, true},
 
 		{`17. "aaa" != "bbb"`, Primitive{Val: "aaa"}, "bbb", SymNe, true},
+
+		{"18. date/time string > date", Primitive{Val: date(2025, 1, 1)}, "2025-03-01T10:00:00+01:00", SymGT, true},
+		{"19. date/time string in other zone", Primitive{Val: date(2025, 1, 1)}, "2025-01-01T01:00:00+02:00", SymLT, true},
+		{"20. date/time strings", Primitive{Val: "2025-01-01"}, "20241231T230000-0200", SymGT, true},
+		{"21. durations", Primitive{Val: "P1D"}, "PT36H", SymGT, true},
+		{"22. durations are not strings", Primitive{Val: "P1W"}, "P2D", SymLT, true},
+		{"23. time string", Primitive{Val: time.Date(0, 1, 1, 10, 0, 0, 0, time.UTC)}, "09:59:59", SymLT, true},
+		{"24. not a date/time", Primitive{Val: date(2025, 1, 1)}, "tomorrow", SymNe, false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -330,3 +364,7 @@ func TestPrimitive_Compare(t *testing.T) {
 		})
 	}
 }
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
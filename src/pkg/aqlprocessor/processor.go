@@ -1,6 +1,9 @@
 package aqlprocessor
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/aqlprocessor/aqlparser"
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/errors"
 
@@ -33,54 +36,94 @@ func (p *AqlProcessor) Process() (*Query, error) {
 	p.lexer.RemoveErrorListeners()
 	p.parser.RemoveErrorListeners()
 
-	lexerErrors := &CustomErrorListener{}
-	p.lexer.AddErrorListener(lexerErrors)
-
-	parserErrors := &CustomErrorListener{}
-	p.parser.AddErrorListener(parserErrors)
+	// the lexer and the parser share the listener, so the errors are kept in the order of their positions in the query
+	errorListener := &CustomErrorListener{}
+	p.lexer.AddErrorListener(errorListener)
+	p.parser.AddErrorListener(errorListener)
 
 	antlr.ParseTreeWalkerDefault.Walk(p.listener, p.parser.SelectQuery())
 
-	var err error
-
-	if len(lexerErrors.Errors) > 0 {
-		for _, e := range lexerErrors.Errors {
-			err = e
-		}
-	}
-
-	if len(parserErrors.Errors) > 0 {
-		for _, e := range parserErrors.Errors {
-			err = e
-		}
+	if len(errorListener.Errors) > 0 {
+		return nil, errors.Wrap(errorListener.Errors, "cannot get query")
 	}
 
-	if err != nil {
-		return nil, errors.Wrap(err, "cannot get query")
-	}
 	return &p.listener.query, nil
 }
 
-type CustomSyntaxError struct {
-	line, column int
-	msg          string
+// SyntaxError is the error of the query at the given position.
+// OffendingToken and Expected are set for the parser errors, Expected lists the tokens allowed at the position.
+type SyntaxError struct {
+	Line           int      `json:"line"`
+	Column         int      `json:"column"`
+	OffendingToken string   `json:"offending_token,omitempty"`
+	Expected       []string `json:"expected,omitempty"`
+	Message        string   `json:"message"`
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("line %d:%d %s", e.Line, e.Column, e.Message)
 }
 
-func (e *CustomSyntaxError) Error() string {
-	return e.msg
+// SyntaxErrors are all errors found in the query.
+type SyntaxErrors []*SyntaxError
+
+func (e SyntaxErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+
+	return strings.Join(messages, "; ")
 }
 
 type CustomErrorListener struct {
 	*antlr.DefaultErrorListener // Embed default which ensures we fit the interface
-	Errors                      []error
+	Errors                      SyntaxErrors
 }
 
 func (c *CustomErrorListener) SyntaxError(recognizer antlr.Recognizer, offendingSymbol interface{}, line, column int, msg string, e antlr.RecognitionException) {
-	c.Errors = append(c.Errors, &CustomSyntaxError{
-		line:   line,
-		column: column,
-		msg:    msg,
-	})
+	syntaxErr := &SyntaxError{
+		Line:    line,
+		Column:  column,
+		Message: msg,
+	}
+
+	if token, ok := offendingSymbol.(antlr.Token); ok && token != nil {
+		syntaxErr.OffendingToken = token.GetText()
+	}
+
+	switch r := recognizer.(type) {
+	case antlr.Parser:
+		syntaxErr.Expected = expectedTokenNames(r)
+	case *antlr.BaseLexer:
+		// the lexer does not pass the offending symbol, it is the text of the unrecognized token
+		input := r.GetInputStream()
+		syntaxErr.OffendingToken = input.GetTextFromInterval(antlr.NewInterval(r.TokenStartCharIndex, input.Index()))
+	}
+
+	c.Errors = append(c.Errors, syntaxErr)
+}
+
+func expectedTokenNames(parser antlr.Parser) []string {
+	literalNames := parser.GetLiteralNames()
+	symbolicNames := parser.GetSymbolicNames()
+
+	names := []string{}
+
+	for _, interval := range parser.GetExpectedTokens().GetIntervals() {
+		for t := interval.Start; t < interval.Stop; t++ {
+			switch {
+			case t == antlr.TokenEOF:
+				names = append(names, "<EOF>")
+			case t < len(literalNames) && literalNames[t] != "":
+				names = append(names, literalNames[t])
+			case t < len(symbolicNames) && symbolicNames[t] != "":
+				names = append(names, symbolicNames[t])
+			}
+		}
+	}
+
+	return names
 }
 
 func handleError(aParser antlr.Parser, token antlr.Token, err error) {
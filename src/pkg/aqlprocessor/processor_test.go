@@ -1,6 +1,7 @@
 package aqlprocessor
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -329,6 +330,52 @@ LIMIT 3`,
 	}
 }
 
+func TestProcessor_SyntaxErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  SyntaxErrors
+	}{
+		{
+			"1. parser error with expected tokens",
+			"SELECT e/ehr_id FROM EHR e LIMIT abc",
+			SyntaxErrors{
+				{Line: 1, Column: 33, OffendingToken: "abc", Expected: []string{"INTEGER"}, Message: "mismatched input 'abc' expecting INTEGER"},
+			},
+		},
+		{
+			"2. lexer error",
+			"SELECT e/ehr_id\nFROM EHR e ~",
+			SyntaxErrors{
+				{Line: 2, Column: 11, OffendingToken: "~", Message: "token recognition error at: '~'"},
+			},
+		},
+		{
+			"3. all errors are collected",
+			"SELECT e/ehr_id FROM EHR e ~ LIMIT abc",
+			SyntaxErrors{
+				{Line: 1, Column: 27, OffendingToken: "~", Message: "token recognition error at: '~'"},
+				{Line: 1, Column: 35, OffendingToken: "abc", Expected: []string{"INTEGER"}, Message: "mismatched input 'abc' expecting INTEGER"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewAqlProcessor(tt.query).Process()
+
+			var got SyntaxErrors
+			if !errors.As(err, &got) {
+				t.Fatalf("Process Query err: '%v', want SyntaxErrors", err)
+			}
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Mismatch {+want;-got}:\n\t%s", diff)
+			}
+		})
+	}
+}
+
 type Attribute = uint8
 
 const (
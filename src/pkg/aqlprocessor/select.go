@@ -29,9 +29,14 @@ type PrimitiveSelectValue struct {
 }
 
 type AggregateFunctionCallSelectValue struct {
+	Name           AggregateFunctionName
+	Distinct       bool
+	Asterisk       bool
+	IdentifiedPath *IdentifiedPath
 }
 
 type FunctionCallSelectValue struct {
+	Val FunctionCall
 }
 
 func getSelect(ctx *aqlparser.SelectClauseContext) (*Select, error) {
@@ -104,14 +109,24 @@ func getColumnExpr(ctx *aqlparser.ColumnExprContext) (SelectValuer, error) {
 		}
 
 		return psv, nil
-	case *aqlparser.AggregateFunctionCallContext: // nolint
-		// selectValue = &AggregateFunctionCallSelectValue{}
+	case *aqlparser.AggregateFunctionCallContext:
+		afc, err := getAggregateFunctionCall(val)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot get ColumnExpr.AggregateFunctionCall")
+		}
+
+		return afc, nil
+	case *aqlparser.FunctionCallContext:
+		fc, err := getFunctionCall(val)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot get ColumnExpr.FunctionCall")
+		}
 
-		return nil, errors.New("column expr Aggregate Func Call Not implemented")
-	case *aqlparser.FunctionCallContext: // nolint
-		// selectValue = &FunctionCallSelectValue{}
+		fcsv := &FunctionCallSelectValue{
+			Val: *fc,
+		}
 
-		return nil, errors.New("column expr Func Call Not implemented")
+		return fcsv, nil
 	default:
 		return nil, fmt.Errorf("unexpected column expresion type: %T", val) // nolint
 	}
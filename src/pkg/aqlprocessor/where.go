@@ -15,8 +15,11 @@ type IdentifiedExpr struct {
 	Next               *IdentifiedExpr
 	IsExists           *bool
 	IdentifiedPath     *IdentifiedPath
+	FunctionCall       *FunctionCall
 	Terminal           *Terminal
 	ComparisonOperator *ComparisionSymbol
+	Like               *Terminal
+	Matches            []*Terminal
 }
 
 func getWhere(ctx *aqlparser.WhereExprContext) (*Where, error) {
@@ -101,14 +104,121 @@ func getIdentifiedExpr(ctx *aqlparser.IdentifiedExprContext) (*IdentifiedExpr, e
 		result.Terminal = terminal
 	}
 
+	if ctx.IdentifiedPath() != nil && ctx.LIKE() != nil {
+		ip, err := getIdentifiedPath(ctx.IdentifiedPath().(*aqlparser.IdentifiedPathContext))
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot get IdentifierExpr.IdentifierPath")
+		}
+
+		result.IdentifiedPath = &ip
+
+		like, err := getLikeOperand(ctx.LikeOperand().(*aqlparser.LikeOperandContext))
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot get IdentifiedExpr.LikeOperand")
+		}
+
+		result.Like = like
+	}
+
+	if ctx.IdentifiedPath() != nil && ctx.MATCHES() != nil {
+		ip, err := getIdentifiedPath(ctx.IdentifiedPath().(*aqlparser.IdentifiedPathContext))
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot get IdentifierExpr.IdentifierPath")
+		}
+
+		result.IdentifiedPath = &ip
+
+		matches, err := getMatchesOperand(ctx.MatchesOperand().(*aqlparser.MatchesOperandContext))
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot get IdentifiedExpr.MatchesOperand")
+		}
+
+		result.Matches = matches
+	}
+
+	if ctx.FunctionCall() != nil && ctx.COMPARISON_OPERATOR() != nil {
+		fc, err := getFunctionCall(ctx.FunctionCall().(*aqlparser.FunctionCallContext))
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot get IdentifierExpr.FunctionCall")
+		}
+
+		result.FunctionCall = fc
+
+		co, err := getComparisionSimbol(ctx.COMPARISON_OPERATOR())
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot get IdentifiedExpr.ComparisonOperator")
+		}
+
+		result.ComparisonOperator = &co
+
+		terminal, err := getTerminal(ctx.Terminal().(*aqlparser.TerminalContext))
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot get IdentifiedExpr.Terminal value")
+		}
+
+		result.Terminal = terminal
+	}
+
 	return &result, nil
 }
 
+func getLikeOperand(ctx *aqlparser.LikeOperandContext) (*Terminal, error) {
+	if ctx.PARAMETER() != nil {
+		p, err := getParameter(ctx.PARAMETER())
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot get LikeOperand.PARAMETER")
+		}
+
+		return &Terminal{Parameter: p}, nil
+	}
+
+	return &Terminal{
+		Primitive: &Primitive{Val: trimString(ctx.STRING().GetText())},
+	}, nil
+}
+
+func getMatchesOperand(ctx *aqlparser.MatchesOperandContext) ([]*Terminal, error) {
+	if ctx.TerminologyFunction() != nil {
+		return nil, errors.New("MATCHES TERMINOLOGY function not implemented")
+	}
+
+	if ctx.URI() != nil {
+		return nil, errors.New("MATCHES URI not implemented")
+	}
+
+	result := make([]*Terminal, 0, len(ctx.AllValueListItem()))
+
+	for _, item := range ctx.AllValueListItem() {
+		item := item.(*aqlparser.ValueListItemContext)
+
+		switch {
+		case item.Primitive() != nil:
+			p, err := getPrimitive(item.Primitive().(*aqlparser.PrimitiveContext))
+			if err != nil {
+				return nil, errors.Wrap(err, "cannot get ValueListItem.Primitive")
+			}
+
+			result = append(result, &Terminal{Primitive: &p})
+		case item.PARAMETER() != nil:
+			p, err := getParameter(item.PARAMETER())
+			if err != nil {
+				return nil, errors.Wrap(err, "cannot get ValueListItem.PARAMETER")
+			}
+
+			result = append(result, &Terminal{Parameter: p})
+		default:
+			return nil, errors.New("ValueListItem TERMINOLOGY function not implemented")
+		}
+	}
+
+	return result, nil
+}
+
 type Terminal struct {
 	Primitive      *Primitive
 	Parameter      *Parameter
 	IdentifiedPath *IdentifiedPath
-	// FunctionCall *FunctionCall
+	FunctionCall   *FunctionCall
 }
 
 func getTerminal(ctx *aqlparser.TerminalContext) (*Terminal, error) { //nolint
@@ -142,8 +252,12 @@ func getTerminal(ctx *aqlparser.TerminalContext) (*Terminal, error) { //nolint
 	}
 
 	if ctx.FunctionCall() != nil {
-		//TODO: implement
-		return nil, errors.New("Terminal.FunctionCall not implemented")
+		fc, err := getFunctionCall(ctx.FunctionCall().(*aqlparser.FunctionCallContext))
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot get Terminal.FunctionCall")
+		}
+
+		t.FunctionCall = fc
 	}
 
 	return t, nil
@@ -219,6 +219,75 @@ func TestProcessor_Where(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"5. Where with EXISTS",
+			`SELECT val FROM EHR e WHERE EXISTS e/ehr_status`,
+			&Where{
+				IdentifiedExpr: &IdentifiedExpr{
+					IsExists: toRef(true),
+					IdentifiedPath: &IdentifiedPath{
+						Identifier: "e",
+						ObjectPath: &ObjectPath{
+							Paths: []PartPath{{Identifier: "ehr_status"}},
+						},
+					},
+				},
+			},
+			false,
+		},
+		{
+			"6. Where with LIKE",
+			`SELECT val FROM EHR e WHERE e/name/value LIKE 'Blood*' OR e/name/value LIKE $name`,
+			&Where{
+				OperatorType: OROperator,
+				Next: []*Where{
+					{
+						IdentifiedExpr: &IdentifiedExpr{
+							IdentifiedPath: &IdentifiedPath{
+								Identifier: "e",
+								ObjectPath: &ObjectPath{
+									Paths: []PartPath{{Identifier: "name"}, {Identifier: "value"}},
+								},
+							},
+							Like: &Terminal{Primitive: &Primitive{Val: "Blood*"}},
+						},
+					},
+					{
+						IdentifiedExpr: &IdentifiedExpr{
+							IdentifiedPath: &IdentifiedPath{
+								Identifier: "e",
+								ObjectPath: &ObjectPath{
+									Paths: []PartPath{{Identifier: "name"}, {Identifier: "value"}},
+								},
+							},
+							Like: &Terminal{Parameter: toRef(Parameter("name"))},
+						},
+					},
+				},
+			},
+			false,
+		},
+		{
+			"7. Where with MATCHES",
+			`SELECT val FROM EHR e WHERE e/value/magnitude MATCHES {1, 2.5, 'str', $param}`,
+			&Where{
+				IdentifiedExpr: &IdentifiedExpr{
+					IdentifiedPath: &IdentifiedPath{
+						Identifier: "e",
+						ObjectPath: &ObjectPath{
+							Paths: []PartPath{{Identifier: "value"}, {Identifier: "magnitude"}},
+						},
+					},
+					Matches: []*Terminal{
+						{Primitive: &Primitive{Val: 1}},
+						{Primitive: &Primitive{Val: 2.5}},
+						{Primitive: &Primitive{Val: "str"}},
+						{Parameter: toRef(Parameter("param"))},
+					},
+				},
+			},
+			false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
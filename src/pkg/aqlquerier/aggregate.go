@@ -0,0 +1,254 @@
+package aqlquerier
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/aqlprocessor"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/storage/treeindex"
+)
+
+// countAll is the argument value of COUNT(*), it is counted for every row
+type countAll struct{}
+
+func (exec *executer) hasAggregates() bool {
+	for _, se := range exec.query.Select.SelectExprs {
+		if _, ok := se.Value.(*aqlprocessor.AggregateFunctionCallSelectValue); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (exec *executer) getAggregateArgument(afc *aqlprocessor.AggregateFunctionCallSelectValue, source dataRow) any {
+	if afc.Asterisk {
+		return countAll{}
+	}
+
+	if afc.IdentifiedPath == nil {
+		return nil
+	}
+
+	cell, ok := source.cells[afc.IdentifiedPath.Identifier]
+	if !ok {
+		return nil
+	}
+
+	if afc.IdentifiedPath.ObjectPath == nil {
+		return cell.data
+	}
+
+	val, _ := exec.getValueForPath(afc.IdentifiedPath.ObjectPath, cell.data)
+
+	return exec.reveal(val)
+}
+
+// aggregateRows applies the aggregate functions of the SELECT to the rows.
+// AQL has no GROUP BY, so rows are grouped by the values of all not aggregated columns:
+// an aggregate-only projection always collapses to a single row, even when there are no rows at all.
+func (exec *executer) aggregateRows(sources dataRows, rows []Row) ([]Row, error) {
+	type group struct {
+		first int
+		rows  []Row
+	}
+
+	selectExprs := exec.query.Select.SelectExprs
+
+	var (
+		groups []*group
+		byKey  = map[string]*group{}
+	)
+
+	for i, row := range rows {
+		keyParts := make([]string, 0, len(selectExprs))
+
+		for j, se := range selectExprs {
+			if _, ok := se.Value.(*aqlprocessor.AggregateFunctionCallSelectValue); !ok {
+				keyParts = append(keyParts, valueKey(row.values[j]))
+			}
+		}
+
+		key := strings.Join(keyParts, "\x00")
+
+		g, ok := byKey[key]
+		if !ok {
+			g = &group{first: i}
+			byKey[key] = g
+			groups = append(groups, g)
+		}
+
+		g.rows = append(g.rows, row)
+	}
+
+	if len(groups) == 0 {
+		if !exec.isAggregateOnly() {
+			return []Row{}, nil
+		}
+
+		groups = append(groups, &group{first: -1})
+	}
+
+	result := make([]Row, 0, len(groups))
+
+	for _, g := range groups {
+		row := Row{
+			values: make([]any, len(selectExprs)),
+		}
+
+		for j, se := range selectExprs {
+			if prim, ok := se.Value.(*aqlprocessor.PrimitiveSelectValue); ok {
+				row.values[j] = exec.getPrimitiveColumnValue(prim)
+				continue
+			}
+
+			afc, ok := se.Value.(*aqlprocessor.AggregateFunctionCallSelectValue)
+			if !ok {
+				row.values[j] = g.rows[0].values[j]
+				continue
+			}
+
+			args := make([]any, 0, len(g.rows))
+			for _, r := range g.rows {
+				args = append(args, r.values[j])
+			}
+
+			val, err := aggregate(afc, args)
+			if err != nil {
+				return nil, fmt.Errorf("%s error: %w", se.Path, err)
+			}
+
+			row.values[j] = val
+		}
+
+		if g.first >= 0 {
+			row.orderKeys = exec.getOrderKeys(sources[g.first], row)
+		} else {
+			row.orderKeys = exec.getOrderKeys(dataRow{}, row)
+		}
+
+		result = append(result, row)
+	}
+
+	return result, nil
+}
+
+// isAggregateOnly reports whether the SELECT has only aggregate functions and constants
+func (exec *executer) isAggregateOnly() bool {
+	for _, se := range exec.query.Select.SelectExprs {
+		switch se.Value.(type) {
+		case *aqlprocessor.AggregateFunctionCallSelectValue, *aqlprocessor.PrimitiveSelectValue:
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// aggregate applies the function to the argument values, NULL values are skipped.
+// COUNT returns int, SUM returns int when all values are integers and float64 otherwise, AVG returns float64.
+// MIN, MAX, SUM and AVG return NULL when there are no values.
+func aggregate(afc *aqlprocessor.AggregateFunctionCallSelectValue, args []any) (any, error) {
+	values := make([]any, 0, len(args))
+	seen := map[string]bool{}
+
+	for _, arg := range args {
+		if arg == nil {
+			continue
+		}
+
+		if afc.Distinct {
+			key := valueKey(arg)
+			if seen[key] {
+				continue
+			}
+
+			seen[key] = true
+		}
+
+		values = append(values, arg)
+	}
+
+	switch afc.Name {
+	case aqlprocessor.CountAggregateFunction:
+		return len(values), nil
+	case aqlprocessor.MinAggregateFunction, aqlprocessor.MaxAggregateFunction:
+		var (
+			result    any
+			resultKey any
+		)
+
+		for _, v := range values {
+			key := treeindex.OrderKey(v)
+
+			c := treeindex.CompareOrderKeys(key, resultKey)
+			if afc.Name == aqlprocessor.MaxAggregateFunction && resultKey != nil {
+				c = -c
+			}
+
+			if resultKey == nil || c < 0 {
+				result, resultKey = v, key
+			}
+		}
+
+		return result, nil
+	case aqlprocessor.SumAggregateFunction, aqlprocessor.AvgAggregateFunction:
+		if len(values) == 0 {
+			return nil, nil
+		}
+
+		var (
+			intSum   int
+			floatSum float64
+			isFloat  bool
+		)
+
+		for _, v := range values {
+			n, ok := treeindex.Number(v)
+			if !ok {
+				return nil, fmt.Errorf("value of type %T is not a number", v) //nolint
+			}
+
+			switch n := n.(type) {
+			case int:
+				intSum += n
+			case float64:
+				floatSum += n
+				isFloat = true
+			}
+		}
+
+		if afc.Name == aqlprocessor.AvgAggregateFunction {
+			return (floatSum + float64(intSum)) / float64(len(values)), nil
+		}
+
+		if isFloat {
+			return floatSum + float64(intSum), nil
+		}
+
+		return intSum, nil
+	default:
+		return nil, fmt.Errorf("unexpected aggregate function: %s", afc.Name) //nolint
+	}
+}
+
+// valueKey returns a string that is equal for equal values, it is used for grouping and DISTINCT
+func valueKey(val any) string {
+	switch v := treeindex.OrderKey(val).(type) {
+	case nil:
+		return "<nil>"
+	case time.Time:
+		return "time:" + v.UTC().Format(time.RFC3339Nano)
+	case treeindex.Noder:
+		return fmt.Sprintf("node:%p", v)
+	default:
+		if key, ok := compositeValueKey(reflect.ValueOf(v)); ok {
+			return key
+		}
+
+		return fmt.Sprintf("%T:%#v", v, v)
+	}
+}
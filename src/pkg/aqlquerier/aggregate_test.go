@@ -0,0 +1,52 @@
+package aqlquerier
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/aqlprocessor"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model/base"
+)
+
+func Test_aggregate(t *testing.T) {
+	// the tree index keeps the DV_COUNT magnitudes as int64
+	counts := []base.DvCount{{Magnitude: 3}, {Magnitude: 4}, {Magnitude: 8}}
+
+	magnitudes := make([]any, 0, len(counts)+1)
+	for _, c := range counts {
+		magnitudes = append(magnitudes, c.Magnitude)
+	}
+
+	magnitudes = append(magnitudes, nil)
+
+	tests := []struct {
+		name    string
+		fn      aqlprocessor.AggregateFunctionName
+		args    []any
+		want    any
+		wantErr bool
+	}{
+		{"1. SUM of DV_COUNT magnitudes", aqlprocessor.SumAggregateFunction, magnitudes, 15, false},
+		{"2. AVG of DV_COUNT magnitudes", aqlprocessor.AvgAggregateFunction, magnitudes, 5.0, false},
+		{"3. MAX of DV_COUNT magnitudes", aqlprocessor.MaxAggregateFunction, magnitudes, int64(8), false},
+		{"4. SUM of numbers of different widths", aqlprocessor.SumAggregateFunction, []any{uint8(1), int32(2), float32(0.5)}, 3.5, false},
+		{"5. SUM of not numbers", aqlprocessor.SumAggregateFunction, []any{int64(1), "2"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			afc := &aqlprocessor.AggregateFunctionCallSelectValue{Name: tt.fn}
+
+			got, err := aggregate(afc, tt.args)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
@@ -18,14 +18,16 @@ type AQLDriver struct{}
 
 func (svc *AQLDriver) Open(name string) (driver.Conn, error) {
 	conn := &AQLConn{
-		index: treeindex.DefaultEHRIndex,
+		index:     treeindex.DefaultEHRIndex,
+		functions: DefaultFunctionRegistry,
 	}
 
 	return conn, nil
 }
 
 type AQLConn struct {
-	index *treeindex.EHRIndex
+	index     *treeindex.EHRIndex
+	functions *FunctionRegistry
 }
 
 // Prepare returns a prepared statement, bound to this connection.
@@ -40,8 +42,9 @@ func (conn *AQLConn) PrepareContext(_ context.Context, query string) (driver.Stm
 	}
 
 	stmt := &Stmt{
-		query: aqlQuery,
-		index: conn.index,
+		query:     aqlQuery,
+		index:     conn.index,
+		functions: conn.functions,
 	}
 
 	return stmt, nil
@@ -1,8 +1,11 @@
 package aqlquerier
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
+	"math"
 	"os"
 	"sort"
 	"testing"
@@ -268,7 +271,7 @@ func TestService_ExecuteQuery(t *testing.T) {
 				})
 				return result, nil
 			},
-			[]*float64{nil, nil, nil, nil, nil, toRef(940.0), toRef(981.13)},
+			[]*float64{toRef(940.0), toRef(981.13)},
 			false,
 		},
 		{
@@ -317,7 +320,7 @@ func TestService_ExecuteQuery(t *testing.T) {
 				})
 				return result, nil
 			},
-			[]*float64{nil, nil, nil, nil, nil, toRef(79.9), toRef(981.13)},
+			[]*float64{toRef(79.9), toRef(981.13)},
 			false,
 		},
 		{
@@ -465,16 +468,860 @@ func TestService_ExecuteQuery(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"13. select values with ORDER BY DESC",
+			`SELECT
+			   o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/magnitude
+			FROM EHR e CONTAINS COMPOSITION c CONTAINS OBSERVATION o
+			ORDER BY o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/magnitude DESC`,
+			[]interface{}{},
+			[]string{"test_fixtures/composition_2.json"},
+			scanNullFloats,
+			[]*float64{nil, nil, nil, nil, nil, toRef(981.13), toRef(940.0), toRef(79.9)},
+			false,
+		},
+		{
+			"14. select values with ORDER BY DV_QUANTITY ASC",
+			`SELECT
+			   o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/magnitude
+			FROM EHR e CONTAINS COMPOSITION c CONTAINS OBSERVATION o
+			ORDER BY o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value ASC`,
+			[]interface{}{},
+			[]string{"test_fixtures/composition_2.json"},
+			scanNullFloats,
+			[]*float64{toRef(79.9), toRef(940.0), toRef(981.13), nil, nil, nil, nil, nil},
+			false,
+		},
+		{
+			"15. select values with ORDER BY alias and several keys",
+			`SELECT
+			   o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/magnitude AS magnitude
+			FROM EHR e CONTAINS COMPOSITION c CONTAINS OBSERVATION o
+			WHERE
+				o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/magnitude >= 0
+			ORDER BY o/data[at0002]/events[at0003]/time DESC, magnitude DESC`,
+			[]interface{}{},
+			[]string{"test_fixtures/composition_2.json"},
+			scanNullFloats,
+			[]*float64{toRef(981.13), toRef(940.0), toRef(79.9)},
+			false,
+		},
+		{
+			"16. select aggregate functions",
+			`SELECT
+				COUNT(*),
+				COUNT(o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/magnitude),
+				MIN(o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/magnitude),
+				MAX(o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/magnitude),
+				SUM(o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/magnitude),
+				AVG(o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/magnitude)
+			FROM EHR e CONTAINS COMPOSITION c CONTAINS OBSERVATION o`,
+			[]interface{}{},
+			[]string{"test_fixtures/composition_2.json"},
+			func(rows *sqlx.Rows) (interface{}, error) {
+				result := [][]any{}
+				for rows.Next() {
+					var (
+						count, countValues int
+						min, max, sum, avg float64
+					)
+
+					if err := rows.Scan(&count, &countValues, &min, &max, &sum, &avg); err != nil {
+						return nil, errors.Wrap(err, "cannot scan aggregate values")
+					}
+
+					result = append(result, []any{count, countValues, min, max, math.Round(sum*100) / 100, math.Round(avg*100) / 100})
+				}
+
+				return result, nil
+			},
+			[][]any{{8, 3, 79.9, 981.13, 2001.03, 667.01}},
+			false,
+		},
+		{
+			"17. select COUNT DISTINCT",
+			`SELECT COUNT(DISTINCT e/ehr_id/value), COUNT(e/ehr_id/value)
+			FROM EHR e CONTAINS COMPOSITION c CONTAINS OBSERVATION o`,
+			[]interface{}{},
+			[]string{"test_fixtures/composition_2.json"},
+			func(rows *sqlx.Rows) (interface{}, error) {
+				result := [][]int{}
+				for rows.Next() {
+					var distinct, all int
+					if err := rows.Scan(&distinct, &all); err != nil {
+						return nil, errors.Wrap(err, "cannot scan count values")
+					}
+
+					result = append(result, []int{distinct, all})
+				}
+
+				return result, nil
+			},
+			[][]int{{1, 8}},
+			false,
+		},
+		{
+			"18. select aggregate functions without rows",
+			`SELECT COUNT(*), MAX(o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/magnitude)
+			FROM EHR e CONTAINS COMPOSITION c CONTAINS OBSERVATION o
+			WHERE o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/magnitude > 10000`,
+			[]interface{}{},
+			[]string{"test_fixtures/composition_2.json"},
+			func(rows *sqlx.Rows) (interface{}, error) {
+				result := [][]any{}
+				for rows.Next() {
+					var (
+						count int
+						max   *float64
+					)
+
+					if err := rows.Scan(&count, &max); err != nil {
+						return nil, errors.Wrap(err, "cannot scan aggregate values")
+					}
+
+					result = append(result, []any{count, max})
+				}
+
+				return result, nil
+			},
+			[][]any{{0, (*float64)(nil)}},
+			false,
+		},
+		{
+			"19. select aggregate function grouped by column",
+			`SELECT e/ehr_id/value, COUNT(*)
+			FROM EHR e CONTAINS COMPOSITION c CONTAINS OBSERVATION o`,
+			[]interface{}{},
+			[]string{"test_fixtures/composition_2.json"},
+			func(rows *sqlx.Rows) (interface{}, error) {
+				result := [][]any{}
+				for rows.Next() {
+					var (
+						id    string
+						count int
+					)
+
+					if err := rows.Scan(&id, &count); err != nil {
+						return nil, errors.Wrap(err, "cannot scan aggregate values")
+					}
+
+					result = append(result, []any{id, count})
+				}
+
+				return result, nil
+			},
+			[][]any{{"7d44b88c-4199-4bad-97dc-d78268e01398", 8}},
+			false,
+		},
+		{
+			"20. select function calls",
+			`SELECT
+				LENGTH(e/ehr_id/value),
+				SUBSTRING(e/ehr_id/value, 1, 8),
+				ROUND(o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/magnitude)
+			FROM EHR e CONTAINS COMPOSITION c CONTAINS OBSERVATION o
+			WHERE o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/magnitude >= 0
+			ORDER BY o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/magnitude`,
+			[]interface{}{},
+			[]string{"test_fixtures/composition_2.json"},
+			func(rows *sqlx.Rows) (interface{}, error) {
+				result := [][]any{}
+				for rows.Next() {
+					var (
+						length  int
+						prefix  string
+						rounded float64
+					)
+
+					if err := rows.Scan(&length, &prefix, &rounded); err != nil {
+						return nil, errors.Wrap(err, "cannot scan function values")
+					}
+
+					result = append(result, []any{length, prefix, rounded})
+				}
+
+				return result, nil
+			},
+			[][]any{{36, "7d44b88c", 80.0}, {36, "7d44b88c", 940.0}, {36, "7d44b88c", 981.0}},
+			false,
+		},
+		{
+			"21. filter with function calls",
+			`SELECT o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/magnitude
+			FROM EHR e CONTAINS COMPOSITION c CONTAINS OBSERVATION o
+			WHERE POSITION($unit, o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/units) > 0
+				OR o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/magnitude < ABS(-100)`,
+			[]interface{}{
+				sql.Named("unit", "min"),
+			},
+			[]string{"test_fixtures/composition_2.json"},
+			func(rows *sqlx.Rows) (interface{}, error) {
+				values, err := scanNullFloats(rows)
+				if err != nil {
+					return nil, err
+				}
+
+				result := values.([]*float64)
+				sort.Slice(result, func(i, j int) bool {
+					return *result[i] < *result[j]
+				})
+
+				return result, nil
+			},
+			[]*float64{toRef(79.9), toRef(940.0)},
+			false,
+		},
+		{
+			"22. select DISTINCT",
+			`SELECT DISTINCT e/ehr_id/value, 'observation'
+			FROM EHR e CONTAINS COMPOSITION c CONTAINS OBSERVATION o`,
+			[]interface{}{},
+			[]string{"test_fixtures/composition_2.json"},
+			func(rows *sqlx.Rows) (interface{}, error) {
+				result := [][]string{}
+				for rows.Next() {
+					var id, kind string
+					if err := rows.Scan(&id, &kind); err != nil {
+						return nil, errors.Wrap(err, "cannot scan distinct values")
+					}
+
+					result = append(result, []string{id, kind})
+				}
+
+				return result, nil
+			},
+			[][]string{{"7d44b88c-4199-4bad-97dc-d78268e01398", "observation"}},
+			false,
+		},
+		{
+			"23. select DISTINCT with ORDER BY and LIMIT OFFSET",
+			`SELECT DISTINCT o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/magnitude AS magnitude
+			FROM EHR e CONTAINS COMPOSITION c CONTAINS OBSERVATION o
+			ORDER BY magnitude DESC
+			LIMIT 2 OFFSET 1`,
+			[]interface{}{},
+			[]string{"test_fixtures/composition_2.json"},
+			scanNullFloats,
+			[]*float64{toRef(981.13), toRef(940.0)},
+			false,
+		},
+		{
+			"24. filter with LIKE",
+			`SELECT o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/magnitude
+			FROM EHR e CONTAINS COMPOSITION c CONTAINS OBSERVATION o
+			WHERE o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/units LIKE '*min' OR o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/units LIKE $units
+			ORDER BY o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/magnitude`,
+			[]interface{}{
+				sql.Named("units", "k?"),
+			},
+			[]string{"test_fixtures/composition_2.json"},
+			scanNullFloats,
+			[]*float64{toRef(940.0), toRef(981.13)},
+			false,
+		},
+		{
+			"25. filter with MATCHES",
+			`SELECT o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/magnitude
+			FROM EHR e CONTAINS COMPOSITION c CONTAINS OBSERVATION o
+			WHERE o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/units MATCHES {'kg', $units}
+			ORDER BY o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/magnitude`,
+			[]interface{}{
+				sql.Named("units", "Cel"),
+			},
+			[]string{"test_fixtures/composition_2.json"},
+			scanNullFloats,
+			[]*float64{toRef(79.9), toRef(981.13)},
+			false,
+		},
+		{
+			"26. filter with EXISTS",
+			`SELECT o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/magnitude
+			FROM EHR e CONTAINS COMPOSITION c CONTAINS OBSERVATION o
+			WHERE EXISTS o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/magnitude
+			ORDER BY o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/magnitude`,
+			[]interface{}{},
+			[]string{"test_fixtures/composition_2.json"},
+			scanNullFloats,
+			[]*float64{toRef(79.9), toRef(940.0), toRef(981.13)},
+			false,
+		},
+		{
+			"27. filter with NOT EXISTS",
+			`SELECT o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/magnitude
+			FROM EHR e CONTAINS COMPOSITION c CONTAINS OBSERVATION o
+			WHERE NOT EXISTS o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/magnitude
+			ORDER BY o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/magnitude`,
+			[]interface{}{},
+			[]string{"test_fixtures/composition_2.json"},
+			scanNullFloats,
+			[]*float64{nil, nil, nil, nil, nil},
+			false,
+		},
+		{
+			"28. filter with parameter and path terminals",
+			`SELECT o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/magnitude
+			FROM EHR e CONTAINS COMPOSITION c CONTAINS OBSERVATION o
+			WHERE o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/magnitude > $min AND o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/magnitude = o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/magnitude
+			ORDER BY o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/magnitude`,
+			[]interface{}{
+				sql.Named("min", 100),
+			},
+			[]string{"test_fixtures/composition_2.json"},
+			scanNullFloats,
+			[]*float64{toRef(940.0), toRef(981.13)},
+			false,
+		},
+		{
+			"29. filter with parameter without value",
+			`SELECT o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/magnitude
+			FROM EHR e CONTAINS COMPOSITION c CONTAINS OBSERVATION o
+			WHERE o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/magnitude > $min
+			ORDER BY o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/magnitude`,
+			[]interface{}{},
+			[]string{"test_fixtures/composition_2.json"},
+			scanNullFloats,
+			nil,
+			true,
+		},
+		{
+			"30. select from nested containment classes",
+			`SELECT cl/archetype_node_id
+			FROM EHR e CONTAINS COMPOSITION c CONTAINS SECTION s CONTAINS OBSERVATION o CONTAINS CLUSTER cl`,
+			[]interface{}{},
+			[]string{"test_fixtures/composition_1.json", "test_fixtures/composition_2.json"},
+			scanSortedSlices,
+			[][]any{
+				{"openEHR-EHR-CLUSTER.laboratory_test_analyte.v1"},
+				{"openEHR-EHR-CLUSTER.multimedia_source.v0"},
+				{"openEHR-EHR-CLUSTER.specimen.v1"},
+			},
+			false,
+		},
+		{
+			"31. select ELEMENT contained in CLUSTER without COMPOSITION",
+			`SELECT el/archetype_node_id
+			FROM EHR e CONTAINS CLUSTER cl [openEHR-EHR-CLUSTER.specimen.v1] CONTAINS ELEMENT el`,
+			[]interface{}{},
+			[]string{"test_fixtures/composition_1.json", "test_fixtures/composition_2.json"},
+			scanSortedSlices,
+			[][]any{{"at0007"}, {"at0029"}, {"at0087"}},
+			false,
+		},
+		{
+			"32. select with CONTAINS AND",
+			`SELECT o1/archetype_node_id, o2/archetype_node_id
+			FROM EHR e CONTAINS COMPOSITION c CONTAINS (
+				OBSERVATION o1 [openEHR-EHR-OBSERVATION.pulse.v2] AND OBSERVATION o2 [openEHR-EHR-OBSERVATION.body_weight.v2]
+			)`,
+			[]interface{}{},
+			[]string{"test_fixtures/composition_1.json", "test_fixtures/composition_2.json"},
+			scanSortedSlices,
+			[][]any{{"openEHR-EHR-OBSERVATION.pulse.v2", "openEHR-EHR-OBSERVATION.body_weight.v2"}},
+			false,
+		},
+		{
+			"33. select with CONTAINS AND from different compositions",
+			`SELECT o1/archetype_node_id, o2/archetype_node_id
+			FROM EHR e CONTAINS COMPOSITION c CONTAINS (
+				OBSERVATION o1 [openEHR-EHR-OBSERVATION.pulse.v2] AND OBSERVATION o2 [openEHR-EHR-OBSERVATION.laboratory_test_result.v1]
+			)`,
+			[]interface{}{},
+			[]string{"test_fixtures/composition_1.json", "test_fixtures/composition_2.json"},
+			scanSortedSlices,
+			[][]any{},
+			false,
+		},
+		{
+			"34. select with CONTAINS OR",
+			`SELECT o1/archetype_node_id, o2/archetype_node_id
+			FROM EHR e CONTAINS COMPOSITION c CONTAINS (
+				OBSERVATION o1 [openEHR-EHR-OBSERVATION.pulse.v2] OR OBSERVATION o2 [openEHR-EHR-OBSERVATION.laboratory_test_result.v1]
+			)`,
+			[]interface{}{},
+			[]string{"test_fixtures/composition_1.json", "test_fixtures/composition_2.json"},
+			scanSortedSlices,
+			[][]any{
+				{nil, "openEHR-EHR-OBSERVATION.laboratory_test_result.v1"},
+				{"openEHR-EHR-OBSERVATION.pulse.v2", nil},
+			},
+			false,
+		},
+		{
+			"35. select with NOT CONTAINS",
+			`SELECT s/archetype_node_id, COUNT(*)
+			FROM EHR e CONTAINS SECTION s NOT CONTAINS OBSERVATION o [openEHR-EHR-OBSERVATION.pulse.v2]`,
+			[]interface{}{},
+			[]string{"test_fixtures/composition_1.json", "test_fixtures/composition_2.json"},
+			scanSortedSlices,
+			[][]any{{"openEHR-EHR-SECTION.adhoc.v1", 1}},
+			false,
+		},
+		{
+			"36. unknown function",
+			`SELECT FOO(e/ehr_id/value) FROM EHR e`,
+			[]interface{}{},
+			[]string{"test_fixtures/composition_2.json"},
+			func(rows *sqlx.Rows) (interface{}, error) {
+				return nil, nil
+			},
+			nil,
+			true,
+		},
+		{
+			"37. node predicates with name",
+			`SELECT o/data[at0001]/events[at0006]/data[at0003]/items[at0004, 'Systolic']/value/magnitude,
+				o/data[at0001]/events[at0006]/data[at0003]/items[at0004, 'Diastolic']/value/magnitude
+			FROM EHR e CONTAINS OBSERVATION o[openEHR-EHR-OBSERVATION.blood_pressure.v2, 'Blood pressure']`,
+			[]interface{}{},
+			[]string{"test_fixtures/composition_2.json"},
+			scanSortedSlices,
+			[][]any{{266.0, nil}},
+			false,
+		},
+		{
+			"38. node predicates with parameter and name/value",
+			`SELECT o/data[at0001]/events[at0006 and name/value='Any event']/data[at0003]/items[name/value='Diastolic']/value/magnitude
+			FROM EHR e CONTAINS OBSERVATION o[openEHR-EHR-OBSERVATION.blood_pressure.v2, $name]`,
+			[]interface{}{sql.Named("name", "Blood pressure")},
+			[]string{"test_fixtures/composition_2.json"},
+			scanSortedSlices,
+			[][]any{{756.0}},
+			false,
+		},
+		{
+			"39. class expression with name/value predicate",
+			`SELECT o/archetype_node_id FROM EHR e CONTAINS OBSERVATION o[name/value='Pulse/Heart beat']`,
+			[]interface{}{},
+			[]string{"test_fixtures/composition_2.json"},
+			scanSortedSlices,
+			[][]any{{"openEHR-EHR-OBSERVATION.pulse.v2"}},
+			false,
+		},
+		{
+			"40. archetype predicates inside the path",
+			`SELECT o/data[at0001]/events[at0002]/data[at0003]/items[openEHR-EHR-CLUSTER.specimen.v1]/items[at0029]/name/value,
+				o/data[at0001]/events[at0002]/data[at0003]/items[openEHR-EHR-CLUSTER.specimen.v1, 'Specimen']/items[at0087, 'Body site']/value/value
+			FROM EHR e CONTAINS OBSERVATION o[openEHR-EHR-OBSERVATION.laboratory_test_result.v1]`,
+			[]interface{}{},
+			[]string{"test_fixtures/composition_1.json"},
+			scanSortedSlices,
+			[][]any{{"Specimen type", "Body site 14"}},
+			false,
+		},
+		{
+			"41. node predicate with MATCHES",
+			`SELECT o/data[at0001]/events[at0006]/data[at0003]/items[name/value matches {/^Dia/}]/value/magnitude
+			FROM EHR e CONTAINS OBSERVATION o[openEHR-EHR-OBSERVATION.blood_pressure.v2]`,
+			[]interface{}{},
+			[]string{"test_fixtures/composition_2.json"},
+			scanSortedSlices,
+			[][]any{{756.0}},
+			false,
+		},
+		{
+			"42. WHERE on the indexed values",
+			`SELECT o/archetype_node_id
+			FROM EHR e CONTAINS COMPOSITION c CONTAINS OBSERVATION o[openEHR-EHR-OBSERVATION.blood_pressure.v2]
+			WHERE o/data[at0001]/events[at0006]/data[at0003]/items[at0004]/value/magnitude >= $min
+				AND o/data[at0001]/events[at0006]/data[at0003]/items[at0005]/value/magnitude < 757`,
+			[]interface{}{sql.Named("min", 266)},
+			[]string{"test_fixtures/composition_1.json", "test_fixtures/composition_2.json"},
+			scanSortedSlices,
+			[][]any{{"openEHR-EHR-OBSERVATION.blood_pressure.v2"}},
+			false,
+		},
+		{
+			"43. WHERE OR on the indexed values",
+			`SELECT o/archetype_node_id
+			FROM EHR e CONTAINS OBSERVATION o[openEHR-EHR-OBSERVATION.blood_pressure.v2]
+			WHERE o/data[at0001]/events[at0006]/data[at0003]/items[at0004]/value/magnitude > 1000
+				OR o/data[at0001]/events[at0006]/data[at0003]/items[at0005]/value/magnitude = 756`,
+			[]interface{}{},
+			[]string{"test_fixtures/composition_2.json"},
+			scanSortedSlices,
+			[][]any{{"openEHR-EHR-OBSERVATION.blood_pressure.v2"}},
+			false,
+		},
+		{
+			"44. WHERE on the indexed values inside CONTAINS OR",
+			`SELECT o1/archetype_node_id, o2/archetype_node_id
+			FROM EHR e CONTAINS COMPOSITION c CONTAINS (
+				OBSERVATION o1[openEHR-EHR-OBSERVATION.blood_pressure.v2] OR OBSERVATION o2[openEHR-EHR-OBSERVATION.pulse.v2]
+			)
+			WHERE o1/data[at0001]/events[at0006]/data[at0003]/items[at0004]/value/magnitude > 100`,
+			[]interface{}{},
+			[]string{"test_fixtures/composition_2.json"},
+			scanSortedSlices,
+			[][]any{{"openEHR-EHR-OBSERVATION.blood_pressure.v2", nil}},
+			false,
+		},
+		{
+			"45. WHERE on the variable missing in the other CONTAINS OR branch",
+			`SELECT o1/archetype_node_id, o2/archetype_node_id
+			FROM EHR e CONTAINS COMPOSITION c CONTAINS (
+				OBSERVATION o1[openEHR-EHR-OBSERVATION.blood_pressure.v2] OR OBSERVATION o2[openEHR-EHR-OBSERVATION.pulse.v2]
+			)
+			WHERE o1/data[at0001]/events[at0006]/data[at0003]/items[at0004]/value/magnitude > 1000
+				OR o2/archetype_node_id = 'openEHR-EHR-OBSERVATION.pulse.v2'`,
+			[]interface{}{},
+			[]string{"test_fixtures/composition_2.json"},
+			scanSortedSlices,
+			[][]any{{nil, "openEHR-EHR-OBSERVATION.pulse.v2"}},
+			false,
+		},
+		{
+			"46. CONTAINS function in SELECT and WHERE",
+			`SELECT CONTAINS(o/archetype_node_id, 'blood'), o/archetype_node_id
+			FROM EHR e CONTAINS COMPOSITION c CONTAINS OBSERVATION o
+			WHERE CONTAINS(o/archetype_node_id, $part) = $found`,
+			[]interface{}{
+				sql.Named("part", "pressure"),
+				sql.Named("found", true),
+			},
+			[]string{"test_fixtures/composition_2.json"},
+			scanSortedSlices,
+			[][]any{{true, "openEHR-EHR-OBSERVATION.blood_pressure.v2"}},
+			false,
+		},
+		{
+			"47. NOT on the variable missing in the other CONTAINS OR branch",
+			`SELECT o1/archetype_node_id, o2/archetype_node_id
+			FROM EHR e CONTAINS COMPOSITION c CONTAINS (
+				OBSERVATION o1[openEHR-EHR-OBSERVATION.blood_pressure.v2] OR OBSERVATION o2[openEHR-EHR-OBSERVATION.pulse.v2]
+			)
+			WHERE NOT o1/data[at0001]/events[at0006]/data[at0003]/items[at0004]/value/magnitude > 1000
+				AND NOT (NOT o1/data[at0001]/events[at0006]/data[at0003]/items[at0004]/value/magnitude > 0)`,
+			[]interface{}{},
+			[]string{"test_fixtures/composition_2.json"},
+			scanSortedSlices,
+			[][]any{{"openEHR-EHR-OBSERVATION.blood_pressure.v2", nil}},
+			false,
+		},
+	}
+
+	// the same results are expected from the index with the encrypted values
+	ciphers := map[string]*treeindex.ValueCipher{
+		"":                   nil,
+		" (encrypted index)": treeindex.NewValueCipher([32]byte{7}),
+	}
+
+	for suffix, cipher := range ciphers {
+		for _, tt := range tests {
+			t.Run(tt.name+suffix, func(t *testing.T) {
+				err := getPreparedTreeIndexWithCipher(cipher, tt.dataFiles...)
+				if err != nil {
+					t.Errorf("Service.ExecQuery() error on prepare tree index = %v", err)
+					return
+				}
+
+				conn, err := sqlx.Open("aql", "")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				defer conn.Close()
+
+				rows, err := conn.Queryx(tt.query, tt.args...)
+				if err != nil {
+					if (err != nil) != tt.wantErr {
+						t.Errorf("Service.ExecQuery() error = %v, wantErr %v", err, tt.wantErr)
+					}
+
+					return
+				}
+
+				got, err := tt.scan(rows)
+				if assert.Nil(t, err) {
+					assert.Equal(t, tt.want, got)
+				}
+			})
+		}
+	}
+}
+
+func TestService_ExecuteQuery_Versions(t *testing.T) {
+	const (
+		uid1     = "8d5b2eb1-ad71-4ae8-8a9d-9b8d2f3b3b3a::openEHRSys.example.com::1"
+		uid2     = "8d5b2eb1-ad71-4ae8-8a9d-9b8d2f3b3b3a::openEHRSys.example.com::2"
+		uid3     = "8d5b2eb1-ad71-4ae8-8a9d-9b8d2f3b3b3a::openEHRSys.example.com::3"
+		otherUID = "2a1a2f3c-5b1e-4c5a-9b7a-1f8c7d6e5a4b::openEHRSys.example.com::1"
+	)
+
+	if err := getPreparedTreeIndex(); err != nil {
+		t.Fatal(err)
+	}
+
+	ehrs, err := treeindex.DefaultEHRIndex.GetEHRs("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ehrID := ehrs[0].GetID()
+	committed := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	cmp, err := loadTestComposition("test_fixtures/composition_1.json", uid1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	audit := model.NewAuditDetails("openEHRSys.example.com", "user-1", model.ChangeTypeCreation, committed)
+	if err := treeindex.AddComposition(ehrID, *cmp, audit); err != nil {
+		t.Fatal(err)
+	}
+
+	cmp, err = loadTestComposition("test_fixtures/composition_2.json", uid2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	audit = model.NewAuditDetails("openEHRSys.example.com", "user-2", model.ChangeTypeModification, committed.Add(time.Hour))
+	if err := treeindex.UpdateComposition(ehrID, *cmp, audit); err != nil {
+		t.Fatal(err)
+	}
+
+	cmp, err = loadTestComposition("test_fixtures/composition_2.json", otherUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := treeindex.AddComposition(ehrID, *cmp, model.AuditDetails{}); err != nil {
+		t.Fatal(err)
+	}
+
+	audit = model.NewAuditDetails("openEHRSys.example.com", "user-1", model.ChangeTypeDeleted, committed.Add(2*time.Hour))
+	if err := treeindex.DeleteComposition(ehrID, otherUID, audit); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		args    []interface{}
+		want    [][]any
+		wantErr bool
+	}{
+		{
+			"1. all versions with commit audit",
+			`SELECT v/uid/value, v/preceding_version_uid/value, v/commit_audit/change_type/value, v/commit_audit/committer/external_ref/id/value
+			FROM EHR e CONTAINS VERSION v[ALL_VERSIONS]`,
+			nil,
+			[][]any{
+				{"2a1a2f3c-5b1e-4c5a-9b7a-1f8c7d6e5a4b::openEHRSys.example.com::1", nil, "creation", nil},
+				{"2a1a2f3c-5b1e-4c5a-9b7a-1f8c7d6e5a4b::openEHRSys.example.com::2", otherUID, "deleted", "user-1"},
+				{uid1, nil, "creation", "user-1"},
+				{uid2, uid1, "modification", "user-2"},
+			},
+			false,
+		},
+		{
+			"2. latest versions",
+			`SELECT v/uid/value, v/lifecycle_state/value FROM EHR e CONTAINS VERSION v[LATEST_VERSION]`,
+			nil,
+			[][]any{
+				{"2a1a2f3c-5b1e-4c5a-9b7a-1f8c7d6e5a4b::openEHRSys.example.com::2", "deleted"},
+				{uid2, "complete"},
+			},
+			false,
+		},
+		{
+			"3. latest version is the default",
+			`SELECT v/uid/value FROM VERSION v CONTAINS COMPOSITION c`,
+			nil,
+			[][]any{{uid2}},
+			false,
+		},
+		{
+			"4. compositions of all versions",
+			`SELECT v/uid/value, c/uid/value
+			FROM EHR e CONTAINS VERSION v[ALL_VERSIONS] CONTAINS COMPOSITION c[openEHR-EHR-COMPOSITION.health_summary.v1]`,
+			nil,
+			[][]any{
+				{"2a1a2f3c-5b1e-4c5a-9b7a-1f8c7d6e5a4b::openEHRSys.example.com::1", otherUID},
+				{uid1, uid1},
+				{uid2, uid2},
+			},
+			false,
+		},
+		{
+			"5. version standard predicate",
+			`SELECT v/uid/value, v/commit_audit/time_committed/value
+			FROM EHR e CONTAINS VERSION v[commit_audit/change_type/value = $changeType]`,
+			[]interface{}{sql.Named("changeType", "modification")},
+			[][]any{{uid2, "2022-10-01T13:00:00+00:00"}},
+			false,
+		},
+		{
+			"6. versions of the versioned objects",
+			`SELECT vo/uid/value, vo/time_created/value, COUNT(v/uid/value)
+			FROM EHR e CONTAINS VERSIONED_OBJECT vo CONTAINS VERSION v[ALL_VERSIONS]`,
+			nil,
+			[][]any{
+				{"2a1a2f3c-5b1e-4c5a-9b7a-1f8c7d6e5a4b", nil, 2},
+				{"8d5b2eb1-ad71-4ae8-8a9d-9b8d2f3b3b3a", "2022-10-01T12:00:00+00:00", 2},
+			},
+			false,
+		},
+		{
+			"7. entries of the previous versions",
+			`SELECT v/uid/value, COUNT(o)
+			FROM VERSION v[ALL_VERSIONS] CONTAINS OBSERVATION o[openEHR-EHR-OBSERVATION.pulse.v2]`,
+			nil,
+			[][]any{{otherUID, 1}, {uid2, 1}},
+			false,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := getPreparedTreeIndex(tt.dataFiles...)
+			conn, err := sqlx.Open("aql", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer conn.Close()
+
+			rows, err := conn.Queryx(tt.query, tt.args...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExecQuery() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
 			if err != nil {
-				t.Errorf("Service.ExecQuery() error on prepare tree index = %v", err)
 				return
 			}
 
+			got, err := scanSortedSlices(rows)
+			if assert.Nil(t, err) {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func loadTestComposition(filename, uid string) (*model.Composition, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read file")
+	}
+
+	cmp := model.Composition{}
+	if err := json.Unmarshal(data, &cmp); err != nil {
+		return nil, errors.Wrap(err, "cannot unmarshal composition")
+	}
+
+	cmp.UID.Value = uid
+
+	return &cmp, nil
+}
+
+func TestService_ExecuteQuery_Scope(t *testing.T) {
+	const (
+		uid1 = "8d5b2eb1-ad71-4ae8-8a9d-9b8d2f3b3b3a::openEHRSys.example.com::1"
+		uid2 = "2a1a2f3c-5b1e-4c5a-9b7a-1f8c7d6e5a4b::openEHRSys.example.com::1"
+	)
+
+	if err := getPreparedTreeIndex(); err != nil {
+		t.Fatal(err)
+	}
+
+	ehrs, err := treeindex.DefaultEHRIndex.GetEHRs("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ehrID := ehrs[0].GetID()
+
+	for uid, filename := range map[string]string{uid1: "test_fixtures/composition_1.json", uid2: "test_fixtures/composition_2.json"} {
+		cmp, err := loadTestComposition(filename, uid)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := treeindex.AddComposition(ehrID, *cmp, model.AuditDetails{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ehrScope := NewScope()
+	ehrScope.AddEHR(ehrID)
+
+	cmpScope := NewScope()
+	cmpScope.AddComposition(ehrID, uid1)
+
+	if err := treeindex.AddDoc("cid2", ehrID, uid2); err != nil {
+		t.Fatal(err)
+	}
+
+	docScope := NewScope()
+	assert.True(t, docScope.AddDoc(treeindex.DefaultEHRIndex, "cid2"))
+	assert.False(t, docScope.AddDoc(treeindex.DefaultEHRIndex, "unknown"), "the document unknown to the index is reported")
+
+	otherScope := NewScope()
+	otherScope.AddEHR("other-ehr")
+
+	tests := []struct {
+		name      string
+		query     string
+		scope     *Scope
+		queryable bool
+		want      [][]any
+	}{
+		{
+			"1. without scope",
+			`SELECT c/uid/value FROM EHR e CONTAINS COMPOSITION c`,
+			nil,
+			true,
+			[][]any{{uid2}, {uid1}},
+		},
+		{
+			"2. whole EHR",
+			`SELECT c/uid/value FROM COMPOSITION c`,
+			ehrScope,
+			true,
+			[][]any{{uid2}, {uid1}},
+		},
+		{
+			"3. granted composition",
+			`SELECT e/ehr_id/value, c/uid/value FROM EHR e CONTAINS COMPOSITION c`,
+			cmpScope,
+			true,
+			[][]any{{ehrID, uid1}},
+		},
+		{
+			"4. versions of granted composition",
+			`SELECT v/uid/value FROM VERSION v[ALL_VERSIONS]`,
+			cmpScope,
+			true,
+			[][]any{{uid1}},
+		},
+		{
+			"5. granted document",
+			`SELECT c/uid/value FROM EHR e CONTAINS COMPOSITION c`,
+			docScope,
+			true,
+			[][]any{{uid2}},
+		},
+		{
+			"6. another EHR",
+			`SELECT e/ehr_id/value FROM EHR e`,
+			otherScope,
+			true,
+			[][]any{},
+		},
+		{
+			"7. EHR is not queryable",
+			`SELECT c/uid/value FROM EHR e CONTAINS COMPOSITION c`,
+			ehrScope,
+			false,
+			[][]any{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := treeindex.UpdateEHRStatus(ehrID, model.EhrStatus{IsQueryable: tt.queryable}); err != nil {
+				t.Fatal(err)
+			}
+
 			conn, err := sqlx.Open("aql", "")
 			if err != nil {
 				t.Fatal(err)
@@ -482,16 +1329,17 @@ func TestService_ExecuteQuery(t *testing.T) {
 
 			defer conn.Close()
 
-			rows, err := conn.Queryx(tt.query, tt.args...)
-			if err != nil {
-				if (err != nil) != tt.wantErr {
-					t.Errorf("Service.ExecQuery() error = %v, wantErr %v", err, tt.wantErr)
-				}
+			ctx := context.Background()
+			if tt.scope != nil {
+				ctx = WithScope(ctx, tt.scope)
+			}
 
-				return
+			rows, err := conn.QueryxContext(ctx, tt.query)
+			if err != nil {
+				t.Fatalf("ExecQuery() error = %v", err)
 			}
 
-			got, err := tt.scan(rows)
+			got, err := scanSortedSlices(rows)
 			if assert.Nil(t, err) {
 				assert.Equal(t, tt.want, got)
 			}
@@ -502,8 +1350,16 @@ func TestService_ExecuteQuery(t *testing.T) {
 const ehrFile = "./../../../data/mock/ehr/ehr.json"
 
 func getPreparedTreeIndex(filenames ...string) error {
+	return getPreparedTreeIndexWithCipher(nil, filenames...)
+}
+
+func getPreparedTreeIndexWithCipher(cipher *treeindex.ValueCipher, filenames ...string) error {
 	treeindex.DefaultEHRIndex = treeindex.NewEHRIndex()
 
+	if cipher != nil {
+		treeindex.DefaultEHRIndex.SetValueCipher(cipher)
+	}
+
 	ehr := model.EHR{}
 	{
 		data, err := os.ReadFile(ehrFile)
@@ -531,7 +1387,7 @@ func getPreparedTreeIndex(filenames ...string) error {
 			return errors.Wrap(err, "cannot unmarshal composition")
 		}
 
-		if err := treeindex.AddComposition(ehr.EhrID.Value, comp); err != nil {
+		if err := treeindex.AddComposition(ehr.EhrID.Value, comp, model.AuditDetails{}); err != nil {
 			return errors.Wrap(err, "cannot add Composition into EHRIndex")
 		}
 	}
@@ -539,6 +1395,44 @@ func getPreparedTreeIndex(filenames ...string) error {
 	return nil
 }
 
+func scanNullFloats(rows *sqlx.Rows) (interface{}, error) {
+	result := []*float64{}
+
+	for rows.Next() {
+		var val any
+		if err := rows.Scan(&val); err != nil {
+			return nil, errors.Wrap(err, "cannot scan float64 value")
+		}
+
+		if val != nil {
+			result = append(result, toRef(val.(float64)))
+		} else {
+			result = append(result, nil)
+		}
+	}
+
+	return result, nil
+}
+
+func scanSortedSlices(rows *sqlx.Rows) (interface{}, error) {
+	result := [][]any{}
+
+	for rows.Next() {
+		row, err := rows.SliceScan()
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot scan row")
+		}
+
+		result = append(result, row)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return fmt.Sprint(result[i]) < fmt.Sprint(result[j])
+	})
+
+	return result, nil
+}
+
 func toRef[T any](val T) *T {
 	return &val
 }
@@ -0,0 +1,102 @@
+package aqlquerier
+
+import (
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/aqlprocessor"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/storage/treeindex"
+)
+
+// reveal returns the plain value of the encrypted index value, the values stored in the clear are returned as is.
+// The value which can not be decrypted is NULL. It is used where the ciphertexts are not enough: the selected values,
+// LIKE and the regular expressions, the function arguments, the data values comparisons, ORDER BY and the aggregates.
+func (exec *executer) reveal(val any) any {
+	ev, ok := val.(*treeindex.EncryptedValue)
+	if !ok {
+		return val
+	}
+
+	if exec.cipher == nil {
+		return nil
+	}
+
+	plain, err := exec.cipher.Decrypt(ev)
+	if err != nil {
+		return nil
+	}
+
+	return plain
+}
+
+// compareValues compares the values as compareValues does, the data values as their types define
+// and the encrypted values over the ciphertexts:
+// the other value is encrypted with the key of the EHR of the encrypted one. The encrypted strings keep the equality only,
+// so they are never less or greater than the other strings.
+func (exec *executer) compareValues(x, y any, cmpOperator aqlprocessor.ComparisionSymbol) bool {
+	switch x := x.(type) {
+	case quantity:
+		return x.compare(exec.reveal(y), cmpOperator)
+	case codedText:
+		return x.compare(exec.reveal(y), cmpOperator)
+	}
+
+	_, xEncrypted := x.(*treeindex.EncryptedValue)
+	_, yEncrypted := y.(*treeindex.EncryptedValue)
+
+	if !xEncrypted && !yEncrypted {
+		return compareValues(x, y, cmpOperator)
+	}
+
+	if exec.cipher == nil || treeindex.OrderKey(x) == nil || treeindex.OrderKey(y) == nil {
+		return false
+	}
+
+	switch {
+	case xEncrypted && !yEncrypted:
+		y = exec.encrypt(x.(*treeindex.EncryptedValue).EhrID, y)
+	case !xEncrypted && yEncrypted:
+		x = exec.encrypt(y.(*treeindex.EncryptedValue).EhrID, x)
+	}
+
+	c, ordered, ok := exec.cipher.Compare(x, y)
+
+	switch {
+	case !ok:
+		return cmpOperator == aqlprocessor.SymNe
+	case !ordered && cmpOperator != aqlprocessor.SymEQ && cmpOperator != aqlprocessor.SymNe:
+		return false
+	default:
+		return compareResult(c, cmpOperator)
+	}
+}
+
+type encryptedKey struct {
+	ehrID string
+	value string
+}
+
+// encrypt returns the value encrypted with the key of the EHR, so the query literal is encrypted once per EHR
+// instead of once per compared row. The value which can not be encrypted is returned as is.
+func (exec *executer) encrypt(ehrID string, val any) any {
+	key := encryptedKey{ehrID: ehrID, value: valueKey(val)}
+
+	ev, ok := exec.encrypted[key]
+	if !ok {
+		var err error
+
+		ev, err = exec.cipher.Encrypt(ehrID, val)
+		if err != nil {
+			ev = nil
+		}
+
+		if exec.encrypted == nil {
+			exec.encrypted = map[encryptedKey]*treeindex.EncryptedValue{}
+		}
+
+		exec.encrypted[key] = ev
+	}
+
+	if ev == nil {
+		return val
+	}
+
+	return ev
+}
@@ -0,0 +1,105 @@
+package aqlquerier
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model/base"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/storage/treeindex"
+)
+
+// TestService_ExecuteQuery_ConcurrentWrites runs the queries while the EHR is written, it is meant for the -race runs.
+func TestService_ExecuteQuery_ConcurrentWrites(t *testing.T) {
+	require.NoError(t, getPreparedTreeIndex("test_fixtures/composition_2.json"))
+
+	idx := treeindex.DefaultEHRIndex
+
+	ehrs, err := idx.GetEHRs("")
+	require.NoError(t, err)
+	require.Len(t, ehrs, 1)
+
+	ehrID := ehrs[0].GetID()
+
+	data, err := os.ReadFile("test_fixtures/composition_2.json")
+	require.NoError(t, err)
+
+	conn, err := sqlx.Open("aql", "")
+	require.NoError(t, err)
+
+	defer conn.Close()
+
+	const writes = 10
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		for i := 0; i < writes; i++ {
+			var cmp model.Composition
+			if err := json.Unmarshal(data, &cmp); err != nil {
+				t.Error(err)
+				return
+			}
+
+			uid := fmt.Sprintf("a95c4e04-aa4b-4fc6-9fef-b1ac5b4bd1%02d", i)
+
+			cmp.UID = &base.UIDBasedID{ObjectID: base.ObjectID{Value: uid + "::openEHRSys.example.com::1"}}
+			if err := idx.AddComposition(ehrID, cmp, model.AuditDetails{}); err != nil {
+				t.Error(err)
+				return
+			}
+
+			cmp.UID = &base.UIDBasedID{ObjectID: base.ObjectID{Value: uid + "::openEHRSys.example.com::2"}}
+			if err := idx.UpdateComposition(ehrID, cmp, model.AuditDetails{}); err != nil {
+				t.Error(err)
+				return
+			}
+
+			if err := idx.UpdateEHRStatus(ehrID, model.EhrStatus{IsQueryable: true}); err != nil {
+				t.Error(err)
+				return
+			}
+
+			if i%2 == 0 {
+				if err := idx.DeleteComposition(ehrID, uid, model.AuditDetails{}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}
+	}()
+
+	queries := []string{
+		`SELECT c/uid/value, o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value/magnitude
+			FROM EHR e CONTAINS COMPOSITION c CONTAINS OBSERVATION o`,
+		`SELECT c FROM EHR e CONTAINS COMPOSITION c`,
+		`SELECT v/uid/value, v/commit_audit/change_type/value FROM EHR e CONTAINS VERSION v`,
+		`SELECT vo/uid/value FROM EHR e CONTAINS VERSIONED_OBJECT vo`,
+	}
+
+	for i := 0; i < writes; i++ {
+		for _, q := range queries {
+			rows, err := conn.Queryx(q)
+			require.NoError(t, err)
+
+			for rows.Next() {
+				_, err := rows.SliceScan()
+				require.NoError(t, err)
+			}
+
+			require.NoError(t, rows.Close())
+		}
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,155 @@
+package aqlquerier
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/aqlprocessor"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model/base"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/storage/treeindex"
+)
+
+// quantity is the DV_QUANTITY compared by the magnitude converted into its units,
+// e.g. o/data[at0001]/events[at0006]/data[at0003]/items[at0004]/value > '140 mm[Hg]'.
+type quantity struct {
+	magnitude float64
+	units     string
+}
+
+// codedText is the DV_CODED_TEXT matched either by the text or by the defining code, e.g. 'SNOMED-CT::313267000'.
+type codedText struct {
+	value       string
+	terminology string
+	code        string
+}
+
+// getComparableValueForPath returns the value at the path the comparisons are applied to.
+// The data values are compared as a whole: DV_QUANTITY with the units conversion, DV_CODED_TEXT by the defining code
+// and the rest by the main attribute, e.g. DV_DATE_TIME by value and DV_COUNT by magnitude.
+func (exec *executer) getComparableValueForPath(path *aqlprocessor.ObjectPath, node treeindex.Noder) (any, bool) {
+	node, ok := exec.getNodeForPath(path, node)
+	if !ok {
+		return nil, false
+	}
+
+	switch node := node.(type) {
+	case *treeindex.ValueNode:
+		return node.GetData(), true
+	case *treeindex.DataValueNode:
+		return exec.getDataValue(node)
+	default:
+		return nil, false
+	}
+}
+
+func (exec *executer) getDataValue(node *treeindex.DataValueNode) (any, bool) {
+	switch node.Type {
+	case base.DvQuantityItemType:
+		val, _ := getChildValue(node, "magnitude")
+
+		magnitude, err := toFloat(exec.reveal(val))
+		if err != nil {
+			return nil, false
+		}
+
+		val, _ = getChildValue(node, "units")
+		units, _ := exec.reveal(val).(string)
+
+		return quantity{magnitude: magnitude, units: units}, true
+	case base.DvCodedTextItemType:
+		var result codedText
+
+		val, _ := getChildValue(node, "value")
+		result.value, _ = exec.reveal(val).(string)
+
+		val, _ = getChildValue(node, "defining_code", "terminology_id")
+		result.terminology, _ = exec.reveal(val).(string)
+
+		val, _ = getChildValue(node, "defining_code", "code_string")
+		result.code, _ = exec.reveal(val).(string)
+
+		return result, true
+	default:
+		for _, attr := range []string{"magnitude", "value"} {
+			if val, ok := getChildValue(node, attr); ok {
+				return val, true
+			}
+		}
+
+		return nil, false
+	}
+}
+
+// compare compares the quantity with the number in its units or with the quantity, e.g. '140 mm[Hg]',
+// converted into its units. The quantities of the units of different dimensions are only not equal.
+func (q quantity) compare(val any, cmpOperator aqlprocessor.ComparisionSymbol) bool {
+	var other quantity
+
+	switch v := val.(type) {
+	case int, float64:
+		return compareValues(q.magnitude, v, cmpOperator)
+	case quantity:
+		other = v
+	case string:
+		var ok bool
+		if other, ok = parseQuantity(v); !ok {
+			return cmpOperator == aqlprocessor.SymNe
+		}
+	default:
+		return val != nil && cmpOperator == aqlprocessor.SymNe
+	}
+
+	if other.units == "" {
+		// the magnitude without units is in the units of the quantity
+		other.units = q.units
+	}
+
+	magnitude, err := convertQuantity(other.magnitude, other.units, q.units)
+	if err != nil {
+		return cmpOperator == aqlprocessor.SymNe
+	}
+
+	return compareValues(q.magnitude, magnitude, cmpOperator)
+}
+
+// parseQuantity parses the quantity of the '<magnitude> <units>' form, the units are optional.
+func parseQuantity(s string) (quantity, bool) {
+	parts := strings.SplitN(strings.TrimSpace(s), " ", 2)
+
+	magnitude, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return quantity{}, false
+	}
+
+	q := quantity{magnitude: magnitude}
+	if len(parts) == 2 {
+		q.units = strings.TrimSpace(parts[1])
+	}
+
+	return q, true
+}
+
+// compare matches the coded text with the defining code of the 'terminology::code' form
+// or compares it with the text otherwise.
+func (ct codedText) compare(val any, cmpOperator aqlprocessor.ComparisionSymbol) bool {
+	s, ok := val.(string)
+	if !ok {
+		return compareValues(ct.value, val, cmpOperator)
+	}
+
+	parts := strings.SplitN(s, "::", 2)
+	if len(parts) != 2 {
+		return compareValues(ct.value, s, cmpOperator)
+	}
+
+	match := ct.terminology == parts[0] && ct.code == parts[1]
+
+	switch cmpOperator {
+	case aqlprocessor.SymEQ:
+		return match
+	case aqlprocessor.SymNe:
+		return !match
+	default:
+		return false
+	}
+}
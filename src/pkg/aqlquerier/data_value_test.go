@@ -0,0 +1,126 @@
+package aqlquerier
+
+import (
+	"testing"
+
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/storage/treeindex"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestService_ExecuteQuery_DataValues(t *testing.T) {
+	const (
+		from = `FROM EHR e CONTAINS COMPOSITION c CONTAINS OBSERVATION o[openEHR-EHR-OBSERVATION.blood_pressure.v2]`
+
+		systolic    = `o/data[at0001]/events[at0006]/data[at0003]/items[at0004]/value`
+		eventTime   = `o/data[at0001]/events[at0006]/time/value`
+		temperature = `o/data[at0002]/events[at0003]/data[at0001]/items[at0004]/value`
+	)
+
+	tests := []struct {
+		name  string
+		query string
+		want  [][]any
+	}{
+		{
+			"1. systolic above the threshold since the date",
+			`SELECT ` + systolic + `/magnitude ` + from + `
+			WHERE ` + systolic + ` > '140 mm[Hg]' AND ` + eventTime + ` >= '2021-01-01'`,
+			[][]any{{266.0}},
+		},
+		{
+			"2. systolic in other units",
+			`SELECT ` + systolic + `/magnitude ` + from + ` WHERE ` + systolic + ` > '35 kPa'`,
+			[][]any{{266.0}},
+		},
+		{
+			"3. systolic below the value in other units",
+			`SELECT ` + systolic + `/magnitude ` + from + ` WHERE ` + systolic + ` > '36 kPa'`,
+			[][]any{},
+		},
+		{
+			"4. magnitude without units",
+			`SELECT ` + systolic + `/magnitude ` + from + ` WHERE ` + systolic + ` = 266`,
+			[][]any{{266.0}},
+		},
+		{
+			"5. units of other dimension are only not equal",
+			`SELECT ` + systolic + `/magnitude ` + from + ` WHERE ` + systolic + ` > '140 kg' OR ` + systolic + ` = '140 kg'`,
+			[][]any{},
+		},
+		{
+			"6. temperature in fahrenheit",
+			`SELECT ` + temperature + `/units FROM EHR e CONTAINS OBSERVATION o[openEHR-EHR-OBSERVATION.body_temperature.v2]
+			WHERE ` + temperature + ` > '175 [degF]' AND ` + temperature + ` < '176 [degF]'`,
+			[][]any{{"Cel"}},
+		},
+		{
+			"7. date/time in other time zone",
+			`SELECT ` + eventTime + ` ` + from + ` WHERE ` + eventTime + ` < '2021-12-03T17:00:00Z'`,
+			[][]any{{"2021-12-03T17:34:06.849379+01:00"}},
+		},
+		{
+			"8. date/time after the event",
+			`SELECT ` + eventTime + ` ` + from + ` WHERE ` + eventTime + ` > '2021-12-03T16:35:00Z'`,
+			[][]any{},
+		},
+		{
+			"9. coded text by defining code",
+			`SELECT c/category/value FROM EHR e CONTAINS COMPOSITION c WHERE c/category = 'openehr::433'`,
+			[][]any{{"event"}},
+		},
+		{
+			"10. coded text by other code",
+			`SELECT c/category/value FROM EHR e CONTAINS COMPOSITION c WHERE c/category = 'openehr::434'`,
+			[][]any{},
+		},
+		{
+			"11. coded text by text",
+			`SELECT c/category/value FROM EHR e CONTAINS COMPOSITION c WHERE c/category = 'event'`,
+			[][]any{{"event"}},
+		},
+		{
+			"12. coded text in predicate",
+			`SELECT c/category/value FROM EHR e CONTAINS COMPOSITION c[category='openehr::433']`,
+			[][]any{{"event"}},
+		},
+		{
+			"13. coded text in predicate by other code",
+			`SELECT c/category/value FROM EHR e CONTAINS COMPOSITION c[category='openehr::434']`,
+			[][]any{},
+		},
+	}
+
+	ciphers := map[string]*treeindex.ValueCipher{
+		"":                   nil,
+		" (encrypted index)": treeindex.NewValueCipher([32]byte{7}),
+	}
+
+	for suffix, cipher := range ciphers {
+		for _, tt := range tests {
+			t.Run(tt.name+suffix, func(t *testing.T) {
+				if err := getPreparedTreeIndexWithCipher(cipher, "test_fixtures/composition_2.json"); err != nil {
+					t.Fatal(err)
+				}
+
+				conn, err := sqlx.Open("aql", "")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				defer conn.Close()
+
+				rows, err := conn.Queryx(tt.query)
+				if err != nil {
+					t.Fatalf("ExecQuery() error = %v", err)
+				}
+
+				got, err := scanSortedSlices(rows)
+				if assert.Nil(t, err) {
+					assert.Equal(t, tt.want, got)
+				}
+			})
+		}
+	}
+}
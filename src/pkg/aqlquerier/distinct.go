@@ -0,0 +1,75 @@
+package aqlquerier
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// distinctRows removes the rows with the projected values equal to the values of a previous row.
+// The first row of the duplicates is kept with its ORDER BY keys, so DISTINCT is applied before
+// the rows are ordered and limited.
+func distinctRows(rows []Row) []Row {
+	result := make([]Row, 0, len(rows))
+	seen := map[string]bool{}
+
+	for _, row := range rows {
+		keyParts := make([]string, 0, len(row.values))
+		for _, v := range row.values {
+			keyParts = append(keyParts, valueKey(v))
+		}
+
+		key := strings.Join(keyParts, "\x00")
+		if seen[key] {
+			continue
+		}
+
+		seen[key] = true
+
+		result = append(result, row)
+	}
+
+	return result
+}
+
+// compositeValueKey returns the key of a map, slice, array or pointer value built from the keys of its elements.
+// Map keys are sorted, so maps with the same content have the same key regardless of the iteration order.
+func compositeValueKey(v reflect.Value) (string, bool) {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return valueKey(nil), true
+		}
+
+		return valueKey(v.Elem().Interface()), true
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return valueKey(nil), true
+		}
+
+		parts := make([]string, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			parts = append(parts, valueKey(v.Index(i).Interface()))
+		}
+
+		return "[" + strings.Join(parts, ",") + "]", true
+	case reflect.Map:
+		if v.IsNil() {
+			return valueKey(nil), true
+		}
+
+		parts := make([]string, 0, v.Len())
+
+		iter := v.MapRange()
+		for iter.Next() {
+			parts = append(parts, fmt.Sprintf("%s:%s", valueKey(iter.Key().Interface()), valueKey(iter.Value().Interface())))
+		}
+
+		sort.Strings(parts)
+
+		return "{" + strings.Join(parts, ",") + "}", true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,24 @@
+package aqlquerier
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_distinctRows(t *testing.T) {
+	rows := []Row{
+		{values: []any{1, "a"}},
+		{values: []any{1.0, "a"}},
+		{values: []any{map[string]any{"x": 1, "y": []any{"a", toRef("b")}}, nil}},
+		{values: []any{map[string]any{"y": []any{"a", "b"}, "x": 1.0}, nil}},
+		{values: []any{map[string]any{"x": 2}, nil}},
+		{values: []any{[]string{"a", "b"}, "2021-12-03T17:00:00Z"}},
+		{values: []any{[]string{"a", "b"}, "2021-12-03T18:00:00+01:00"}},
+		{values: []any{[]string{"b", "a"}, "2021-12-03T17:00:00Z"}},
+	}
+
+	got := distinctRows(rows)
+
+	assert.Equal(t, []Row{rows[0], rows[2], rows[4], rows[5], rows[7]}, got)
+}
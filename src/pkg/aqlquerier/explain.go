@@ -0,0 +1,263 @@
+package aqlquerier
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/aqlprocessor"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/errors"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/storage/treeindex"
+)
+
+const (
+	StageFrom   = "FROM"
+	StageWhere  = "WHERE"
+	StageSelect = "SELECT"
+	StageOrder  = "ORDER BY"
+	StageLimit  = "LIMIT"
+)
+
+// Plan describes the execution of the query: the parsed query, the containment of the FROM sources
+// and the number of rows left after every stage of the execution.
+type Plan struct {
+	Query       *aqlprocessor.Query `json:"query"`
+	Containment *PlanContainment    `json:"containment"`
+	Stages      []PlanStage         `json:"stages"`
+
+	sources map[string]*PlanSource
+}
+
+// PlanContainment is the node of the FROM containment tree.
+// It has either the source of the class expression or the logical operator of the nested containments.
+type PlanContainment struct {
+	Source   *PlanSource        `json:"source,omitempty"`
+	Operator string             `json:"operator,omitempty"`
+	Contains []*PlanContainment `json:"contains,omitempty"`
+}
+
+// PlanSource is the class expression of the FROM containment.
+// Candidates is the number of the class nodes found in the tree index, Matched is the number of them left after the predicate.
+// Where has the WHERE conditions, joined by AND, which depend on this source only.
+// Indexed is true when the candidates are found by the archetype and value indexes of the tree index.
+type PlanSource struct {
+	Variable   string                         `json:"variable"`
+	Class      string                         `json:"class"`
+	Predicate  *aqlprocessor.PathPredicate    `json:"predicate,omitempty"`
+	Where      []*aqlprocessor.IdentifiedExpr `json:"where,omitempty"`
+	Candidates int                            `json:"candidates"`
+	Matched    int                            `json:"matched"`
+	Indexed    bool                           `json:"indexed"`
+}
+
+type PlanStage struct {
+	Name string `json:"name"`
+	Rows int    `json:"rows"`
+}
+
+// Explain executes the query over the default tree index and returns its plan instead of the rows.
+func Explain(ctx context.Context, query string, params map[string]any) (*Plan, error) {
+	aqlQuery, err := aqlprocessor.NewAqlProcessor(query).Process()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parse AQL query")
+	}
+
+	parameterValues := map[string]driver.Value{}
+
+	for name, val := range params {
+		if _, ok := aqlQuery.Parameters[name]; !ok {
+			return nil, fmt.Errorf("unknown query paramenter: '%s'", name) // nolint
+		}
+
+		v, err := driver.DefaultParameterConverter.ConvertValue(val)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot convert query parameter "+name)
+		}
+
+		parameterValues[name] = v
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, errors.Wrap(err, "cannot explain query")
+	}
+
+	plan := newPlan(aqlQuery)
+
+	exec := executer{
+		ctx:       ctx,
+		query:     aqlQuery,
+		params:    parameterValues,
+		index:     treeindex.DefaultEHRIndex,
+		functions: DefaultFunctionRegistry,
+		plan:      plan,
+		scope:     scopeFromContext(ctx),
+		page:      pageFromContext(ctx),
+		cipher:    treeindex.DefaultEHRIndex.ValueCipher(),
+	}
+
+	if _, err := exec.run(); err != nil {
+		return nil, errors.Wrap(err, "cannot executer query")
+	}
+
+	return plan, nil
+}
+
+func newPlan(query *aqlprocessor.Query) *Plan {
+	plan := &Plan{
+		Query:   query,
+		Stages:  []PlanStage{},
+		sources: map[string]*PlanSource{},
+	}
+
+	plan.Containment = plan.addContainment(&query.From.ContainsExpr)
+
+	if query.Where != nil {
+		for _, ie := range getWhereConjunction(query.Where) {
+			variables := map[string]bool{}
+			collectIdentifiedExprVariables(ie, variables)
+
+			if len(variables) != 1 {
+				continue
+			}
+
+			for name := range variables {
+				if src, ok := plan.sources[name]; ok {
+					src.Where = append(src.Where, ie)
+				}
+			}
+		}
+	}
+
+	return plan
+}
+
+func (plan *Plan) addContainment(containsExpr *aqlprocessor.ContainsExpr) *PlanContainment {
+	node := &PlanContainment{}
+
+	switch operand := containsExpr.Operand.(type) {
+	case aqlprocessor.ClassExpression:
+		src := &PlanSource{
+			Variable:  operand.Identifiers[0],
+			Class:     operand.Identifiers[0],
+			Predicate: operand.PathPredicate,
+		}
+
+		if len(operand.Identifiers) > 1 {
+			src.Variable = operand.Identifiers[1]
+		}
+
+		node.Source = plan.addSource(src)
+	case aqlprocessor.VersionClassExpr:
+		src := &PlanSource{
+			Variable:  treeindex.VERSION,
+			Class:     treeindex.VERSION,
+			Predicate: operand.VersionPredicate,
+		}
+
+		if operand.Variable != nil {
+			src.Variable = *operand.Variable
+		}
+
+		node.Source = plan.addSource(src)
+	}
+
+	if containsExpr.Operator != nil {
+		node.Operator = string(*containsExpr.Operator)
+	}
+
+	for _, ce := range containsExpr.Contains {
+		node.Contains = append(node.Contains, plan.addContainment(ce))
+	}
+
+	return node
+}
+
+// addSource returns the source of the variable, so the class expressions without alias of the same class share the counters
+// the same way as they share the row cell.
+func (plan *Plan) addSource(src *PlanSource) *PlanSource {
+	if existing, ok := plan.sources[src.Variable]; ok {
+		return existing
+	}
+
+	plan.sources[src.Variable] = src
+
+	return src
+}
+
+func (plan *Plan) countSource(variable string, candidates, matched int) {
+	if plan == nil {
+		return
+	}
+
+	if src, ok := plan.sources[variable]; ok {
+		src.Candidates += candidates
+		src.Matched += matched
+	}
+}
+
+func (plan *Plan) addStage(name string, rows int) {
+	if plan == nil {
+		return
+	}
+
+	plan.Stages = append(plan.Stages, PlanStage{Name: name, Rows: rows})
+}
+
+// getWhereConjunction returns the conditions of the WHERE block which must all be true.
+func getWhereConjunction(where *aqlprocessor.Where) []*aqlprocessor.IdentifiedExpr {
+	switch {
+	case where.IdentifiedExpr != nil:
+		return []*aqlprocessor.IdentifiedExpr{where.IdentifiedExpr}
+	case where.OperatorType == aqlprocessor.ANDOperator:
+		result := []*aqlprocessor.IdentifiedExpr{}
+		for _, next := range where.Next {
+			result = append(result, getWhereConjunction(next)...)
+		}
+
+		return result
+	case (where.OperatorType == aqlprocessor.NoneOperator || where.OperatorType == "") && len(where.Next) == 1:
+		return getWhereConjunction(where.Next[0])
+	default:
+		return nil
+	}
+}
+
+func collectIdentifiedExprVariables(ie *aqlprocessor.IdentifiedExpr, variables map[string]bool) {
+	if ie.Next != nil {
+		collectIdentifiedExprVariables(ie.Next, variables)
+		return
+	}
+
+	if ie.IdentifiedPath != nil {
+		variables[ie.IdentifiedPath.Identifier] = true
+	}
+
+	if ie.FunctionCall != nil {
+		collectFunctionCallVariables(ie.FunctionCall, variables)
+	}
+
+	terminals := append([]*aqlprocessor.Terminal{ie.Terminal, ie.Like}, ie.Matches...)
+	for _, t := range terminals {
+		collectTerminalVariables(t, variables)
+	}
+}
+
+func collectTerminalVariables(t *aqlprocessor.Terminal, variables map[string]bool) {
+	if t == nil {
+		return
+	}
+
+	if t.IdentifiedPath != nil {
+		variables[t.IdentifiedPath.Identifier] = true
+	}
+
+	if t.FunctionCall != nil {
+		collectFunctionCallVariables(t.FunctionCall, variables)
+	}
+}
+
+func collectFunctionCallVariables(fc *aqlprocessor.FunctionCall, variables map[string]bool) {
+	for _, arg := range fc.Args {
+		collectTerminalVariables(arg, variables)
+	}
+}
@@ -0,0 +1,77 @@
+package aqlquerier
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplain(t *testing.T) {
+	if err := getPreparedTreeIndex("test_fixtures/composition_1.json", "test_fixtures/composition_2.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	query := `SELECT o/data[at0001]/events[at0006]/data[at0003]/items[at0004]/value/magnitude
+		FROM EHR e CONTAINS COMPOSITION c CONTAINS OBSERVATION o[openEHR-EHR-OBSERVATION.blood_pressure.v2]
+		WHERE o/data[at0001]/events[at0006]/data[at0003]/items[at0004]/value/magnitude > $min AND e/ehr_id/value = c/uid/value
+		LIMIT 1`
+
+	plan, err := Explain(context.Background(), query, map[string]any{"min": 200.0})
+	require.NoError(t, err)
+
+	assert.NotNil(t, plan.Query)
+	assert.Equal(t, []PlanStage{
+		{Name: StageFrom, Rows: 1},
+		{Name: StageWhere, Rows: 0},
+		{Name: StageSelect, Rows: 0},
+		{Name: StageOrder, Rows: 0},
+		{Name: StageLimit, Rows: 0},
+	}, plan.Stages)
+
+	ehrSource := plan.Containment.Source
+	require.NotNil(t, ehrSource)
+	assert.Equal(t, "e", ehrSource.Variable)
+	assert.Equal(t, "EHR", ehrSource.Class)
+	assert.Equal(t, 1, ehrSource.Matched)
+	assert.Empty(t, ehrSource.Where, "the condition on two sources can not be pushed down")
+
+	require.Len(t, plan.Containment.Contains, 1)
+	cmpSource := plan.Containment.Contains[0].Source
+	assert.Equal(t, "c", cmpSource.Variable)
+	assert.Equal(t, 2, cmpSource.Candidates)
+	assert.Equal(t, 2, cmpSource.Matched)
+
+	require.Len(t, plan.Containment.Contains[0].Contains, 1)
+	obsSource := plan.Containment.Contains[0].Contains[0].Source
+	assert.Equal(t, "o", obsSource.Variable)
+	assert.NotNil(t, obsSource.Predicate)
+	assert.True(t, obsSource.Indexed)
+	assert.Equal(t, 1, obsSource.Candidates, "the observations of other archetypes should not be candidates")
+	assert.Equal(t, 1, obsSource.Matched)
+	assert.Len(t, obsSource.Where, 1)
+	assert.False(t, cmpSource.Indexed)
+
+	// no blood pressure is found by the value index, so the EHR is not searched
+	plan, err = Explain(context.Background(), query, map[string]any{"min": 1000.0})
+	require.NoError(t, err)
+	assert.Equal(t, PlanStage{Name: StageFrom, Rows: 0}, plan.Stages[0])
+	assert.Equal(t, 0, plan.Containment.Source.Candidates)
+
+	_, err = json.Marshal(plan)
+	assert.NoError(t, err)
+
+	_, err = Explain(context.Background(), query, map[string]any{"unknown": 1})
+	assert.Error(t, err)
+
+	_, err = Explain(context.Background(), "SELECT FROM", nil)
+	assert.Error(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = Explain(ctx, query, map[string]any{"min": 1000.0})
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -2,9 +2,9 @@ package aqlquerier
 
 import (
 	"fmt"
-	"reflect"
 
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/aqlprocessor"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model/base"
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/errors"
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/storage/treeindex"
 
@@ -15,6 +15,9 @@ type dataCell struct {
 	name  string
 	alias string
 	data  treeindex.Noder
+
+	// ehr is the EHR the data belongs to
+	ehr *treeindex.EHRNode
 }
 
 func (dc dataCell) getName() string {
@@ -33,6 +36,8 @@ type dataRow struct {
 type dataRows []dataRow
 
 func (exec *executer) findSources() (dataRows, error) {
+	exec.filter = exec.newIndexFilter()
+
 	rows, err := exec.getDataRows(exec.query.From.ContainsExpr)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot find data rows")
@@ -50,252 +55,304 @@ func (exec *executer) getDataRows(containsExpr aqlprocessor.ContainsExpr) (dataR
 	return result, nil
 }
 
+// processRowsContainsExpr returns the rows matching the containment expression inside the root cell.
+// The rows have a cell for every class expression of the containment, but not for the root cell itself.
 func (exec *executer) processRowsContainsExpr(rootCell *dataCell, containsExpr *aqlprocessor.ContainsExpr) (dataRows, error) {
-	result := dataRows{}
-
 	switch operand := containsExpr.Operand.(type) {
 	case aqlprocessor.ClassExpression:
-		var node treeindex.Noder
-		if rootCell != nil {
-			node = rootCell.data
+		cells, err := exec.getDataForClassExpr(rootCell, operand)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot get data from node")
 		}
 
-		nodeDataCells, err := exec.getDataForClassExpr(node, operand)
+		return exec.processRowsCells(cells, containsExpr)
+	case aqlprocessor.VersionClassExpr:
+		cells, err := exec.getDataForVersionClassExpr(rootCell, operand)
 		if err != nil {
-			return nil, errors.Wrap(err, "cannot get data from node")
+			return nil, errors.Wrap(err, "cannot get versions data")
 		}
 
-		if len(containsExpr.Contains) > 0 {
-			for i := range nodeDataCells {
-				rowsSet := make([]dataRows, 0, len(containsExpr.Contains))
-
-				for _, ce := range containsExpr.Contains {
-					rows, err := exec.processRowsContainsExpr(&nodeDataCells[i], ce)
-					if err != nil {
-						return nil, errors.Wrap(err, "cannot process rows contains expr")
-					}
-
-					if rootCell != nil {
-						for _, r := range rows {
-							r.cells[rootCell.getName()] = *rootCell
-						}
-					}
-
-					if len(rows) > 0 {
-						rowsSet = append(rowsSet, rows)
-					}
-				}
+		return exec.processRowsCells(cells, containsExpr)
+	case nil:
+		return exec.processRowsLogicalExpr(rootCell, containsExpr)
+	default:
+		return nil, fmt.Errorf("unexpected operand type: %T", operand) //nolint
+	}
+}
 
-				if len(rowsSet) == 1 {
-					result = append(result, rowsSet[0]...)
-				}
-			}
-		} else {
-			for _, cell := range nodeDataCells {
-				row := dataRow{
-					id: uuid.New(),
-					cells: map[string]dataCell{
-						cell.getName(): cell,
-					},
-				}
+// processRowsCells returns the rows for the cells of the class expression and the containment expressions inside them.
+func (exec *executer) processRowsCells(nodeDataCells []dataCell, containsExpr *aqlprocessor.ContainsExpr) (dataRows, error) {
+	result := dataRows{}
 
-				if rootCell != nil {
-					row.cells[rootCell.getName()] = *rootCell
-				}
+	for i, cell := range nodeDataCells {
+		if err := exec.checkContext(); err != nil {
+			return nil, err
+		}
+
+		if len(containsExpr.Contains) == 0 {
+			result = append(result, dataRow{
+				id:    uuid.New(),
+				cells: map[string]dataCell{cell.getName(): cell},
+			})
+
+			continue
+		}
+
+		rows, err := exec.processRowsJoin(&nodeDataCells[i], containsExpr.Contains)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot process rows contains expr")
+		}
 
-				result = append(result, row)
+		if containsExpr.Operator != nil && *containsExpr.Operator == aqlprocessor.NOTOperator {
+			if len(rows) == 0 {
+				result = append(result, dataRow{
+					id:    uuid.New(),
+					cells: map[string]dataCell{cell.getName(): cell},
+				})
 			}
+
+			continue
 		}
 
-		// result = append(result, nodeDataCells)
-	default:
-		return nil, fmt.Errorf("unexpected operand type: %T", operand) //nolint
+		for _, r := range rows {
+			r.cells[cell.getName()] = cell
+			result = append(result, r)
+		}
 	}
 
 	return result, nil
 }
 
-func (exec *executer) getDataForClassExpr(node treeindex.Noder, operand aqlprocessor.ClassExpression) ([]dataCell, error) {
-	var (
-		result []dataCell
-		err    error
-	)
+// processRowsLogicalExpr handles the AND, OR and parenthesized containment expressions.
+// AND joins every row of the left branch with every row of the right one, so both branches must match
+// inside the same root. OR returns the rows of both branches, the cells of the other branch are NULL.
+func (exec *executer) processRowsLogicalExpr(rootCell *dataCell, containsExpr *aqlprocessor.ContainsExpr) (dataRows, error) {
+	if containsExpr.Operator == nil || *containsExpr.Operator == aqlprocessor.ANDOperator {
+		return exec.processRowsJoin(rootCell, containsExpr.Contains)
+	}
 
-	if node == nil {
-		result, err = exec.getDataForClassExpression(operand)
-	} else {
-		result, err = exec.getDataForClassExpressionnFromNode(node, operand)
+	if *containsExpr.Operator != aqlprocessor.OROperator {
+		return nil, fmt.Errorf("unexpected contains operator: %v", *containsExpr.Operator) //nolint
 	}
 
-	if err != nil {
-		return nil, err
+	result := dataRows{}
+
+	for _, ce := range containsExpr.Contains {
+		rows, err := exec.processRowsContainsExpr(rootCell, ce)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, rows...)
 	}
 
 	return result, nil
 }
 
-func (exec *executer) getDataForClassExpression(operand aqlprocessor.ClassExpression) ([]dataCell, error) {
-	cells := []dataCell{}
+// processRowsJoin returns the cross join of the rows matching every containment expression.
+func (exec *executer) processRowsJoin(rootCell *dataCell, containsExprs []*aqlprocessor.ContainsExpr) (dataRows, error) {
+	var result dataRows
 
-	switch name := operand.Identifiers[0]; name {
-	case "EHR":
-		ehrs, err := exec.index.GetEHRs("")
+	for i, ce := range containsExprs {
+		rows, err := exec.processRowsContainsExpr(rootCell, ce)
 		if err != nil {
-			return nil, errors.Wrap(err, "cannot get data source for EHRs")
+			return nil, err
 		}
 
-		for _, ehrNode := range ehrs {
-			ok, err := exec.checkNodeByPathPredicate(ehrNode, operand.PathPredicate)
-			if err != nil {
-				return nil, err
-			}
+		if i == 0 {
+			result = rows
+			continue
+		}
 
-			if !ok {
-				continue
-			}
+		joined := make(dataRows, 0, len(result)*len(rows))
 
-			dc := dataCell{
-				name: operand.Identifiers[0],
-				data: ehrNode,
-			}
+		for _, left := range result {
+			for _, right := range rows {
+				row := dataRow{
+					id:    uuid.New(),
+					cells: make(map[string]dataCell, len(left.cells)+len(right.cells)),
+				}
 
-			if len(operand.Identifiers) > 1 {
-				dc.alias = operand.Identifiers[1]
-			}
+				for name, cell := range left.cells {
+					row.cells[name] = cell
+				}
+
+				for name, cell := range right.cells {
+					row.cells[name] = cell
+				}
 
-			cells = append(cells, dc)
+				joined = append(joined, row)
+			}
 		}
-	default:
-		return nil, fmt.Errorf("unexpected data source type: %s", name) //nolint
+
+		result = joined
 	}
 
-	return cells, nil
+	return result, nil
 }
 
-func (exec *executer) getDataForClassExpressionnFromNode(node treeindex.Noder, from aqlprocessor.ClassExpression) ([]dataCell, error) {
-	result := []dataCell{}
+// findNodes returns the nodes of the class contained in the node which are allowed by the indexes.
+func (exec *executer) findNodes(ehr *treeindex.EHRNode, node treeindex.Noder, name, variable string) []treeindex.Noder {
+	if nodes, ok := exec.filter.findNodes(ehr, node, name, variable); ok {
+		return nodes
+	}
 
-	name := from.Identifiers[0]
+	result := []treeindex.Noder{}
 
-	alias := ""
-	if len(from.Identifiers) > 1 {
-		alias = from.Identifiers[1]
+	for _, n := range treeindex.FindByType(ehr, node, name) {
+		if exec.filter.allowNode(variable, n) {
+			result = append(result, n)
+		}
 	}
 
-	var container treeindex.Container
+	return result
+}
 
-	switch node := node.(type) {
-	case *treeindex.EHRNode:
-		container = node.GetCompositions()
-	case *treeindex.CompositionNode:
-		sources, err := node.GetDataSourceByName(name)
-		if err != nil {
-			return nil, errors.Wrap(err, "cannot get sources from compositions node")
-		}
+// getDataForClassExpr returns the cells for the nodes of the class contained in the root cell.
+// Without the root cell, EHR returns all EHRs of the scope and any other class is searched in them.
+func (exec *executer) getDataForClassExpr(rootCell *dataCell, operand aqlprocessor.ClassExpression) ([]dataCell, error) {
+	name := operand.Identifiers[0]
 
-		container = sources
-	default:
-		return nil, fmt.Errorf("not imlemented error for: %T", node) //nolint
+	alias := ""
+	if len(operand.Identifiers) > 1 {
+		alias = operand.Identifiers[1]
 	}
 
-	for _, nodes := range container {
-		for _, node := range nodes {
-			ok, err := exec.checkNodeByPathPredicate(node, from.PathPredicate)
-			if err != nil {
-				return nil, err
-			}
+	type source struct {
+		ehr  *treeindex.EHRNode
+		node treeindex.Noder
+	}
 
-			if !ok {
+	sources := []source{}
+
+	variable := dataCell{name: name, alias: alias}.getName()
+
+	if rootCell != nil {
+		for _, node := range exec.findNodes(rootCell.ehr, rootCell.data, name, variable) {
+			sources = append(sources, source{rootCell.ehr, node})
+		}
+	} else {
+		ehrs, err := exec.getEHRs()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ehrNode := range ehrs {
+			if name == string(base.EHRItemType) {
+				sources = append(sources, source{ehrNode, ehrNode})
 				continue
 			}
 
-			dc := dataCell{
-				name:  name,
-				alias: alias,
-				data:  node,
+			for _, node := range exec.findNodes(ehrNode, ehrNode, name, variable) {
+				sources = append(sources, source{ehrNode, node})
 			}
+		}
+	}
+
+	result := []dataCell{}
+
+	for _, src := range sources {
+		if err := exec.checkContext(); err != nil {
+			return nil, err
+		}
+
+		ok, err := exec.checkNodeByPathPredicate(src.node, operand.PathPredicate)
+		if err != nil {
+			return nil, err
+		}
 
-			result = append(result, dc)
+		if !ok {
+			continue
 		}
+
+		result = append(result, dataCell{
+			name:  name,
+			alias: alias,
+			data:  src.node,
+			ehr:   src.ehr,
+		})
 	}
 
+	exec.plan.countSource(variable, len(sources), len(result))
+
 	return result, nil
 }
 
-func (exec *executer) checkNodeByPathPredicate(node treeindex.Noder, pathPredicate *aqlprocessor.PathPredicate) (bool, error) {
-	if pathPredicate == nil {
-		return true, nil
-	}
+// getDataForVersionClassExpr returns the cells for the composition versions contained in the root cell or in all EHRs.
+// Without the version predicate only the latest versions are returned, as for LATEST_VERSION.
+// The standard predicate is checked against all versions.
+func (exec *executer) getDataForVersionClassExpr(rootCell *dataCell, operand aqlprocessor.VersionClassExpr) ([]dataCell, error) {
+	name := treeindex.VERSION
 
-	switch pathPredicate.Type {
-	case aqlprocessor.StandartPathPredicate:
-		return exec.checkNodeByStandartPathPredicate(node, pathPredicate.StandartPredicate)
-	case aqlprocessor.ArchetypedPathPredicate:
-		return exec.checkNodeByArchetypePredicate(node, pathPredicate.Archetype)
-	case aqlprocessor.NodePathPredicate:
-	default:
-		return false, fmt.Errorf("unexpected PathPredicate Type: %v", pathPredicate.Type) //nolint
+	alias := ""
+	if operand.Variable != nil {
+		alias = *operand.Variable
 	}
 
-	return false, errors.New("not implemented")
-}
+	latest := true
 
-func (exec *executer) checkNodeByStandartPathPredicate(node treeindex.Noder, predicate *aqlprocessor.StandartPredicate) (bool, error) {
-	val, ok := getValueForPath(predicate.ObjectPath, node)
-	if !ok {
-		return false, nil
+	var standartPredicate *aqlprocessor.PathPredicate
+
+	if p := operand.VersionPredicate; p != nil {
+		switch p.Type {
+		case aqlprocessor.LatestVersionPredicate:
+		case aqlprocessor.AllVersionsPredicate:
+			latest = false
+		case aqlprocessor.StandartPathPredicate:
+			latest = false
+			standartPredicate = p
+		default:
+			return nil, fmt.Errorf("unexpected version predicate type: %v", p.Type) //nolint
+		}
 	}
 
-	if predicate.Operand != nil {
-		if param := predicate.Operand.Parameter; param != nil {
-			paramVal, ok := exec.params[string(*param)]
-			if !ok {
-				return false, nil
-			}
+	var roots []dataCell
 
-			if reflect.TypeOf(paramVal) == reflect.TypeOf(val) {
-				switch pv := paramVal.(type) {
-				case string:
-					return pv == val.(string), nil
-				default:
-					return false, fmt.Errorf("unexpected type: %T", paramVal) //nolint
-				}
-			}
+	if rootCell != nil {
+		roots = []dataCell{*rootCell}
+	} else {
+		ehrs, err := exec.getEHRs()
+		if err != nil {
+			return nil, err
 		}
 
-		return false, errors.New("standart predicate operand operations are not implemented")
+		for _, ehrNode := range ehrs {
+			roots = append(roots, dataCell{data: ehrNode, ehr: ehrNode})
+		}
 	}
 
-	return false, errors.New("unexpected standart predicate state")
-}
+	result := []dataCell{}
 
-func (exec *executer) checkNodeByArchetypePredicate(node treeindex.Noder, predicate *aqlprocessor.ArchetypePathPredicate) (bool, error) {
-	targetArchetypeID := ""
-	if predicate.ArchetypeHRID != nil {
-		targetArchetypeID = *predicate.ArchetypeHRID
-	} else if predicate.Parameter != nil {
-		paramVal, ok := exec.params[string(*predicate.Parameter)]
-		if !ok {
-			return false, nil
-		}
+	candidates := 0
 
-		targetArchetypeID, ok = paramVal.(string)
-		if !ok {
-			return false, nil
+	for _, root := range roots {
+		if err := exec.checkContext(); err != nil {
+			return nil, err
 		}
-	} else {
-		return false, errors.New("unexpected archetype predicate state")
-	}
 
-	nodeArchetypeID := node.TryGetChild("archetype_node_id")
-	if nodeArchetypeID == nil {
-		return false, nil
-	}
+		versions := treeindex.FindVersions(root.ehr, root.data, latest)
+		candidates += len(versions)
+
+		for _, node := range versions {
+			ok, err := exec.checkNodeByPathPredicate(node, standartPredicate)
+			if err != nil {
+				return nil, err
+			}
+
+			if !ok {
+				continue
+			}
 
-	valueNode, ok := nodeArchetypeID.(*treeindex.ValueNode)
-	if !ok {
-		return false, errors.New("invalid  archetype_node_id type")
+			result = append(result, dataCell{
+				name:  name,
+				alias: alias,
+				data:  node,
+				ehr:   root.ehr,
+			})
+		}
 	}
 
-	return valueNode.GetData().(string) == targetArchetypeID, nil
+	exec.plan.countSource(dataCell{name: name, alias: alias}.getName(), candidates, len(result))
+
+	return result, nil
 }
@@ -0,0 +1,451 @@
+package aqlquerier
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/errors"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/storage/treeindex"
+)
+
+// Function is an AQL function implementation. Arguments are already evaluated,
+// NULL arguments are passed as nil.
+type Function func(args ...any) (any, error)
+
+// FunctionRegistry holds the functions available in AQL queries by their upper-case names.
+type FunctionRegistry struct {
+	mu        sync.RWMutex
+	functions map[string]Function
+}
+
+var DefaultFunctionRegistry = newDefaultFunctionRegistry()
+
+func NewFunctionRegistry() *FunctionRegistry {
+	return &FunctionRegistry{
+		functions: map[string]Function{},
+	}
+}
+
+// RegisterFunction adds the function into the default registry, an existing function with the same name is replaced.
+func RegisterFunction(name string, fn Function) {
+	DefaultFunctionRegistry.Register(name, fn)
+}
+
+func (r *FunctionRegistry) Register(name string, fn Function) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.functions[strings.ToUpper(name)] = fn
+}
+
+func (r *FunctionRegistry) Get(name string) (Function, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	fn, ok := r.functions[strings.ToUpper(name)]
+
+	return fn, ok
+}
+
+func (r *FunctionRegistry) Call(name string, args ...any) (any, error) {
+	fn, ok := r.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown function: %s", name) //nolint
+	}
+
+	result, err := fn(args...)
+	if err != nil {
+		return nil, fmt.Errorf("function %s error: %w", name, err)
+	}
+
+	return result, nil
+}
+
+func newDefaultFunctionRegistry() *FunctionRegistry {
+	r := NewFunctionRegistry()
+
+	// string functions
+	r.Register("LENGTH", fnLength)
+	r.Register("CONTAINS", fnContains)
+	r.Register("POSITION", fnPosition)
+	r.Register("SUBSTRING", fnSubstring)
+	r.Register("CONCAT", fnConcat)
+	r.Register("CONCAT_WS", fnConcatWS)
+
+	// numeric functions
+	r.Register("ABS", numericFunc(math.Abs))
+	r.Register("CEIL", numericFunc(math.Ceil))
+	r.Register("FLOOR", numericFunc(math.Floor))
+	r.Register("MOD", fnMod)
+	r.Register("ROUND", fnRound)
+
+	// date and time functions
+	r.Register("CURRENT_DATE", fnCurrentDate)
+	r.Register("CURRENT_TIME", fnCurrentTime)
+	r.Register("CURRENT_DATE_TIME", fnNow)
+	r.Register("NOW", fnNow)
+	r.Register("CURRENT_TIMEZONE", fnCurrentTimezone)
+
+	return r
+}
+
+// now is replaced in tests
+var now = time.Now
+
+func checkArgsCount(args []any, min, max int) error {
+	if len(args) < min || len(args) > max {
+		if min == max {
+			return fmt.Errorf("expected %d arguments, got %d", min, len(args)) //nolint
+		}
+
+		return fmt.Errorf("expected from %d to %d arguments, got %d", min, max, len(args)) //nolint
+	}
+
+	return nil
+}
+
+func hasNil(args []any) bool {
+	for _, a := range args {
+		if a == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+func toString(val any) (string, error) {
+	switch v := val.(type) {
+	case string:
+		return v, nil
+	case *string:
+		return *v, nil
+	default:
+		return "", fmt.Errorf("value of type %T is not a string", val) //nolint
+	}
+}
+
+func toInt(val any) (int, error) {
+	switch v, _ := treeindex.Number(val); v := v.(type) {
+	case int:
+		return v, nil
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, fmt.Errorf("value %v is not an integer", v) //nolint
+		}
+
+		return int(v), nil
+	default:
+		return 0, fmt.Errorf("value of type %T is not an integer", val) //nolint
+	}
+}
+
+func fnLength(args ...any) (any, error) {
+	if err := checkArgsCount(args, 1, 1); err != nil {
+		return nil, err
+	}
+
+	if hasNil(args) {
+		return nil, nil
+	}
+
+	s, err := toString(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return len([]rune(s)), nil
+}
+
+// fnContains returns true when the first string argument contains the second one.
+func fnContains(args ...any) (any, error) {
+	if err := checkArgsCount(args, 2, 2); err != nil {
+		return nil, err
+	}
+
+	if hasNil(args) {
+		return nil, nil
+	}
+
+	s, err := toString(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	substr, err := toString(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.Contains(s, substr), nil
+}
+
+// fnPosition returns the 1-based position of the first argument in the second one, or 0 when it is not found.
+func fnPosition(args ...any) (any, error) {
+	if err := checkArgsCount(args, 2, 2); err != nil {
+		return nil, err
+	}
+
+	if hasNil(args) {
+		return nil, nil
+	}
+
+	substr, err := toString(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := toString(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	i := strings.Index(s, substr)
+	if i < 0 {
+		return 0, nil
+	}
+
+	return len([]rune(s[:i])) + 1, nil
+}
+
+// fnSubstring returns the part of the string from the 1-based start position with an optional length.
+func fnSubstring(args ...any) (any, error) {
+	if err := checkArgsCount(args, 2, 3); err != nil {
+		return nil, err
+	}
+
+	if hasNil(args) {
+		return nil, nil
+	}
+
+	s, err := toString(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	start, err := toInt(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	runes := []rune(s)
+
+	from := start - 1
+	to := len(runes)
+
+	if len(args) == 3 {
+		length, err := toInt(args[2])
+		if err != nil {
+			return nil, err
+		}
+
+		if length < 0 {
+			return nil, fmt.Errorf("negative substring length: %d", length) //nolint
+		}
+
+		to = from + length
+	}
+
+	if from < 0 {
+		from = 0
+	}
+
+	if to > len(runes) {
+		to = len(runes)
+	}
+
+	if from >= to {
+		return "", nil
+	}
+
+	return string(runes[from:to]), nil
+}
+
+// fnConcat concatenates the arguments, NULL arguments are skipped.
+func fnConcat(args ...any) (any, error) {
+	return concat("", args)
+}
+
+// fnConcatWS concatenates the arguments with the separator given in the first argument, NULL arguments are skipped.
+func fnConcatWS(args ...any) (any, error) {
+	if len(args) < 1 {
+		return nil, errors.New("separator argument is expected")
+	}
+
+	if args[0] == nil {
+		return nil, nil
+	}
+
+	sep, err := toString(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return concat(sep, args[1:])
+}
+
+func concat(sep string, args []any) (any, error) {
+	parts := make([]string, 0, len(args))
+
+	for _, a := range args {
+		if a == nil {
+			continue
+		}
+
+		if s, err := toString(a); err == nil {
+			parts = append(parts, s)
+		} else {
+			parts = append(parts, fmt.Sprint(a))
+		}
+	}
+
+	return strings.Join(parts, sep), nil
+}
+
+// numericFunc makes a function of one numeric argument. Integer arguments give integer results.
+func numericFunc(fn func(float64) float64) Function {
+	return func(args ...any) (any, error) {
+		if err := checkArgsCount(args, 1, 1); err != nil {
+			return nil, err
+		}
+
+		if args[0] == nil {
+			return nil, nil
+		}
+
+		switch v, _ := treeindex.Number(args[0]); v := v.(type) {
+		case int:
+			return int(fn(float64(v))), nil
+		case float64:
+			return fn(v), nil
+		default:
+			return nil, fmt.Errorf("value of type %T is not a number", args[0]) //nolint
+		}
+	}
+}
+
+func fnMod(args ...any) (any, error) {
+	if err := checkArgsCount(args, 2, 2); err != nil {
+		return nil, err
+	}
+
+	if hasNil(args) {
+		return nil, nil
+	}
+
+	nx, _ := treeindex.Number(args[0])
+	ny, _ := treeindex.Number(args[1])
+
+	x, xIsInt := nx.(int)
+	y, yIsInt := ny.(int)
+
+	if xIsInt && yIsInt {
+		if y == 0 {
+			return nil, errors.New("division by zero")
+		}
+
+		return x % y, nil
+	}
+
+	fx, err := toFloat(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	fy, err := toFloat(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	if fy == 0 {
+		return nil, errors.New("division by zero")
+	}
+
+	return math.Mod(fx, fy), nil
+}
+
+// fnRound rounds the number half away from zero to the given count of decimal places, 0 by default.
+func fnRound(args ...any) (any, error) {
+	if err := checkArgsCount(args, 1, 2); err != nil {
+		return nil, err
+	}
+
+	if hasNil(args) {
+		return nil, nil
+	}
+
+	places := 0
+
+	if len(args) == 2 {
+		p, err := toInt(args[1])
+		if err != nil {
+			return nil, err
+		}
+
+		places = p
+	}
+
+	n, _ := treeindex.Number(args[0])
+	if v, ok := n.(int); ok && places >= 0 {
+		return v, nil
+	}
+
+	v, err := toFloat(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	pow := math.Pow(10, float64(places))
+
+	return math.Round(v*pow) / pow, nil
+}
+
+func toFloat(val any) (float64, error) {
+	switch v, _ := treeindex.Number(val); v := v.(type) {
+	case int:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	default:
+		return 0, fmt.Errorf("value of type %T is not a number", val) //nolint
+	}
+}
+
+func fnCurrentDate(args ...any) (any, error) {
+	if err := checkArgsCount(args, 0, 0); err != nil {
+		return nil, err
+	}
+
+	t := now()
+
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()), nil
+}
+
+func fnCurrentTime(args ...any) (any, error) {
+	if err := checkArgsCount(args, 0, 0); err != nil {
+		return nil, err
+	}
+
+	t := now()
+
+	return time.Date(0, 1, 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location()), nil
+}
+
+func fnNow(args ...any) (any, error) {
+	if err := checkArgsCount(args, 0, 0); err != nil {
+		return nil, err
+	}
+
+	return now(), nil
+}
+
+func fnCurrentTimezone(args ...any) (any, error) {
+	if err := checkArgsCount(args, 0, 0); err != nil {
+		return nil, err
+	}
+
+	return now().Format("-07:00"), nil
+}
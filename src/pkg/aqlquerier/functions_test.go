@@ -0,0 +1,80 @@
+package aqlquerier
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFunctionRegistry_Call(t *testing.T) {
+	current := time.Date(2022, 12, 5, 15, 35, 10, 0, time.FixedZone("", 3*60*60))
+
+	now = func() time.Time { return current }
+	defer func() { now = time.Now }()
+
+	tests := []struct {
+		name    string
+		fn      string
+		args    []any
+		want    any
+		wantErr bool
+	}{
+		{"1. LENGTH", "LENGTH", []any{"привет"}, 6, false},
+		{"2. LENGTH of NULL", "length", []any{nil}, nil, false},
+		{"3. LENGTH of number", "LENGTH", []any{1}, nil, true},
+		{"4. CONTAINS", "CONTAINS", []any{"hello world", "o w"}, true, false},
+		{"5. POSITION", "POSITION", []any{"world", "hello world"}, 7, false},
+		{"6. POSITION not found", "POSITION", []any{"abc", "hello world"}, 0, false},
+		{"7. SUBSTRING", "SUBSTRING", []any{"hello world", 7}, "world", false},
+		{"8. SUBSTRING with length", "SUBSTRING", []any{"hello world", 1, 5}, "hello", false},
+		{"9. SUBSTRING out of range", "SUBSTRING", []any{"hello", 10, 5}, "", false},
+		{"10. CONCAT skips NULL", "CONCAT", []any{"a", nil, "b", 1}, "ab1", false},
+		{"11. CONCAT_WS", "CONCAT_WS", []any{", ", "a", "b"}, "a, b", false},
+		{"12. ABS int", "ABS", []any{-5}, 5, false},
+		{"13. ABS float", "ABS", []any{-5.5}, 5.5, false},
+		{"14. CEIL", "CEIL", []any{1.2}, 2.0, false},
+		{"15. FLOOR", "FLOOR", []any{-1.2}, -2.0, false},
+		{"16. MOD int", "MOD", []any{7, 3}, 1, false},
+		{"17. MOD float", "MOD", []any{7.5, 2}, 1.5, false},
+		{"18. MOD by zero", "MOD", []any{7, 0}, nil, true},
+		{"19. ROUND", "ROUND", []any{2.5}, 3.0, false},
+		{"20. ROUND with places", "ROUND", []any{3.14159, 2}, 3.14, false},
+		{"21. CURRENT_DATE", "CURRENT_DATE", nil, time.Date(2022, 12, 5, 0, 0, 0, 0, current.Location()), false},
+		{"22. NOW", "NOW", nil, current, false},
+		{"23. CURRENT_TIMEZONE", "CURRENT_TIMEZONE", nil, "+03:00", false},
+		{"24. wrong arguments count", "NOW", []any{1}, nil, true},
+		{"25. unknown function", "FOO", nil, nil, true},
+		{"26. ABS int64", "ABS", []any{int64(-3)}, 3, false},
+		{"27. MOD of integers of other widths", "MOD", []any{int64(7), uint8(3)}, 1, false},
+		{"28. ROUND int64", "ROUND", []any{int64(5)}, 5, false},
+		{"29. SUBSTRING with int32 position", "SUBSTRING", []any{"hello world", int32(7)}, "world", false},
+		{"30. FLOOR float32", "FLOOR", []any{float32(1.5)}, 1.0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DefaultFunctionRegistry.Call(tt.fn, tt.args...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Call() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFunctionRegistry_Register(t *testing.T) {
+	r := NewFunctionRegistry()
+	r.Register("double", func(args ...any) (any, error) {
+		return args[0].(int) * 2, nil
+	})
+
+	got, err := r.Call("DOUBLE", 21)
+	assert.NoError(t, err)
+	assert.Equal(t, 42, got)
+
+	_, ok := r.Get("LENGTH")
+	assert.False(t, ok)
+}
@@ -0,0 +1,358 @@
+package aqlquerier
+
+import (
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/aqlprocessor"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model/base"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/storage/treeindex"
+)
+
+// indexFilter has the nodes of the class expressions and the EHRs left after the lookups in the secondary indexes
+// of the tree index. The other nodes can not match the archetype predicate of the class expression
+// or the WHERE conditions on its values, so they are skipped before the conditions are evaluated.
+type indexFilter struct {
+	index *treeindex.EHRIndex
+
+	nodes      map[string]map[treeindex.Noder]string // variable -> nodes with EHR ids
+	archetypes map[string]string                     // variable -> archetype id
+
+	// ehrs are the EHRs having the nodes of every class expression required by the containment, nil if all EHRs are allowed
+	ehrs map[string]bool
+}
+
+// indexedSource is the class expression of the FROM containment which nodes are found by the archetype id.
+type indexedSource struct {
+	variable    string
+	archetypeID string
+
+	// required is true when every row has the cell of the class expression, i.e. it is not inside OR
+	required bool
+}
+
+var notIndexedClasses = map[string]bool{
+	string(base.EHRItemType):        true,
+	treeindex.FOLDER:                true,
+	treeindex.VERSION:               true,
+	treeindex.VERSIONED_OBJECT:      true,
+	treeindex.VERSIONED_COMPOSITION: true,
+}
+
+func (exec *executer) newIndexFilter() *indexFilter {
+	if exec.index == nil {
+		return nil
+	}
+
+	variables := map[string]int{}
+	countContainsVariables(&exec.query.From.ContainsExpr, variables)
+
+	sources := []indexedSource{}
+	exec.collectIndexedSources(&exec.query.From.ContainsExpr, true, &sources)
+
+	var where []*aqlprocessor.IdentifiedExpr
+	if exec.query.Where != nil {
+		where = getWhereConjunction(exec.query.Where)
+	}
+
+	filter := &indexFilter{
+		index:      exec.index,
+		nodes:      map[string]map[treeindex.Noder]string{},
+		archetypes: map[string]string{},
+	}
+
+	for _, src := range sources {
+		// the cells of the class expressions without alias of the same class are shared
+		if variables[src.variable] != 1 {
+			continue
+		}
+
+		nodes := exec.index.FindByArchetype(src.archetypeID)
+
+		for _, ie := range where {
+			path, op, val, ok := exec.getIndexCondition(ie, src.variable)
+			if !ok {
+				continue
+			}
+
+			found, ok := exec.index.FindByValue(src.archetypeID, path, op, val)
+			if !ok {
+				continue
+			}
+
+			for node := range nodes {
+				if _, ok := found[node]; !ok {
+					delete(nodes, node)
+				}
+			}
+		}
+
+		filter.nodes[src.variable] = nodes
+		filter.archetypes[src.variable] = src.archetypeID
+
+		if exec.plan != nil {
+			if planSource, ok := exec.plan.sources[src.variable]; ok {
+				planSource.Indexed = true
+			}
+		}
+
+		if !src.required {
+			continue
+		}
+
+		ehrs := map[string]bool{}
+
+		for _, ehrID := range nodes {
+			if filter.ehrs == nil || filter.ehrs[ehrID] {
+				ehrs[ehrID] = true
+			}
+		}
+
+		filter.ehrs = ehrs
+	}
+
+	if len(filter.nodes) == 0 {
+		return nil
+	}
+
+	return filter
+}
+
+// allowNode checks the node of the class expression is found by the indexes.
+func (f *indexFilter) allowNode(variable string, node treeindex.Noder) bool {
+	if f == nil {
+		return true
+	}
+
+	nodes, ok := f.nodes[variable]
+	if !ok {
+		return true
+	}
+
+	_, ok = nodes[node]
+
+	return ok
+}
+
+// findNodes returns the nodes of the class expression contained in the EHR or the composition as FindByType does.
+// The nodes are taken from the ones found by the indexes in the compositions, so the compositions are not walked.
+// It returns false if the nodes of the variable are not found by the indexes or the containment is not resolved by them,
+// e.g. inside the VERSION or the FOLDER.
+func (f *indexFilter) findNodes(ehr *treeindex.EHRNode, node treeindex.Noder, name, variable string) ([]treeindex.Noder, bool) {
+	if f == nil || ehr == nil || name == treeindex.COMPOSITION {
+		return nil, false
+	}
+
+	allowed, ok := f.nodes[variable]
+	if !ok {
+		return nil, false
+	}
+
+	var compositions []treeindex.Noder
+
+	switch node := node.(type) {
+	case *treeindex.EHRNode:
+		compositions = treeindex.FindByType(node, node, treeindex.COMPOSITION)
+	case *treeindex.CompositionNode:
+		compositions = []treeindex.Noder{node}
+	default:
+		return nil, false
+	}
+
+	result := []treeindex.Noder{}
+
+	for _, cmp := range compositions {
+		nodes, ok := f.index.FindInContent(ehr.ID, cmp, f.archetypes[variable])
+		if !ok {
+			return nil, false
+		}
+
+		for _, n := range nodes {
+			if obj, ok := n.(*treeindex.ObjectNode); !ok || string(obj.Type) != name {
+				continue
+			}
+
+			if _, ok := allowed[n]; ok {
+				result = append(result, n)
+			}
+		}
+	}
+
+	return result, true
+}
+
+// allowEHR checks the EHR has the nodes of the class expressions required by the containment.
+func (f *indexFilter) allowEHR(ehrID string) bool {
+	return f == nil || f.ehrs == nil || f.ehrs[ehrID]
+}
+
+// collectIndexedSources collects the class expressions with the archetype id predicate.
+// The class expressions inside NOT CONTAINS are not collected, their nodes are needed to exclude the rows.
+func (exec *executer) collectIndexedSources(containsExpr *aqlprocessor.ContainsExpr, required bool, sources *[]indexedSource) {
+	if operand, ok := containsExpr.Operand.(aqlprocessor.ClassExpression); ok && !notIndexedClasses[operand.Identifiers[0]] {
+		if archetypeID, ok := exec.getPredicateArchetypeID(operand.PathPredicate); ok {
+			src := indexedSource{
+				variable:    operand.Identifiers[0],
+				archetypeID: archetypeID,
+				required:    required,
+			}
+
+			if len(operand.Identifiers) > 1 {
+				src.variable = operand.Identifiers[1]
+			}
+
+			*sources = append(*sources, src)
+		}
+	}
+
+	if op := containsExpr.Operator; op != nil {
+		switch {
+		case *op == aqlprocessor.NOTOperator:
+			return
+		case *op == aqlprocessor.OROperator && containsExpr.Operand == nil:
+			required = false
+		}
+	}
+
+	for _, ce := range containsExpr.Contains {
+		exec.collectIndexedSources(ce, required, sources)
+	}
+}
+
+func countContainsVariables(containsExpr *aqlprocessor.ContainsExpr, variables map[string]int) {
+	switch operand := containsExpr.Operand.(type) {
+	case aqlprocessor.ClassExpression:
+		variables[operand.Identifiers[len(operand.Identifiers)-1]]++
+	case aqlprocessor.VersionClassExpr:
+		if operand.Variable != nil {
+			variables[*operand.Variable]++
+		} else {
+			variables[treeindex.VERSION]++
+		}
+	}
+
+	for _, ce := range containsExpr.Contains {
+		countContainsVariables(ce, variables)
+	}
+}
+
+// getPredicateArchetypeID returns the archetype_node_id the node must have to match the predicate of the class expression.
+func (exec *executer) getPredicateArchetypeID(predicate *aqlprocessor.PathPredicate) (string, bool) {
+	if predicate == nil {
+		return "", false
+	}
+
+	switch predicate.Type {
+	case aqlprocessor.ArchetypedPathPredicate:
+		if predicate.Archetype.ArchetypeHRID != nil {
+			return *predicate.Archetype.ArchetypeHRID, true
+		}
+
+		if predicate.Archetype.Parameter != nil {
+			return exec.getStringParam(*predicate.Archetype.Parameter)
+		}
+	case aqlprocessor.NodePathPredicate:
+		return exec.getNodePredicateID(predicate.NodePredicate)
+	}
+
+	return "", false
+}
+
+// getNodePredicateID returns the archetype_node_id of the node predicate, e.g. 'at0004' of [at0004, 'Systolic'].
+// One of the node ids joined by AND is enough.
+func (exec *executer) getNodePredicateID(np *aqlprocessor.NodePredicate) (string, bool) {
+	if np == nil {
+		return "", false
+	}
+
+	switch {
+	case np.Operator == aqlprocessor.ANDOperator:
+		for _, next := range np.Next {
+			if id, ok := exec.getNodePredicateID(next); ok {
+				return id, true
+			}
+		}
+
+		return "", false
+	case np.Operator == aqlprocessor.OROperator:
+		return "", false
+	case np.AtCode != nil:
+		return np.AtCode.ToString(), true
+	case np.IDCode != nil:
+		return np.IDCode.ToString(), true
+	case np.ArchetypeHRID != nil:
+		return *np.ArchetypeHRID, true
+	case np.Parameter != nil:
+		return exec.getStringParam(*np.Parameter)
+	default:
+		return "", false
+	}
+}
+
+func (exec *executer) getStringParam(name aqlprocessor.Parameter) (string, bool) {
+	val, ok := exec.params[string(name)]
+	if !ok {
+		return "", false
+	}
+
+	s, ok := val.(string)
+
+	return s, ok
+}
+
+// getIndexCondition returns the comparison of the WHERE condition which can be looked up in the value indexes:
+// the value at the path of the variable compared with the primitive or the parameter.
+func (exec *executer) getIndexCondition(ie *aqlprocessor.IdentifiedExpr, variable string) ([]treeindex.PathPart, treeindex.CompareOperator, any, bool) {
+	for ie.Next != nil {
+		ie = ie.Next
+	}
+
+	ip := ie.IdentifiedPath
+
+	switch {
+	case ip == nil || ip.Identifier != variable || ip.ObjectPath == nil,
+		ie.ComparisonOperator == nil || ie.Terminal == nil,
+		ie.FunctionCall != nil || ie.Like != nil || len(ie.Matches) > 0,
+		ie.IsExists != nil && *ie.IsExists:
+		return nil, "", nil, false
+	}
+
+	var op treeindex.CompareOperator
+
+	switch *ie.ComparisonOperator {
+	case aqlprocessor.SymEQ:
+		op = treeindex.OpEQ
+	case aqlprocessor.SymLT:
+		op = treeindex.OpLT
+	case aqlprocessor.SymLE:
+		op = treeindex.OpLE
+	case aqlprocessor.SymGT:
+		op = treeindex.OpGT
+	case aqlprocessor.SymGE:
+		op = treeindex.OpGE
+	default:
+		return nil, "", nil, false
+	}
+
+	var val any
+
+	switch term := ie.Terminal; {
+	case term.Primitive != nil:
+		val = term.Primitive.Val
+	case term.Parameter != nil:
+		paramVal, ok := exec.params[string(*term.Parameter)]
+		if !ok {
+			return nil, "", nil, false
+		}
+
+		val = paramVal
+	default:
+		return nil, "", nil, false
+	}
+
+	path := make([]treeindex.PathPart, 0, len(ip.ObjectPath.Paths))
+
+	for _, part := range ip.ObjectPath.Paths {
+		nodeID, _ := exec.getPredicateArchetypeID(part.PathPredicate)
+		path = append(path, treeindex.PathPart{Attribute: part.Identifier, NodeID: nodeID})
+	}
+
+	return path, op, val, true
+}
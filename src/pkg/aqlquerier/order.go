@@ -0,0 +1,96 @@
+package aqlquerier
+
+import (
+	"sort"
+
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/aqlprocessor"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/storage/treeindex"
+)
+
+// orderRows sorts the rows by the ORDER BY expressions, one key after another.
+//
+// NULL values are treated as greater than any other value: they go last in ascending
+// order and first in descending order. Values of different kinds are ordered by kind:
+// booleans, numbers, date/times, strings.
+func (exec *executer) orderRows(rows *Rows) (*Rows, error) {
+	if exec.query.Order == nil || len(exec.query.Order.Orders) == 0 {
+		return rows, nil
+	}
+
+	orders := exec.query.Order.Orders
+
+	sort.SliceStable(rows.rows, func(i, j int) bool {
+		left, right := rows.rows[i].orderKeys, rows.rows[j].orderKeys
+
+		for k, order := range orders {
+			c := treeindex.CompareOrderKeys(left[k], right[k])
+			if c == 0 {
+				continue
+			}
+
+			if order.Ordering == aqlprocessor.DescendingOrdering {
+				return c > 0
+			}
+
+			return c < 0
+		}
+
+		return false
+	})
+
+	return rows, nil
+}
+
+// getOrderKeys returns the values of the ORDER BY expressions for the data row.
+// An expression without path may refer to a SELECT column alias.
+func (exec *executer) getOrderKeys(source dataRow, row Row) []any {
+	if exec.query.Order == nil {
+		return nil
+	}
+
+	keys := make([]any, 0, len(exec.query.Order.Orders))
+
+	for _, order := range exec.query.Order.Orders {
+		var key any
+
+		ip := order.IdentifierPath
+
+		if cell, ok := source.cells[ip.Identifier]; ok {
+			if ip.ObjectPath != nil {
+				if node, ok := exec.getNodeForPath(ip.ObjectPath, cell.data); ok {
+					key = exec.getOrderKey(node)
+				}
+			}
+		} else if ip.ObjectPath == nil {
+			for i, se := range exec.query.Select.SelectExprs {
+				if se.AliasName == ip.Identifier && i < len(row.values) {
+					key = treeindex.OrderKey(row.values[i])
+					break
+				}
+			}
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// getOrderKey returns the comparable value of the node.
+// Data values are compared by their main attribute, e.g. DV_QUANTITY by magnitude.
+func (exec *executer) getOrderKey(node treeindex.Noder) any {
+	switch node := node.(type) {
+	case *treeindex.ValueNode:
+		return treeindex.OrderKey(exec.reveal(node.GetData()))
+	case *treeindex.DataValueNode:
+		// DV_QUANTITY, DV_COUNT and other quantified values are ordered by magnitude,
+		// DV_DATE_TIME, DV_TEXT and the rest by value
+		for _, attr := range []string{"magnitude", "value"} {
+			if v, ok := node.TryGetChild(attr).(*treeindex.ValueNode); ok {
+				return treeindex.OrderKey(exec.reveal(v.GetData()))
+			}
+		}
+	}
+
+	return nil
+}
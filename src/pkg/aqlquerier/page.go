@@ -0,0 +1,49 @@
+package aqlquerier
+
+import "context"
+
+type pageContextKey struct{}
+
+// Page is the part of the query result requested by the caller, e.g. with the offset and fetch of the REST request.
+// It is applied to the rows left after the LIMIT and OFFSET of the query itself.
+type Page struct {
+	Offset int
+	Fetch  int // 0 means all the rows after the offset
+}
+
+// WithPage returns the context making the queries executed with it return the page of their rows only.
+func WithPage(ctx context.Context, offset, fetch int) context.Context {
+	return context.WithValue(ctx, pageContextKey{}, &Page{Offset: offset, Fetch: fetch})
+}
+
+func pageFromContext(ctx context.Context) *Page {
+	if ctx == nil {
+		return nil
+	}
+
+	page, _ := ctx.Value(pageContextKey{}).(*Page)
+
+	return page
+}
+
+// pageRows leaves the rows of the requested page.
+func (exec *executer) pageRows(rows *Rows) *Rows {
+	if exec.page == nil {
+		return rows
+	}
+
+	offset := exec.page.Offset
+	if offset > len(rows.rows) {
+		offset = len(rows.rows)
+	}
+
+	if offset > 0 {
+		rows.rows = rows.rows[offset:]
+	}
+
+	if fetch := exec.page.Fetch; fetch > 0 && fetch < len(rows.rows) {
+		rows.rows = rows.rows[:fetch]
+	}
+
+	return rows
+}
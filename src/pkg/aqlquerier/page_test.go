@@ -0,0 +1,42 @@
+package aqlquerier
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithPage(t *testing.T) {
+	require.NoError(t, getPreparedTreeIndex("test_fixtures/composition_2.json"))
+
+	conn, err := sqlx.Open("aql", "")
+	require.NoError(t, err)
+
+	defer conn.Close()
+
+	query := `SELECT o/archetype_node_id
+		FROM EHR e CONTAINS COMPOSITION c CONTAINS OBSERVATION o
+		ORDER BY o/archetype_node_id
+		LIMIT 4 OFFSET 1`
+
+	queryRows := func(ctx context.Context) [][]any {
+		rows, err := conn.QueryxContext(ctx, query)
+		require.NoError(t, err)
+
+		got, err := scanSortedSlices(rows)
+		require.NoError(t, err)
+
+		return got.([][]any)
+	}
+
+	all := queryRows(context.Background())
+	require.Len(t, all, 4)
+
+	// the page is taken from the rows limited by the query itself
+	assert.Equal(t, all[1:3], queryRows(WithPage(context.Background(), 1, 2)))
+	assert.Equal(t, all[3:], queryRows(WithPage(context.Background(), 3, 0)))
+	assert.Empty(t, queryRows(WithPage(context.Background(), 10, 2)))
+}
@@ -0,0 +1,251 @@
+package aqlquerier
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/aqlprocessor"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/errors"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/storage/treeindex"
+)
+
+// checkNodeByPathPredicate checks the node against the predicate of the class expression or of the path part.
+func (exec *executer) checkNodeByPathPredicate(node treeindex.Noder, pathPredicate *aqlprocessor.PathPredicate) (bool, error) {
+	if pathPredicate == nil {
+		return true, nil
+	}
+
+	switch pathPredicate.Type {
+	case aqlprocessor.StandartPathPredicate:
+		return exec.checkNodeByStandartPathPredicate(node, pathPredicate.StandartPredicate)
+	case aqlprocessor.ArchetypedPathPredicate:
+		return exec.checkNodeByArchetypePredicate(node, pathPredicate.Archetype)
+	case aqlprocessor.NodePathPredicate:
+		return exec.checkNodeByNodePredicate(node, pathPredicate.NodePredicate)
+	default:
+		return false, fmt.Errorf("unexpected PathPredicate Type: %v", pathPredicate.Type) //nolint
+	}
+}
+
+func (exec *executer) checkNodeByStandartPathPredicate(node treeindex.Noder, predicate *aqlprocessor.StandartPredicate) (bool, error) {
+	if predicate.Operand == nil {
+		return false, errors.New("unexpected standart predicate state")
+	}
+
+	return exec.checkNodeByComparison(node, predicate.ObjectPath, predicate.CMPOperator, predicate.Operand)
+}
+
+// checkNodeByComparison compares the value at the path of the node with the predicate operand.
+func (exec *executer) checkNodeByComparison(node treeindex.Noder, path *aqlprocessor.ObjectPath, cmpOperator aqlprocessor.ComparisionSymbol, operand *aqlprocessor.PathPredicateOperand) (bool, error) {
+	val, ok := exec.getComparableValueForPath(path, node)
+	if !ok {
+		return false, nil
+	}
+
+	switch {
+	case operand.Primitive != nil:
+		return exec.compareValues(val, operand.Primitive.Val, cmpOperator), nil
+	case operand.Parameter != nil:
+		paramVal, ok := exec.params[string(*operand.Parameter)]
+		if !ok {
+			return false, nil
+		}
+
+		return exec.compareValues(val, paramVal, cmpOperator), nil
+	case operand.ObjectPath != nil:
+		pathVal, _ := exec.getValueForPath(operand.ObjectPath, node)
+		return exec.compareValues(val, pathVal, cmpOperator), nil
+	case operand.AtCode != nil:
+		return exec.compareValues(val, "at"+*operand.AtCode, cmpOperator), nil
+	case operand.IDCode != nil:
+		return exec.compareValues(val, "id"+*operand.IDCode, cmpOperator), nil
+	default:
+		return false, errors.New("standart predicate operand operations are not implemented")
+	}
+}
+
+func (exec *executer) checkNodeByArchetypePredicate(node treeindex.Noder, predicate *aqlprocessor.ArchetypePathPredicate) (bool, error) {
+	targetArchetypeID := ""
+	if predicate.ArchetypeHRID != nil {
+		targetArchetypeID = *predicate.ArchetypeHRID
+	} else if predicate.Parameter != nil {
+		paramVal, ok := exec.params[string(*predicate.Parameter)]
+		if !ok {
+			return false, nil
+		}
+
+		targetArchetypeID, ok = paramVal.(string)
+		if !ok {
+			return false, nil
+		}
+	} else {
+		return false, errors.New("unexpected archetype predicate state")
+	}
+
+	archetypeID, ok := getArchetypeNodeID(node)
+
+	return ok && archetypeID == targetArchetypeID, nil
+}
+
+// checkNodeByNodePredicate checks the node against the node predicate, e.g. [at0001], [at0001, 'name'],
+// [openEHR-EHR-OBSERVATION.bp.v1, $name], [$archetypeID], [name/value='name'] or their AND and OR combinations.
+func (exec *executer) checkNodeByNodePredicate(node treeindex.Noder, np *aqlprocessor.NodePredicate) (bool, error) {
+	switch np.Operator {
+	case aqlprocessor.ANDOperator, aqlprocessor.OROperator:
+		for _, next := range np.Next {
+			ok, err := exec.checkNodeByNodePredicate(node, next)
+			if err != nil {
+				return false, err
+			}
+
+			if ok == (np.Operator == aqlprocessor.OROperator) {
+				return ok, nil
+			}
+		}
+
+		return np.Operator == aqlprocessor.ANDOperator, nil
+	}
+
+	switch {
+	case np.AtCode != nil, np.IDCode != nil, np.ArchetypeHRID != nil:
+		var target string
+
+		switch {
+		case np.AtCode != nil:
+			target = np.AtCode.ToString()
+		case np.IDCode != nil:
+			target = np.IDCode.ToString()
+		default:
+			target = *np.ArchetypeHRID
+		}
+
+		if archetypeID, ok := getArchetypeNodeID(node); !ok || archetypeID != target {
+			return false, nil
+		}
+
+		if np.AdditionalData == nil {
+			return true, nil
+		}
+
+		return exec.checkNodeByName(node, np.AdditionalData)
+	case np.Parameter != nil:
+		paramVal, ok := exec.params[string(*np.Parameter)]
+		if !ok {
+			return false, nil
+		}
+
+		archetypeID, ok := getArchetypeNodeID(node)
+
+		return ok && archetypeID == paramVal, nil
+	case np.IsMatches:
+		return exec.checkNodeByRegex(node, np.ObjectPath, np.ContainedRegex)
+	case np.ObjectPath != nil && np.PathPredicateOperand != nil:
+		return exec.checkNodeByComparison(node, np.ObjectPath, np.ComparisionSymbol, np.PathPredicateOperand)
+	default:
+		return false, errors.New("unexpected node predicate state")
+	}
+}
+
+// checkNodeByName checks the name of the node against the second part of the node predicate.
+func (exec *executer) checkNodeByName(node treeindex.Noder, ad *aqlprocessor.NodePredicateAdditionalData) (bool, error) {
+	switch {
+	case ad.String != nil:
+		name, ok := getChildValue(node, "name", "value")
+		return ok && name == *ad.String, nil
+	case ad.Parameter != nil:
+		paramVal, ok := exec.params[string(*ad.Parameter)]
+		if !ok {
+			return false, nil
+		}
+
+		name, ok := getChildValue(node, "name", "value")
+
+		return ok && name == paramVal, nil
+	case ad.TermCode != nil:
+		// coded name, e.g. [at0001, SNOMED-CT::313267000]
+		parts := strings.SplitN(*ad.TermCode, "::", 2)
+		if len(parts) != 2 {
+			return false, fmt.Errorf("%w: invalid term code %s", errors.ErrIncorrectRequest, *ad.TermCode)
+		}
+
+		terminology, ok := getChildValue(node, "name", "defining_code", "terminology_id")
+		if !ok || terminology != parts[0] {
+			return false, nil
+		}
+
+		code, ok := getChildValue(node, "name", "defining_code", "code_string")
+
+		return ok && code == parts[1], nil
+	default:
+		return false, errors.New("node predicate name is not supported")
+	}
+}
+
+func (exec *executer) checkNodeByRegex(node treeindex.Noder, path *aqlprocessor.ObjectPath, containedRegex *string) (bool, error) {
+	if path == nil || containedRegex == nil {
+		return false, errors.New("unexpected node predicate MATCHES state")
+	}
+
+	re, err := containedRegexToRegexp(*containedRegex)
+	if err != nil {
+		return false, err
+	}
+
+	val, ok := exec.getValueForPath(path, node)
+	if !ok {
+		return false, nil
+	}
+
+	s, ok := exec.reveal(val).(string)
+
+	return ok && re.MatchString(s), nil
+}
+
+// containedRegexToRegexp compiles the regular expression of the '{/regex/}' form.
+func containedRegexToRegexp(containedRegex string) (*regexp.Regexp, error) {
+	s := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(containedRegex, "{"), "}"))
+
+	// the optional assumed value after ';' is not used for the matching
+	start, end := strings.Index(s, "/"), strings.LastIndex(s, "/")
+	if start != 0 || end <= start {
+		return nil, fmt.Errorf("%w: invalid regular expression %s", errors.ErrIncorrectRequest, containedRegex)
+	}
+
+	re, err := regexp.Compile(strings.ReplaceAll(s[start+1:end], `\/`, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid regular expression %s: %v", errors.ErrIncorrectRequest, containedRegex, err) //nolint
+	}
+
+	return re, nil
+}
+
+// getArchetypeNodeID returns the archetype_node_id of the locatable node.
+func getArchetypeNodeID(node treeindex.Noder) (string, bool) {
+	val, ok := getChildValue(node, "archetype_node_id")
+	if !ok {
+		return "", false
+	}
+
+	s, ok := val.(string)
+
+	return s, ok
+}
+
+// getChildValue returns the value of the value node found by the keys of the nested child nodes.
+func getChildValue(node treeindex.Noder, keys ...string) (any, bool) {
+	for _, key := range keys {
+		if node == nil {
+			return nil, false
+		}
+
+		node = node.TryGetChild(key)
+	}
+
+	valueNode, ok := node.(*treeindex.ValueNode)
+	if !ok {
+		return nil, false
+	}
+
+	return valueNode.GetData(), true
+}
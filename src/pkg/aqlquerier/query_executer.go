@@ -1,6 +1,7 @@
 package aqlquerier
 
 import (
+	"context"
 	"database/sql/driver"
 
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/aqlprocessor"
@@ -9,10 +10,30 @@ import (
 )
 
 type executer struct {
+	ctx    context.Context
 	query  *aqlprocessor.Query
 	params map[string]driver.Value
 
-	index *treeindex.EHRIndex
+	index     *treeindex.EHRIndex
+	functions *FunctionRegistry
+
+	// plan collects the execution statistics, it is nil unless the query is explained
+	plan *Plan
+
+	// scope restricts the EHRs and the compositions the query reads, it is nil if the whole index is read
+	scope *Scope
+
+	// page is the part of the rows returned to the caller, it is nil if all the rows are returned
+	page *Page
+
+	// cipher decrypts the values of the encrypted index, it is nil if the values are stored in the clear
+	cipher *treeindex.ValueCipher
+
+	// encrypted has the values compared with the encrypted ones by the EHRs of their keys, it is nil until the first comparison
+	encrypted map[encryptedKey]*treeindex.EncryptedValue
+
+	// filter has the sources found by the secondary indexes, it is nil if the indexes are not used by the query
+	filter *indexFilter
 }
 
 func (exec *executer) run() (*Rows, error) {
@@ -22,24 +43,49 @@ func (exec *executer) run() (*Rows, error) {
 		return nil, errors.Wrap(err, "cannot find data sources")
 	}
 
+	exec.plan.addStage(StageFrom, len(dataSources))
+
 	// handle WHERE block
 	dataSources, err = exec.filterSources(dataSources)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot filter data sources")
 	}
 
+	exec.plan.addStage(StageWhere, len(dataSources))
+
 	// handle SELECT block
 	rows, err := exec.queryData(dataSources)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot query rows from data sources")
 	}
 
+	exec.plan.addStage(StageSelect, len(rows.rows))
+
 	rows, err = exec.orderRows(rows)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot order rows")
 	}
 
-	return exec.limitRows(rows), nil
+	exec.plan.addStage(StageOrder, len(rows.rows))
+
+	rows = exec.pageRows(exec.limitRows(rows))
+
+	exec.plan.addStage(StageLimit, len(rows.rows))
+
+	return rows, nil
+}
+
+// checkContext stops the execution of the canceled query.
+func (exec *executer) checkContext() error {
+	if exec.ctx == nil {
+		return nil
+	}
+
+	if err := exec.ctx.Err(); err != nil {
+		return errors.Wrap(err, "query execution is canceled")
+	}
+
+	return nil
 }
 
 func (exec *executer) filterSources(rows dataRows) (dataRows, error) {
@@ -47,13 +93,12 @@ func (exec *executer) filterSources(rows dataRows) (dataRows, error) {
 		return rows, nil
 	}
 
-	return processWhere(exec.query.Where, rows)
-}
+	result, err := exec.processWhere(exec.query.Where, rows)
+	if err != nil {
+		return nil, err
+	}
 
-func (exec *executer) orderRows(rows *Rows) (*Rows, error) {
-	// handle ORDER block
-	//TODO: add order logic
-	return rows, nil
+	return result.matched, nil
 }
 
 func (exec *executer) limitRows(rows *Rows) *Rows {
@@ -79,59 +124,57 @@ func (exec *executer) limitRows(rows *Rows) *Rows {
 	return rows
 }
 
-func getValueForPath(path *aqlprocessor.ObjectPath, node treeindex.Noder) (any, bool) {
-	index := 0
-	queue := []treeindex.Noder{node}
+func (exec *executer) getValueForPath(path *aqlprocessor.ObjectPath, node treeindex.Noder) (any, bool) {
+	node, ok := exec.getNodeForPath(path, node)
+	if !ok {
+		return nil, false
+	}
+
+	valueNode, ok := node.(*treeindex.ValueNode)
+	if !ok {
+		return nil, false
+	}
+
+	return valueNode.GetData(), true
+}
+
+// getNodeForPath returns the node addressed by the path.
+// The predicate of a path part selects the items of a collection or checks the single node, the first matching node is returned.
+// The walk stops on the first value node, so the trailing 'value' of ids like 'e/ehr_id/value' is optional.
+func (exec *executer) getNodeForPath(path *aqlprocessor.ObjectPath, node treeindex.Noder) (treeindex.Noder, bool) {
+	return exec.getNodeForPathParts(path.Paths, node)
+}
+
+func (exec *executer) getNodeForPathParts(parts []aqlprocessor.PartPath, node treeindex.Noder) (treeindex.Noder, bool) {
+	if len(parts) == 0 {
+		return node, true
+	}
+
+	if valueNode, ok := node.(*treeindex.ValueNode); ok {
+		return valueNode, true
+	}
+
+	part := parts[0]
+
+	child := node.TryGetChild(part.Identifier)
+	if child == nil {
+		return nil, false
+	}
+
+	candidates := []treeindex.Noder{child}
+
+	if slice, ok := child.(*treeindex.SliceNode); ok {
+		candidates = slice.Items()
+	}
 
-	for len(queue) > 0 {
-		if index >= len(path.Paths) {
-			return nil, false
+	for _, candidate := range candidates {
+		// a predicate that can not be evaluated for the node, e.g. the node without a name, does not match
+		if ok, err := exec.checkNodeByPathPredicate(candidate, part.PathPredicate); err != nil || !ok {
+			continue
 		}
 
-		path := path.Paths[index]
-
-		node := queue[0]
-		queue = queue[1:]
-
-		switch node := node.(type) {
-		case *treeindex.ObjectNode, *treeindex.EHRNode, *treeindex.CompositionNode, *treeindex.EventContextNode:
-			{
-				nextNode := node.TryGetChild(path.Identifier)
-				if nextNode == nil {
-					continue
-				}
-
-				switch nextNode.GetNodeType() {
-				case treeindex.ObjectNodeType:
-					if path.PathPredicate != nil && path.PathPredicate.Type == aqlprocessor.NodePathPredicate {
-						if np := path.PathPredicate.NodePredicate; np.AtCode != nil && nextNode.GetID() == np.AtCode.ToString() {
-							index++
-						}
-					}
-				case treeindex.DataValueNodeType:
-					index++
-				}
-
-				queue = append(queue, nextNode)
-			}
-		case *treeindex.SliceNode:
-			if path.PathPredicate != nil && path.PathPredicate.Type == aqlprocessor.NodePathPredicate {
-				np := path.PathPredicate.NodePredicate
-
-				if np.AtCode != nil {
-					nextNode := node.TryGetChild(np.AtCode.ToString())
-					if nextNode != nil {
-						queue = append(queue, nextNode)
-						index++
-					}
-				}
-			}
-		case *treeindex.DataValueNode:
-			if valueNode := node.TryGetChild(path.Identifier); valueNode != nil {
-				queue = append(queue, valueNode)
-			}
-		case *treeindex.ValueNode:
-			return node.GetData(), true
+		if result, ok := exec.getNodeForPathParts(parts[1:], candidate); ok {
+			return result, true
 		}
 	}
 
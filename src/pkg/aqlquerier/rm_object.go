@@ -0,0 +1,150 @@
+package aqlquerier
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/aqlprocessor"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model/base"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/storage/treeindex"
+)
+
+// getSelectValue returns the value of the identified path selected by the query.
+// The leaf values are returned as is and the object nodes, e.g. 'o' or 'c/context', as the RM objects rebuilt from the index.
+func (exec *executer) getSelectValue(path *aqlprocessor.IdentifiedPath, node treeindex.Noder) any {
+	if path.ObjectPath != nil {
+		var ok bool
+		if node, ok = exec.getNodeForPath(path.ObjectPath, node); !ok {
+			return nil
+		}
+	}
+
+	if valueNode, ok := node.(*treeindex.ValueNode); ok {
+		return exec.reveal(valueNode.GetData())
+	}
+
+	return exec.rmObject(node)
+}
+
+// rmObject rebuilds the sub-tree of the node into the object of the canonical openEHR JSON form,
+// the RM types are in the '_type' attributes. The encrypted values are decrypted.
+func (exec *executer) rmObject(node treeindex.Noder) any {
+	switch node := node.(type) {
+	case *treeindex.ValueNode:
+		val := exec.reveal(node.GetData())
+		if node.Type == "" {
+			return val
+		}
+
+		// the object ids keep their types, e.g. HIER_OBJECT_ID
+		return map[string]any{
+			"_type": string(node.Type),
+			"value": val,
+		}
+	case *treeindex.SliceNode:
+		items := []any{}
+		for _, item := range node.Items() {
+			items = append(items, exec.rmObject(item))
+		}
+
+		return items
+	case *treeindex.ObjectNode:
+		return exec.rmAttributes(string(node.Type), node.Attributes)
+	case *treeindex.DataValueNode:
+		return exec.rmAttributes(string(node.Type), node.Values)
+	case *treeindex.EventContextNode:
+		return exec.rmAttributes(string(base.EventContextItemType), node.Attributes)
+	case *treeindex.EHRNode:
+		return exec.rmAttributes(string(node.Type), node.Attributes)
+	case *treeindex.CompositionNode:
+		obj := exec.rmAttributes(string(node.Type), node.Attributes)
+		obj["archetype_node_id"] = node.ID
+		obj["content"] = exec.compositionContent(&node.Tree)
+
+		return obj
+	default:
+		return nil
+	}
+}
+
+func (exec *executer) rmAttributes(typ string, attrs treeindex.Attributes) map[string]any {
+	obj := make(map[string]any, len(attrs)+1)
+
+	if typ != "" {
+		obj["_type"] = typ
+	}
+
+	// the index keeps the unset optional strings, e.g. DV_TEXT.formatting, they are omitted as in the canonical form
+	for key, attr := range attrs {
+		if val := exec.rmObject(attr); val != nil && val != "" {
+			obj[key] = val
+		}
+	}
+
+	return obj
+}
+
+// compositionContent returns the top level content items of the composition.
+// The tree keeps the items of the sections in the collections of their types as well,
+// so the items found in the sections are skipped. They are matched by the content,
+// because the nodes shared by the sections and the collections are copied by the index persistence.
+func (exec *executer) compositionContent(tree *treeindex.Tree) []any {
+	types := make([]string, 0, len(tree.Data))
+	for typ := range tree.Data {
+		types = append(types, typ)
+	}
+
+	sort.Strings(types)
+
+	var items []any
+
+	for _, typ := range types {
+		container := tree.Data[typ]
+
+		ids := make([]string, 0, len(container))
+		for id := range container {
+			ids = append(ids, id)
+		}
+
+		sort.Strings(ids)
+
+		for _, id := range ids {
+			for _, node := range container[id] {
+				items = append(items, exec.rmObject(node))
+			}
+		}
+	}
+
+	nested := map[string]int{}
+
+	for _, item := range items {
+		obj, ok := item.(map[string]any)
+		if !ok || obj["_type"] != treeindex.SECTION {
+			continue
+		}
+
+		sectionItems, _ := obj["items"].([]any)
+		for _, sectionItem := range sectionItems {
+			nested[contentKey(sectionItem)]++
+		}
+	}
+
+	content := make([]any, 0, len(items))
+
+	for _, item := range items {
+		key := contentKey(item)
+		if nested[key] > 0 {
+			nested[key]--
+			continue
+		}
+
+		content = append(content, item)
+	}
+
+	return content
+}
+
+func contentKey(item any) string {
+	data, _ := json.Marshal(item)
+	return string(data)
+}
@@ -0,0 +1,155 @@
+package aqlquerier
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/storage/treeindex"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_ExecuteQuery_RMObjects(t *testing.T) {
+	ciphers := map[string]*treeindex.ValueCipher{
+		"":                   nil,
+		" (encrypted index)": treeindex.NewValueCipher([32]byte{7}),
+	}
+
+	for suffix, cipher := range ciphers {
+		t.Run("select objects"+suffix, func(t *testing.T) {
+			require.NoError(t, getPreparedTreeIndexWithCipher(cipher, "test_fixtures/composition_2.json"))
+
+			conn, err := sqlx.Open("aql", "")
+			require.NoError(t, err)
+
+			defer conn.Close()
+
+			rows, err := conn.Queryx(`SELECT o, c/context, c
+				FROM EHR e CONTAINS COMPOSITION c CONTAINS OBSERVATION o[openEHR-EHR-OBSERVATION.blood_pressure.v2]`)
+			require.NoError(t, err)
+
+			defer rows.Close()
+
+			require.True(t, rows.Next())
+
+			row, err := rows.SliceScan()
+			require.NoError(t, err)
+			require.Len(t, row, 3)
+
+			observation, ok := row[0].(map[string]any)
+			require.True(t, ok, "the observation should be the object")
+			assert.Equal(t, "OBSERVATION", observation["_type"])
+			assert.Equal(t, "openEHR-EHR-OBSERVATION.blood_pressure.v2", observation["archetype_node_id"])
+			assert.Equal(t, map[string]any{"_type": "DV_TEXT", "value": "Blood pressure"}, observation["name"])
+
+			var bp struct {
+				Data struct {
+					Events []struct {
+						Data struct {
+							Items []struct {
+								Value struct {
+									Type      string  `json:"_type"`
+									Magnitude float64 `json:"magnitude"`
+									Units     string  `json:"units"`
+								} `json:"value"`
+							} `json:"items"`
+						} `json:"data"`
+					} `json:"events"`
+				} `json:"data"`
+			}
+
+			data, err := json.Marshal(observation)
+			require.NoError(t, err)
+			require.NoError(t, json.Unmarshal(data, &bp))
+			require.Len(t, bp.Data.Events, 1)
+			require.Len(t, bp.Data.Events[0].Data.Items, 2)
+
+			systolic := bp.Data.Events[0].Data.Items[0].Value
+			assert.Equal(t, "DV_QUANTITY", systolic.Type)
+			assert.Equal(t, 266.0, systolic.Magnitude, "the values should be decrypted")
+			assert.Equal(t, "mm[Hg]", systolic.Units)
+
+			context, ok := row[1].(map[string]any)
+			require.True(t, ok, "the context should be the object")
+			assert.Equal(t, "EVENT_CONTEXT", context["_type"])
+			assert.Equal(t, map[string]any{"_type": "DV_DATE_TIME", "value": "2021-12-03T17:34:06.849379+01:00"}, context["start_time"])
+
+			composition, ok := row[2].(map[string]any)
+			require.True(t, ok, "the composition should be the object")
+			assert.Equal(t, "COMPOSITION", composition["_type"])
+			assert.Equal(t, "openEHR-EHR-COMPOSITION.health_summary.v1", composition["archetype_node_id"])
+
+			content, ok := composition["content"].([]any)
+			require.True(t, ok)
+			require.Len(t, content, 1, "the items of the section should not be in the composition content")
+
+			section, ok := content[0].(map[string]any)
+			require.True(t, ok)
+			assert.Equal(t, "SECTION", section["_type"])
+			assert.Len(t, section["items"], 8)
+
+			assert.False(t, rows.Next())
+		})
+	}
+}
+
+func TestColumns(t *testing.T) {
+	columns, err := Columns(`SELECT
+			o[name/value='Blood pressure']/data[at0001]/events[at0006]/data[at0003]/items[at0004]/value/magnitude AS systolic,
+			c,
+			c/context/start_time/value,
+			COUNT(c/uid/value) AS cnt,
+			1
+		FROM EHR e CONTAINS COMPOSITION c CONTAINS OBSERVATION o`)
+	require.NoError(t, err)
+
+	assert.Equal(t, []Column{
+		{Name: "systolic", Path: "/data[at0001]/events[at0006]/data[at0003]/items[at0004]/value/magnitude"},
+		{Name: "#1", Path: "/"},
+		{Name: "#2", Path: "/context/start_time/value"},
+		{Name: "cnt", Path: ""},
+		{Name: "#4", Path: ""},
+	}, columns)
+
+	_, err = Columns(`SELECT FROM`)
+	assert.Error(t, err)
+}
+
+func TestService_ExecuteQuery_Metadata(t *testing.T) {
+	ciphers := map[string]*treeindex.ValueCipher{
+		"":                   nil,
+		" (encrypted index)": treeindex.NewValueCipher([32]byte{7}),
+	}
+
+	for suffix, cipher := range ciphers {
+		t.Run("patient list"+suffix, func(t *testing.T) {
+			require.NoError(t, getPreparedTreeIndexWithCipher(cipher, "test_fixtures/composition_2.json"))
+
+			conn, err := sqlx.Open("aql", "")
+			require.NoError(t, err)
+
+			defer conn.Close()
+
+			rows, err := conn.Queryx(`SELECT
+					e/ehr_id/value, e/system_id/value, e/time_created/value,
+					c/uid/value, c/name/value, c/archetype_details/template_id/value, c/archetype_details/rm_version,
+					c/composer/name, c/language/code_string, c/territory/code_string, c/category/defining_code/code_string,
+					c/context/start_time/value
+				FROM EHR e CONTAINS COMPOSITION c
+				WHERE c/archetype_details/template_id/value = 'International Patient Summary'`)
+			require.NoError(t, err)
+
+			got, err := scanSortedSlices(rows)
+			require.NoError(t, err)
+
+			assert.Equal(t, [][]any{{
+				"7d44b88c-4199-4bad-97dc-d78268e01398", "d60e2348-b083-48ce-93b9-916cef1d3a5a", "2015-01-20T19:30:22.765+01:00",
+				"__COMPOSITION_ID__", "International Patient Summary", "International Patient Summary", "1.0.4",
+				"Silvia Blake", "en", "US", "433",
+				"2021-12-03T17:34:06.849379+01:00",
+			}}, got)
+		})
+	}
+}
@@ -2,6 +2,7 @@ package aqlquerier
 
 import (
 	"database/sql/driver"
+	"io"
 
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/errors"
 )
@@ -25,6 +26,8 @@ type Rows struct {
 
 type Row struct {
 	values []interface{}
+
+	orderKeys []any
 }
 
 // Columns returns the names of the columns. The number of
@@ -60,7 +63,7 @@ func (rs *Rows) NamedColumns() []Column {
 // a buffer held in dest.
 func (rs *Rows) Next(dest []driver.Value) error {
 	if len(rs.rows) <= rs.cursor {
-		return errors.New("now rows")
+		return io.EOF
 	}
 
 	row := rs.rows[rs.cursor]
@@ -0,0 +1,109 @@
+package aqlquerier
+
+import (
+	"context"
+
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/errors"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/storage/treeindex"
+)
+
+type scopeContextKey struct{}
+
+// Scope is the data of the tree index the query is allowed to read: the whole EHRs
+// and the compositions of the other EHRs, granted one by one.
+type Scope struct {
+	ehrs         map[string]bool
+	compositions map[string]map[string]bool // EHR id -> versioned object ids
+}
+
+func NewScope() *Scope {
+	return &Scope{
+		ehrs:         map[string]bool{},
+		compositions: map[string]map[string]bool{},
+	}
+}
+
+// AddEHR allows the EHR with all its compositions.
+func (s *Scope) AddEHR(ehrID string) {
+	s.ehrs[ehrID] = true
+}
+
+// AddComposition allows the composition of the EHR, uid may be either the versioned object id or the version id.
+func (s *Scope) AddComposition(ehrID, uid string) {
+	uids, ok := s.compositions[ehrID]
+	if !ok {
+		uids = map[string]bool{}
+		s.compositions[ehrID] = uids
+	}
+
+	uids[uid] = true
+}
+
+// AddDoc allows the data of the document stored under the CID: the whole EHR for the EHR and EHR_STATUS documents
+// or the composition. It returns false for the documents unknown to the tree index, they are skipped.
+func (s *Scope) AddDoc(index *treeindex.EHRIndex, CID string) bool {
+	ref, ok := index.GetDoc(CID)
+	if !ok {
+		return false
+	}
+
+	if ref.UID == "" {
+		s.AddEHR(ref.EhrID)
+	} else {
+		s.AddComposition(ref.EhrID, ref.UID)
+	}
+
+	return true
+}
+
+// WithScope returns the context restricting the queries executed with it to the scope.
+// The queries executed without a scope read the whole tree index.
+func WithScope(ctx context.Context, scope *Scope) context.Context {
+	return context.WithValue(ctx, scopeContextKey{}, scope)
+}
+
+func scopeFromContext(ctx context.Context) *Scope {
+	if ctx == nil {
+		return nil
+	}
+
+	scope, _ := ctx.Value(scopeContextKey{}).(*Scope)
+
+	return scope
+}
+
+// view returns the part of the EHR in the scope, false if the EHR is out of it.
+func (s *Scope) view(ehrNode *treeindex.EHRNode) (*treeindex.EHRNode, bool) {
+	if s == nil || s.ehrs[ehrNode.ID] {
+		return ehrNode, true
+	}
+
+	uids, ok := s.compositions[ehrNode.ID]
+	if !ok {
+		return nil, false
+	}
+
+	return ehrNode.Restrict(uids), true
+}
+
+// getEHRs returns the queryable EHRs allowed by the scope and the secondary indexes.
+func (exec *executer) getEHRs() ([]*treeindex.EHRNode, error) {
+	ehrs, err := exec.index.GetEHRs("")
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get data source for EHRs")
+	}
+
+	result := make([]*treeindex.EHRNode, 0, len(ehrs))
+
+	for _, ehrNode := range ehrs {
+		if !ehrNode.IsQueryable() || !exec.filter.allowEHR(ehrNode.ID) {
+			continue
+		}
+
+		if view, ok := exec.scope.view(ehrNode); ok {
+			result = append(result, view)
+		}
+	}
+
+	return result, nil
+}
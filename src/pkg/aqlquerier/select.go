@@ -9,7 +9,7 @@ import (
 )
 
 func (exec *executer) queryData(sources dataRows) (*Rows, error) {
-	if len(sources) == 0 {
+	if len(sources) == 0 && !exec.hasAggregates() {
 		return &Rows{}, nil
 	}
 
@@ -17,10 +17,11 @@ func (exec *executer) queryData(sources dataRows) (*Rows, error) {
 		rows: []Row{},
 	}
 
-	//TODO: add DISTINCT handling
-	// exec.query.Select.Distinct
-
 	for _, dataRow := range sources {
+		if err := exec.checkContext(); err != nil {
+			return nil, err
+		}
+
 		row := Row{
 			values: []interface{}{},
 		}
@@ -30,15 +31,10 @@ func (exec *executer) queryData(sources dataRows) (*Rows, error) {
 			case *aqlprocessor.IdentifiedPathSelectValue:
 				{
 					var val any
-					ip := slct.Val
 
 					indexNode, ok := dataRow.cells[slct.Val.Identifier]
 					if ok {
-						if ip.ObjectPath != nil {
-							val, _ = getValueForPath(ip.ObjectPath, indexNode.data)
-						} else {
-							return nil, errors.New("unsupported select expresion format")
-						}
+						val = exec.getSelectValue(&slct.Val, indexNode.data)
 					}
 
 					row.values = append(row.values, val)
@@ -50,20 +46,41 @@ func (exec *executer) queryData(sources dataRows) (*Rows, error) {
 				}
 			case *aqlprocessor.AggregateFunctionCallSelectValue:
 				{
-					return nil, errors.New("Aggregation function call not implemented")
+					// Only the argument is collected here, the function itself is applied in aggregateRows
+					row.values = append(row.values, exec.getAggregateArgument(slct, dataRow))
 				}
 			case *aqlprocessor.FunctionCallSelectValue:
 				{
-					return nil, errors.New("Function call not implemented")
+					val, err := exec.callFunction(&slct.Val, dataRow)
+					if err != nil {
+						return nil, errors.Wrap(err, "cannot get function call value")
+					}
+
+					row.values = append(row.values, val)
 				}
 			default:
 				return nil, errors.New("Unexpected SelectExpr type")
 			}
 		}
 
+		row.orderKeys = exec.getOrderKeys(dataRow, row)
+
 		result.rows = append(result.rows, row)
 	}
 
+	if exec.hasAggregates() {
+		rows, err := exec.aggregateRows(sources, result.rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot aggregate rows")
+		}
+
+		result.rows = rows
+	}
+
+	if exec.query.Select.Distinct {
+		result.rows = distinctRows(result.rows)
+	}
+
 	return exec.fillColumns(result), nil
 }
 
@@ -76,9 +93,26 @@ func (exec *executer) getPrimitiveColumnValue(prim *aqlprocessor.PrimitiveSelect
 }
 
 func (exec *executer) fillColumns(rows *Rows) *Rows {
-	for i, se := range exec.query.Select.SelectExprs {
+	rows.columns = append(rows.columns, queryColumns(exec.query)...)
+	return rows
+}
+
+// Columns returns the columns of the result of the query with the paths of their sources.
+func Columns(query string) ([]Column, error) {
+	aqlQuery, err := aqlprocessor.NewAqlProcessor(query).Process()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parse AQL query")
+	}
+
+	return queryColumns(aqlQuery), nil
+}
+
+func queryColumns(query *aqlprocessor.Query) []Column {
+	columns := make([]Column, 0, len(query.Select.SelectExprs))
+
+	for i, se := range query.Select.SelectExprs {
 		c := Column{
-			Path: se.Path,
+			Path: columnPath(se),
 			Name: se.AliasName,
 		}
 
@@ -86,8 +120,34 @@ func (exec *executer) fillColumns(rows *Rows) *Rows {
 			c.Name = fmt.Sprintf("#%d", i)
 		}
 
-		rows.columns = append(rows.columns, c)
+		columns = append(columns, c)
 	}
 
-	return rows
+	return columns
+}
+
+// columnPath returns the path of the selected identified path without the variable, e.g. '/data[at0001]/origin/value',
+// or '/' if the variable itself is selected. The columns of the other expressions have no path.
+func columnPath(se aqlprocessor.SelectExpr) string {
+	if _, ok := se.Value.(*aqlprocessor.IdentifiedPathSelectValue); !ok {
+		return ""
+	}
+
+	// the predicates of the variable may contain the paths as well, e.g. o[name/value='Blood pressure']
+	depth := 0
+
+	for i, r := range se.Path {
+		switch r {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case '/':
+			if depth == 0 {
+				return se.Path[i:]
+			}
+		}
+	}
+
+	return "/"
 }
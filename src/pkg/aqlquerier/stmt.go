@@ -11,8 +11,9 @@ import (
 )
 
 type Stmt struct {
-	query *aqlprocessor.Query
-	index *treeindex.EHRIndex
+	query     *aqlprocessor.Query
+	index     *treeindex.EHRIndex
+	functions *FunctionRegistry
 }
 
 // Close closes the statement.
@@ -70,9 +71,14 @@ func (stmt *Stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (d
 	}
 
 	exec := executer{
-		query:  stmt.query,
-		params: parameterValues,
-		index:  stmt.index,
+		ctx:       ctx,
+		query:     stmt.query,
+		params:    parameterValues,
+		index:     stmt.index,
+		functions: stmt.functions,
+		scope:     scopeFromContext(ctx),
+		page:      pageFromContext(ctx),
+		cipher:    stmt.index.ValueCipher(),
 	}
 
 	rows, err := exec.run()
@@ -0,0 +1,300 @@
+package aqlquerier
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/errors"
+)
+
+// ucumDimension is the exponents of the base units: m, g, s, K, mol and the arbitrary units, e.g. [iU].
+type ucumDimension [6]int
+
+const arbitraryDimension = 5
+
+// ucumUnit is the unit of the UCUM case sensitive syntax converted into the base units: value * factor + offset.
+// The offset is set for the special units of temperature only, they can not be combined with other units.
+type ucumUnit struct {
+	factor  float64
+	offset  float64
+	dim     ucumDimension
+	special bool
+}
+
+type ucumAtom struct {
+	ucumUnit
+	metric bool // the atom may have a prefix
+}
+
+var ucumPrefixes = map[string]float64{
+	"Y": 1e24, "Z": 1e21, "E": 1e18, "P": 1e15, "T": 1e12, "G": 1e9, "M": 1e6, "k": 1e3, "h": 1e2, "da": 1e1,
+	"d": 1e-1, "c": 1e-2, "m": 1e-3, "u": 1e-6, "n": 1e-9, "p": 1e-12, "f": 1e-15, "a": 1e-18, "z": 1e-21, "y": 1e-24,
+}
+
+var ucumAtoms = func() map[string]ucumAtom {
+	var (
+		length = ucumDimension{1}
+		mass   = ucumDimension{0, 1}
+		tm     = ucumDimension{0, 0, 1}
+		temp   = ucumDimension{0, 0, 0, 1}
+		amount = ucumDimension{0, 0, 0, 0, 1}
+		volume = ucumDimension{3}
+		press  = ucumDimension{-1, 1, -2}
+		none   = ucumDimension{}
+	)
+
+	atom := func(factor float64, dim ucumDimension, metric bool) ucumAtom {
+		return ucumAtom{ucumUnit: ucumUnit{factor: factor, dim: dim}, metric: metric}
+	}
+
+	const pascal = 1e3 // kg/(m.s2) in the base units
+
+	return map[string]ucumAtom{
+		"1":       atom(1, none, false),
+		"%":       atom(1e-2, none, false),
+		"m":       atom(1, length, true),
+		"g":       atom(1, mass, true),
+		"s":       atom(1, tm, true),
+		"K":       atom(1, temp, true),
+		"mol":     atom(6.0221367e23, amount, true),
+		"L":       atom(1e-3, volume, true),
+		"l":       atom(1e-3, volume, true),
+		"Pa":      atom(pascal, press, true),
+		"bar":     atom(1e5*pascal, press, true),
+		"m[Hg]":   atom(133.322e3*pascal, press, true),
+		"m[H2O]":  atom(9.80665e3*pascal, press, true),
+		"[psi]":   atom(6894.757293168*pascal, press, false),
+		"atm":     atom(101325*pascal, press, false),
+		"min":     atom(60, tm, false),
+		"h":       atom(3600, tm, false),
+		"d":       atom(86400, tm, false),
+		"wk":      atom(604800, tm, false),
+		"mo":      atom(2629746, tm, false),
+		"a":       atom(31556952, tm, false),
+		"[in_i]":  atom(0.0254, length, false),
+		"[ft_i]":  atom(0.3048, length, false),
+		"[lb_av]": atom(453.59237, mass, false),
+		"[oz_av]": atom(28.349523125, mass, false),
+		"[iU]":    atom(1, ucumDimension{arbitraryDimension: 1}, true),
+		"[IU]":    atom(1, ucumDimension{arbitraryDimension: 1}, true),
+		"U":       atom(6.0221367e23/60*1e-6, ucumDimension{0, 0, -1, 0, 1}, true),
+		"Cel": {
+			ucumUnit: ucumUnit{factor: 1, offset: 273.15, dim: temp, special: true},
+		},
+		"[degF]": {
+			ucumUnit: ucumUnit{factor: 5.0 / 9, offset: 273.15 - 32*5.0/9, dim: temp, special: true},
+		},
+	}
+}()
+
+// parseUCUM parses the unit expression of the UCUM case sensitive syntax, e.g. mm[Hg], mg/dL, kg.m-2 or 10*9/L.
+// The annotations in curly braces are ignored.
+func parseUCUM(expr string) (ucumUnit, error) {
+	expr = strings.TrimSpace(expr)
+
+	result := ucumUnit{factor: 1}
+
+	if expr == "" {
+		return result, nil
+	}
+
+	sign := 1
+	if strings.HasPrefix(expr, "/") {
+		sign = -1
+		expr = expr[1:]
+	}
+
+	for expr != "" {
+		end := nextUCUMOperator(expr)
+		component := expr[:end]
+
+		unit, err := parseUCUMComponent(component)
+		if err != nil {
+			return ucumUnit{}, err
+		}
+
+		if unit.special {
+			if result.factor != 1 || result.dim != (ucumDimension{}) || end < len(expr) || sign < 0 {
+				return ucumUnit{}, fmt.Errorf("%w: %s can not be combined with other units", errors.ErrIncorrectRequest, component)
+			}
+
+			return unit, nil
+		}
+
+		result.factor *= math.Pow(unit.factor, float64(sign))
+		for i := range result.dim {
+			result.dim[i] += sign * unit.dim[i]
+		}
+
+		if end == len(expr) {
+			break
+		}
+
+		if expr[end] == '/' {
+			sign = -1
+		} else {
+			sign = 1
+		}
+
+		expr = expr[end+1:]
+	}
+
+	return result, nil
+}
+
+// nextUCUMOperator returns the index of the next '.' or '/' outside the brackets or the length of the expression.
+func nextUCUMOperator(expr string) int {
+	depth := 0
+
+	for i, r := range expr {
+		switch r {
+		case '[', '{', '(':
+			depth++
+		case ']', '}', ')':
+			depth--
+		case '.', '/':
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+
+	return len(expr)
+}
+
+func parseUCUMComponent(component string) (ucumUnit, error) {
+	// annotations have no effect on the unit, a sole annotation is the unity, e.g. {beats}/min
+	if i := strings.Index(component, "{"); i >= 0 {
+		component = component[:i]
+		if component == "" {
+			component = "1"
+		}
+	}
+
+	// factors, e.g. 10*3 or 10^3
+	if i := strings.IndexAny(component, "*^"); i > 0 && isUCUMNumber(component[:i]) {
+		base, _ := strconv.ParseFloat(component[:i], 64)
+
+		exp, err := strconv.Atoi(component[i+1:])
+		if err != nil {
+			return ucumUnit{}, fmt.Errorf("%w: invalid unit %s", errors.ErrIncorrectRequest, component)
+		}
+
+		return ucumUnit{factor: math.Pow(base, float64(exp))}, nil
+	}
+
+	if isUCUMNumber(component) {
+		factor, _ := strconv.ParseFloat(component, 64)
+		return ucumUnit{factor: factor}, nil
+	}
+
+	// the trailing exponent, e.g. m2 or s-1, unless the digits are the part of the atom
+	symbol, exp := component, 1
+
+	if _, ok := lookupUCUMAtom(component); !ok {
+		i := len(component)
+		for i > 0 && component[i-1] >= '0' && component[i-1] <= '9' {
+			i--
+		}
+
+		if i > 0 && (component[i-1] == '-' || component[i-1] == '+') {
+			i--
+		}
+
+		if i > 0 && i < len(component) {
+			e, err := strconv.Atoi(component[i:])
+			if err == nil {
+				symbol, exp = component[:i], e
+			}
+		}
+	}
+
+	unit, ok := lookupUCUMAtom(symbol)
+	if !ok {
+		return ucumUnit{}, fmt.Errorf("%w: unknown unit %s", errors.ErrIncorrectRequest, component)
+	}
+
+	if unit.special {
+		if exp != 1 {
+			return ucumUnit{}, fmt.Errorf("%w: %s can not have an exponent", errors.ErrIncorrectRequest, component)
+		}
+
+		return unit, nil
+	}
+
+	result := ucumUnit{factor: math.Pow(unit.factor, float64(exp))}
+	for i := range unit.dim {
+		result.dim[i] = unit.dim[i] * exp
+	}
+
+	return result, nil
+}
+
+// lookupUCUMAtom finds the unit atom, optionally prefixed. The atoms take precedence over the prefixed atoms, e.g. min or Pa.
+func lookupUCUMAtom(symbol string) (ucumUnit, bool) {
+	if atom, ok := ucumAtoms[symbol]; ok {
+		return atom.ucumUnit, true
+	}
+
+	for prefix, factor := range ucumPrefixes {
+		if !strings.HasPrefix(symbol, prefix) {
+			continue
+		}
+
+		atom, ok := ucumAtoms[symbol[len(prefix):]]
+		if !ok || !atom.metric {
+			continue
+		}
+
+		unit := atom.ucumUnit
+		unit.factor *= factor
+
+		return unit, true
+	}
+
+	return ucumUnit{}, false
+}
+
+func isUCUMNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// toBase converts the magnitude into the base units.
+func (u ucumUnit) toBase(magnitude float64) float64 {
+	return magnitude*u.factor + u.offset
+}
+
+// convertQuantity converts the magnitude from the units into the other units of the same dimension.
+func convertQuantity(magnitude float64, from, to string) (float64, error) {
+	if from == to {
+		return magnitude, nil
+	}
+
+	fromUnit, err := parseUCUM(from)
+	if err != nil {
+		return 0, err
+	}
+
+	toUnit, err := parseUCUM(to)
+	if err != nil {
+		return 0, err
+	}
+
+	if fromUnit.dim != toUnit.dim {
+		return 0, fmt.Errorf("%w: units %s and %s are not comparable", errors.ErrIncorrectRequest, from, to)
+	}
+
+	return (fromUnit.toBase(magnitude) - toUnit.offset) / toUnit.factor, nil
+}
@@ -0,0 +1,48 @@
+package aqlquerier
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvertQuantity(t *testing.T) {
+	tests := []struct {
+		name      string
+		magnitude float64
+		from      string
+		to        string
+		want      float64
+		wantErr   bool
+	}{
+		{"1. same units", 140, "mm[Hg]", "mm[Hg]", 140, false},
+		{"2. pressure", 1, "kPa", "mm[Hg]", 7.5006376, false},
+		{"3. prefixes", 1.5, "kg", "g", 1500, false},
+		{"4. division", 100, "mg/dL", "g/L", 1, false},
+		{"5. exponents", 25, "kg/m2", "g.cm-2", 2.5, false},
+		{"6. temperature", 100, "[degF]", "Cel", 37.777778, false},
+		{"7. temperature into kelvins", 0, "Cel", "K", 273.15, false},
+		{"8. annotations", 60, "{beats}/min", "/s", 1, false},
+		{"9. factors", 4.5, "10*9/L", "10*6/mL", 4.5, false},
+		{"10. percents", 50, "%", "1", 0.5, false},
+		{"11. time", 2, "h", "min", 120, false},
+		{"12. customary units", 1, "[lb_av]", "[oz_av]", 16, false},
+		{"13. different dimensions", 1, "kg", "m", 0, true},
+		{"14. unknown unit", 1, "parsec", "m", 0, true},
+		{"15. temperature combined", 1, "Cel/min", "K/min", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := convertQuantity(tt.magnitude, tt.from, tt.to)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			if assert.NoError(t, err) {
+				assert.InDelta(t, tt.want, got, 1e-6)
+			}
+		})
+	}
+}
@@ -2,14 +2,42 @@ package aqlquerier
 
 import (
 	"fmt"
+	"regexp"
+	"strings"
 
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/aqlprocessor"
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/errors"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/storage/treeindex"
 )
 
-func processWhere(where *aqlprocessor.Where, sources dataRows) (dataRows, error) {
+// truth is the value of the WHERE condition for the row. The conditions over NULL, e.g. the value missing in the row,
+// are unknown, so they are not true under NOT as well.
+type truth byte
+
+const (
+	falseTruth truth = iota
+	trueTruth
+	unknownTruth
+)
+
+func truthOf(ok bool) truth {
+	if ok {
+		return trueTruth
+	}
+
+	return falseTruth
+}
+
+// whereRows are the rows for which the condition is true and the ones for which it is unknown,
+// the condition is false for the other rows of the sources.
+type whereRows struct {
+	matched dataRows
+	unknown dataRows
+}
+
+func (exec *executer) processWhere(where *aqlprocessor.Where, sources dataRows) (*whereRows, error) {
 	if ie := where.IdentifiedExpr; ie != nil {
-		return getDataSourceForIdentifierExpr(ie, sources)
+		return exec.getDataSourceForIdentifierExpr(ie, sources)
 	}
 
 	if where.OperatorType != aqlprocessor.NoneOperator && where.OperatorType != "" {
@@ -17,10 +45,10 @@ func processWhere(where *aqlprocessor.Where, sources dataRows) (dataRows, error)
 			return nil, errors.New("unexpected where conditions count")
 		}
 
-		results := make([]dataRows, len(where.Next))
+		results := make([]*whereRows, len(where.Next))
 
 		for i, where := range where.Next {
-			processedDataSources, err := processWhere(where, sources)
+			processedDataSources, err := exec.processWhere(where, sources)
 			if err != nil {
 				return nil, errors.Wrap(err, "cannot filter inner WHERE conditions")
 			}
@@ -31,7 +59,7 @@ func processWhere(where *aqlprocessor.Where, sources dataRows) (dataRows, error)
 		switch where.OperatorType {
 		case aqlprocessor.NOTOperator:
 			if len(results) != 1 {
-				return sources, nil
+				return nil, errors.New("invalid data sources count")
 			}
 
 			return mergeDataSourcesNOT(sources, results[0]), nil
@@ -51,109 +79,368 @@ func processWhere(where *aqlprocessor.Where, sources dataRows) (dataRows, error)
 			return nil, fmt.Errorf("unexpected operator type: %v", where.OperatorType) //nolint
 		}
 	} else if len(where.Next) == 1 {
-		return processWhere(where.Next[0], sources)
+		return exec.processWhere(where.Next[0], sources)
 	}
 
 	return nil, errors.New("unexpected WHERE object state")
 }
 
-func getDataSourceForIdentifierExpr(ie *aqlprocessor.IdentifiedExpr, rows dataRows) (dataRows, error) {
-	result := dataRows{}
+func (exec *executer) getDataSourceForIdentifierExpr(ie *aqlprocessor.IdentifiedExpr, rows dataRows) (*whereRows, error) {
+	if ie.Next != nil {
+		return exec.getDataSourceForIdentifierExpr(ie.Next, rows)
+	}
 
-	if ie.ComparisonOperator == nil || ie.IdentifiedPath == nil {
-		return result, nil
+	var like *regexp.Regexp
+
+	if ie.Like != nil {
+		// LIKE operand is a string or a parameter, so it does not depend on the row
+		pattern, err := exec.evalTerminal(ie.Like, dataRow{})
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot get LIKE pattern")
+		}
+
+		s, ok := pattern.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: LIKE pattern must be a string, got %T", errors.ErrIncorrectRequest, pattern)
+		}
+
+		like, err = likePatternToRegexp(s)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot compile LIKE pattern")
+		}
 	}
 
+	result := &whereRows{matched: dataRows{}}
+
 	for _, row := range rows {
-		ip := *ie.IdentifiedPath
+		if err := exec.checkContext(); err != nil {
+			return nil, err
+		}
+
+		t, err := exec.checkIdentifiedExpr(ie, like, row)
+		if err != nil {
+			return nil, err
+		}
+
+		switch t {
+		case trueTruth:
+			result.matched = append(result.matched, row)
+		case unknownTruth:
+			result.unknown = append(result.unknown, row)
+		}
+	}
+
+	return result, nil
+}
 
-		if cell, ok := row.cells[ip.Identifier]; ok {
-			containsValues := false
+func (exec *executer) checkIdentifiedExpr(ie *aqlprocessor.IdentifiedExpr, like *regexp.Regexp, row dataRow) (truth, error) {
+	if ie.FunctionCall != nil {
+		if ie.ComparisonOperator == nil {
+			return falseTruth, nil
+		}
+
+		value, err := exec.callFunction(ie.FunctionCall, row)
+		if err != nil {
+			return falseTruth, err
+		}
+
+		return exec.compare(ie.Terminal, row, value, *ie.ComparisonOperator)
+	}
+
+	if ie.IdentifiedPath == nil {
+		return falseTruth, nil
+	}
 
-			indexNode := cell.data
-			if ip.ObjectPath != nil {
-				value, ok := getValueForPath(ip.ObjectPath, indexNode)
-				if !ok {
-					continue
-				}
+	ip := ie.IdentifiedPath
+	exists := ie.IsExists != nil && *ie.IsExists
 
-				containsValues = compare(ie.Terminal, value, *ie.ComparisonOperator)
+	// the variable is missing in the rows of the other OR containment branch, its values are NULL
+	cell, ok := row.cells[ip.Identifier]
+	if !ok {
+		if exists {
+			return falseTruth, nil
+		}
+
+		return unknownTruth, nil
+	}
+
+	if exists {
+		if ip.ObjectPath == nil {
+			return trueTruth, nil
+		}
+
+		_, ok := exec.getNodeForPath(ip.ObjectPath, cell.data)
+
+		return truthOf(ok), nil
+	}
+
+	if ip.ObjectPath == nil {
+		return falseTruth, nil
+	}
+
+	value, ok := exec.getComparableValueForPath(ip.ObjectPath, cell.data)
+	if !ok || value == nil {
+		return unknownTruth, nil
+	}
+
+	switch {
+	case like != nil:
+		s, ok := exec.reveal(value).(string)
+		return truthOf(ok && like.MatchString(s)), nil
+	case ie.Matches != nil:
+		result := falseTruth
+
+		for _, term := range ie.Matches {
+			t, err := exec.compare(term, row, value, aqlprocessor.SymEQ)
+			if err != nil || t == trueTruth {
+				return t, err
 			}
 
-			if containsValues {
-				result = append(result, row)
+			if t == unknownTruth {
+				result = unknownTruth
 			}
-		} else {
-			result = append(result, row)
+		}
+
+		return result, nil
+	case ie.ComparisonOperator != nil:
+		return exec.compare(ie.Terminal, row, value, *ie.ComparisonOperator)
+	default:
+		return falseTruth, nil
+	}
+}
+
+// likePatternToRegexp converts the LIKE pattern into a regular expression matching the whole string.
+// The AQL wildcards are supported: '*' matches any sequence of characters and '?' matches a single character.
+// A wildcard is matched literally when escaped with a backslash.
+func likePatternToRegexp(pattern string) (*regexp.Regexp, error) {
+	var (
+		sb      strings.Builder
+		escaped bool
+	)
+
+	sb.WriteString("(?s)^")
+
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '*':
+			sb.WriteString(".*")
+		case r == '?':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
 		}
 	}
 
-	return result, nil
+	if escaped {
+		sb.WriteString(regexp.QuoteMeta("\\"))
+	}
+
+	sb.WriteString("$")
+
+	return regexp.Compile(sb.String())
 }
 
-func mergeDataSourcesNOT(origin, exclude dataRows) dataRows {
-	result := dataRows{}
+func mergeDataSourcesNOT(origin dataRows, exclude *whereRows) *whereRows {
+	excluded := rowIDs(exclude.matched, exclude.unknown)
 
-	m := make(map[string]bool, len(exclude))
-	for _, r := range exclude {
-		m[r.id.String()] = true
+	return &whereRows{
+		matched: filterRows(origin, func(id string) bool { return !excluded[id] }),
+		unknown: exclude.unknown,
 	}
+}
+
+func mergeDataSourcesAND(left, right *whereRows) *whereRows {
+	rightIDs := rowIDs(right.matched)
+	matched := filterRows(left.matched, func(id string) bool { return rightIDs[id] })
+
+	// the condition is unknown if none of the operands is false and it is not true
+	matchedIDs := rowIDs(matched)
+	notFalse := rowIDs(right.matched, right.unknown)
+
+	unknown := filterRows(concatRows(left.matched, left.unknown), func(id string) bool {
+		return notFalse[id] && !matchedIDs[id]
+	})
 
-	for _, row := range origin {
-		if m[row.id.String()] {
-			continue
+	return &whereRows{matched: matched, unknown: unknown}
+}
+
+func mergeDataSourcesOR(left, right *whereRows) *whereRows {
+	matched := concatRows(left.matched)
+
+	leftIDs := rowIDs(left.matched)
+	matched = append(matched, filterRows(right.matched, func(id string) bool { return !leftIDs[id] })...)
+
+	// the condition is unknown if none of the operands is true and it is not false
+	matchedIDs := rowIDs(matched)
+	unknownIDs := map[string]bool{}
+
+	unknown := filterRows(concatRows(left.unknown, right.unknown), func(id string) bool {
+		if matchedIDs[id] || unknownIDs[id] {
+			return false
 		}
 
-		result = append(result, row)
+		unknownIDs[id] = true
+
+		return true
+	})
+
+	return &whereRows{matched: matched, unknown: unknown}
+}
+
+func rowIDs(rows ...dataRows) map[string]bool {
+	m := map[string]bool{}
+
+	for _, rows := range rows {
+		for _, r := range rows {
+			m[r.id.String()] = true
+		}
+	}
+
+	return m
+}
+
+// filterRows returns the new slice of the rows whose ids are kept.
+func filterRows(rows dataRows, keep func(id string) bool) dataRows {
+	result := dataRows{}
+
+	for _, row := range rows {
+		if keep(row.id.String()) {
+			result = append(result, row)
+		}
 	}
 
 	return result
 }
 
-func mergeDataSourcesAND(left, right dataRows) dataRows {
+func concatRows(rows ...dataRows) dataRows {
 	result := dataRows{}
 
-	m := make(map[string]bool, len(right))
-	for _, r := range right {
-		m[r.id.String()] = true
+	for _, rows := range rows {
+		result = append(result, rows...)
 	}
 
-	for _, row := range left {
-		if !m[row.id.String()] {
-			continue
+	return result
+}
+
+// compare checks the value against the terminal evaluated for the row.
+// The comparison with NULL is unknown.
+func (exec *executer) compare(term *aqlprocessor.Terminal, row dataRow, val any, cmpOperator aqlprocessor.ComparisionSymbol) (truth, error) {
+	if val == nil {
+		return unknownTruth, nil
+	}
+
+	if term.Primitive != nil {
+		if term.Primitive.Val == nil {
+			return unknownTruth, nil
+		}
+
+		switch val.(type) {
+		case *treeindex.EncryptedValue, quantity, codedText:
+			return truthOf(exec.compareValues(val, term.Primitive.Val, cmpOperator)), nil
 		}
 
-		result = append(result, row)
+		switch term.Primitive.Val.(type) {
+		case int, float64, string:
+			return truthOf(term.Primitive.Compare(val, cmpOperator)), nil
+		default:
+			// booleans and date/times
+			return truthOf(compareValues(val, term.Primitive.Val, cmpOperator)), nil
+		}
 	}
 
-	return result
+	termVal, err := exec.evalTerminal(term, row)
+	if err != nil {
+		return falseTruth, err
+	}
+
+	if termVal == nil {
+		return unknownTruth, nil
+	}
+
+	return truthOf(exec.compareValues(val, termVal, cmpOperator)), nil
 }
 
-func mergeDataSourcesOR(left, right dataRows) dataRows {
-	result := left
+// evalTerminal returns the value of the terminal for the row: a primitive, a parameter value,
+// a value at the path or a function call result.
+func (exec *executer) evalTerminal(term *aqlprocessor.Terminal, row dataRow) (any, error) {
+	switch {
+	case term.Primitive != nil:
+		return term.Primitive.Val, nil
+	case term.Parameter != nil:
+		val, ok := exec.params[string(*term.Parameter)]
+		if !ok {
+			return nil, fmt.Errorf("%w: parameter '%s' value is not provided", errors.ErrIncorrectRequest, *term.Parameter)
+		}
+
+		return val, nil
+	case term.IdentifiedPath != nil:
+		cell, ok := row.cells[term.IdentifiedPath.Identifier]
+		if !ok || term.IdentifiedPath.ObjectPath == nil {
+			return nil, nil
+		}
+
+		val, _ := exec.getValueForPath(term.IdentifiedPath.ObjectPath, cell.data)
 
-	m := make(map[string]bool, len(left))
-	for _, r := range left {
-		m[r.id.String()] = true
+		return val, nil
+	case term.FunctionCall != nil:
+		return exec.callFunction(term.FunctionCall, row)
 	}
 
-	for _, r := range right {
-		if m[r.id.String()] {
-			continue
+	return nil, nil
+}
+
+func (exec *executer) callFunction(fc *aqlprocessor.FunctionCall, row dataRow) (any, error) {
+	args := make([]any, 0, len(fc.Args))
+
+	for _, arg := range fc.Args {
+		val, err := exec.evalTerminal(arg, row)
+		if err != nil {
+			return nil, err
 		}
 
-		result = append(result, r)
+		args = append(args, exec.reveal(val))
 	}
 
-	return result
+	return exec.functions.Call(fc.Name, args...)
 }
 
-func compare(term *aqlprocessor.Terminal, val any, cmpOperator aqlprocessor.ComparisionSymbol) bool {
-	if term.Primitive != nil {
-		return term.Primitive.Compare(val, cmpOperator)
+// compareValues compares the values of the kinds supported by ORDER BY.
+// Comparison with NULL is never true, values of different kinds are only not equal.
+func compareValues(x, y any, cmpOperator aqlprocessor.ComparisionSymbol) bool {
+	kx, ky := treeindex.OrderKey(x), treeindex.OrderKey(y)
+
+	if kx == nil || ky == nil {
+		return false
 	}
 
-	//TODO: add logic for other conditions
+	if treeindex.OrderKindRank(kx) != treeindex.OrderKindRank(ky) {
+		return cmpOperator == aqlprocessor.SymNe
+	}
 
-	return false
+	return compareResult(treeindex.CompareOrderKeys(kx, ky), cmpOperator)
+}
+
+// compareResult checks the result of the comparison, -1, 0 or +1, against the operator.
+func compareResult(c int, cmpOperator aqlprocessor.ComparisionSymbol) bool {
+	switch cmpOperator {
+	case aqlprocessor.SymLT:
+		return c < 0
+	case aqlprocessor.SymGT:
+		return c > 0
+	case aqlprocessor.SymLE:
+		return c <= 0
+	case aqlprocessor.SymGE:
+		return c >= 0
+	case aqlprocessor.SymNe:
+		return c != 0
+	case aqlprocessor.SymEQ:
+		return c == 0
+	default:
+		return false
+	}
 }
@@ -0,0 +1,34 @@
+package aqlquerier
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLikePatternToRegexp(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		value   string
+		want    bool
+	}{
+		{"1. any sequence", "*min", "/min", true},
+		{"2. single character", "k?", "kg", true},
+		{"3. single character does not match a sequence", "k?", "kgm", false},
+		{"4. SQL % is matched literally", "%min", "/min", false},
+		{"5. SQL % is matched literally", "%min", "%min", true},
+		{"6. SQL _ is matched literally", "k_", "kg", false},
+		{"7. escaped wildcard", `10\*`, "10*", true},
+		{"8. escaped wildcard", `10\*`, "100", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			re, err := likePatternToRegexp(tt.pattern)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, re.MatchString(tt.value))
+		})
+	}
+}
@@ -16,6 +16,10 @@ const (
 	DefaultGroupAllDocuments         = "all documents"
 	DefaultGroupDoctors              = "doctors"
 	QueryExecutionTimeout            = time.Second * 60
+	QueryExecutionWorkers            = 8
+	QueryUserConcurrency             = 2
+	QueryCursorTTL                   = 10 * time.Minute
+	QueryStreamBufferRows            = 1000
 
 	ScryptKeyLen  = 32
 	ScryptSaltLen = 16
@@ -0,0 +1,159 @@
+// Package iso8601 parses the ISO 8601 date, time and duration values used by openEHR.
+package iso8601
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var dateTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05Z07",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04",
+	"20060102T150405.999999999Z0700",
+	"20060102T150405.999999999Z07:00",
+	"20060102T150405.999999999",
+	"2006-01-02",
+	"20060102",
+	"2006-01",
+}
+
+var timeLayouts = []string{
+	"15:04:05.999999999Z07:00",
+	"15:04:05.999999999Z0700",
+	"15:04:05.999999999",
+	"15:04Z07:00",
+	"15:04",
+	"150405.999999999Z0700",
+	"150405.999999999Z07:00",
+	"150405.999999999",
+}
+
+// ParseDateTime parses the date/time or the date, including the partial date with the month precision.
+// The values without the time zone are in UTC.
+func ParseDateTime(s string) (time.Time, bool) {
+	// Fast path, all supported layouts start with a year
+	if len(s) < 7 || !isDigit(s[0]) || !isDigit(s[3]) {
+		return time.Time{}, false
+	}
+
+	return parse(dateTimeLayouts, s)
+}
+
+// ParseTime parses the time of day, the result is on the zero date.
+func ParseTime(s string) (time.Time, bool) {
+	if len(s) < 4 || !isDigit(s[0]) || !isDigit(s[1]) {
+		return time.Time{}, false
+	}
+
+	return parse(timeLayouts, s)
+}
+
+func parse(layouts []string, s string) (time.Time, bool) {
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// Nominal lengths of the calendar units, the same as the average Gregorian year and month used by openEHR.
+const (
+	Day   = 24 * time.Hour
+	Week  = 7 * Day
+	Year  = time.Duration(365.2425 * float64(Day))
+	Month = Year / 12
+)
+
+// ParseDuration parses the duration of PnYnMnWnDTnHnMnS form, optionally negative.
+// The years and months have the nominal lengths, the smallest component may have a fraction.
+func ParseDuration(s string) (time.Duration, bool) {
+	negative := strings.HasPrefix(s, "-")
+	if negative {
+		s = s[1:]
+	}
+
+	if len(s) < 3 || s[0] != 'P' {
+		return 0, false
+	}
+
+	var (
+		total     float64
+		inTime    bool
+		number    string
+		hasValues bool
+		timeEmpty bool
+	)
+
+	for _, r := range s[1:] {
+		switch {
+		case r >= '0' && r <= '9' || r == '.' || r == ',':
+			if r == ',' {
+				r = '.'
+			}
+
+			number += string(r)
+
+			continue
+		case r == 'T' && !inTime && number == "":
+			inTime, timeEmpty = true, true
+			continue
+		}
+
+		if number == "" {
+			return 0, false
+		}
+
+		val, err := strconv.ParseFloat(number, 64)
+		if err != nil {
+			return 0, false
+		}
+
+		var unit time.Duration
+
+		switch {
+		case r == 'Y' && !inTime:
+			unit = Year
+		case r == 'M' && !inTime:
+			unit = Month
+		case r == 'W' && !inTime:
+			unit = Week
+		case r == 'D' && !inTime:
+			unit = Day
+		case r == 'H' && inTime:
+			unit = time.Hour
+		case r == 'M' && inTime:
+			unit = time.Minute
+		case r == 'S' && inTime:
+			unit = time.Second
+		default:
+			return 0, false
+		}
+
+		total += val * float64(unit)
+		number = ""
+		hasValues = true
+		timeEmpty = false
+	}
+
+	if number != "" || !hasValues || timeEmpty || total > math.MaxInt64 {
+		return 0, false
+	}
+
+	if negative {
+		total = -total
+	}
+
+	return time.Duration(total), true
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
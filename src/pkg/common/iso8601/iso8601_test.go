@@ -0,0 +1,81 @@
+package iso8601
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDateTime(t *testing.T) {
+	tests := []struct {
+		in     string
+		want   time.Time
+		wantOK bool
+	}{
+		{"2025-01-01", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), true},
+		{"20250101", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), true},
+		{"2025-03", time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), true},
+		{"2025-01-01T10:00:00Z", time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC), true},
+		{"2025-01-01T10:00:00+02:00", time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC), true},
+		{"2025-01-01T10:00:00.123", time.Date(2025, 1, 1, 10, 0, 0, 123000000, time.UTC), true},
+		{"20250101T100000+0200", time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC), true},
+		{"2025-01-01T10:00", time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC), true},
+		{"2025 is a year", time.Time{}, false},
+		{"P1D", time.Time{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, ok := ParseDateTime(tt.in)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.True(t, tt.want.Equal(got), "got %v", got)
+		})
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	got, ok := ParseTime("10:30:15.5+01:00")
+	assert.True(t, ok)
+	assert.Equal(t, "09:30:15.5", got.UTC().Format("15:04:05.999"))
+
+	got, ok = ParseTime("103015")
+	assert.True(t, ok)
+	assert.Equal(t, "10:30:15", got.Format("15:04:05"))
+
+	_, ok = ParseTime("2025-01-01")
+	assert.False(t, ok)
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in     string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"P1D", Day, true},
+		{"PT36H", 36 * time.Hour, true},
+		{"P1DT12H", 36 * time.Hour, true},
+		{"P2W", 2 * Week, true},
+		{"PT1.5S", 1500 * time.Millisecond, true},
+		{"PT0,5M", 30 * time.Second, true},
+		{"-PT10M", -10 * time.Minute, true},
+		{"P1Y", Year, true},
+		{"P1M", Month, true},
+		{"PT1M", time.Minute, true},
+		{"P", 0, false},
+		{"PT", 0, false},
+		{"P1H", 0, false},
+		{"P1DT", 0, false},
+		{"P10", 0, false},
+		{"Pulse", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, ok := ParseDuration(tt.in)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
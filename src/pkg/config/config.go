@@ -20,10 +20,20 @@ type Config struct {
 	CompressionLevel     int    `json:"compressionLevel"` // 1-9 Fast-Best compression or 0 - No compression
 	DefaultUserID        string `json:"defaultUserId"`
 	DefaultGroupAccessID string `json:"defaultGroupAccessId"`
+	TreeIndexEncryption  bool   `json:"treeIndexEncryption"` // AQL tree index values are encrypted with the hm keys of the EHRs, see treeindex.ValueCipher
 	Storage              struct {
+		Type      string `json:"type"` // localfile (default), s3 or memory
 		Localfile struct {
 			Path string
 		}
+		S3 struct {
+			Endpoint        string
+			Region          string
+			Bucket          string
+			Prefix          string
+			AccessKeyID     string
+			SecretAccessKey string
+		} `json:"s3"`
 		Ipfs struct {
 			EndpointURLs []string `json:"endpointURLs"`
 		}
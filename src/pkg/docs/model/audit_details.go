@@ -0,0 +1,72 @@
+package model
+
+import (
+	"time"
+
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/common"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model/base"
+)
+
+// openEHR terminology codes of the AUDIT_DETAILS.change_type and VERSION.lifecycle_state
+// https://specifications.openehr.org/releases/TERM/latest/SupportTerminology.html
+const (
+	ChangeTypeCreation     = "249"
+	ChangeTypeAmendment    = "250"
+	ChangeTypeModification = "251"
+	ChangeTypeUnknown      = "253"
+	ChangeTypeDeleted      = "523"
+
+	LifecycleStateComplete   = "532"
+	LifecycleStateIncomplete = "553"
+	LifecycleStateDeleted    = "523"
+)
+
+var openEHRTerms = map[string]string{
+	ChangeTypeCreation:       "creation",
+	ChangeTypeAmendment:      "amendment",
+	ChangeTypeModification:   "modification",
+	ChangeTypeUnknown:        "unknown",
+	ChangeTypeDeleted:        "deleted",
+	LifecycleStateComplete:   "complete",
+	LifecycleStateIncomplete: "incomplete",
+}
+
+// NewOpenEHRCodedText returns DV_CODED_TEXT for the code of the openEHR terminology.
+func NewOpenEHRCodedText(code string) base.DvCodedText {
+	return base.NewDvCodedText(openEHRTerms[code], base.CodePhrase{
+		Type: base.CodePhraseItemType,
+		TerminologyID: base.ObjectID{
+			Type:  base.TerminologyIDItemType,
+			Value: "openehr",
+		},
+		CodeString: code,
+	})
+}
+
+// NewAuditDetails returns the audit of the change committed by the user at the given time.
+func NewAuditDetails(systemID, userID, changeType string, timeCommitted time.Time) AuditDetails {
+	return AuditDetails{
+		Type:     base.AuditDetailsType,
+		SystemID: systemID,
+		TimeCommitted: base.DvDateTime{
+			DvTemporal: base.DvTemporal{
+				DvValueBase: base.DvValueBase{Type: base.DvDateTimeItemType},
+			},
+			Value: timeCommitted.Format(common.OpenEhrTimeFormat),
+		},
+		ChangeType: NewOpenEHRCodedText(changeType),
+		Committer: base.NewPartyProxy(&base.PartyIdentified{
+			PartyProxyBase: base.PartyProxyBase{
+				Type: base.PartyIdentifiedItemType,
+				ExternalRef: &base.ObjectRef{
+					ID: base.ObjectID{
+						Type:  base.GenericIDItemType,
+						Value: userID,
+					},
+					Namespace: "users",
+					Type:      "PERSON",
+				},
+			},
+		}),
+	}
+}
@@ -1,8 +1,32 @@
 package base
 
+import "github.com/pkg/errors"
+
 // ContentItem
 // Abstract ancestor of all concrete content types.
 // https://specifications.openehr.org/releases/RM/Release-1.0.2/ehr.html#_content_item_class
 type ContentItem struct {
 	Locatable
 }
+
+// NewContentItem returns the empty content item of the RM type to unmarshal COMPOSITION.content and SECTION.items into.
+func NewContentItem(itemType ItemType) (Root, error) {
+	switch itemType {
+	case SectionItemType:
+		return &Section{}, nil
+	case ActionItemType:
+		return &Action{}, nil
+	case EvaluationItemType:
+		return &Evaluation{}, nil
+	case ObservationItemType:
+		return &Observation{}, nil
+	case InstructionItemType:
+		return &Instruction{}, nil
+	case AdminEntryItemType:
+		return &AdminEntry{}, nil
+	case GenericEntryItemType:
+		return &GenericEntry{}, nil
+	default:
+		return nil, errors.Errorf("unexpected content item type: '%v'", itemType)
+	}
+}
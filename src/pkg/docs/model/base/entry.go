@@ -91,3 +91,22 @@ type Observation struct {
 	State *History[ItemStructure] `json:"state,omitempty"`
 	CareEntry
 }
+
+// AdminEntry
+// Entry subtype for administrative information, i.e. information about setting up the clinical process,
+// but not itself clinically relevant. Archetypes will define contained information.
+// https://specifications.openehr.org/releases/RM/latest/ehr.html#_admin_entry_class
+type AdminEntry struct {
+	Entry
+	Data ItemStructure `json:"data"`
+}
+
+// GenericEntry
+// This class is used to create intermediate representations of data from sources not otherwise conforming
+// to openEHR classes, such as HL7 messages, relational databases and so on.
+//
+// https://specifications.openehr.org/releases/RM/latest/integration.html#_generic_entry_class
+type GenericEntry struct {
+	ContentItem
+	Data ItemTree `json:"data"`
+}
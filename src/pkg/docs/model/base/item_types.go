@@ -9,6 +9,7 @@ func (cit ItemType) ToString() string {
 const (
 	EHRItemType                ItemType = "EHR"
 	ActionItemType             ItemType = "ACTION"
+	AdminEntryItemType         ItemType = "ADMIN_ENTRY"
 	AuditDetailsType           ItemType = "AUDIT_DETAILS"
 	ActivityItemType           ItemType = "ACTIVITY"
 	ArchetypedItemType         ItemType = "ARCHETYPED"
@@ -40,15 +41,20 @@ const (
 	ElementItemType            ItemType = "ELEMENT"
 	EvaluationItemType         ItemType = "EVALUATION"
 	EventContextItemType       ItemType = "EVENT_CONTEXT"
+	GenericEntryItemType       ItemType = "GENERIC_ENTRY"
 	GenericIDItemType          ItemType = "GENERIC_ID"
 	HierObjectIDItemType       ItemType = "HIER_OBJECT_ID"
 	HistoryItemType            ItemType = "HISTORY"
 	InstructionItemType        ItemType = "INSTRUCTION"
+	InstructionDetailsItemType ItemType = "INSTRUCTION_DETAILS"
+	IntervalItemType           ItemType = "INTERVAL"
 	IsmTransitionItemType      ItemType = "ISM_TRANSITION"
 	ItemSingleItemType         ItemType = "ITEM_SINGLE"
 	ItemListItemType           ItemType = "ITEM_LIST"
 	ItemTableItemType          ItemType = "ITEM_TABLE"
 	ItemTreeItemType           ItemType = "ITEM_TREE"
+	LocatableRefItemType       ItemType = "LOCATABLE_REF"
+	ObjectRefItemType          ItemType = "OBJECT_REF"
 	ObjectVersionIDItemType    ItemType = "OBJECT_VERSION_ID"
 	ObservationItemType        ItemType = "OBSERVATION"
 	ParticipationItemType      ItemType = "PARTICIPATION"
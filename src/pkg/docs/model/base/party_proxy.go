@@ -31,11 +31,21 @@ func NewPartyProxy(pp PartyProxier) PartyProxy {
 	}
 }
 
+// GetData returns the concrete party proxy object or nil if it is not set.
+func (pp PartyProxy) GetData() PartyProxier {
+	return pp.data
+}
+
 func (pp PartyProxy) MarshalJSON() ([]byte, error) {
 	return json.Marshal(pp.data)
 }
 
 func (pp *PartyProxy) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		pp.data = nil
+		return nil
+	}
+
 	tmp := struct {
 		Type ItemType `json:"_type"`
 	}{}
@@ -50,7 +60,7 @@ func (pp *PartyProxy) UnmarshalJSON(data []byte) error {
 	case PartyIdentifiedItemType:
 		pp.data = &PartyIdentified{}
 	case PartyRelatedItemType:
-		pp.data = &PartyIdentified{}
+		pp.data = &PartyRelated{}
 	default:
 		return fmt.Errorf("unexpected PartyProxy type: '%v'", tmp.Type) //nolint
 	}
@@ -49,19 +49,13 @@ func (item *sectionItemWrapper) UnmarshalJSON(data []byte) error {
 		return errors.Wrap(err, "cannot unmarshal section item wrapper")
 	}
 
-	switch str.Type {
-	case ActionItemType:
-		item.contentItem = &Action{}
-	case EvaluationItemType:
-		item.contentItem = &Evaluation{}
-	case ObservationItemType:
-		item.contentItem = &Observation{}
-	case InstructionItemType:
-		item.contentItem = &Instruction{}
-	default:
-		return errors.Errorf("unexpected section item type: '%v'", str.Type)
+	contentItem, err := NewContentItem(str.Type)
+	if err != nil {
+		return errors.Wrap(err, "cannot create section item")
 	}
 
+	item.contentItem = contentItem
+
 	if err := json.Unmarshal(data, item.contentItem); err != nil {
 		return errors.Wrapf(err, "cannot unmarshal secion item type: '%v'", str.Type)
 	}
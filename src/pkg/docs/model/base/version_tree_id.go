@@ -86,3 +86,63 @@ func (v *VersionTreeID) Increase() string {
 
 	return v.String()
 }
+
+func (v *VersionTreeID) parts() []int {
+	result := []int{}
+
+	for _, s := range []string{v.trunkVersion, v.branchNumber, v.branchVersion} {
+		if s == "" {
+			break
+		}
+
+		i, _ := strconv.Atoi(s)
+		result = append(result, i)
+	}
+
+	return result
+}
+
+// IsFull reports whether the version has all three parts, e.g. 1.0.2.
+func (v *VersionTreeID) IsFull() bool {
+	return v.branchVersion != ""
+}
+
+// Compare compares the versions part by part numerically, so 1.10.0 is greater than 1.9.0.
+// The missing parts are less than any part, so 1.0 is less than 1.0.0.
+func (v *VersionTreeID) Compare(other *VersionTreeID) int {
+	x, y := v.parts(), other.parts()
+
+	for i := 0; i < len(x) && i < len(y); i++ {
+		switch {
+		case x[i] < y[i]:
+			return -1
+		case x[i] > y[i]:
+			return 1
+		}
+	}
+
+	switch {
+	case len(x) < len(y):
+		return -1
+	case len(x) > len(y):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// HasPrefix reports whether the version starts with the parts of the prefix, e.g. 1.2.3 has the prefixes 1 and 1.2.
+func (v *VersionTreeID) HasPrefix(prefix *VersionTreeID) bool {
+	x, p := v.parts(), prefix.parts()
+	if len(p) > len(x) {
+		return false
+	}
+
+	for i := range p {
+		if x[i] != p[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -196,3 +196,48 @@ func TestVersionTreeID_Increase(t *testing.T) {
 		})
 	}
 }
+
+func TestVersionTreeID_Compare(t *testing.T) {
+	tests := []struct {
+		x, y string
+		want int
+	}{
+		{"1.0.1", "1.0.1", 0},
+		{"1.0.1", "1.0.2", -1},
+		{"1.10.0", "1.9.0", 1},
+		{"2", "1.9.9", 1},
+		{"1.0", "1.0.0", -1},
+	}
+
+	for _, tt := range tests {
+		x, _ := NewVersionTreeID(tt.x)
+		y, _ := NewVersionTreeID(tt.y)
+
+		if got := x.Compare(y); got != tt.want {
+			t.Errorf("Compare(%s, %s) = %d, want %d", tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+func TestVersionTreeID_HasPrefix(t *testing.T) {
+	tests := []struct {
+		version, prefix string
+		want            bool
+	}{
+		{"1.2.3", "1", true},
+		{"1.2.3", "1.2", true},
+		{"1.2.3", "1.2.3", true},
+		{"1.2.3", "1.3", false},
+		{"1.20.3", "1.2", false},
+		{"1.2", "1.2.3", false},
+	}
+
+	for _, tt := range tests {
+		v, _ := NewVersionTreeID(tt.version)
+		p, _ := NewVersionTreeID(tt.prefix)
+
+		if got := v.HasPrefix(p); got != tt.want {
+			t.Errorf("%s.HasPrefix(%s) = %v, want %v", tt.version, tt.prefix, got, tt.want)
+		}
+	}
+}
@@ -85,15 +85,13 @@ func (w *compositionContentWrapper) UnmarshalJSON(data []byte) error {
 		return errors.Wrap(err, "can't unmarshal composition content wrapper")
 	}
 
-	switch tmp.Type {
-	case base.SectionItemType:
-		fallthrough
-	case base.EvaluationItemType:
-		w.item = &base.Section{}
-	default:
-		return errors.Errorf("unexpected composition content item: '%v'", tmp.Type)
+	item, err := base.NewContentItem(tmp.Type)
+	if err != nil {
+		return errors.Wrap(err, "cannot create composition content item")
 	}
 
+	w.item = item
+
 	if err := json.Unmarshal(data, w.item); err != nil {
 		return errors.Wrapf(err, "cannot unmarshal composition content item: '%v'", tmp.Type)
 	}
@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// CompositionVersion is the stored version of the composition with the commit time and the status recorded by the indexer.
+// Composition is nil until the document is read by the metadata.
+type CompositionVersion struct {
+	UID           string
+	Composition   *Composition
+	TimeCommitted time.Time
+	Deleted       bool
+	Meta          *DocumentMeta
+}
@@ -6,8 +6,15 @@ type QueryRequest struct {
 	Offset          int                    `json:"offset"`
 	Fetch           int                    `json:"fetch"`
 	QueryParameters map[string]interface{} `json:"query_parameters"`
+
+	// ContinuationToken of the previous response requests the next page of its result
+	ContinuationToken string `json:"continuation_token,omitempty"`
 }
 
+// QueryParameterText is the value of the query parameter passed as text, e.g. in the URL of the GET request.
+// Unlike the JSON values it has no type of its own, the type of the stored query parameter is used.
+type QueryParameterText string
+
 func (q *QueryRequest) Validate() bool {
 	return len(q.Query) != 0
 }
@@ -26,6 +33,9 @@ type QueryResponse struct {
 	Query   string        `json:"q"`
 	Columns []QueryColumn `json:"columns"`
 	Rows    []interface{} `json:"rows"`
+
+	// ContinuationToken is set when the result has more rows than fetched
+	ContinuationToken string `json:"continuation_token,omitempty"`
 }
 
 func (q *QueryResponse) Validate() bool {
@@ -13,6 +13,16 @@ type StoredQuery struct {
 	Version     string    `json:"version"`
 	TimeCreated string    `json:"saved"`
 	Query       string    `json:"q"`
+
+	// Parameters are extracted from the query when it is stored, they are checked before the query is executed
+	Parameters []QueryParameter `json:"parameters,omitempty"`
+}
+
+// QueryParameter is the parameter of the stored query with the type inferred from its usage in the query:
+// string, number or any primitive value.
+type QueryParameter struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
 }
 
 func (q *StoredQuery) Validate() error {
@@ -4,7 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log"
 	"math/big"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/sha3"
@@ -124,10 +128,6 @@ func (s *Service) Create(ctx context.Context, userID, systemID string, ehrUUID,
 		return nil, fmt.Errorf("Composition %s save error: %w", composition.UID.Value, err)
 	}
 
-	if err := treeindex.AddComposition(ehrUUID.String(), *composition); err != nil {
-		return nil, fmt.Errorf("Composition %s save into tree index error: %w", composition.UID.Value, err)
-	}
-
 	txHash, err := multiCallTx.Commit()
 	if err != nil {
 		return nil, fmt.Errorf("Create composition commit error: %w", err)
@@ -137,6 +137,12 @@ func (s *Service) Create(ctx context.Context, userID, systemID string, ehrUUID,
 		procRequest.AddEthereumTx(proc.TxKind(txKind), txHash)
 	}
 
+	audit := model.NewAuditDetails(systemID, userID, model.ChangeTypeCreation, time.Now())
+
+	if err := treeindex.AddComposition(ehrUUID.String(), *composition, audit); err != nil {
+		log.Printf("Composition %s save into tree index error: %v, EHR is re-indexed on the next restore", composition.UID.Value, err)
+	}
+
 	return composition, nil
 }
 
@@ -183,7 +189,13 @@ func (s *Service) Update(ctx context.Context, procRequest *proc.Request, userID,
 		procRequest.AddEthereumTx(proc.TxKind(txKind), txHash)
 	}
 
-	// TODO what we should do with prev composition?
+	// Previous versions are kept in the tree index versions history, COMPOSITION queries see only the last one
+	audit := model.NewAuditDetails(systemID, userID, model.ChangeTypeModification, time.Now())
+
+	if err := treeindex.UpdateComposition(ehrUUID.String(), *composition, audit); err != nil {
+		log.Printf("Composition %s update in tree index error: %v, EHR is re-indexed on the next restore", composition.UID.Value, err)
+	}
+
 	return composition, nil
 }
 
@@ -311,6 +323,10 @@ func (s *Service) save(ctx context.Context, multiCallTx *indexer.MultiCallTx, pr
 		multiCallTx.Add(uint8(proc.TxAddEhrDoc), packed)
 	}
 
+	if err := treeindex.AddDoc(CID.String(), ehrUUID.String(), objectVersionID.String()); err != nil {
+		log.Printf("Composition document %s save into tree index error: %v", CID.String(), err)
+	}
+
 	// Index DataSearch
 	_ = groupAccess
 	/* TODO
@@ -404,6 +420,10 @@ func (s *Service) GetByID(ctx context.Context, userID, systemID string, ehrUUID
 		return nil, fmt.Errorf("GetCompositionByID error: %w", errors.ErrAlreadyDeleted)
 	}
 
+	return s.getByMeta(ctx, userID, systemID, ehrUUID, docMeta)
+}
+
+func (s *Service) getByMeta(ctx context.Context, userID, systemID string, ehrUUID *uuid.UUID, docMeta *model.DocumentMeta) (*model.Composition, error) {
 	CID, err := cid.Parse(docMeta.Id)
 	if err != nil {
 		return nil, fmt.Errorf("cid.Parse error: %w", err)
@@ -453,6 +473,12 @@ func (s *Service) DeleteByID(ctx context.Context, procRequest *proc.Request, ehr
 
 	procRequest.AddEthereumTx(proc.TxDeleteDoc, txHash)
 
+	audit := model.NewAuditDetails(systemID, userID, model.ChangeTypeDeleted, time.Now())
+
+	if err := treeindex.DeleteComposition(ehrUUID.String(), versionUID, audit); err != nil && !errors.Is(err, errors.ErrNotFound) {
+		log.Printf("Composition %s delete from tree index error: %v, EHR is re-indexed on the next restore", versionUID, err)
+	}
+
 	// Waiting for tx processed and pending nonce increased
 	//time.Sleep(common.BlockchainTxProcAwaitTime)
 
@@ -541,3 +567,133 @@ func (s *Service) IsExist(ctx context.Context, args ...string) (bool, error) {
 
 	return (ok != nil), nil
 }
+
+// ListVersions returns the stored versions of the compositions of the user, the deleted ones included,
+// ordered by the versioned object and the version. Only the indexer metadata is read: the uid, the commit time and the status,
+// the documents are read by GetVersion. The documents which metadata can not be decrypted are logged and skipped.
+func (s *Service) ListVersions(ctx context.Context, userID, systemID string) ([]*model.CompositionVersion, error) {
+	docsMeta, err := s.indexer.ListDocByType(ctx, userID, systemID, types.Composition)
+	if err != nil {
+		if errors.Is(err, errors.ErrNotFound) {
+			return nil, err
+		}
+
+		return nil, fmt.Errorf("ListDocByType error: %w", err)
+	}
+
+	var (
+		list       []*model.CompositionVersion
+		versionIDs = map[*model.CompositionVersion]*base.ObjectVersionID{}
+	)
+
+	for i := range docsMeta {
+		c := &docsMeta[i]
+
+		objectVersionID, err := s.versionID(userID, systemID, c)
+		if err != nil {
+			log.Printf("Composition %x version list error: %v", c.Id, err)
+			continue
+		}
+
+		version := &model.CompositionVersion{
+			UID:           objectVersionID.String(),
+			TimeCommitted: time.Unix(int64(c.Timestamp), 0),
+			Deleted:       c.Status == uint8(status.DELETED),
+			Meta:          c,
+		}
+
+		list = append(list, version)
+		versionIDs[version] = objectVersionID
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := versionIDs[list[i]], versionIDs[list[j]]
+		if a.BasedID() != b.BasedID() {
+			return a.BasedID() < b.BasedID()
+		}
+
+		return lessVersion(a.VersionString(), b.VersionString())
+	})
+
+	return list, nil
+}
+
+func (s *Service) versionID(userID, systemID string, docMeta *model.DocumentMeta) (*base.ObjectVersionID, error) {
+	keyEncr := model.AttributesEhr(docMeta.Attrs).GetByCode(model.AttributeKeyEncr)
+	if keyEncr == nil {
+		return nil, fmt.Errorf("%w: meta field KeyEncr is empty", errors.ErrCustom)
+	}
+
+	uidEncr := model.AttributesEhr(docMeta.Attrs).GetByCode(model.AttributeDocUIDEncr)
+	if uidEncr == nil {
+		return nil, fmt.Errorf("%w: meta field DocUIDEncr is empty", errors.ErrCustom)
+	}
+
+	docKey, err := s.docSvc.DecryptKey(userID, keyEncr)
+	if err != nil {
+		return nil, fmt.Errorf("DecryptKey error: %w", err)
+	}
+
+	uid, err := docKey.Decrypt(uidEncr)
+	if err != nil {
+		return nil, fmt.Errorf("UID decryption error: %w", err)
+	}
+
+	objectVersionID, err := base.NewObjectVersionID(string(uid), systemID)
+	if err != nil {
+		return nil, fmt.Errorf("NewObjectVersionID error: %w versionUID %s", err, uid)
+	}
+
+	return objectVersionID, nil
+}
+
+// GetVersion reads the composition of the version listed by ListVersions.
+// It returns ErrNotFound for the versions of the user's other EHRs.
+func (s *Service) GetVersion(ctx context.Context, userID, systemID string, ehrUUID *uuid.UUID, version *model.CompositionVersion) (*model.Composition, error) {
+	objectVersionID, err := base.NewObjectVersionID(version.UID, systemID)
+	if err != nil {
+		return nil, fmt.Errorf("NewObjectVersionID error: %w versionUID %s", err, version.UID)
+	}
+
+	baseDocumentUIDHash := sha3.Sum256([]byte(objectVersionID.BasedID()))
+
+	docMeta, err := s.indexer.GetDocByVersion(ctx, ehrUUID, types.Composition, &baseDocumentUIDHash, objectVersionID.VersionBytes())
+	if err != nil {
+		if errors.Is(err, errors.ErrNotFound) {
+			return nil, err
+		}
+
+		return nil, fmt.Errorf("Index.GetDocByVersion error: %w objectVersionID %s", err, objectVersionID)
+	}
+
+	composition, err := s.getByMeta(ctx, userID, systemID, ehrUUID, docMeta)
+	if err != nil {
+		return nil, fmt.Errorf("getByMeta error: %w versionUID %s", err, version.UID)
+	}
+
+	return composition, nil
+}
+
+// lessVersion compares the version tree ids by their numbers, e.g. "2" is less than "10".
+func lessVersion(a, b string) bool {
+	aParts, bParts := strings.Split(a, "."), strings.Split(b, ".")
+
+	for i := 0; i < len(aParts) && i < len(bParts); i++ {
+		an, aErr := strconv.Atoi(aParts[i])
+		bn, bErr := strconv.Atoi(bParts[i])
+
+		if aErr != nil || bErr != nil {
+			if aParts[i] != bParts[i] {
+				return aParts[i] < bParts[i]
+			}
+
+			continue
+		}
+
+		if an != bn {
+			return an < bn
+		}
+	}
+
+	return len(aParts) < len(bParts)
+}
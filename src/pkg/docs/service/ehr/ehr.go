@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/google/uuid"
@@ -140,10 +141,6 @@ func (s *Service) EhrCreateWithID(ctx context.Context, userID, systemID string,
 		return nil, fmt.Errorf("SaveEhr error: %w", err)
 	}
 
-	if err := treeindex.AddEHR(ehr); err != nil {
-		return nil, fmt.Errorf("Add EHR into tree index error: %w", err)
-	}
-
 	txHash, err := multiCallTx.Commit()
 	if err != nil {
 		return nil, fmt.Errorf("EhrCreateWithID commit error: %w", err)
@@ -153,6 +150,10 @@ func (s *Service) EhrCreateWithID(ctx context.Context, userID, systemID string,
 		procRequest.AddEthereumTx(proc.TxKind(txKind), txHash)
 	}
 
+	if err := treeindex.AddEHR(ehr); err != nil {
+		log.Printf("Add EHR %s into tree index error: %v, EHR is re-indexed on the next restore", ehr.EhrID.Value, err)
+	}
+
 	// Granting access to the group 'All documents' for the 'Doctors' group
 	{
 		userGroupList, err := s.User.GroupGetList(ctx, userID, systemID)
@@ -309,6 +310,11 @@ func (s *Service) SaveEhr(ctx context.Context, multiCallTx *indexer.MultiCallTx,
 		multiCallTx.Add(uint8(proc.TxDocGroupAddDoc), packed)
 	}
 
+	// The documents granted by the access lists are resolved into the EHR when it is queried
+	if err := treeindex.AddDoc(CID.String(), ehrUUID.String(), ""); err != nil {
+		log.Printf("EHR document %s save into tree index error: %v", CID.String(), err)
+	}
+
 	return nil
 }
 
@@ -574,6 +580,10 @@ func (s *Service) SaveStatus(ctx context.Context, multiCallTx *indexer.MultiCall
 		multiCallTx.Add(uint8(proc.TxDocGroupAddDoc), packed)
 	}
 
+	if err := treeindex.AddDoc(CID.String(), ehrUUID.String(), ""); err != nil {
+		log.Printf("EHR_STATUS document %s save into tree index error: %v", CID.String(), err)
+	}
+
 	return nil
 }
 
@@ -627,6 +637,10 @@ func (s *Service) UpdateStatus(ctx context.Context, procRequest *proc.Request, u
 		procRequest.AddEthereumTx(proc.TxKind(txKind), txHash)
 	}
 
+	if err := treeindex.UpdateEHRStatus(ehrUUID.String(), *status); err != nil {
+		log.Printf("EHR %s status update in tree index error: %v, EHR is re-indexed on the next restore", ehrUUID.String(), err)
+	}
+
 	return nil
 }
 
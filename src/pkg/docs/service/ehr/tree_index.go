@@ -0,0 +1,230 @@
+package ehr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ipfs/go-cid"
+
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/types"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/errors"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/storage/treeindex"
+)
+
+type CompositionLister interface {
+	ListVersions(ctx context.Context, userID, systemID string) ([]*model.CompositionVersion, error)
+	GetVersion(ctx context.Context, userID, systemID string, ehrUUID *uuid.UUID, version *model.CompositionVersion) (*model.Composition, error)
+}
+
+// RestoreTreeIndex reconciles the tree index with the EHRs created through the gateway and the versions history of their compositions.
+// The EHRs missing in the index or marked stale are indexed again from scratch, the versions committed meanwhile,
+// e.g. by another gateway or while the index was not persisted, are added into the indexed EHRs.
+// Only the documents missing in the index are read. EHRs and documents that can not be restored are logged and skipped,
+// so one broken document does not block the startup, the missing versions are tried again by the next restore.
+func (s *Service) RestoreTreeIndex(ctx context.Context, systemID string, compositions CompositionLister) error {
+	requests, err := s.Doc.Proc.GetEhrRequests()
+	if err != nil {
+		return fmt.Errorf("GetEhrRequests error: %w", err)
+	}
+
+	for _, r := range requests {
+		if err := s.restoreEhr(ctx, r.UserID, systemID, r.EhrUUID, compositions); err != nil {
+			log.Printf("Tree index restore error: %v userID %s ehrID %s", err, r.UserID, r.EhrUUID)
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) restoreEhr(ctx context.Context, userID, systemID, ehrID string, compositions CompositionLister) error {
+	ehrUUID, err := uuid.Parse(ehrID)
+	if err != nil {
+		return fmt.Errorf("uuid.Parse error: %w", err)
+	}
+
+	if treeindex.DefaultEHRIndex.IsStale(ehrID) {
+		if err := treeindex.RemoveEHR(ehrID); err != nil {
+			return fmt.Errorf("treeindex.RemoveEHR error: %w", err)
+		}
+	}
+
+	if !treeindex.DefaultEHRIndex.IsIndexed(ehrID) {
+		docDecrypted, err := s.GetByID(ctx, userID, systemID, &ehrUUID)
+		if err != nil {
+			return fmt.Errorf("GetByID error: %w", err)
+		}
+
+		var ehr model.EHR
+		if err = json.Unmarshal(docDecrypted, &ehr); err != nil {
+			return fmt.Errorf("EHR unmarshal error: %w", err)
+		}
+
+		if err := treeindex.AddEHR(ehr); err != nil {
+			return fmt.Errorf("treeindex.AddEHR error: %w", err)
+		}
+	}
+
+	status, err := s.GetStatus(ctx, userID, systemID, &ehrUUID)
+	if err != nil {
+		return fmt.Errorf("GetStatus error: %w", err)
+	}
+
+	ehrNodes, err := treeindex.DefaultEHRIndex.GetEHRs(ehrID)
+	if err != nil {
+		return fmt.Errorf("treeindex.GetEHRs error: %w", err)
+	}
+
+	if ehrNodes[0].IsQueryable() != status.IsQueryable {
+		if err := treeindex.UpdateEHRStatus(ehrID, *status); err != nil {
+			return fmt.Errorf("treeindex.UpdateEHRStatus error: %w", err)
+		}
+	}
+
+	versions, err := compositions.ListVersions(ctx, userID, systemID)
+	if err != nil && !errors.Is(err, errors.ErrNotFound) {
+		return fmt.Errorf("ListVersions error: %w", err)
+	}
+
+	// the versions are ordered by the versioned object
+	for start := 0; start < len(versions); {
+		end := start + 1
+		for end < len(versions) && baseUID(versions[end].UID) == baseUID(versions[start].UID) {
+			end++
+		}
+
+		restoreVersions(ctx, userID, systemID, &ehrUUID, versions[start:end], compositions)
+
+		start = end
+	}
+
+	if err := s.restoreDocs(ctx, userID, systemID, ehrID, versions); err != nil {
+		return err
+	}
+
+	if err := treeindex.DefaultEHRIndex.ClearStale(ehrID); err != nil {
+		return fmt.Errorf("treeindex.ClearStale error: %w", err)
+	}
+
+	return nil
+}
+
+// restoreDocs records the CIDs of the EHR documents missing in the index, so the documents granted to other users
+// are resolved into the EHR by the query scopes: the EHR and EHR_STATUS documents and the indexed composition versions.
+func (s *Service) restoreDocs(ctx context.Context, userID, systemID, ehrID string, versions []*model.CompositionVersion) error {
+	addDoc := func(docID []byte, uid string) {
+		CID, err := cid.Parse(docID)
+		if err != nil {
+			log.Printf("Tree index restore error: cid.Parse error: %v ehrID %s", err, ehrID)
+			return
+		}
+
+		if _, ok := treeindex.DefaultEHRIndex.GetDoc(CID.String()); ok {
+			return
+		}
+
+		if err := treeindex.AddDoc(CID.String(), ehrID, uid); err != nil {
+			log.Printf("Tree index restore error: treeindex.AddDoc error: %v ehrID %s CID %s", err, ehrID, CID.String())
+		}
+	}
+
+	// the user has the only EHR, so all the EHR documents of the user are its documents
+	for _, docType := range []types.DocumentType{types.Ehr, types.EhrStatus} {
+		docsMeta, err := s.Infra.Index.ListDocByType(ctx, userID, systemID, docType)
+		if err != nil && !errors.Is(err, errors.ErrNotFound) {
+			return fmt.Errorf("ListDocByType error: %w docType %s", err, docType.String())
+		}
+
+		for _, docMeta := range docsMeta {
+			addDoc(docMeta.Id, "")
+		}
+	}
+
+	for _, v := range versions {
+		// the versions of the other EHRs of the user are not indexed in this EHR
+		if v.Meta != nil && treeindex.DefaultEHRIndex.IsVersionIndexed(ehrID, v.UID, false) {
+			addDoc(v.Meta.Id, v.UID)
+		}
+	}
+
+	return nil
+}
+
+// restoreVersions indexes the versions of the versioned object missing in the index, the indexed ones are not read.
+// If the indexed last version is followed by the restored ones, it is indexed again, so it stays the indexed composition.
+func restoreVersions(ctx context.Context, userID, systemID string, ehrUUID *uuid.UUID, versions []*model.CompositionVersion, compositions CompositionLister) {
+	ehrID := ehrUUID.String()
+	last := len(versions) - 1
+	restored := -1
+
+	for i, v := range versions {
+		switch {
+		case !treeindex.DefaultEHRIndex.IsVersionIndexed(ehrID, v.UID, false):
+		case v.Deleted && !treeindex.DefaultEHRIndex.IsVersionIndexed(ehrID, v.UID, true):
+			if err := deleteVersion(userID, systemID, ehrID, v); err != nil {
+				log.Printf("Tree index restore error: %v ehrID %s version %s", err, ehrID, v.UID)
+			}
+
+			continue
+		case i == last && restored >= 0:
+		default:
+			continue
+		}
+
+		if err := restoreVersion(ctx, userID, systemID, ehrUUID, v, i == 0, compositions); err != nil {
+			if !errors.Is(err, errors.ErrNotFound) {
+				log.Printf("Tree index restore error: %v ehrID %s version %s", err, ehrID, v.UID)
+			}
+
+			continue
+		}
+
+		restored = i
+	}
+}
+
+func restoreVersion(ctx context.Context, userID, systemID string, ehrUUID *uuid.UUID, v *model.CompositionVersion, created bool, compositions CompositionLister) error {
+	composition, err := compositions.GetVersion(ctx, userID, systemID, ehrUUID, v)
+	if err != nil {
+		// ErrNotFound for the versions of the user's other EHRs
+		return err
+	}
+
+	changeType := model.ChangeTypeModification
+	if created {
+		changeType = model.ChangeTypeCreation
+	}
+
+	audit := model.NewAuditDetails(systemID, userID, changeType, v.TimeCommitted)
+
+	if err := treeindex.UpdateComposition(ehrUUID.String(), *composition, audit); err != nil {
+		return fmt.Errorf("treeindex.UpdateComposition error: %w", err)
+	}
+
+	if !v.Deleted {
+		return nil
+	}
+
+	return deleteVersion(userID, systemID, ehrUUID.String(), v)
+}
+
+func deleteVersion(userID, systemID, ehrID string, v *model.CompositionVersion) error {
+	// The indexer keeps the status of the deleted version only, the time of the deletion is not stored
+	audit := model.NewAuditDetails(systemID, userID, model.ChangeTypeDeleted, time.Time{})
+	audit.TimeCommitted.Value = ""
+
+	if err := treeindex.DeleteComposition(ehrID, v.UID, audit); err != nil && !errors.Is(err, errors.ErrNotFound) {
+		return fmt.Errorf("treeindex.DeleteComposition error: %w", err)
+	}
+
+	return nil
+}
+
+func baseUID(uid string) string {
+	return strings.SplitN(uid, "::", 2)[0]
+}
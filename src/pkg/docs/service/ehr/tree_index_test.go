@@ -0,0 +1,100 @@
+package ehr
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model/base"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/errors"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/storage/treeindex"
+)
+
+type testCompositionLister struct {
+	failed map[string]bool
+	read   []string
+}
+
+func (l *testCompositionLister) ListVersions(ctx context.Context, userID, systemID string) ([]*model.CompositionVersion, error) {
+	return nil, errors.ErrNotFound
+}
+
+func (l *testCompositionLister) GetVersion(ctx context.Context, userID, systemID string, ehrUUID *uuid.UUID, version *model.CompositionVersion) (*model.Composition, error) {
+	l.read = append(l.read, version.UID)
+
+	if l.failed[version.UID] {
+		return nil, errors.New("unreadable document")
+	}
+
+	data, err := os.ReadFile("./../../../aqlquerier/test_fixtures/composition_2.json")
+	if err != nil {
+		return nil, err
+	}
+
+	var composition model.Composition
+	if err := json.Unmarshal(data, &composition); err != nil {
+		return nil, err
+	}
+
+	composition.UID = &base.UIDBasedID{ObjectID: base.ObjectID{Value: version.UID}}
+
+	return &composition, nil
+}
+
+func TestRestoreVersions(t *testing.T) {
+	prev := treeindex.DefaultEHRIndex
+	treeindex.DefaultEHRIndex = treeindex.NewEHRIndex()
+
+	t.Cleanup(func() { treeindex.DefaultEHRIndex = prev })
+
+	data, err := os.ReadFile("./../../../../../data/mock/ehr/ehr.json")
+	require.NoError(t, err)
+
+	var ehr model.EHR
+	require.NoError(t, json.Unmarshal(data, &ehr))
+	require.NoError(t, treeindex.AddEHR(ehr))
+
+	ehrUUID := uuid.MustParse(ehr.EhrID.Value)
+	ctx := context.Background()
+
+	const objectID = "8d5b2eb1-ad71-4ae8-8a9d-9b8d2f3b3b3a::openEHRSys.example.com::"
+
+	versions := []*model.CompositionVersion{
+		{UID: objectID + "1", TimeCommitted: time.Unix(1, 0)},
+		{UID: objectID + "2", TimeCommitted: time.Unix(2, 0)},
+		{UID: objectID + "3", TimeCommitted: time.Unix(3, 0)},
+	}
+
+	lister := &testCompositionLister{failed: map[string]bool{objectID + "2": true}}
+
+	restoreVersions(ctx, "user", "system", &ehrUUID, versions, lister)
+
+	assert.Equal(t, []string{objectID + "1", objectID + "2", objectID + "3"}, lister.read)
+	assert.True(t, treeindex.DefaultEHRIndex.IsVersionIndexed(ehr.EhrID.Value, objectID+"1", false))
+	assert.False(t, treeindex.DefaultEHRIndex.IsVersionIndexed(ehr.EhrID.Value, objectID+"2", false), "the unreadable version is skipped")
+	assert.True(t, treeindex.DefaultEHRIndex.IsVersionIndexed(ehr.EhrID.Value, objectID+"3", false))
+
+	// the next restore reads the missing version and the last one to keep it the indexed composition
+	lister.read, lister.failed = nil, nil
+
+	restoreVersions(ctx, "user", "system", &ehrUUID, versions, lister)
+
+	assert.Equal(t, []string{objectID + "2", objectID + "3"}, lister.read)
+	assert.True(t, treeindex.DefaultEHRIndex.IsVersionIndexed(ehr.EhrID.Value, objectID+"2", false))
+
+	// the complete index reads no documents, the deletion is restored from the metadata
+	lister.read = nil
+	versions[2].Deleted = true
+
+	restoreVersions(ctx, "user", "system", &ehrUUID, versions, lister)
+
+	assert.Empty(t, lister.read)
+	assert.True(t, treeindex.DefaultEHRIndex.IsVersionIndexed(ehr.EhrID.Value, objectID+"3", true))
+}
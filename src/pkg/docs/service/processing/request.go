@@ -282,3 +282,19 @@ func (p *Proc) GetRequest(userID, reqID string) ([]byte, error) {
 
 	return resultBytes, nil
 }
+
+// GetEhrRequests returns all EHR creation requests that were not failed.
+// It is used to find out which EHRs are known by the gateway, e.g. to rebuild the tree index on startup.
+func (p *Proc) GetEhrRequests() ([]*Request, error) {
+	var requests []*Request
+
+	err := p.db.Model(&Request{}).
+		Where("kind IN ?", []RequestKind{RequestEhrCreate, RequestEhrCreateWithID}).
+		Where("status <> ?", StatusFailed).
+		Find(&requests).Error
+	if err != nil {
+		return nil, fmt.Errorf("EHR requests select error: %w", err)
+	}
+
+	return requests, nil
+}
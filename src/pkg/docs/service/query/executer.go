@@ -3,117 +3,411 @@ package query
 import (
 	"context"
 	"database/sql"
-	"fmt"
+	"sync"
 
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/aqlquerier"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/common"
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/errors"
 
 	"github.com/jmoiron/sqlx"
 )
 
-type queryCallback func(columns []string, rows []any, err error)
+// RowsWriter gets the result of the query while the rows are read.
+// WriteColumns is called once before the rows.
+type RowsWriter interface {
+	WriteColumns(columns []string) error
+	WriteRow(row []any) error
+}
+
+type rowsCollector struct {
+	columns []string
+	rows    []any
+}
+
+func (rc *rowsCollector) WriteColumns(columns []string) error {
+	rc.columns = columns
+	return nil
+}
+
+func (rc *rowsCollector) WriteRow(row []any) error {
+	rc.rows = append(rc.rows, row)
+	return nil
+}
+
+type rowsBufferItem struct {
+	columns []string
+	row     []any
+}
+
+// rowsBuffer passes the columns and the rows read by the worker to the goroutine calling the writer.
+type rowsBuffer struct {
+	ctx   context.Context
+	items chan rowsBufferItem
+}
+
+func (b *rowsBuffer) WriteColumns(columns []string) error {
+	if columns == nil {
+		columns = []string{}
+	}
+
+	return b.put(rowsBufferItem{columns: columns})
+}
+
+func (b *rowsBuffer) WriteRow(row []any) error {
+	return b.put(rowsBufferItem{row: row})
+}
+
+func (b *rowsBuffer) put(item rowsBufferItem) error {
+	select {
+	case b.items <- item:
+		return nil
+	case <-b.ctx.Done():
+		return b.ctx.Err()
+	}
+}
+
+// query is the job of the worker, run executes the query or explains it.
 type query struct {
-	ctx      context.Context
-	query    string
-	args     []any
-	callback queryCallback
+	ctx    context.Context
+	userID string
+	run    func(ctx context.Context) error
+	result chan error
 }
 
+// ExecuterService runs the queries on the bounded pool of workers.
+// Every user has its own queue, the workers take the queries from the queues in turn,
+// so the queries of one user do not block the others. A user runs at most userLimit queries at once.
 type ExecuterService struct {
-	db          *sqlx.DB
-	queriesChan chan query
+	db        *sqlx.DB
+	userLimit int
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queues  map[string][]*query
+	users   []string // users with queued queries in the order of their turns
+	running map[string]int
+	closed  bool
+	wg      sync.WaitGroup
 }
 
-func NewQueryExecuterService(db *sqlx.DB) *ExecuterService {
+func NewQueryExecuterService(db *sqlx.DB, workers, userLimit int) *ExecuterService {
+	if workers < 1 {
+		workers = 1
+	}
+
+	if userLimit < 1 {
+		userLimit = workers
+	}
+
 	svc := &ExecuterService{
-		db:          db,
-		queriesChan: make(chan query, 100),
+		db:        db,
+		userLimit: userLimit,
+		queues:    map[string][]*query{},
+		running:   map[string]int{},
 	}
 
-	go svc.run()
+	svc.cond = sync.NewCond(&svc.mu)
+
+	svc.wg.Add(workers)
+
+	for i := 0; i < workers; i++ {
+		go svc.run()
+	}
 
 	return svc
 }
 
 func (svc *ExecuterService) run() {
-	for q := range svc.queriesChan {
-		if q.ctx.Err() != nil {
-			continue
-		}
+	defer svc.wg.Done()
 
-		rows, err := svc.db.QueryxContext(q.ctx, q.query, q.args...)
-		if err != nil {
-			q.callback(nil, nil, errors.Wrap(err, "cannot query rows"))
-			continue
+	for {
+		q, ok := svc.next()
+		if !ok {
+			return
 		}
 
-		columns, err := rows.Columns()
-		if err != nil {
-			q.callback(nil, nil, errors.Wrap(err, "cannot get columns"))
-			continue
+		q.result <- svc.exec(q)
+
+		svc.done(q)
+	}
+}
+
+// next waits for the query which can be run by the user limit.
+// It returns false when the service is closed.
+func (svc *ExecuterService) next() (*query, bool) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	for {
+		if svc.closed {
+			return nil, false
 		}
 
-		result := []any{}
+		for i, userID := range svc.users {
+			if svc.running[userID] >= svc.userLimit {
+				continue
+			}
+
+			queue := svc.queues[userID]
+			q := queue[0]
 
-		for rows.Next() {
-			row, err := rows.SliceScan()
-			if err != nil {
-				q.callback(nil, nil, errors.Wrap(err, "cannot scan row"))
+			svc.users = append(svc.users[:i], svc.users[i+1:]...)
+
+			if len(queue) > 1 {
+				svc.queues[userID] = queue[1:]
+				// the user waits for the next turn after all other users
+				svc.users = append(svc.users, userID)
+			} else {
+				delete(svc.queues, userID)
 			}
 
-			result = append(result, row)
+			svc.running[userID]++
+
+			return q, true
+		}
+
+		svc.cond.Wait()
+	}
+}
+
+func (svc *ExecuterService) done(q *query) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	svc.running[q.userID]--
+	if svc.running[q.userID] == 0 {
+		delete(svc.running, q.userID)
+	}
+
+	svc.cond.Broadcast()
+}
+
+func (svc *ExecuterService) exec(q *query) error {
+	if err := q.ctx.Err(); err != nil {
+		return errors.Wrap(err, "query is canceled")
+	}
+
+	return q.run(q.ctx)
+}
+
+func (svc *ExecuterService) queryRows(ctx context.Context, queryStr string, args []any, w RowsWriter) error {
+	rows, err := svc.db.QueryxContext(ctx, queryStr, args...)
+	if err != nil {
+		return errors.Wrap(err, "cannot query rows")
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return errors.Wrap(err, "cannot get columns")
+	}
+
+	if err := w.WriteColumns(columns); err != nil {
+		return errors.Wrap(err, "cannot write columns")
+	}
+
+	for rows.Next() {
+		row, err := rows.SliceScan()
+		if err != nil {
+			return errors.Wrap(err, "cannot scan row")
+		}
+
+		if err := w.WriteRow(row); err != nil {
+			return errors.Wrap(err, "cannot write row")
 		}
+	}
 
-		q.callback(columns, result, nil)
+	if err := rows.Err(); err != nil {
+		return errors.Wrap(err, "cannot iterate rows")
 	}
+
+	return nil
 }
 
+// Close stops the workers after the running queries, the queued queries are rejected.
 func (svc *ExecuterService) Close() {
-	close(svc.queriesChan)
+	svc.mu.Lock()
+
+	svc.closed = true
+
+	for _, queue := range svc.queues {
+		for _, q := range queue {
+			q.result <- errors.New("query executer is closed")
+		}
+	}
+
+	svc.queues = map[string][]*query{}
+	svc.users = nil
+
+	svc.cond.Broadcast()
+	svc.mu.Unlock()
+
+	svc.wg.Wait()
+}
+
+func (svc *ExecuterService) ExecQueryContext(ctx context.Context, userID, queryStr string, offset, limit int, params map[string]any) ([]string, []any, error) {
+	collector := &rowsCollector{rows: []any{}}
+
+	if err := svc.StreamQueryContext(ctx, userID, queryStr, offset, limit, params, collector); err != nil {
+		return nil, nil, err
+	}
+
+	return collector.columns, collector.rows, nil
 }
 
-func (svc *ExecuterService) ExecQueryContext(ctx context.Context, queryStr string, offset, limit int, params map[string]any) ([]string, []any, error) {
+// StreamQueryContext passes the result rows to the writer one by one while they are read.
+// The worker reads the rows into the bounded buffer and the writer is called from the calling goroutine,
+// so a slow writer does not keep the worker busy longer than the buffer allows. It returns after the last call of the writer.
+func (svc *ExecuterService) StreamQueryContext(ctx context.Context, userID, queryStr string, offset, limit int, params map[string]any, w RowsWriter) error {
 	args := []any{}
 
 	for k, v := range params {
 		args = append(args, sql.Named(k, v))
 	}
 
-	if offset != 0 {
-		queryStr = fmt.Sprintf("%s OFFSET %d", queryStr, offset)
+	// the query is stopped if the writer fails
+	ctx, cancel := context.WithCancel(aqlquerier.WithPage(ctx, offset, limit))
+	defer cancel()
+
+	var (
+		buf  = &rowsBuffer{ctx: ctx, items: make(chan rowsBufferItem, common.QueryStreamBufferRows)}
+		errc = make(chan error, 1)
+	)
+
+	go func() {
+		// the worker does not write into the buffer after the result of the query
+		defer close(buf.items)
+
+		errc <- svc.do(ctx, userID, func(ctx context.Context) error {
+			return svc.queryRows(ctx, queryStr, args, buf)
+		})
+	}()
+
+	var writeErr error
+
+	for item := range buf.items {
+		if writeErr != nil {
+			continue
+		}
+
+		if item.columns != nil {
+			writeErr = w.WriteColumns(item.columns)
+		} else {
+			writeErr = w.WriteRow(item.row)
+		}
+
+		if writeErr != nil {
+			cancel()
+		}
 	}
 
-	if limit != 0 {
-		queryStr = fmt.Sprintf("%s LIMIT %d", queryStr, limit)
+	err := <-errc
+
+	if writeErr != nil {
+		return writeErr
 	}
 
-	var (
-		resultColumns []string
-		resultRows    []any
-		resultErr     error
-	)
+	return err
+}
 
-	done := make(chan bool)
-	q := query{
-		ctx:   ctx,
-		query: queryStr,
-		args:  args,
-		callback: func(columns []string, rows []any, err error) {
-			resultColumns = columns
-			resultRows = rows
-			resultErr = err
-			done <- true
-		},
+// ExplainQueryContext returns the execution plan of the query, the query is explained by the workers as the executed ones.
+func (svc *ExecuterService) ExplainQueryContext(ctx context.Context, userID, queryStr string, offset, limit int, params map[string]any) (*aqlquerier.Plan, error) {
+	var plan *aqlquerier.Plan
+
+	err := svc.do(ctx, userID, func(ctx context.Context) (err error) {
+		plan, err = aqlquerier.Explain(aqlquerier.WithPage(ctx, offset, limit), queryStr, params)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+// do queues the run of the user and waits for its result.
+func (svc *ExecuterService) do(ctx context.Context, userID string, run func(ctx context.Context) error) error {
+	q := &query{
+		ctx:    ctx,
+		userID: userID,
+		run:    run,
+		result: make(chan error, 1),
+	}
+
+	if err := svc.enqueue(q); err != nil {
+		return err
 	}
 
-	svc.queriesChan <- q
 	select {
 	case <-ctx.Done():
-		return nil, nil, errors.New("timeout")
-	case <-done:
-		if resultErr != nil {
-			return nil, nil, resultErr
+		if svc.dequeue(q) {
+			return errors.ErrTimeout
 		}
+	case err := <-q.result:
+		return err
+	}
+
+	// the running query stops on the context cancellation, the writer must not be used after the return
+	if err := <-q.result; err != nil {
+		if ctx.Err() != nil {
+			return errors.ErrTimeout
+		}
+
+		return err
 	}
 
-	return resultColumns, resultRows, nil
+	return nil
+}
+
+// dequeue removes the query not started yet from the queue.
+// It returns false if a worker has already taken the query.
+func (svc *ExecuterService) dequeue(q *query) bool {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	queue := svc.queues[q.userID]
+
+	for i, queued := range queue {
+		if queued != q {
+			continue
+		}
+
+		queue = append(queue[:i], queue[i+1:]...)
+		if len(queue) > 0 {
+			svc.queues[q.userID] = queue
+			return true
+		}
+
+		delete(svc.queues, q.userID)
+
+		for j, userID := range svc.users {
+			if userID == q.userID {
+				svc.users = append(svc.users[:j], svc.users[j+1:]...)
+				break
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
+
+func (svc *ExecuterService) enqueue(q *query) error {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	if svc.closed {
+		return errors.New("query executer is closed")
+	}
+
+	if _, ok := svc.queues[q.userID]; !ok {
+		svc.users = append(svc.users, q.userID)
+	}
+
+	svc.queues[q.userID] = append(svc.queues[q.userID], q)
+
+	svc.cond.Signal()
+
+	return nil
 }
@@ -2,7 +2,9 @@ package query
 
 import (
 	"context"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/errors"
 
@@ -71,7 +73,30 @@ func TestNewQueryExecuterService(t *testing.T) {
 			true,
 		},
 		{
-			"3. timeout error",
+			"3. error on rows iteration",
+			args{
+				context.Background(),
+				"SELECT 123 as Number FROM e",
+				0,
+				0,
+				nil,
+			},
+			func(mock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{"Number"}).
+					AddRow(123).
+					AddRow(456).
+					RowError(1, errors.New("some error"))
+
+				mock.ExpectQuery("SELECT 123 as Number FROM e").
+					WillReturnRows(rows).
+					RowsWillBeClosed()
+			},
+			nil,
+			nil,
+			true,
+		},
+		{
+			"4. timeout error",
 			args{
 				ctx,
 				"SELECT 123 as Number FROM e",
@@ -99,10 +124,10 @@ func TestNewQueryExecuterService(t *testing.T) {
 
 			tt.prepare(mock)
 
-			svc := NewQueryExecuterService(sqlxDB)
+			svc := NewQueryExecuterService(sqlxDB, 2, 1)
 			defer svc.Close()
 
-			gotCol, gotRows, err := svc.ExecQueryContext(tt.args.ctx, tt.args.query, tt.args.offset, tt.args.limit, tt.args.params)
+			gotCol, gotRows, err := svc.ExecQueryContext(tt.args.ctx, "userID", tt.args.query, tt.args.offset, tt.args.limit, tt.args.params)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("want error %v, got %v", tt.wantErr, err)
 			}
@@ -116,3 +141,169 @@ func TestNewQueryExecuterService(t *testing.T) {
 		})
 	}
 }
+
+func TestExecuterService_UserQueues(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.MatchExpectationsInOrder(false)
+
+	mock.ExpectQuery("SELECT slow").
+		WillDelayFor(300 * time.Millisecond).
+		WillReturnRows(sqlmock.NewRows([]string{"n"}).AddRow(1))
+	mock.ExpectQuery("SELECT slow").
+		WillDelayFor(300 * time.Millisecond).
+		WillReturnRows(sqlmock.NewRows([]string{"n"}).AddRow(1))
+	mock.ExpectQuery("SELECT fast").
+		WillReturnRows(sqlmock.NewRows([]string{"n"}).AddRow(2))
+
+	// two workers, but one user runs only one query at once
+	svc := NewQueryExecuterService(sqlx.NewDb(db, "sqlmock"), 2, 1)
+	defer svc.Close()
+
+	var wg sync.WaitGroup
+
+	slowDone := make(chan time.Time, 2)
+
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			_, _, err := svc.ExecQueryContext(context.Background(), "user1", "SELECT slow", 0, 0, nil)
+			assert.NoError(t, err)
+
+			slowDone <- time.Now()
+		}()
+	}
+
+	// let the slow queries be queued first
+	time.Sleep(50 * time.Millisecond)
+
+	_, rows, err := svc.ExecQueryContext(context.Background(), "user2", "SELECT fast", 0, 0, nil)
+	fastDone := time.Now()
+
+	assert.NoError(t, err)
+	assert.Equal(t, []any{[]any{int64(2)}}, rows)
+
+	wg.Wait()
+	close(slowDone)
+
+	for done := range slowDone {
+		assert.True(t, fastDone.Before(done), "the query of the other user should not wait for the slow queries")
+	}
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExecuterService_Close(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	svc := NewQueryExecuterService(sqlx.NewDb(db, "sqlmock"), 1, 1)
+	svc.Close()
+
+	_, _, err = svc.ExecQueryContext(context.Background(), "user1", "SELECT 1", 0, 0, nil)
+	assert.Error(t, err)
+}
+
+func TestExecuterService_ExplainQueryContext(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT slow").
+		WillDelayFor(200 * time.Millisecond).
+		WillReturnRows(sqlmock.NewRows([]string{"n"}).AddRow(1))
+
+	svc := NewQueryExecuterService(sqlx.NewDb(db, "sqlmock"), 2, 1)
+
+	slowDone := make(chan struct{})
+
+	go func() {
+		defer close(slowDone)
+
+		_, _, err := svc.ExecQueryContext(context.Background(), "user1", "SELECT slow", 0, 0, nil)
+		assert.NoError(t, err)
+	}()
+
+	// let the slow query be taken by a worker first
+	time.Sleep(50 * time.Millisecond)
+
+	start := time.Now()
+
+	plan, err := svc.ExplainQueryContext(context.Background(), "user1", "SELECT e/ehr_id/value FROM EHR e", 0, 0, nil)
+
+	assert.NoError(t, err)
+	assert.NotNil(t, plan)
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond, "the explained query should wait for the running query of the user")
+
+	<-slowDone
+
+	svc.Close()
+
+	_, err = svc.ExplainQueryContext(context.Background(), "user1", "SELECT e/ehr_id/value FROM EHR e", 0, 0, nil)
+	assert.Error(t, err)
+}
+
+type blockingRowsWriter struct {
+	rowsCollector
+	release chan struct{}
+}
+
+func (w *blockingRowsWriter) WriteRow(row []any) error {
+	<-w.release
+	return w.rowsCollector.WriteRow(row)
+}
+
+func TestExecuterService_StreamQueryContext_SlowWriter(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.MatchExpectationsInOrder(false)
+
+	mock.ExpectQuery("SELECT streamed").
+		WillReturnRows(sqlmock.NewRows([]string{"n"}).AddRow(1).AddRow(2))
+	mock.ExpectQuery("SELECT other").
+		WillReturnRows(sqlmock.NewRows([]string{"n"}).AddRow(3))
+
+	// the only worker must be free for the other query while the rows of the first one are written
+	svc := NewQueryExecuterService(sqlx.NewDb(db, "sqlmock"), 1, 1)
+	defer svc.Close()
+
+	w := &blockingRowsWriter{release: make(chan struct{})}
+	streamed := make(chan error, 1)
+
+	go func() {
+		streamed <- svc.StreamQueryContext(context.Background(), "user1", "SELECT streamed", 0, 0, nil, w)
+	}()
+
+	// let the streamed query be taken by the worker first
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, rows, err := svc.ExecQueryContext(ctx, "user2", "SELECT other", 0, 0, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []any{[]any{int64(3)}}, rows)
+
+	close(w.release)
+
+	assert.NoError(t, <-streamed)
+	assert.Equal(t, []string{"n"}, w.columns)
+	assert.Equal(t, []any{[]any{int64(1)}, []any{int64(2)}}, w.rows)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,118 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/aqlprocessor"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/errors"
+)
+
+// queryParameters returns the parameters of the query sorted by name.
+func queryParameters(q string) ([]model.QueryParameter, error) {
+	aqlQuery, err := aqlprocessor.NewAqlProcessor(q).Process()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parse query")
+	}
+
+	types := aqlQuery.ParameterTypes()
+
+	result := make([]model.QueryParameter, 0, len(types))
+	for name, typ := range types {
+		result = append(result, model.QueryParameter{Name: name, Type: string(typ)})
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+
+	return result, nil
+}
+
+// checkParameters checks the values of all parameters of the stored query are passed and are of their types.
+// The values of the GET requests are text, it is converted into the numbers of the number parameters only:
+// the text of the parameters of any type is kept, e.g. the code "007" is not a number.
+// The values of the parameters unknown to the query are kept, the executer rejects them.
+func checkParameters(params []model.QueryParameter, values map[string]any) (map[string]any, error) {
+	result := make(map[string]any, len(values))
+	for name, val := range values {
+		result[name] = val
+	}
+
+	for _, p := range params {
+		val, ok := values[p.Name]
+		if !ok || val == nil {
+			return nil, fmt.Errorf("%w: query parameter %s is missing", errors.ErrIncorrectRequest, p.Name)
+		}
+
+		converted, ok := convertParameter(val, aqlprocessor.ParameterType(p.Type))
+		if !ok {
+			return nil, fmt.Errorf("%w: query parameter %s should be %s, got %v", errors.ErrIncorrectRequest, p.Name, parameterTypeName(p.Type), val)
+		}
+
+		result[p.Name] = converted
+	}
+
+	return result, nil
+}
+
+func convertParameter(val any, typ aqlprocessor.ParameterType) (any, bool) {
+	if s, ok := val.(fmt.Stringer); ok {
+		// the identifiers, e.g. uuid.UUID of ehr_id
+		val = s.String()
+	}
+
+	if text, ok := val.(model.QueryParameterText); ok {
+		return convertText(string(text), typ)
+	}
+
+	switch typ {
+	case aqlprocessor.ParameterTypeString:
+		s, ok := val.(string)
+		return s, ok
+	case aqlprocessor.ParameterTypeNumber:
+		switch v := val.(type) {
+		case int, int32, int64, float32, float64:
+			return v, true
+		case json.Number:
+			f, err := v.Float64()
+			return f, err == nil
+		case string:
+			f, err := strconv.ParseFloat(v, 64)
+			return f, err == nil
+		default:
+			return nil, false
+		}
+	default:
+		switch v := val.(type) {
+		case string, bool, int, int32, int64, float32, float64:
+			return v, true
+		case json.Number:
+			f, err := v.Float64()
+			return f, err == nil
+		default:
+			return nil, false
+		}
+	}
+}
+
+func convertText(text string, typ aqlprocessor.ParameterType) (any, bool) {
+	if typ == aqlprocessor.ParameterTypeNumber {
+		f, err := strconv.ParseFloat(text, 64)
+		return f, err == nil
+	}
+
+	return text, true
+}
+
+func parameterTypeName(typ string) string {
+	switch aqlprocessor.ParameterType(typ) {
+	case aqlprocessor.ParameterTypeString:
+		return "a string"
+	case aqlprocessor.ParameterTypeNumber:
+		return "a number"
+	default:
+		return "a primitive value"
+	}
+}
@@ -0,0 +1,132 @@
+package query
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/errors"
+)
+
+func TestQueryParameters(t *testing.T) {
+	params, err := queryParameters(`SELECT o/data[at0001]/events[at0006]/data[at0003]/items[at0004]/value/magnitude
+		FROM EHR e CONTAINS OBSERVATION o[$archetype]
+		WHERE e/ehr_id/value = $ehr_id AND o/data[at0001]/events[at0006]/data[at0003]/items[at0004]/value/magnitude > $systolic`)
+	require.NoError(t, err)
+
+	assert.Equal(t, []model.QueryParameter{
+		{Name: "archetype", Type: "string"},
+		{Name: "ehr_id", Type: "any"},
+		{Name: "systolic", Type: "number"},
+	}, params)
+
+	_, err = queryParameters(`SELECT FROM`)
+	assert.Error(t, err)
+}
+
+func TestCheckParameters(t *testing.T) {
+	params := []model.QueryParameter{
+		{Name: "archetype", Type: "string"},
+		{Name: "ehr_id", Type: "any"},
+		{Name: "systolic", Type: "number"},
+	}
+
+	ehrID := uuid.MustParse("7d44b88c-4199-4bad-97dc-d78268e01398")
+
+	tests := []struct {
+		name    string
+		values  map[string]any
+		want    map[string]any
+		wantErr bool
+	}{
+		{
+			"1. values of the POST request",
+			map[string]any{"archetype": "openEHR-EHR-OBSERVATION.blood_pressure.v2", "ehr_id": ehrID.String(), "systolic": json.Number("140")},
+			map[string]any{"archetype": "openEHR-EHR-OBSERVATION.blood_pressure.v2", "ehr_id": ehrID.String(), "systolic": 140.0},
+			false,
+		},
+		{
+			"2. string values of the number parameter",
+			map[string]any{"archetype": "openEHR-EHR-OBSERVATION.blood_pressure.v2", "ehr_id": ehrID, "systolic": "140.5"},
+			map[string]any{"archetype": "openEHR-EHR-OBSERVATION.blood_pressure.v2", "ehr_id": ehrID.String(), "systolic": 140.5},
+			false,
+		},
+		{
+			"3. text values of the GET request",
+			map[string]any{"archetype": model.QueryParameterText("a"), "ehr_id": model.QueryParameterText("140"), "systolic": model.QueryParameterText("140.5")},
+			map[string]any{"archetype": "a", "ehr_id": "140", "systolic": 140.5},
+			false,
+		},
+		{
+			"4. text of any type is kept though it spells a number or a boolean",
+			map[string]any{"archetype": model.QueryParameterText("1"), "ehr_id": model.QueryParameterText("true"), "systolic": 140.0},
+			map[string]any{"archetype": "1", "ehr_id": "true", "systolic": 140.0},
+			false,
+		},
+		{
+			"5. numeric-looking codes of any type",
+			map[string]any{"archetype": "a", "ehr_id": model.QueryParameterText("12345"), "systolic": model.QueryParameterText("1e3")},
+			map[string]any{"archetype": "a", "ehr_id": "12345", "systolic": 1000.0},
+			false,
+		},
+		{
+			"6. unknown parameters are kept",
+			map[string]any{"archetype": "a", "ehr_id": 1.0, "systolic": 140.0, "other": "x"},
+			map[string]any{"archetype": "a", "ehr_id": 1.0, "systolic": 140.0, "other": "x"},
+			false,
+		},
+		{
+			"7. missing parameter",
+			map[string]any{"archetype": "a", "systolic": 140.0},
+			nil,
+			true,
+		},
+		{
+			"8. null parameter",
+			map[string]any{"archetype": "a", "ehr_id": nil, "systolic": 140.0},
+			nil,
+			true,
+		},
+		{
+			"9. number of string parameter",
+			map[string]any{"archetype": 1.0, "ehr_id": "1", "systolic": 140.0},
+			nil,
+			true,
+		},
+		{
+			"10. not a number",
+			map[string]any{"archetype": "a", "ehr_id": "1", "systolic": "high"},
+			nil,
+			true,
+		},
+		{
+			"11. text is not a number",
+			map[string]any{"archetype": "a", "ehr_id": "1", "systolic": model.QueryParameterText("high")},
+			nil,
+			true,
+		},
+		{
+			"12. object value",
+			map[string]any{"archetype": "a", "ehr_id": map[string]any{"value": "1"}, "systolic": 140.0},
+			nil,
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := checkParameters(params, tt.values)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, errors.ErrIncorrectRequest)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
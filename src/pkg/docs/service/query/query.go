@@ -3,13 +3,16 @@ package query
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
-	"github.com/gin-gonic/gin"
+	"github.com/akyoto/cache"
 	"github.com/vmihailenco/msgpack/v5"
 	"golang.org/x/crypto/sha3"
 
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/aqlprocessor"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/aqlquerier"
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/common"
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/compressor"
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/crypto/chachaPoly"
@@ -23,24 +26,34 @@ import (
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/errors"
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/indexer"
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/indexer/ehrIndexer"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/storage/treeindex"
 )
 
 const defaultVersion = "1.0.1"
 
+// LatestVersion is the version of the REST paths resolved into the latest version of the stored query.
+const LatestVersion = "latest"
+
 type QueryExecuter interface { //nolint
-	ExecQueryContext(ctx context.Context, query string, offset, limit int, params map[string]any) ([]string, []any, error)
+	ExecQueryContext(ctx context.Context, userID, query string, offset, limit int, params map[string]any) ([]string, []any, error)
+	StreamQueryContext(ctx context.Context, userID, query string, offset, limit int, params map[string]any, w RowsWriter) error
+	ExplainQueryContext(ctx context.Context, userID, query string, offset, limit int, params map[string]any) (*aqlquerier.Plan, error)
 }
 
 type Service struct {
 	*service.DefaultDocumentService
 
-	qExec QueryExecuter
+	qExec   QueryExecuter
+	scopes  ScopeResolver
+	cursors *cache.Cache
 }
 
 func NewService(docService *service.DefaultDocumentService, qExec QueryExecuter) *Service {
 	return &Service{
 		DefaultDocumentService: docService,
 		qExec:                  qExec,
+		scopes:                 NewAccessScopeResolver(docService.Infra.Index, docService.Infra.Keystore, treeindex.DefaultEHRIndex),
+		cursors:                cache.New(common.CacheCleanerTimeout),
 	}
 }
 
@@ -88,9 +101,86 @@ func (s *Service) List(ctx context.Context, userID, systemID, qualifiedQueryName
 		result = append(result, &storedQuery)
 	}
 
+	sortByVersion(result)
+
 	return result, nil
 }
 
+// sortByVersion sorts the stored queries by name, the versions of the query from the latest.
+func sortByVersion(queries []*model.StoredQuery) {
+	sort.SliceStable(queries, func(i, j int) bool {
+		if queries[i].Name != queries[j].Name {
+			return queries[i].Name < queries[j].Name
+		}
+
+		vi, erri := base.NewVersionTreeID(queries[i].Version)
+		vj, errj := base.NewVersionTreeID(queries[j].Version)
+
+		if erri != nil || errj != nil {
+			return errj != nil && erri == nil
+		}
+
+		return vi.Compare(vj) > 0
+	})
+}
+
+// ResolveVersion returns the stored query of the version given as the exact version, e.g. 1.0.2,
+// or as the prefix of the form {major} or {major}.{minor}, in which case the latest matching version is returned.
+// The latest version is returned if the version is empty or LatestVersion.
+func (s *Service) ResolveVersion(ctx context.Context, userID, systemID, name, version string) (*model.StoredQuery, error) {
+	var prefix *base.VersionTreeID
+
+	if version != "" && version != LatestVersion {
+		v, err := base.NewVersionTreeID(version)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid version %s", errors.ErrIncorrectRequest, version)
+		}
+
+		if v.IsFull() {
+			return s.GetByVersion(ctx, userID, systemID, name, v)
+		}
+
+		prefix = v
+	}
+
+	list, err := s.List(ctx, userID, systemID, name)
+	if err != nil {
+		return nil, err
+	}
+
+	storedQuery := latestVersion(list, prefix)
+	if storedQuery == nil {
+		return nil, fmt.Errorf("%w: stored query %s version %s", errors.ErrNotFound, name, version)
+	}
+
+	return storedQuery, nil
+}
+
+// latestVersion returns the stored query of the latest version matching the prefix or nil, the prefix is optional.
+func latestVersion(queries []*model.StoredQuery, prefix *base.VersionTreeID) *model.StoredQuery {
+	var (
+		result *model.StoredQuery
+		latest *base.VersionTreeID
+	)
+
+	for _, q := range queries {
+		v, err := base.NewVersionTreeID(q.Version)
+		if err != nil {
+			continue
+		}
+
+		if prefix != nil && !v.HasPrefix(prefix) {
+			continue
+		}
+
+		if latest == nil || v.Compare(latest) > 0 {
+			result, latest = q, v
+		}
+	}
+
+	return result
+}
+
 func (s *Service) GetByVersion(ctx context.Context, userID, systemID, name string, version *base.VersionTreeID) (*model.StoredQuery, error) {
 	userPubKey, userPrivKey, err := s.Infra.Keystore.Get(userID)
 	if err != nil {
@@ -140,25 +230,50 @@ func (s *Service) GetByVersion(ctx context.Context, userID, systemID, name strin
 	return &storedQuery, nil
 }
 
-func (*Service) Validate(data []byte) bool {
-	return true
+// Validate checks the syntax of the query, the error has the aqlprocessor.SyntaxErrors of the query.
+func (*Service) Validate(data []byte) error {
+	if _, err := aqlprocessor.NewAqlProcessor(string(data)).Process(); err != nil {
+		return errors.Wrap(err, "cannot parse query")
+	}
+
+	return nil
 }
 
+// Store stores the query as the next version after the latest one or as the default version if the query is new.
 func (s *Service) Store(ctx context.Context, userID, systemID, reqID, qType, name, q string) (*model.StoredQuery, error) {
 	v, _ := base.NewVersionTreeID(defaultVersion)
 
+	latest, err := s.ResolveVersion(ctx, userID, systemID, name, "")
+
+	switch {
+	case err == nil:
+		if v, err = base.NewVersionTreeID(latest.Version); err != nil {
+			return nil, fmt.Errorf("latest version %s parse error: %w", latest.Version, err)
+		}
+
+		v.Increase()
+	case !errors.Is(err, errors.ErrNotFound):
+		return nil, errors.Wrap(err, "cannot get latest version of stored query")
+	}
+
 	return s.StoreVersion(ctx, userID, systemID, reqID, qType, name, v, q)
 }
 
 func (s *Service) StoreVersion(ctx context.Context, userID, systemID, reqID, qType, name string, version *base.VersionTreeID, q string) (*model.StoredQuery, error) {
 	timestamp := time.Now()
 
+	params, err := queryParameters(q)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errors.ErrIncorrectRequest, err) //nolint
+	}
+
 	storedQuery := &model.StoredQuery{
 		Name:        name,
 		Type:        qType,
 		Version:     version.String(),
 		TimeCreated: timestamp.Format(common.OpenEhrTimeFormat),
 		Query:       q,
+		Parameters:  params,
 	}
 
 	id := []byte(userID + systemID + storedQuery.Name + storedQuery.Version)
@@ -233,17 +348,34 @@ func (s *Service) StoreVersion(ctx context.Context, userID, systemID, reqID, qTy
 	return storedQuery, nil
 }
 
-func (s *Service) ExecStoredQuery(ctx context.Context, userID, systemID, qualifiedQueryName string, query *model.QueryRequest) (*model.QueryResponse, error) {
-	v, _ := base.NewVersionTreeID(defaultVersion)
-
-	storedQuery, err := s.GetByVersion(ctx, userID, systemID, qualifiedQueryName, v)
+// ExecStoredQuery executes the stored query of the version resolved by ResolveVersion, the latest version if the version is empty.
+func (s *Service) ExecStoredQuery(ctx context.Context, userID, systemID, qualifiedQueryName, version string, query *model.QueryRequest) (*model.QueryResponse, error) {
+	storedQuery, err := s.ResolveVersion(ctx, userID, systemID, qualifiedQueryName, version)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot find stored query")
 	}
 
+	params := storedQuery.Parameters
+	if params == nil {
+		// the queries stored before the parameters were extracted
+		if params, err = queryParameters(storedQuery.Query); err != nil {
+			return nil, errors.Wrap(err, "cannot get stored query parameters")
+		}
+	}
+
+	query.QueryParameters, err = checkParameters(params, query.QueryParameters)
+	if err != nil {
+		return nil, err
+	}
+
 	query.Query = storedQuery.Query
 
-	columns, result, err := s.qExec.ExecQueryContext(ctx, query.Query, query.Offset, query.Fetch, query.QueryParameters)
+	ctx, err = s.withScope(ctx, userID, systemID)
+	if err != nil {
+		return nil, err
+	}
+
+	columns, result, err := s.qExec.ExecQueryContext(ctx, userID, query.Query, query.Offset, query.Fetch, query.QueryParameters)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot exec query")
 	}
@@ -254,15 +386,18 @@ func (s *Service) ExecStoredQuery(ctx context.Context, userID, systemID, qualifi
 		Rows:  result,
 	}
 
-	for _, c := range columns {
-		resp.Columns = append(resp.Columns, model.QueryColumn{Name: c})
-	}
+	resp.Columns = queryColumns(query.Query, columns)
 
 	return resp, nil
 }
 
-func (s *Service) ExecQuery(ctx context.Context, query *model.QueryRequest) (*model.QueryResponse, error) {
-	columns, result, err := s.qExec.ExecQueryContext(ctx, query.Query, query.Offset, query.Fetch, query.QueryParameters)
+func (s *Service) ExecQuery(ctx context.Context, userID, systemID string, query *model.QueryRequest) (*model.QueryResponse, error) {
+	ctx, err := s.withScope(ctx, userID, systemID)
+	if err != nil {
+		return nil, err
+	}
+
+	columns, result, err := s.qExec.ExecQueryContext(ctx, userID, query.Query, query.Offset, query.Fetch, query.QueryParameters)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot exec query")
 	}
@@ -272,34 +407,52 @@ func (s *Service) ExecQuery(ctx context.Context, query *model.QueryRequest) (*mo
 		Rows:  result,
 	}
 
-	for _, c := range columns {
-		resp.Columns = append(resp.Columns, model.QueryColumn{Name: c})
-	}
+	resp.Columns = queryColumns(query.Query, columns)
 
 	return resp, nil
 }
 
-func (s *Service) ExecQueryWithTimeout(ctx *gin.Context, query *model.QueryRequest) (*model.QueryResponse, error) {
-	type wr struct {
-		result *model.QueryResponse
-		err    error
+// ExplainQuery returns the execution plan of the query with the row counts of every stage instead of the rows.
+func (s *Service) ExplainQuery(ctx context.Context, userID, systemID string, query *model.QueryRequest) (*aqlquerier.Plan, error) {
+	ctx, err := s.withScope(ctx, userID, systemID)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := s.qExec.ExplainQueryContext(ctx, userID, query.Query, query.Offset, query.Fetch, query.QueryParameters)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot explain query")
 	}
 
-	ch := make(chan wr, 1)
+	return plan, nil
+}
 
-	go func() {
-		resp, err := s.ExecQuery(ctx, query)
-		ch <- wr{
-			resp, err,
-		}
-	}()
-
-	for {
-		select {
-		case <-ctx.Request.Context().Done():
-			return nil, errors.ErrTimeout
-		case data := <-ch:
-			return data.result, data.err
-		}
+// queryColumns returns the columns of the result with the paths of their sources.
+// The paths are left empty if the query can not be parsed, the executer has already reported the error then.
+func queryColumns(query string, names []string) []model.QueryColumn {
+	result := make([]model.QueryColumn, 0, len(names))
+	for _, name := range names {
+		result = append(result, model.QueryColumn{Name: name})
 	}
+
+	columns, err := aqlquerier.Columns(query)
+	if err != nil || len(columns) != len(result) {
+		return result
+	}
+
+	for i, c := range columns {
+		result[i].Path = c.Path
+	}
+
+	return result
+}
+
+// withScope restricts the queries executed with the context to the EHRs and the compositions the user can read.
+func (s *Service) withScope(ctx context.Context, userID, systemID string) (context.Context, error) {
+	scope, err := s.scopes.QueryScope(ctx, userID, systemID)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get query scope")
+	}
+
+	return aqlquerier.WithScope(ctx, scope), nil
 }
@@ -0,0 +1,76 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model/base"
+)
+
+func storedQueries(versions ...string) []*model.StoredQuery {
+	result := make([]*model.StoredQuery, 0, len(versions))
+	for _, v := range versions {
+		result = append(result, &model.StoredQuery{Name: "org.openehr::compositions", Version: v})
+	}
+
+	return result
+}
+
+func TestLatestVersion(t *testing.T) {
+	queries := storedQueries("1.0.1", "1.2.0", "1.10.3", "1.2.7", "2.0.0")
+
+	tests := []struct {
+		name   string
+		prefix string
+		want   string
+	}{
+		{"latest", "", "2.0.0"},
+		{"major", "1", "1.10.3"},
+		{"major and minor", "1.2", "1.2.7"},
+		{"not the string prefix", "1.1", ""},
+		{"not found", "3", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var prefix *base.VersionTreeID
+
+			if tt.prefix != "" {
+				var err error
+
+				prefix, err = base.NewVersionTreeID(tt.prefix)
+				require.NoError(t, err)
+			}
+
+			got := latestVersion(queries, prefix)
+			if tt.want == "" {
+				assert.Nil(t, got)
+				return
+			}
+
+			require.NotNil(t, got)
+			assert.Equal(t, tt.want, got.Version)
+		})
+	}
+}
+
+func TestSortByVersion(t *testing.T) {
+	queries := append(storedQueries("1.0.1", "1.10.0", "1.2.0"), &model.StoredQuery{Name: "a::first", Version: "1.0.0"})
+
+	sortByVersion(queries)
+
+	got := make([]string, 0, len(queries))
+	for _, q := range queries {
+		got = append(got, q.Name+" "+q.Version)
+	}
+
+	assert.Equal(t, []string{
+		"a::first 1.0.0",
+		"org.openehr::compositions 1.10.0",
+		"org.openehr::compositions 1.2.0",
+		"org.openehr::compositions 1.0.1",
+	}, got)
+}
@@ -0,0 +1,193 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/ipfs/go-cid"
+	"golang.org/x/crypto/sha3"
+
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/access"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/aqlquerier"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/crypto/chachaPoly"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/errors"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/indexer"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/keystore"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/storage/treeindex"
+)
+
+// ScopeResolver returns the data of the tree index the user is allowed to query.
+type ScopeResolver interface {
+	QueryScope(ctx context.Context, userID, systemID string) (*aqlquerier.Scope, error)
+}
+
+// AccessScopeResolver builds the query scope from the access lists of the indexer:
+// the own EHR of the user, the documents granted to the user and the documents of the granted document groups,
+// directly or through the user groups.
+type AccessScopeResolver struct {
+	index    *indexer.Index
+	keystore *keystore.KeyStore
+	tree     *treeindex.EHRIndex
+}
+
+func NewAccessScopeResolver(index *indexer.Index, ks *keystore.KeyStore, tree *treeindex.EHRIndex) *AccessScopeResolver {
+	return &AccessScopeResolver{
+		index:    index,
+		keystore: ks,
+		tree:     tree,
+	}
+}
+
+func (r *AccessScopeResolver) QueryScope(ctx context.Context, userID, systemID string) (*aqlquerier.Scope, error) {
+	userPubKey, userPrivKey, err := r.keystore.Get(userID)
+	if err != nil {
+		return nil, fmt.Errorf("Keystore.Get error: %w userID %s", err, userID)
+	}
+
+	scope := aqlquerier.NewScope()
+
+	ehrUUID, err := r.index.GetEhrUUIDByUserID(ctx, userID, systemID)
+
+	switch {
+	case err == nil:
+		scope.AddEHR(ehrUUID.String())
+	case errors.Is(err, errors.ErrIsNotExist):
+	default:
+		return nil, fmt.Errorf("Index.GetEhrUUIDByUserID error: %w userID %s", err, userID)
+	}
+
+	IDHash := sha3.Sum256([]byte(userID + systemID))
+
+	docACL, err := r.getAccessList(ctx, &IDHash, access.Doc)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, a := range docACL {
+		if err := access.ExtractWithUserKey(a, userPubKey, userPrivKey); err != nil {
+			if errors.Is(err, errors.ErrAccessDenied) {
+				continue
+			}
+
+			return nil, fmt.Errorf("index: %d access.Extract doc error: %w", i, err)
+		}
+
+		CID, err := cid.Parse(a.ID)
+		if err != nil {
+			return nil, fmt.Errorf("cid.Parse error: %w id: %x", err, a.ID)
+		}
+
+		r.addDoc(scope, CID)
+	}
+
+	docGroupACL, err := r.getAccessList(ctx, &IDHash, access.DocGroup)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, a := range docGroupACL {
+		if err := access.ExtractWithUserKey(a, userPubKey, userPrivKey); err != nil {
+			if errors.Is(err, errors.ErrAccessDenied) {
+				continue
+			}
+
+			return nil, fmt.Errorf("index: %d access.Extract doc groups error: %w", i, err)
+		}
+
+		if err := r.addDocGroup(ctx, scope, a.ID, a.Key); err != nil {
+			return nil, fmt.Errorf("index: %d addDocGroup error: %w", i, err)
+		}
+	}
+
+	userGroupACL, err := r.getAccessList(ctx, &IDHash, access.UserGroup)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, a := range userGroupACL {
+		if err := access.ExtractWithUserKey(a, userPubKey, userPrivKey); err != nil {
+			if errors.Is(err, errors.ErrAccessDenied) {
+				continue
+			}
+
+			return nil, fmt.Errorf("index: %d access.Extract user groups error: %w", i, err)
+		}
+
+		userGroupIDHash := sha3.Sum256(a.ID)
+
+		groupDocGroupACL, err := r.getAccessList(ctx, &userGroupIDHash, access.DocGroup)
+		if err != nil {
+			return nil, err
+		}
+
+		for j, ga := range groupDocGroupACL {
+			// ExtractWithGroupKey does not check the revoked access
+			if level := ga.Fields["level"]; len(level) > 0 && level[0] == access.NoAccess {
+				continue
+			}
+
+			if err := access.ExtractWithGroupKey(ga, a.Key); err != nil {
+				return nil, fmt.Errorf("index %d: access.ExtractWithGroupKey error: %w", j, err)
+			}
+
+			if err := r.addDocGroup(ctx, scope, ga.ID, ga.Key); err != nil {
+				return nil, fmt.Errorf("index: %d addDocGroup error: %w", j, err)
+			}
+		}
+	}
+
+	return scope, nil
+}
+
+// getAccessList returns the access list of the kind, the missing list is empty.
+func (r *AccessScopeResolver) getAccessList(ctx context.Context, IDHash *[32]byte, kind access.Kind) (access.List, error) {
+	acl, err := r.index.GetAccessList(ctx, IDHash, kind)
+	if err != nil {
+		if errors.Is(err, errors.ErrNotFound) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("Index.GetAccessList error: %w kind %d", err, kind)
+	}
+
+	return acl, nil
+}
+
+// addDocGroup adds the documents of the document group into the scope, their CIDs are encrypted with the group key.
+func (r *AccessScopeResolver) addDocGroup(ctx context.Context, scope *aqlquerier.Scope, groupIDBytes []byte, groupKey *chachaPoly.Key) error {
+	groupID, err := uuid.FromBytes(groupIDBytes)
+	if err != nil {
+		return fmt.Errorf("groupID uuid.FromBytes error: %w", err)
+	}
+
+	CIDsEncr, err := r.index.DocGroupGetDocs(ctx, &groupID)
+	if err != nil {
+		return fmt.Errorf("Index.DocGroupGetDocs error: %w", err)
+	}
+
+	for i, CIDEncr := range CIDsEncr {
+		CIDBytes, err := groupKey.Decrypt(CIDEncr)
+		if err != nil {
+			return fmt.Errorf("index %d CID decryption error: %w", i, err)
+		}
+
+		CID, err := cid.Parse(CIDBytes)
+		if err != nil {
+			return fmt.Errorf("index %d cid.Parse error: %w CIDBytes: %x", i, err, CIDBytes)
+		}
+
+		r.addDoc(scope, CID)
+	}
+
+	return nil
+}
+
+// addDoc adds the granted document into the scope. The documents the tree index does not know yet,
+// e.g. committed through another gateway after the last restore, are logged, they are indexed by the next restore.
+func (r *AccessScopeResolver) addDoc(scope *aqlquerier.Scope, CID cid.Cid) {
+	if !scope.AddDoc(r.tree, CID.String()) {
+		log.Printf("Query scope: granted document %s is not in the tree index, it is skipped until the next restore", CID.String())
+	}
+}
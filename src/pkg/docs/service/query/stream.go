@@ -0,0 +1,194 @@
+package query
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/aqlquerier"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/common"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/errors"
+)
+
+// ResultWriter writes the query response while the rows are read.
+// WriteHeader gets the response without the rows, WriteFooter completes the response.
+type ResultWriter interface {
+	WriteHeader(resp *model.QueryResponse) error
+	WriteRow(row any) error
+	WriteFooter(continuationToken string) error
+}
+
+// cursor is the rest of the paged query result. The query is run once for the first page and the rows after it
+// are kept with the columns, so the next pages are read from the cursor and the compositions committed meanwhile do not shift them.
+type cursor struct {
+	id       string
+	userID   string
+	query    string
+	columns  []model.QueryColumn
+	rows     [][]any // the rows from the offset, they are not changed, so the pages of the same token may be read at once
+	offset   int     // the offset of the first row of rows
+	position int     // the offset of the next page, the tokens beyond it are not issued
+}
+
+type continuationToken struct {
+	CursorID string `json:"c"`
+	Offset   int    `json:"o"`
+}
+
+// StreamQuery executes the ad-hoc query and writes its result into w, the rows are written while the query reads them.
+// With fetch, the response has the continuation token of the next page if there are rows left.
+// The rows after the first page are kept by the cursor of the token until it expires, the next pages are written from it.
+func (s *Service) StreamQuery(ctx context.Context, userID, systemID string, query *model.QueryRequest, w ResultWriter) error {
+	if query.ContinuationToken != "" {
+		return s.streamNextPage(userID, query, w)
+	}
+
+	scope, err := s.scopes.QueryScope(ctx, userID, systemID)
+	if err != nil {
+		return errors.Wrap(err, "cannot get query scope")
+	}
+
+	rw := &resultRowsWriter{
+		header: &model.QueryResponse{Query: query.Query},
+		w:      w,
+		fetch:  query.Fetch,
+	}
+
+	err = s.qExec.StreamQueryContext(aqlquerier.WithScope(ctx, scope), userID, query.Query, query.Offset, 0, query.QueryParameters, rw)
+	if err != nil {
+		return errors.Wrap(err, "cannot exec query")
+	}
+
+	if len(rw.rest) == 0 {
+		return w.WriteFooter("")
+	}
+
+	c := &cursor{
+		id:       uuid.NewString(),
+		userID:   userID,
+		query:    query.Query,
+		columns:  rw.header.Columns,
+		rows:     rw.rest,
+		offset:   query.Offset + query.Fetch,
+		position: query.Offset + query.Fetch,
+	}
+
+	return s.writeFooter(c, c.position, w)
+}
+
+func (s *Service) streamNextPage(userID string, query *model.QueryRequest, w ResultWriter) error {
+	token, err := parseContinuationToken(query.ContinuationToken)
+	if err != nil {
+		return err
+	}
+
+	item, ok := s.cursors.Get(token.CursorID)
+	if !ok {
+		return fmt.Errorf("%w: continuation token is expired", errors.ErrNotFound)
+	}
+
+	c := item.(*cursor)
+
+	// the token of another user is not found as well
+	if c.userID != userID {
+		return fmt.Errorf("%w: continuation token is expired", errors.ErrNotFound)
+	}
+
+	if c.query != query.Query {
+		return fmt.Errorf("%w: continuation token belongs to another query", errors.ErrIncorrectRequest)
+	}
+
+	if token.Offset < c.offset || token.Offset > c.position {
+		return fmt.Errorf("%w: continuation token offset is beyond the result", errors.ErrIncorrectRequest)
+	}
+
+	if err := w.WriteHeader(&model.QueryResponse{Query: c.query, Columns: c.columns}); err != nil {
+		return err
+	}
+
+	rows := c.rows[token.Offset-c.offset:]
+	if query.Fetch > 0 && query.Fetch < len(rows) {
+		rows = rows[:query.Fetch]
+	}
+
+	for _, row := range rows {
+		if err := w.WriteRow(row); err != nil {
+			return err
+		}
+	}
+
+	next := token.Offset + len(rows)
+	if next == c.offset+len(c.rows) {
+		s.cursors.Delete(c.id)
+		return w.WriteFooter("")
+	}
+
+	// the cursor is replaced, not changed, as the pages of the same token may be read at once
+	nextCursor := *c
+	if next > nextCursor.position {
+		nextCursor.position = next
+	}
+
+	return s.writeFooter(&nextCursor, next, w)
+}
+
+// writeFooter keeps the cursor and writes the token of the next page from the offset.
+func (s *Service) writeFooter(c *cursor, offset int, w ResultWriter) error {
+	s.cursors.Set(c.id, c, common.QueryCursorTTL)
+
+	token, err := json.Marshal(continuationToken{CursorID: c.id, Offset: offset})
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal continuation token")
+	}
+
+	return w.WriteFooter(base64.RawURLEncoding.EncodeToString(token))
+}
+
+func parseContinuationToken(s string) (*continuationToken, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: continuation token decode error: %v", errors.ErrIncorrectRequest, err) //nolint
+	}
+
+	var token continuationToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, fmt.Errorf("%w: continuation token unmarshal error: %v", errors.ErrIncorrectRequest, err) //nolint
+	}
+
+	if token.CursorID == "" || token.Offset < 0 {
+		return nil, fmt.Errorf("%w: continuation token is invalid", errors.ErrIncorrectRequest)
+	}
+
+	return &token, nil
+}
+
+// resultRowsWriter passes the rows read by the executer to the response writer.
+// With fetch, the rows after the page are not written but kept in rest for the next pages.
+type resultRowsWriter struct {
+	header *model.QueryResponse
+	w      ResultWriter
+	fetch  int
+	rows   int
+	rest   [][]any
+}
+
+func (rw *resultRowsWriter) WriteColumns(columns []string) error {
+	rw.header.Columns = queryColumns(rw.header.Query, columns)
+
+	return rw.w.WriteHeader(rw.header)
+}
+
+func (rw *resultRowsWriter) WriteRow(row []any) error {
+	if rw.fetch > 0 && rw.rows == rw.fetch {
+		rw.rest = append(rw.rest, row)
+		return nil
+	}
+
+	rw.rows++
+
+	return rw.w.WriteRow(row)
+}
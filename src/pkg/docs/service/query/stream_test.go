@@ -0,0 +1,260 @@
+package query
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/akyoto/cache"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/aqlquerier"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/errors"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/storage/treeindex"
+)
+
+type testExecuter struct {
+	columns []string
+	rows    []any
+	calls   int
+}
+
+func (e *testExecuter) ExecQueryContext(ctx context.Context, userID, query string, offset, limit int, params map[string]any) ([]string, []any, error) {
+	e.calls++
+	return e.columns, e.rows, nil
+}
+
+func (e *testExecuter) StreamQueryContext(ctx context.Context, userID, query string, offset, limit int, params map[string]any, w RowsWriter) error {
+	e.calls++
+
+	if err := w.WriteColumns(e.columns); err != nil {
+		return err
+	}
+
+	rows := []any{}
+	if offset < len(e.rows) {
+		rows = e.rows[offset:]
+	}
+
+	if limit > 0 && limit < len(rows) {
+		rows = rows[:limit]
+	}
+
+	for _, row := range rows {
+		if err := w.WriteRow(row.([]any)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *testExecuter) ExplainQueryContext(ctx context.Context, userID, query string, offset, limit int, params map[string]any) (*aqlquerier.Plan, error) {
+	e.calls++
+	return &aqlquerier.Plan{}, nil
+}
+
+type testScopeResolver struct {
+	ehrs []string
+	err  error
+}
+
+func (r *testScopeResolver) QueryScope(ctx context.Context, userID, systemID string) (*aqlquerier.Scope, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	scope := aqlquerier.NewScope()
+	for _, ehrID := range r.ehrs {
+		scope.AddEHR(ehrID)
+	}
+
+	return scope, nil
+}
+
+type testResultWriter struct {
+	header *model.QueryResponse
+	rows   []any
+	token  string
+}
+
+func (w *testResultWriter) WriteHeader(resp *model.QueryResponse) error {
+	w.header = resp
+	return nil
+}
+
+func (w *testResultWriter) WriteRow(row any) error {
+	w.rows = append(w.rows, row)
+	return nil
+}
+
+func (w *testResultWriter) WriteFooter(continuationToken string) error {
+	w.token = continuationToken
+	return nil
+}
+
+func TestService_StreamQuery(t *testing.T) {
+	exec := &testExecuter{
+		columns: []string{"n"},
+		rows:    []any{[]any{1}, []any{2}, []any{3}},
+	}
+
+	scopes := &testScopeResolver{}
+
+	svc := &Service{
+		qExec:   exec,
+		scopes:  scopes,
+		cursors: cache.New(time.Minute),
+	}
+
+	ctx := context.Background()
+
+	// without fetch all rows are streamed
+	w := &testResultWriter{}
+	require.NoError(t, svc.StreamQuery(ctx, "user1", "system", &model.QueryRequest{Query: "SELECT n"}, w))
+	assert.Equal(t, []model.QueryColumn{{Name: "n"}}, w.header.Columns)
+	assert.Equal(t, exec.rows, w.rows)
+	assert.Empty(t, w.token)
+
+	// the first page
+	w = &testResultWriter{}
+	require.NoError(t, svc.StreamQuery(ctx, "user1", "system", &model.QueryRequest{Query: "SELECT n", Fetch: 2}, w))
+	assert.Equal(t, []any{[]any{1}, []any{2}}, w.rows)
+	require.NotEmpty(t, w.token)
+
+	token := w.token
+
+	_, err := parseContinuationToken(token)
+	require.NoError(t, err)
+
+	err = svc.StreamQuery(ctx, "user2", "system", &model.QueryRequest{Query: "SELECT n", Fetch: 2, ContinuationToken: token}, &testResultWriter{})
+	assert.ErrorIs(t, err, errors.ErrNotFound, "the token of another user")
+
+	err = svc.StreamQuery(ctx, "user1", "system", &model.QueryRequest{Query: "SELECT m", Fetch: 2, ContinuationToken: token}, &testResultWriter{})
+	assert.ErrorIs(t, err, errors.ErrIncorrectRequest, "the token of another query")
+
+	// the offset beyond the position of the cursor is not issued by the service
+	forged, err := json.Marshal(continuationToken{CursorID: tokenCursorID(t, token), Offset: 10})
+	require.NoError(t, err)
+
+	err = svc.StreamQuery(ctx, "user1", "system", &model.QueryRequest{Query: "SELECT n", Fetch: 2, ContinuationToken: base64.RawURLEncoding.EncodeToString(forged)}, &testResultWriter{})
+	assert.ErrorIs(t, err, errors.ErrIncorrectRequest)
+
+	// the next page is read from the cursor without the query
+	scopes.err = errors.ErrAccessDenied
+	calls := exec.calls
+
+	w = &testResultWriter{}
+	require.NoError(t, svc.StreamQuery(ctx, "user1", "system", &model.QueryRequest{Query: "SELECT n", Fetch: 2, ContinuationToken: token}, w))
+	assert.Equal(t, []model.QueryColumn{{Name: "n"}}, w.header.Columns)
+	assert.Equal(t, []any{[]any{3}}, w.rows)
+	assert.Empty(t, w.token)
+	assert.Equal(t, calls, exec.calls, "the next page should not execute the query")
+
+	scopes.err = nil
+
+	// the cursor is removed after the last page
+	err = svc.StreamQuery(ctx, "user1", "system", &model.QueryRequest{Query: "SELECT n", Fetch: 2, ContinuationToken: token}, &testResultWriter{})
+	assert.ErrorIs(t, err, errors.ErrNotFound)
+
+	err = svc.StreamQuery(ctx, "user1", "system", &model.QueryRequest{Query: "SELECT n", ContinuationToken: "invalid token"}, &testResultWriter{})
+	assert.ErrorIs(t, err, errors.ErrIncorrectRequest)
+
+	// the query is not executed without the scope of the user
+	scopes.err = errors.ErrAccessDenied
+	calls = exec.calls
+
+	err = svc.StreamQuery(ctx, "user1", "system", &model.QueryRequest{Query: "SELECT n"}, &testResultWriter{})
+	assert.ErrorIs(t, err, errors.ErrAccessDenied)
+	assert.Equal(t, calls, exec.calls)
+}
+
+func TestService_StreamQuery_CommittedBetweenPages(t *testing.T) {
+	index := treeindex.NewEHRIndex()
+
+	prev := treeindex.DefaultEHRIndex
+	treeindex.DefaultEHRIndex = index
+
+	t.Cleanup(func() { treeindex.DefaultEHRIndex = prev })
+
+	ehr := model.EHR{}
+	loadTestJSON(t, "./../../../../../data/mock/ehr/ehr.json", &ehr)
+	require.NoError(t, index.AddEHR(ehr))
+
+	addComposition := func(uid string) {
+		cmp := model.Composition{}
+		loadTestJSON(t, "./../../../aqlquerier/test_fixtures/composition_2.json", &cmp)
+		cmp.UID.Value = uid
+
+		require.NoError(t, index.AddComposition(ehr.EhrID.Value, cmp, model.AuditDetails{}))
+	}
+
+	addComposition("bbbbbbbb-0000-0000-0000-000000000000::openEHRSys.example.com::1")
+
+	db, err := sqlx.Open("aql", "")
+	require.NoError(t, err)
+
+	exec := NewQueryExecuterService(db, 1, 1)
+	defer exec.Close()
+
+	svc := &Service{
+		qExec:   exec,
+		scopes:  &testScopeResolver{ehrs: []string{ehr.EhrID.Value}},
+		cursors: cache.New(time.Minute),
+	}
+
+	ctx := context.Background()
+	query := "SELECT c/uid/value, o/archetype_node_id FROM EHR e CONTAINS COMPOSITION c CONTAINS OBSERVATION o"
+
+	all := &testResultWriter{}
+	require.NoError(t, svc.StreamQuery(ctx, "user1", "system", &model.QueryRequest{Query: query}, all))
+	require.Greater(t, len(all.rows), 3)
+
+	w := &testResultWriter{}
+	require.NoError(t, svc.StreamQuery(ctx, "user1", "system", &model.QueryRequest{Query: query, Fetch: 3}, w))
+	require.NotEmpty(t, w.token)
+
+	rows := w.rows
+
+	// the composition committed between the pages is ordered before the read rows
+	addComposition("aaaaaaaa-0000-0000-0000-000000000000::openEHRSys.example.com::1")
+
+	for w.token != "" {
+		token := w.token
+
+		w = &testResultWriter{}
+		require.NoError(t, svc.StreamQuery(ctx, "user1", "system", &model.QueryRequest{Query: query, Fetch: 3, ContinuationToken: token}, w))
+
+		rows = append(rows, w.rows...)
+	}
+
+	assert.Equal(t, all.rows, rows, "the pages should neither duplicate nor skip the rows")
+
+	// the new query reads the committed composition
+	w = &testResultWriter{}
+	require.NoError(t, svc.StreamQuery(ctx, "user1", "system", &model.QueryRequest{Query: query}, w))
+	assert.Len(t, w.rows, 2*len(all.rows))
+}
+
+func loadTestJSON(t *testing.T, filename string, v any) {
+	t.Helper()
+
+	data, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, v))
+}
+
+func tokenCursorID(t *testing.T, s string) string {
+	t.Helper()
+
+	token, err := parseContinuationToken(s)
+	require.NoError(t, err)
+
+	return token.CursorID
+}
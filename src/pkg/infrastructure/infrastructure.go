@@ -1,16 +1,21 @@
 package infrastructure
 
 import (
+	"encoding/hex"
+	"fmt"
 	"log"
 	"net/http"
+	"path/filepath"
 
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/jmoiron/sqlx"
+	"golang.org/x/crypto/sha3"
 	"gorm.io/gorm"
 
 	_ "github.com/bsn-si/IPEHR-gateway/src/pkg/aqlquerier" //nolint
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/compressor"
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/config"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/crypto/chachaPoly"
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/service/processing"
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/indexer"
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/keystore"
@@ -18,6 +23,7 @@ import (
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/storage"
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/storage/filecoin"
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/storage/ipfs"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/storage/treeindex"
 )
 
 type Infra struct {
@@ -28,15 +34,17 @@ type Infra struct {
 	IpfsClient         *ipfs.Client
 	FilecoinClient     *filecoin.Client
 	Index              *indexer.Index
-	LocalStorage       storage.Storager
+	Storage            storage.Storager
 	Compressor         compressor.Interface
 	AqlDB              *sqlx.DB
 	CompressionEnabled bool
 }
 
 func New(cfg *config.Config) *Infra {
-	sc := storage.NewConfig(cfg.Storage.Localfile.Path)
-	storage.Init(sc)
+	stor, err := storage.New(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	db, err := localDB.New(cfg.DB.FilePath)
 	if err != nil {
@@ -59,7 +67,11 @@ func New(cfg *config.Config) *Infra {
 		log.Fatal(err)
 	}
 
-	ks := keystore.New(cfg.KeystoreKey)
+	ks := keystore.New(stor, cfg.KeystoreKey)
+
+	if err = persistTreeIndex(cfg); err != nil {
+		log.Fatal(err)
+	}
 
 	ehtClient, err := ethclient.Dial(cfg.Contract.Endpoint)
 	if err != nil {
@@ -98,7 +110,7 @@ func New(cfg *config.Config) *Infra {
 			ehtClient,
 			cfg.Contract.GasTipCap,
 		),
-		LocalStorage:       storage.Storage(),
+		Storage:            stor,
 		Compressor:         compressor.New(cfg.CompressionLevel),
 		CompressionEnabled: cfg.CompressionEnabled,
 		AqlDB:              aqlDB,
@@ -107,4 +119,35 @@ func New(cfg *config.Config) *Infra {
 
 func (infra *Infra) Close() {
 	infra.AqlDB.Close()
+
+	if err := treeindex.DefaultEHRIndex.Close(); err != nil {
+		log.Println("Tree index close error:", err)
+	}
+}
+
+// persistTreeIndex loads the AQL tree index from the DataPath and keeps its changes there.
+// The index is encrypted with a key derived from the keystore key, so are its values if TreeIndexEncryption is set.
+func persistTreeIndex(cfg *config.Config) error {
+	keystoreKey, err := hex.DecodeString(cfg.KeystoreKey)
+	if err != nil {
+		return fmt.Errorf("keystore key decode error: %w", err)
+	}
+
+	keyBytes := sha3.Sum256(append(keystoreKey, []byte("treeindex")...))
+
+	key, err := chachaPoly.NewKeyFromBytes(keyBytes[:])
+	if err != nil {
+		return fmt.Errorf("chachaPoly.NewKeyFromBytes error: %w", err)
+	}
+
+	if cfg.TreeIndexEncryption {
+		cipherKey := sha3.Sum256(append(keystoreKey, []byte("treeindex-hm")...))
+		treeindex.DefaultEHRIndex.SetValueCipher(treeindex.NewValueCipher(cipherKey))
+	}
+
+	if err := treeindex.DefaultEHRIndex.Persist(filepath.Join(cfg.DataPath, "treeindex"), key); err != nil {
+		return fmt.Errorf("tree index persist error: %w", err)
+	}
+
+	return nil
 }
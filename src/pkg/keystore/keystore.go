@@ -20,7 +20,7 @@ type KeyStore struct {
 	keystoreKey []byte
 }
 
-func New(key string) *KeyStore {
+func New(stor storage.Storager, key string) *KeyStore {
 	if key == "" {
 		panic("Keystore key is empty. Check the config.")
 	}
@@ -31,7 +31,7 @@ func New(key string) *KeyStore {
 	}
 
 	return &KeyStore{
-		storage:     storage.Storage(),
+		storage:     stor,
 		keystoreKey: keyByte,
 	}
 }
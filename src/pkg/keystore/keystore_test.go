@@ -1,35 +1,20 @@
 package keystore_test
 
 import (
-	"os"
-	"strconv"
 	"testing"
-	"time"
 
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/config"
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/keystore"
-	"github.com/bsn-si/IPEHR-gateway/src/pkg/storage"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/storage/memory"
 )
 
-const testStorePath string = "/tmp/localfiletest"
-
 func TestKeystore(t *testing.T) {
-	defer func() {
-		err := cleanup()
-		if err != nil {
-			t.Fatal(err)
-		}
-	}()
-
-	sc := storage.NewConfig("./test_" + strconv.FormatInt(time.Now().UnixNano(), 10))
-	storage.Init(sc)
-
 	cfg, err := config.New()
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	ks := keystore.New(cfg.KeystoreKey)
+	ks := keystore.New(memory.New(), cfg.KeystoreKey)
 
 	userIDOne := "111-222-333"
 	userIDTwo := "111-222-333-444"
@@ -57,8 +42,3 @@ func TestKeystore(t *testing.T) {
 		t.Fatal("Got same keys for different user")
 	}
 }
-
-func cleanup() (err error) {
-	err = os.RemoveAll(testStorePath)
-	return
-}
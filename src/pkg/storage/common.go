@@ -1,33 +1,49 @@
 package storage
 
 import (
-	"log"
+	"fmt"
 
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/config"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/errors"
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/storage/localfile"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/storage/memory"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/storage/s3"
 )
 
-var storage Storager
+// Storage types of the config
+const (
+	TypeLocalfile = "localfile"
+	TypeS3        = "s3"
+	TypeMemory    = "memory"
+)
+
+// New returns the storage of the type set in the config, the local files are used by default.
+func New(cfg *config.Config) (Storager, error) {
+	switch cfg.Storage.Type {
+	case "", TypeLocalfile:
+		sc := NewConfig(cfg.Storage.Localfile.Path)
 
-func Init(sc *Config) {
-	if storage == nil {
-		cfg := localfile.Config{
+		s, err := localfile.Init(&localfile.Config{
 			BasePath: sc.Path(),
 			Depth:    3,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("localfile.Init error: %w", err)
 		}
 
-		var err error
+		return s, nil
+	case TypeS3:
+		s3Cfg := s3.Config(cfg.Storage.S3)
 
-		storage, err = localfile.Init(&cfg)
+		s, err := s3.Init(&s3Cfg)
 		if err != nil {
-			log.Fatal(err)
+			return nil, fmt.Errorf("s3.Init error: %w", err)
 		}
-	}
-}
 
-func Storage() Storager {
-	if storage == nil {
-		log.Fatal("Storage is not initialized")
+		return s, nil
+	case TypeMemory:
+		return memory.New(), nil
+	default:
+		return nil, fmt.Errorf("%w: storage type %s", errors.ErrIsUnsupported, cfg.Storage.Type)
 	}
-
-	return storage
 }
@@ -0,0 +1,41 @@
+package storage_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/config"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/errors"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/storage"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/storage/localfile"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/storage/memory"
+)
+
+func TestNew(t *testing.T) {
+	cfg := &config.Config{}
+
+	cfg.Storage.Type = storage.TypeMemory
+
+	s, err := storage.New(cfg)
+	require.NoError(t, err)
+	assert.IsType(t, &memory.Storage{}, s)
+
+	cfg.Storage.Type = ""
+	cfg.Storage.Localfile.Path = t.TempDir()
+
+	s, err = storage.New(cfg)
+	require.NoError(t, err)
+	assert.IsType(t, &localfile.Storage{}, s, "the local files should be used by default")
+
+	cfg.Storage.Type = storage.TypeS3
+
+	_, err = storage.New(cfg)
+	assert.ErrorIs(t, err, errors.ErrIsEmpty, "the s3 endpoint should be set")
+
+	cfg.Storage.Type = "unknown"
+
+	_, err = storage.New(cfg)
+	assert.ErrorIs(t, err, errors.ErrIsUnsupported)
+}
@@ -0,0 +1,65 @@
+// Package memory Storage of the objects in memory, for the tests and the short-lived gateways
+package memory
+
+import (
+	"sync"
+
+	"golang.org/x/crypto/sha3"
+
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/errors"
+)
+
+type Storage struct {
+	sync.RWMutex
+	objects map[[32]byte][]byte
+}
+
+func New() *Storage {
+	return &Storage{
+		objects: map[[32]byte][]byte{},
+	}
+}
+
+func (s *Storage) Add(data []byte) (id *[32]byte, err error) {
+	h := sha3.Sum256(data)
+	id = &h
+
+	err = s.AddWithID(id, data)
+
+	return
+}
+
+func (s *Storage) AddWithID(id *[32]byte, data []byte) (err error) {
+	s.Lock()
+	defer s.Unlock()
+
+	// the callers may reuse the slices
+	s.objects[*id] = append([]byte{}, data...)
+
+	return nil
+}
+
+func (s *Storage) ReplaceWithID(id *[32]byte, data []byte) (err error) {
+	return s.AddWithID(id, data)
+}
+
+func (s *Storage) Get(id *[32]byte) (data []byte, err error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	data, ok := s.objects[*id]
+	if !ok {
+		return nil, errors.ErrIsNotExist
+	}
+
+	return append([]byte{}, data...), nil
+}
+
+func (s *Storage) Clean() (err error) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.objects = map[[32]byte][]byte{}
+
+	return nil
+}
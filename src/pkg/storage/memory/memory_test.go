@@ -0,0 +1,37 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/errors"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/storage/memory"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	s := memory.New()
+
+	data := []byte("some data")
+
+	id, err := s.Add(data)
+	require.NoError(t, err)
+
+	data[0] = 'S'
+
+	got, err := s.Get(id)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("some data"), got, "the stored data should not be changed by the caller")
+
+	require.NoError(t, s.ReplaceWithID(id, []byte("replaced")))
+
+	got, err = s.Get(id)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("replaced"), got)
+
+	require.NoError(t, s.Clean())
+
+	_, err = s.Get(id)
+	assert.ErrorIs(t, err, errors.ErrIsNotExist)
+}
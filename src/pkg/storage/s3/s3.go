@@ -0,0 +1,279 @@
+// Package s3 Storage of the objects in the bucket of the S3 compatible object store, e.g. MinIO
+package s3
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/sha3"
+
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/errors"
+)
+
+const defaultRegion = "us-east-1"
+
+type Config struct {
+	Endpoint        string // e.g. http://localhost:9000
+	Region          string
+	Bucket          string
+	Prefix          string // the objects are kept under the prefix, so the bucket can be shared
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// Storage keeps the objects in the bucket with the path-style requests, the object keys are the prefix and the hex of the id.
+type Storage struct {
+	endpoint   *url.URL
+	bucket     string
+	prefix     string
+	signer     *signer
+	httpClient *http.Client
+}
+
+func Init(config *Config) (*Storage, error) {
+	if config.Endpoint == "" {
+		return nil, fmt.Errorf("%w: Endpoint", errors.ErrIsEmpty)
+	}
+
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("%w: Bucket", errors.ErrIsEmpty)
+	}
+
+	endpoint, err := url.Parse(strings.TrimRight(config.Endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("endpoint parse error: %w", err)
+	}
+
+	region := config.Region
+	if region == "" {
+		region = defaultRegion
+	}
+
+	s := &Storage{
+		endpoint: endpoint,
+		bucket:   config.Bucket,
+		prefix:   config.Prefix,
+		signer: &signer{
+			accessKeyID:     config.AccessKeyID,
+			secretAccessKey: config.SecretAccessKey,
+			region:          region,
+		},
+		httpClient: &http.Client{Timeout: time.Minute},
+	}
+
+	if err = s.ensureBucket(); err != nil {
+		return nil, fmt.Errorf("ensureBucket error: %w", err)
+	}
+
+	return s, nil
+}
+
+func (s *Storage) Add(data []byte) (id *[32]byte, err error) {
+	h := sha3.Sum256(data)
+	id = &h
+
+	err = s.AddWithID(id, data)
+
+	return
+}
+
+func (s *Storage) AddWithID(id *[32]byte, data []byte) (err error) {
+	resp, err := s.do(http.MethodPut, s.objectKey(id), nil, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+
+	return nil
+}
+
+func (s *Storage) ReplaceWithID(id *[32]byte, data []byte) (err error) {
+	return s.AddWithID(id, data)
+}
+
+func (s *Storage) Get(id *[32]byte) (data []byte, err error) {
+	resp, err := s.do(http.MethodGet, s.objectKey(id), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, errors.ErrIsNotExist
+	default:
+		return nil, responseError(resp)
+	}
+
+	data, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("response body read error: %w", err)
+	}
+
+	return data, nil
+}
+
+// Clean removes the objects under the prefix, the bucket and the objects of the other prefixes are kept.
+func (s *Storage) Clean() (err error) {
+	keys, err := s.listKeys()
+	if err != nil {
+		return fmt.Errorf("listKeys error: %w", err)
+	}
+
+	for _, key := range keys {
+		resp, err := s.do(http.MethodDelete, key, nil, nil)
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+			err = responseError(resp)
+			resp.Body.Close()
+
+			return err
+		}
+
+		resp.Body.Close()
+	}
+
+	return nil
+}
+
+func (s *Storage) objectKey(id *[32]byte) string {
+	return s.prefix + hex.EncodeToString(id[:])
+}
+
+func (s *Storage) ensureBucket() error {
+	resp, err := s.do(http.MethodHead, "", nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+	default:
+		return responseError(resp)
+	}
+
+	var body []byte
+
+	if s.signer.region != defaultRegion {
+		body = []byte(`<CreateBucketConfiguration xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><LocationConstraint>` +
+			s.signer.region + `</LocationConstraint></CreateBucketConfiguration>`)
+	}
+
+	resp, err = s.do(http.MethodPut, "", nil, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+
+	return nil
+}
+
+type listBucketResult struct {
+	IsTruncated           bool
+	NextContinuationToken string
+	Contents              []struct {
+		Key string
+	}
+}
+
+func (s *Storage) listKeys() ([]string, error) {
+	var (
+		keys  []string
+		token string
+	)
+
+	for {
+		query := url.Values{
+			"list-type": {"2"},
+			"prefix":    {s.prefix},
+		}
+
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		resp, err := s.do(http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			err = responseError(resp)
+			resp.Body.Close()
+
+			return nil, err
+		}
+
+		var result listBucketResult
+
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+
+		if err != nil {
+			return nil, fmt.Errorf("ListObjectsV2 result decode error: %w", err)
+		}
+
+		for _, c := range result.Contents {
+			keys = append(keys, c.Key)
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return keys, nil
+		}
+
+		token = result.NextContinuationToken
+	}
+}
+
+// do sends the signed request of the object with the key or of the bucket if the key is empty.
+func (s *Storage) do(method, key string, query url.Values, body []byte) (*http.Response, error) {
+	u := *s.endpoint
+	u.Path += "/" + s.bucket
+	u.RawQuery = query.Encode()
+
+	if key != "" {
+		u.Path += "/" + key
+	}
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("http.NewRequest error: %w", err)
+	}
+
+	s.signer.sign(req, payloadHash(body), time.Now())
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s error: %w", method, u.Path, err)
+	}
+
+	return resp, nil
+}
+
+func responseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+	return fmt.Errorf("%w: %s %s status %d: %s", errors.ErrCustom, resp.Request.Method, resp.Request.URL.Path, resp.StatusCode, bytes.TrimSpace(body))
+}
@@ -0,0 +1,171 @@
+package s3
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/errors"
+)
+
+// fakeS3 is the local stand-in of MinIO serving the path-style requests of one bucket.
+// The listing is paged by 2 keys to check the continuation.
+type fakeS3 struct {
+	sync.Mutex
+	bucket   string
+	created  bool
+	objects  map[string][]byte
+	unsigned int
+}
+
+func newFakeS3(bucket string) *fakeS3 {
+	return &fakeS3{bucket: bucket, objects: map[string][]byte{}}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), signAlgorithm+" Credential=minio/") ||
+		r.Header.Get("X-Amz-Content-Sha256") == "" {
+		f.unsigned++
+		w.WriteHeader(http.StatusForbidden)
+
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	bucket, key, _ := strings.Cut(path, "/")
+
+	if bucket != f.bucket || (!f.created && !(r.Method == http.MethodPut && key == "")) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case key == "" && r.Method == http.MethodHead:
+	case key == "" && r.Method == http.MethodPut:
+		f.created = true
+	case key == "" && r.Method == http.MethodGet:
+		f.list(w, r)
+	case r.Method == http.MethodPut:
+		f.objects[key], _ = io.ReadAll(r.Body)
+	case r.Method == http.MethodGet:
+		data, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		_, _ = w.Write(data)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+
+	var keys []string
+
+	for key := range f.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	start, _ := strconv.Atoi(r.URL.Query().Get("continuation-token"))
+	end := start + 2
+
+	var result listBucketResult
+
+	if end < len(keys) {
+		result.IsTruncated = true
+		result.NextContinuationToken = strconv.Itoa(end)
+	} else {
+		end = len(keys)
+	}
+
+	for _, key := range keys[start:end] {
+		result.Contents = append(result.Contents, struct{ Key string }{key})
+	}
+
+	_ = xml.NewEncoder(w).Encode(result)
+}
+
+func TestStorage(t *testing.T) {
+	fake := newFakeS3("ipehr")
+
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	config := func(prefix string) *Config {
+		return &Config{
+			Endpoint:        server.URL,
+			Bucket:          "ipehr",
+			Prefix:          prefix,
+			AccessKeyID:     "minio",
+			SecretAccessKey: "minio123",
+		}
+	}
+
+	gateway1, err := Init(config("gateway1/"))
+	require.NoError(t, err)
+	assert.True(t, fake.created, "the bucket should be created")
+
+	gateway2, err := Init(config("gateway2/"))
+	require.NoError(t, err)
+
+	data := []byte("some data")
+
+	id, err := gateway1.Add(data)
+	require.NoError(t, err)
+
+	got, err := gateway1.Get(id)
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+
+	require.NoError(t, gateway1.ReplaceWithID(id, []byte("replaced")))
+
+	got, err = gateway1.Get(id)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("replaced"), got)
+
+	_, err = gateway2.Get(id)
+	assert.ErrorIs(t, err, errors.ErrIsNotExist, "the objects of the other prefix should not be visible")
+
+	for i := 0; i < 4; i++ {
+		_, err = gateway1.Add([]byte{byte(i)})
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, gateway2.AddWithID(id, data))
+
+	require.NoError(t, gateway1.Clean())
+
+	_, err = gateway1.Get(id)
+	assert.ErrorIs(t, err, errors.ErrIsNotExist)
+
+	got, err = gateway2.Get(id)
+	require.NoError(t, err, "the objects of the other prefix should be kept")
+	assert.Equal(t, data, got)
+
+	assert.Zero(t, fake.unsigned)
+
+	_, err = Init(&Config{Endpoint: server.URL, Bucket: "ipehr", AccessKeyID: "unknown"})
+	assert.Error(t, err)
+}
@@ -55,3 +55,37 @@ func TestAttributes_EncodeDecodeMsgpack(t *testing.T) {
 		})
 	}
 }
+
+func TestSliceNode_Items(t *testing.T) {
+	slice := newSliceNode().(*SliceNode)
+
+	for i := 0; i < 12; i++ {
+		slice.addAttribute("", &ObjectNode{BaseNode: BaseNode{ID: "at0006", NodeType: ObjectNodeType}, Attributes: Attributes{"value": newValueNode(i)}})
+	}
+
+	slice.addAttribute("", &ObjectNode{BaseNode: BaseNode{ID: "at0001", NodeType: ObjectNodeType}, Attributes: Attributes{"value": newValueNode(12)}})
+
+	values := func(items []Noder) []any {
+		result := []any{}
+		for _, item := range items {
+			result = append(result, item.TryGetChild("value").(*ValueNode).Data)
+		}
+
+		return result
+	}
+
+	want := []any{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+
+	assert.Equal(t, want, values(slice.Items()))
+
+	data, err := msgpack.Marshal(Attributes{"slice": slice})
+	assert.Nil(t, err)
+
+	got := Attributes{}
+	assert.Nil(t, msgpack.Unmarshal(data, &got))
+	assert.Equal(t, want, values(got["slice"].(*SliceNode).Items()))
+
+	// the items of the same id keep their order without the keys as well
+	slice.Keys = nil
+	assert.Equal(t, []any{12, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}, values(slice.Items()))
+}
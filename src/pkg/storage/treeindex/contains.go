@@ -0,0 +1,145 @@
+package treeindex
+
+import (
+	"sort"
+)
+
+// FindByType returns the nodes of the RM type contained in the node at any depth,
+// e.g. the COMPOSITIONs of an EHR, the OBSERVATIONs of a COMPOSITION or the ELEMENTs of a CLUSTER.
+// The EHR node is used to resolve the compositions referenced by folders and the composition versions, it may be nil.
+// VERSION returns all versions of the compositions, FindVersions returns the latest ones.
+func FindByType(ehr *EHRNode, node Noder, itemType string) []Noder {
+	result := []Noder{}
+
+	if ehr != nil {
+		switch itemType {
+		case VERSION:
+			return ehr.findVersions(node, false)
+		case VERSIONED_OBJECT, VERSIONED_COMPOSITION:
+			if _, ok := node.(*EHRNode); ok {
+				return ehr.getVersionedObjects()
+			}
+
+			return result
+		}
+
+		if isVersion(node) {
+			data, ok := node.TryGetChild("data").(*CompositionNode)
+			if !ok {
+				return result
+			}
+
+			if itemType == COMPOSITION {
+				return append(result, data)
+			}
+
+			return FindByType(ehr, data, itemType)
+		}
+	}
+
+	switch node := node.(type) {
+	case *EHRNode:
+		switch itemType {
+		case COMPOSITION:
+			result = append(result, node.Compositions.nodes()...)
+		case FOLDER:
+			result = append(result, node.Folders.nodes()...)
+		default:
+			for _, cmp := range node.Compositions.nodes() {
+				result = append(result, FindByType(node, cmp, itemType)...)
+			}
+		}
+	case *CompositionNode:
+		if container, ok := node.Data[itemType]; ok {
+			return append(result, container.nodes()...)
+		}
+
+		for _, name := range sortedKeys(node.Data) {
+			// entries of the sections are in the collections of their types as well
+			if name == SECTION {
+				continue
+			}
+
+			for _, n := range node.Data[name].nodes() {
+				result = append(result, findInChildren(n, itemType)...)
+			}
+		}
+	case *ObjectNode:
+		if node.Type != FOLDER || ehr == nil {
+			return findInChildren(node, itemType)
+		}
+
+		switch itemType {
+		case FOLDER:
+			result = append(result, ehr.getSubFolders(node)...)
+		case COMPOSITION:
+			result = append(result, ehr.getFolderCompositions(node)...)
+		default:
+			for _, cmp := range ehr.getFolderCompositions(node) {
+				result = append(result, FindByType(ehr, cmp, itemType)...)
+			}
+		}
+	default:
+		return findInChildren(node, itemType)
+	}
+
+	return result
+}
+
+// FindVersions returns the versions of the compositions contained in the EHR, the VERSIONED_OBJECT or the FOLDER node.
+// Only the last version of every composition is returned when latest is true.
+func FindVersions(ehr *EHRNode, node Noder, latest bool) []Noder {
+	if ehr == nil {
+		return []Noder{}
+	}
+
+	return ehr.findVersions(node, latest)
+}
+
+// findInChildren returns the descendant object nodes of the RM type
+func findInChildren(node Noder, itemType string) []Noder {
+	var children Attributes
+
+	switch node := node.(type) {
+	case *ObjectNode:
+		children = node.Attributes
+	case *SliceNode:
+		children = node.Data
+	default:
+		return nil
+	}
+
+	result := []Noder{}
+
+	for _, key := range sortedKeys(children) {
+		child := children[key]
+
+		if obj, ok := child.(*ObjectNode); ok && string(obj.Type) == itemType {
+			result = append(result, child)
+		}
+
+		result = append(result, findInChildren(child, itemType)...)
+	}
+
+	return result
+}
+
+func (c Container) nodes() []Noder {
+	result := make([]Noder, 0, c.Len())
+	for _, key := range sortedKeys(c) {
+		result = append(result, c[key]...)
+	}
+
+	return result
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
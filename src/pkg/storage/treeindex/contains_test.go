@@ -0,0 +1,90 @@
+package treeindex
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model/base"
+)
+
+func TestFindByType(t *testing.T) {
+	ehr, err := loadEHRFromFile("./../../../../data/mock/ehr/ehr.json")
+	require.NoError(t, err)
+
+	cmp, err := loadComposition("./../../../../data/mock/ehr/composition.json")
+	require.NoError(t, err)
+
+	cmp.UID = &base.UIDBasedID{ObjectID: base.ObjectID{Value: "8d5b2eb1-ad71-4ae8-8a9d-9b8d2f3b3b3a::openEHRSys.example.com::1"}}
+
+	ehrID := ehr.EhrID.Value
+
+	idx := NewEHRIndex()
+	require.NoError(t, idx.AddEHR(ehr))
+	require.NoError(t, idx.AddComposition(ehrID, cmp, model.AuditDetails{}))
+
+	dir := model.Directory{
+		Locatable: base.Locatable{Type: base.FolderItemType, Name: base.NewDvText("root")},
+		Folders: []*model.Directory{
+			{
+				Locatable: base.Locatable{Type: base.FolderItemType, Name: base.NewDvText("episodes")},
+				Items: []model.DirectoryItem{
+					{ID: base.UIDBasedID{ObjectID: base.ObjectID{Value: "8d5b2eb1-ad71-4ae8-8a9d-9b8d2f3b3b3a::openEHRSys.example.com::2"}}},
+				},
+			},
+			{
+				Locatable: base.Locatable{Type: base.FolderItemType, Name: base.NewDvText("empty")},
+			},
+		},
+	}
+	require.NoError(t, idx.UpdateDirectory(ehrID, dir))
+
+	ehrNode := idx.Ehrs[ehrID]
+
+	assert.Len(t, FindByType(ehrNode, ehrNode, COMPOSITION), 1)
+	assert.Len(t, FindByType(ehrNode, ehrNode, SECTION), 14)
+	assert.Len(t, FindByType(ehrNode, ehrNode, INSTRUCTION), 1)
+	assert.Len(t, FindByType(ehrNode, ehrNode, ADMIN_ENTRY), 0)
+
+	// CLUSTERs are found at any depth
+	clusters := FindByType(ehrNode, ehrNode, "CLUSTER")
+	assert.Contains(t, nodeIDs(clusters), "openEHR-EHR-CLUSTER.timing_daily.v1")
+
+	var labResult Noder
+	for _, n := range FindByType(ehrNode, ehrNode, OBSERVATION) {
+		if n.GetID() == "openEHR-EHR-OBSERVATION.laboratory_test_result.v1" {
+			labResult = n
+		}
+	}
+
+	require.NotNil(t, labResult)
+	assert.ElementsMatch(t, []string{
+		"openEHR-EHR-CLUSTER.specimen.v1",
+		"openEHR-EHR-CLUSTER.laboratory_test_analyte.v1",
+		"openEHR-EHR-CLUSTER.multimedia_source.v0",
+	}, nodeIDs(FindByType(ehrNode, labResult, "CLUSTER")))
+
+	folders := FindByType(ehrNode, ehrNode, FOLDER)
+	require.Len(t, folders, 3)
+
+	root := ehrNode.Folders["root"][0]
+	episodes := ehrNode.Folders["root/episodes"][0]
+	empty := ehrNode.Folders["root/empty"][0]
+
+	assert.ElementsMatch(t, []Noder{episodes, empty}, FindByType(ehrNode, root, FOLDER))
+	assert.Len(t, FindByType(ehrNode, root, COMPOSITION), 1)
+	assert.Len(t, FindByType(ehrNode, episodes, COMPOSITION), 1)
+	assert.Len(t, FindByType(ehrNode, episodes, SECTION), 14)
+	assert.Len(t, FindByType(ehrNode, empty, COMPOSITION), 0)
+}
+
+func nodeIDs(nodes []Noder) []string {
+	result := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		result = append(result, n.GetID())
+	}
+
+	return result
+}
@@ -172,11 +172,31 @@ func processDvProportion(node Noder, value *base.DvProportion) (Noder, error) {
 }
 
 func processDvParsable(node Noder, value *base.DvParsable) (Noder, error) {
-	return node, errors.New("DV_PARSABLE not implemented")
+	node, err := processDvEncapsulated(node, &value.DvEncapsulated)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot process DV_PARSABLE.base")
+	}
+
+	node.addAttribute("value", newNode(value.Value))
+	node.addAttribute("formalism", newNode(value.Formalism))
+
+	return node, nil
 }
 
 func processDvParagraph(node Noder, value *base.DvParagraph) (Noder, error) {
-	return node, errors.New("DV_PARAGRAPH not implemented")
+	node, err := processDvValueBase(node, &value.DvValueBase)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot process DV_PARAGRAPH.base")
+	}
+
+	itemsNode, err := walk(value.Items)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot process DV_PARAGRAPH.items")
+	}
+
+	node.addAttribute("items", itemsNode)
+
+	return node, nil
 }
 
 func processDvMultimedia(node Noder, value *base.DvMultimedia) (Noder, error) {
@@ -305,7 +325,7 @@ func processDvText(node Noder, value *base.DvText) (Noder, error) {
 	node.addAttribute("formatting", newNode(value.Formatting))
 
 	if value.Hyperlink != nil {
-		hyperlinkNode, err := processDvURI(node, value.Hyperlink)
+		hyperlinkNode, err := walk(value.Hyperlink)
 		if err != nil {
 			return nil, errors.Wrap(err, "cannot process DV_TEXT.hyperlink")
 		}
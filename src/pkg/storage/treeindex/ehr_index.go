@@ -2,20 +2,37 @@ package treeindex
 
 import (
 	"encoding/json"
+	"strings"
+	"sync"
 
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model"
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/errors"
+	"github.com/vmihailenco/msgpack/v5"
 )
 
 var DefaultEHRIndex = NewEHRIndex()
 
 type EHRIndex struct {
 	Ehrs map[string]*EHRNode `msgpack:"ehr,omitempty"`
+
+	// Docs are the stored documents of the EHRs keyed by their CIDs
+	Docs map[string]DocRef `msgpack:"docs,omitempty"`
+
+	// Stale are the ids of the EHRs whose committed changes failed to apply, they are re-indexed by the next restore
+	Stale map[string]bool `msgpack:"stale,omitempty"`
+
+	mu        sync.RWMutex
+	persist   *persistence
+	secondary *secondaryIndex
+	cipher    *ValueCipher
 }
 
 func NewEHRIndex() *EHRIndex {
 	idx := EHRIndex{
-		Ehrs: map[string]*EHRNode{},
+		Ehrs:      map[string]*EHRNode{},
+		Docs:      map[string]DocRef{},
+		Stale:     map[string]bool{},
+		secondary: newSecondaryIndex(),
 	}
 
 	return &idx
@@ -25,26 +42,187 @@ func AddEHR(ehr model.EHR) error {
 	return DefaultEHRIndex.AddEHR(ehr)
 }
 
-func AddComposition(ehrID string, cmp model.Composition) error {
-	return DefaultEHRIndex.AddComposition(ehrID, cmp)
+func AddComposition(ehrID string, cmp model.Composition, audit model.AuditDetails) error {
+	return DefaultEHRIndex.AddComposition(ehrID, cmp, audit)
+}
+
+func UpdateComposition(ehrID string, cmp model.Composition, audit model.AuditDetails) error {
+	return DefaultEHRIndex.UpdateComposition(ehrID, cmp, audit)
+}
+
+func DeleteComposition(ehrID, uid string, audit model.AuditDetails) error {
+	return DefaultEHRIndex.DeleteComposition(ehrID, uid, audit)
+}
+
+func UpdateDirectory(ehrID string, dir model.Directory) error {
+	return DefaultEHRIndex.UpdateDirectory(ehrID, dir)
+}
+
+func UpdateEHRStatus(ehrID string, status model.EhrStatus) error {
+	return DefaultEHRIndex.UpdateEHRStatus(ehrID, status)
+}
+
+func AddDoc(CID, ehrID, uid string) error {
+	return DefaultEHRIndex.AddDoc(CID, ehrID, uid)
+}
+
+func RemoveEHR(ehrID string) error {
+	return DefaultEHRIndex.RemoveEHR(ehrID)
 }
 
+// AddEHR adds EHR object into the index.
+// If the EHR is already indexed its compositions are kept.
 func (idx *EHRIndex) AddEHR(ehr model.EHR) error {
+	return idx.write(opAddEHR, ehr.EhrID.Value, "", ehr, nil, func() error {
+		return idx.addEHR(ehr)
+	})
+}
+
+func (idx *EHRIndex) addEHR(ehr model.EHR) error {
 	node, err := processEHR(ehr)
 	if err != nil {
 		return errors.Wrap(err, "cannot add EHR object")
 	}
 
+	if existing, ok := idx.Ehrs[node.GetID()]; ok {
+		for id, nodes := range existing.Compositions {
+			node.Compositions[id] = append(node.Compositions[id], nodes...)
+		}
+
+		node.Folders = existing.Folders
+		node.NotQueryable = existing.NotQueryable
+
+		for id, versions := range existing.Versions {
+			if node.Versions == nil {
+				node.Versions = Container{}
+			}
+
+			node.Versions[id] = versions
+		}
+	}
+
 	idx.Ehrs[node.GetID()] = node
+	idx.secondary.updateEHR(node)
 
 	return nil
 }
 
-func (idx EHRIndex) GetEHRs(id string) ([]*EHRNode, error) {
+// RemoveEHR removes the EHR with its compositions, folders and versions from the index, e.g. before it is restored again.
+// The documents of the EHR and its stale mark are kept.
+func (idx *EHRIndex) RemoveEHR(ehrID string) error {
+	return idx.write(opRemoveEHR, ehrID, "", nil, nil, func() error {
+		idx.removeEHR(ehrID)
+		return nil
+	})
+}
+
+func (idx *EHRIndex) removeEHR(ehrID string) {
+	delete(idx.Ehrs, ehrID)
+	idx.secondary.removeEHR(ehrID)
+}
+
+// MarkStale marks the EHR for the re-index by the next restore.
+func (idx *EHRIndex) MarkStale(ehrID string) error {
+	return idx.write(opSetStale, ehrID, "", true, nil, func() error {
+		idx.setStale(ehrID, true)
+		return nil
+	})
+}
+
+// ClearStale removes the re-index mark of the EHR once it is restored.
+func (idx *EHRIndex) ClearStale(ehrID string) error {
+	if !idx.IsStale(ehrID) {
+		return nil
+	}
+
+	return idx.write(opSetStale, ehrID, "", false, nil, func() error {
+		idx.setStale(ehrID, false)
+		return nil
+	})
+}
+
+func (idx *EHRIndex) setStale(ehrID string, stale bool) {
+	if stale {
+		idx.Stale[ehrID] = true
+	} else {
+		delete(idx.Stale, ehrID)
+	}
+}
+
+// IsStale reports whether the EHR is marked for the re-index.
+func (idx *EHRIndex) IsStale(ehrID string) bool {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return idx.Stale[ehrID]
+}
+
+// IsIndexed reports whether the EHR is in the index.
+func (idx *EHRIndex) IsIndexed(ehrID string) bool {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	_, ok := idx.Ehrs[ehrID]
+
+	return ok
+}
+
+// IsVersionIndexed reports whether the composition version with the uid is in the versions history of the EHR
+// or, if deleted is true, whether the deletion of the version is.
+func (idx *EHRIndex) IsVersionIndexed(ehrID, uid string, deleted bool) bool {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	ehrNode, ok := idx.Ehrs[ehrID]
+	if !ok {
+		return false
+	}
+
+	if deleted {
+		uid = nextVersionUID(uid)
+	}
+
+	for _, v := range ehrNode.Versions[baseUID(uid)] {
+		if v.GetID() != uid {
+			continue
+		}
+
+		_, hasData := v.TryGetChild("data").(*CompositionNode)
+
+		return hasData != deleted
+	}
+
+	return false
+}
+
+// SetValueCipher makes the index encrypt the data values of the compositions added after the call.
+// It must be set before Persist, so the replayed compositions are encrypted as well.
+func (idx *EHRIndex) SetValueCipher(c *ValueCipher) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.cipher = c
+}
+
+// ValueCipher returns the cipher of the indexed values or nil if the values are not encrypted.
+func (idx *EHRIndex) ValueCipher() *ValueCipher {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return idx.cipher
+}
+
+// GetEHRs returns the EHR with the id or all EHRs, ordered by their ids, if the id is empty.
+// The writes replace the indexed EHRs instead of changing them, so the queries walk the returned ones without the lock.
+// The order keeps the rows of the query the same when the query is run again, e.g. for the next page.
+func (idx *EHRIndex) GetEHRs(id string) ([]*EHRNode, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
 	if id == "" {
 		result := make([]*EHRNode, 0, len(idx.Ehrs))
-		for _, ehrNode := range idx.Ehrs {
-			result = append(result, ehrNode)
+		for _, id := range sortedKeys(idx.Ehrs) {
+			result = append(result, idx.Ehrs[id])
 		}
 
 		return result, nil
@@ -58,15 +236,237 @@ func (idx EHRIndex) GetEHRs(id string) ([]*EHRNode, error) {
 	return []*EHRNode{ehrNode}, nil
 }
 
-func (idx *EHRIndex) AddComposition(ehrID string, cmp model.Composition) error {
-	ehrNode, ok := idx.Ehrs[ehrID]
+// AddComposition adds the composition into the index and its version, committed with the audit, into the versions history.
+func (idx *EHRIndex) AddComposition(ehrID string, cmp model.Composition, audit model.AuditDetails) error {
+	return idx.write(opAddComposition, ehrID, "", cmp, &audit, func() error {
+		return idx.addComposition(ehrID, cmp, audit, false)
+	})
+}
+
+// UpdateComposition replaces the indexed composition with the given version.
+// The previous versions are kept in the versions history only.
+func (idx *EHRIndex) UpdateComposition(ehrID string, cmp model.Composition, audit model.AuditDetails) error {
+	return idx.write(opUpdateComposition, ehrID, "", cmp, &audit, func() error {
+		return idx.addComposition(ehrID, cmp, audit, true)
+	})
+}
+
+func (idx *EHRIndex) addComposition(ehrID string, cmp model.Composition, audit model.AuditDetails, replace bool) error {
+	cmpNode, err := processComposition(cmp)
+	if err != nil {
+		return errors.Wrap(err, "cannot process Composition")
+	}
+
+	if idx.cipher != nil {
+		if err := idx.cipher.encryptNode(ehrID, cmpNode, false); err != nil {
+			return errors.Wrap(err, "cannot encrypt Composition values")
+		}
+	}
+
+	indexed, ok := idx.Ehrs[ehrID]
 	if !ok {
 		return errors.New("EHR not found")
 	}
 
-	return ehrNode.addComposition(cmp)
+	ehrNode := indexed.clone()
+
+	if uid := cmpNode.GetUID(); replace && uid != "" {
+		ehrNode.removeComposition(uid)
+	}
+
+	ehrNode.addCompositionNode(cmpNode)
+
+	if cmpNode.GetUID() != "" {
+		if err := ehrNode.addVersion(cmpNode, audit); err != nil {
+			return errors.Wrap(err, "cannot add Composition version")
+		}
+	}
+
+	idx.Ehrs[ehrID] = ehrNode
+	idx.secondary.updateComposition(ehrNode, baseUID(cmpNode.GetUID()))
+
+	return nil
+}
+
+// DeleteComposition removes the composition with the given uid from the index.
+// The deletion is recorded as the last version of the composition in the versions history.
+func (idx *EHRIndex) DeleteComposition(ehrID, uid string, audit model.AuditDetails) error {
+	return idx.write(opDeleteComposition, ehrID, uid, nil, &audit, func() error {
+		return idx.deleteComposition(ehrID, uid, audit)
+	})
+}
+
+func (idx *EHRIndex) deleteComposition(ehrID, uid string, audit model.AuditDetails) error {
+	indexed, ok := idx.Ehrs[ehrID]
+	if !ok {
+		return errors.New("EHR not found")
+	}
+
+	ehrNode := indexed.clone()
+
+	if !ehrNode.removeComposition(uid) {
+		return errors.ErrNotFound
+	}
+
+	if err := ehrNode.addDeletedVersion(uid, audit); err != nil {
+		return errors.Wrap(err, "cannot add Composition deletion version")
+	}
+
+	idx.Ehrs[ehrID] = ehrNode
+	idx.secondary.updateComposition(ehrNode, baseUID(uid))
+
+	return nil
 }
 
-func (idx EHRIndex) MarshalJSON() ([]byte, error) {
+// UpdateDirectory replaces the indexed folders of the EHR with the folders of the directory.
+func (idx *EHRIndex) UpdateDirectory(ehrID string, dir model.Directory) error {
+	return idx.write(opUpdateDirectory, ehrID, "", dir, nil, func() error {
+		return idx.updateDirectory(ehrID, &dir)
+	})
+}
+
+func (idx *EHRIndex) updateDirectory(ehrID string, dir *model.Directory) error {
+	indexed, ok := idx.Ehrs[ehrID]
+	if !ok {
+		return errors.New("EHR not found")
+	}
+
+	ehrNode := *indexed
+	ehrNode.Folders = processDirectory(dir)
+
+	idx.Ehrs[ehrID] = &ehrNode
+
+	return nil
+}
+
+// UpdateEHRStatus applies the flags of the EHR_STATUS to the indexed EHR.
+func (idx *EHRIndex) UpdateEHRStatus(ehrID string, status model.EhrStatus) error {
+	return idx.write(opUpdateEHRStatus, ehrID, "", status, nil, func() error {
+		return idx.updateEHRStatus(ehrID, &status)
+	})
+}
+
+func (idx *EHRIndex) updateEHRStatus(ehrID string, status *model.EhrStatus) error {
+	indexed, ok := idx.Ehrs[ehrID]
+	if !ok {
+		return errors.New("EHR not found")
+	}
+
+	ehrNode := *indexed
+	ehrNode.NotQueryable = !status.IsQueryable
+
+	idx.Ehrs[ehrID] = &ehrNode
+
+	return nil
+}
+
+// AddDoc records the EHR and the versioned object id of the document stored under the CID,
+// so the documents granted by the access lists are resolved into the indexed data.
+// The uid is empty for the EHR-wide documents, e.g. EHR and EHR_STATUS.
+func (idx *EHRIndex) AddDoc(CID, ehrID, uid string) error {
+	return idx.write(opAddDoc, ehrID, uid, CID, nil, func() error {
+		idx.Docs[CID] = DocRef{EhrID: ehrID, UID: baseUID(uid)}
+		return nil
+	})
+}
+
+// GetDoc returns the EHR and the versioned object id of the document stored under the CID.
+func (idx *EHRIndex) GetDoc(CID string) (DocRef, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	ref, ok := idx.Docs[CID]
+
+	return ref, ok
+}
+
+// FindByArchetype returns the composition nodes with the archetype_node_id, e.g. OBSERVATIONs of the archetype
+// or ELEMENTs with the at-code, and the ids of their EHRs.
+func (idx *EHRIndex) FindByArchetype(archetypeNodeID string) map[Noder]string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return idx.secondary.findByArchetype(archetypeNodeID)
+}
+
+// FindInContent returns the nodes with the archetype_node_id contained in the composition of the EHR, the same as
+// FindByType finds in it, so the containment is resolved without walking the composition.
+// It returns false if the composition is not indexed, e.g. it is replaced after the query has read it.
+func (idx *EHRIndex) FindInContent(ehrID string, cmp Noder, archetypeNodeID string) ([]Noder, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return idx.secondary.findInContent(ehrID, cmp, archetypeNodeID)
+}
+
+// FindByValue returns the nodes of the archetype having the value at the path for which the comparison with val is true,
+// and the ids of their EHRs. The values are compared as CompareOrderKeys does, the encrypted values as ValueCipher.Compare does.
+// It returns false if the index can not answer, e.g. for the at-code instead of the archetype id.
+func (idx *EHRIndex) FindByValue(archetypeID string, path []PathPart, op CompareOperator, val any) (map[Noder]string, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return idx.secondary.findByValue(archetypeID, path, op, val, idx.cipher)
+}
+
+// Len returns the amount of indexed EHRs.
+func (idx *EHRIndex) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return len(idx.Ehrs)
+}
+
+// DecodeMsgpack decodes the indexed EHRs and rebuilds the secondary indexes of them.
+func (idx *EHRIndex) DecodeMsgpack(dec *msgpack.Decoder) error {
+	tmp := struct {
+		Ehrs  map[string]*EHRNode `msgpack:"ehr,omitempty"`
+		Docs  map[string]DocRef   `msgpack:"docs,omitempty"`
+		Stale map[string]bool     `msgpack:"stale,omitempty"`
+	}{}
+
+	if err := dec.Decode(&tmp); err != nil {
+		return errors.Wrap(err, "cannot decode EHR index")
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.Ehrs = tmp.Ehrs
+	if idx.Ehrs == nil {
+		idx.Ehrs = map[string]*EHRNode{}
+	}
+
+	idx.Docs = tmp.Docs
+	if idx.Docs == nil {
+		idx.Docs = map[string]DocRef{}
+	}
+
+	idx.Stale = tmp.Stale
+	if idx.Stale == nil {
+		idx.Stale = map[string]bool{}
+	}
+
+	idx.secondary = newSecondaryIndex()
+	idx.secondary.rebuild(idx.Ehrs)
+
+	return nil
+}
+
+func (idx *EHRIndex) MarshalJSON() ([]byte, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
 	return json.Marshal(idx.Ehrs)
 }
+
+// DocRef is the indexed data of the stored document.
+type DocRef struct {
+	EhrID string `msgpack:"ehr_id"`
+	UID   string `msgpack:"uid,omitempty"`
+}
+
+// baseUID returns object_id part of the OBJECT_VERSION_ID value
+func baseUID(uid string) string {
+	return strings.SplitN(uid, "::", 2)[0]
+}
@@ -37,10 +37,7 @@ func TestEHRIndex_AddEHR(t *testing.T) {
 						Type:     base.EHRItemType,
 						NodeType: EHRNodeType,
 					},
-					Attributes: Attributes{
-						"system_id": newValueNode("d60e2348-b083-48ce-93b9-916cef1d3a5a"),
-						"ehr_id":    newValueNode("7d44b88c-4199-4bad-97dc-d78268e01398"),
-					},
+					Attributes:   mockEHRAttributes(),
 					Compositions: Container{},
 				},
 			},
@@ -63,10 +60,7 @@ func TestEHRIndex_AddEHR(t *testing.T) {
 						Type:     base.EHRItemType,
 						NodeType: EHRNodeType,
 					},
-					Attributes: Attributes{
-						"system_id": newValueNode("d60e2348-b083-48ce-93b9-916cef1d3a5a"),
-						"ehr_id":    newValueNode("7d44b88c-4199-4bad-97dc-d78268e01398"),
-					},
+					Attributes: mockEHRAttributes(),
 					Compositions: Container{
 						"openEHR-EHR-COMPOSITION.health_summary.v1": []Noder{
 							&CompositionNode{
@@ -78,6 +72,22 @@ func TestEHRIndex_AddEHR(t *testing.T) {
 								},
 								Tree: *NewTree(),
 								Attributes: Attributes{
+									"uid": newNode(base.UIDBasedID{
+										ObjectID: base.ObjectID{
+											Type:  "OBJECT_VERSION_ID",
+											Value: "__COMPOSITION_ID__",
+										},
+									}),
+									"name": nodeForName(base.DvText{
+										DvValueBase: base.DvValueBase{Type: base.DvTextItemType},
+										Value:       "International Patient Summary",
+									}),
+									"archetype_details": nodeForArchetyped(base.Archetyped{
+										Type:        base.ArchetypedItemType,
+										ArchetypeID: base.ObjectID{Type: base.ArchetypeIDItemType, Value: "openEHR-EHR-COMPOSITION.health_summary.v1"},
+										TemplateID:  &base.ObjectID{Type: base.TemplateIDItemType, Value: "International Patient Summary"},
+										RmVersion:   "1.0.4",
+									}),
 									"language": newNode(&base.CodePhrase{
 										Type: base.CodePhraseItemType,
 										TerminologyID: base.ObjectID{
@@ -94,14 +104,18 @@ func TestEHRIndex_AddEHR(t *testing.T) {
 										},
 										CodeString: "US",
 									}),
-									"category": newNode(base.NewDvCodedText("event", base.CodePhrase{
+									"composer": mustNode(nodeForPartyProxy(base.NewPartyProxy(&base.PartyIdentified{
+										Name:           "Silvia Blake",
+										PartyProxyBase: base.PartyProxyBase{Type: base.PartyIdentifiedItemType},
+									}))),
+									"category": nodeForCodedText("event", base.CodePhrase{
 										Type: base.CodePhraseItemType,
 										TerminologyID: base.ObjectID{
 											Type:  base.TerminologyIDItemType,
 											Value: "openehr",
 										},
-										CodeString: "443",
-									})),
+										CodeString: "433",
+									}),
 								},
 							},
 						},
@@ -129,6 +143,25 @@ func TestEHRIndex_AddEHR(t *testing.T) {
 	}
 }
 
+// mockEHRAttributes returns the attributes of the EHR node of the mock EHR files.
+func mockEHRAttributes() Attributes {
+	return Attributes{
+		"system_id": newValueNode("d60e2348-b083-48ce-93b9-916cef1d3a5a"),
+		"ehr_id":    newValueNode("7d44b88c-4199-4bad-97dc-d78268e01398"),
+		"ehr_status": nodeForObjectRef(base.ObjectRef{
+			ID:        base.ObjectID{Type: base.ObjectVersionIDItemType, Value: "8849182c-82ad-4088-a07f-48ead4180515::openEHRSys.example.com::1"},
+			Namespace: "local",
+			Type:      string(base.EHRStatusItemType),
+		}),
+		"ehr_access": nodeForObjectRef(base.ObjectRef{
+			ID:        base.ObjectID{Type: base.ObjectVersionIDItemType, Value: "59a8d0ac-140e-4feb-b2d6-af99f8e68af8::openEHRSys.example.com::1"},
+			Namespace: "local",
+			Type:      string(base.EHRAccessItemType),
+		}),
+		"time_created": mustNode(walk(&base.DvDateTime{Value: "2015-01-20T19:30:22.765+01:00"})),
+	}
+}
+
 func TestEHRIndex_MessagePack(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -177,6 +210,65 @@ func TestEHRIndex_MessagePack(t *testing.T) {
 	}
 }
 
+func TestEHRIndex_UpdateDeleteComposition(t *testing.T) {
+	ehr, err := loadEHRFromFile("./../../../../data/mock/ehr/ehr.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmp, err := loadComposition("./test_fixtures/simple_composition.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmp.UID = &base.UIDBasedID{ObjectID: base.ObjectID{Value: "8d5b2eb1-ad71-4ae8-8a9d-9b8d2f3b3b3a::openEHRSys.example.com::1"}}
+
+	idx := NewEHRIndex()
+	assert.Nil(t, idx.AddEHR(ehr))
+	assert.Nil(t, idx.AddComposition(ehr.EhrID.Value, cmp, model.AuditDetails{}))
+
+	cmp.UID.Value = "8d5b2eb1-ad71-4ae8-8a9d-9b8d2f3b3b3a::openEHRSys.example.com::2"
+	assert.Nil(t, idx.UpdateComposition(ehr.EhrID.Value, cmp, model.AuditDetails{}))
+
+	ehrNode := idx.Ehrs[ehr.EhrID.Value]
+	if assert.Equal(t, 1, ehrNode.Compositions.Len()) {
+		cmpNode := ehrNode.Compositions[cmp.ArchetypeNodeID][0].(*CompositionNode)
+		assert.Equal(t, cmp.UID.Value, cmpNode.GetUID())
+	}
+
+	assert.Nil(t, idx.AddEHR(ehr))
+	assert.Equal(t, 1, idx.Ehrs[ehr.EhrID.Value].Compositions.Len(), "compositions should be kept on EHR re-adding")
+
+	read, err := idx.GetEHRs(ehr.EhrID.Value)
+	assert.Nil(t, err)
+
+	assert.Nil(t, idx.DeleteComposition(ehr.EhrID.Value, "8d5b2eb1-ad71-4ae8-8a9d-9b8d2f3b3b3a::openEHRSys.example.com::2", model.AuditDetails{}))
+	assert.Equal(t, 0, idx.Ehrs[ehr.EhrID.Value].Compositions.Len())
+
+	// the EHR read before the write is replaced, not changed
+	if assert.Len(t, read, 1) {
+		assert.Equal(t, 1, read[0].Compositions.Len())
+		assert.Len(t, read[0].Versions["8d5b2eb1-ad71-4ae8-8a9d-9b8d2f3b3b3a"], 2)
+	}
+
+	err = idx.DeleteComposition(ehr.EhrID.Value, "8d5b2eb1-ad71-4ae8-8a9d-9b8d2f3b3b3a", model.AuditDetails{})
+	assert.ErrorIs(t, err, errors.ErrNotFound)
+
+	// The deleted version indexed and deleted again, as on the index restore, keeps the history
+	assert.Nil(t, idx.UpdateComposition(ehr.EhrID.Value, cmp, model.AuditDetails{}))
+	assert.Nil(t, idx.DeleteComposition(ehr.EhrID.Value, cmp.UID.Value, model.AuditDetails{}))
+
+	versions := idx.Ehrs[ehr.EhrID.Value].Versions["8d5b2eb1-ad71-4ae8-8a9d-9b8d2f3b3b3a"]
+	if assert.Len(t, versions, 3) {
+		assert.Equal(t, "8d5b2eb1-ad71-4ae8-8a9d-9b8d2f3b3b3a::openEHRSys.example.com::3", versions[2].GetID())
+	}
+
+	assert.True(t, idx.IsVersionIndexed(ehr.EhrID.Value, "8d5b2eb1-ad71-4ae8-8a9d-9b8d2f3b3b3a::openEHRSys.example.com::1", false))
+	assert.False(t, idx.IsVersionIndexed(ehr.EhrID.Value, "8d5b2eb1-ad71-4ae8-8a9d-9b8d2f3b3b3a::openEHRSys.example.com::1", true))
+	assert.True(t, idx.IsVersionIndexed(ehr.EhrID.Value, cmp.UID.Value, true))
+	assert.False(t, idx.IsVersionIndexed(ehr.EhrID.Value, "8d5b2eb1-ad71-4ae8-8a9d-9b8d2f3b3b3a::openEHRSys.example.com::4", false))
+}
+
 func loadEHRFromFile(name string) (model.EHR, error) {
 	data, err := os.ReadFile(name)
 	if err != nil {
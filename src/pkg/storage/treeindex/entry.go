@@ -5,8 +5,97 @@ import (
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/errors"
 )
 
+func processEntry(node Noder, entry *base.Entry) (Noder, error) {
+	if entry.Language.CodeString != "" {
+		node.addAttribute("language", newNode(entry.Language))
+	}
+
+	if entry.Encoding.CodeString != "" {
+		node.addAttribute("encoding", newNode(entry.Encoding))
+	}
+
+	subjectNode, err := nodeForPartyProxy(entry.Subject)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot process ENTRY.subject")
+	}
+
+	if subjectNode != nil {
+		node.addAttribute("subject", subjectNode)
+	}
+
+	if entry.Provider != nil {
+		providerNode, err := nodeForPartyProxy(*entry.Provider)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot process ENTRY.provider")
+		}
+
+		if providerNode != nil {
+			node.addAttribute("provider", providerNode)
+		}
+	}
+
+	if len(entry.OtherParticipations) != 0 {
+		participationsNode, err := walk(entry.OtherParticipations)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot process ENTRY.other_participations")
+		}
+
+		node.addAttribute("other_participations", participationsNode)
+	}
+
+	if entry.WorkflowID != nil {
+		node.addAttribute("workflow_id", nodeForObjectRef(*entry.WorkflowID))
+	}
+
+	return node, nil
+}
+
 func processCareEntry(node Noder, entry *base.CareEntry) (Noder, error) {
-	// todo: add processing for CareEntry struct fields
+	node, err := processEntry(node, &entry.Entry)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot process CARE_ENTRY.base")
+	}
+
+	if entry.Protocol != nil && entry.Protocol.Data != nil {
+		protocolNode, err := walk(*entry.Protocol)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot process CARE_ENTRY.protocol")
+		}
+
+		node.addAttribute("protocol", protocolNode)
+	}
+
+	if entry.GuidelineID.ID.Value != "" {
+		node.addAttribute("guideline_id", nodeForObjectRef(entry.GuidelineID))
+	}
+
+	return node, nil
+}
+
+func processAdminEntry(node Noder, entry *base.AdminEntry) (Noder, error) {
+	node, err := processEntry(node, &entry.Entry)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot process ADMIN_ENTRY.base")
+	}
+
+	dataNode, err := walk(entry.Data)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot process ADMIN_ENTRY.Data")
+	}
+
+	node.addAttribute("data", dataNode)
+
+	return node, nil
+}
+
+func processGenericEntry(node Noder, entry *base.GenericEntry) (Noder, error) {
+	dataNode, err := walk(entry.Data)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot process GENERIC_ENTRY.data")
+	}
+
+	node.addAttribute("data", dataNode)
+
 	return node, nil
 }
 
@@ -16,6 +105,13 @@ func processAction(node Noder, act *base.Action) (Noder, error) {
 		return nil, errors.Wrap(err, "cannot process ACTION.base")
 	}
 
+	timeNode, err := walk(&act.Time)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot process ACTION.time")
+	}
+
+	node.addAttribute("time", timeNode)
+
 	descriptionNode, err := walk(act.Description)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot process ACTION.description")
@@ -23,7 +119,108 @@ func processAction(node Noder, act *base.Action) (Noder, error) {
 
 	node.addAttribute("description", descriptionNode)
 
-	//todo: add processing for ACTION struct fields
+	ismTransitionNode, err := processIsmTransition(&act.IsmTransition)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot process ACTION.ism_transition")
+	}
+
+	node.addAttribute("ism_transition", ismTransitionNode)
+
+	if act.InstructionDetails != nil {
+		detailsNode, err := processInstructionDetails(act.InstructionDetails)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot process ACTION.instruction_details")
+		}
+
+		node.addAttribute("instruction_details", detailsNode)
+	}
+
+	return node, nil
+}
+
+func processIsmTransition(ism *base.IsmTransition) (Noder, error) {
+	node := &ObjectNode{
+		BaseNode: BaseNode{
+			Type:     base.IsmTransitionItemType,
+			NodeType: ObjectNodeType,
+		},
+		Attributes: Attributes{},
+	}
+
+	currentStateNode, err := walk(&ism.CurrentState)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot process ISM_TRANSITION.current_state")
+	}
+
+	node.addAttribute("current_state", currentStateNode)
+
+	if ism.Transition != nil {
+		transitionNode, err := walk(ism.Transition)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot process ISM_TRANSITION.transition")
+		}
+
+		node.addAttribute("transition", transitionNode)
+	}
+
+	if ism.CareflowStep != nil {
+		careflowStepNode, err := walk(ism.CareflowStep)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot process ISM_TRANSITION.careflow_step")
+		}
+
+		node.addAttribute("careflow_step", careflowStepNode)
+	}
+
+	if ism.Reason != nil && len(*ism.Reason) != 0 {
+		reasonNode, err := walk(*ism.Reason)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot process ISM_TRANSITION.reason")
+		}
+
+		node.addAttribute("reason", reasonNode)
+	}
+
+	return node, nil
+}
+
+func processInstructionDetails(details *base.InstructionDetails) (Noder, error) {
+	node := &ObjectNode{
+		BaseNode: BaseNode{
+			Type:     base.InstructionDetailsItemType,
+			NodeType: ObjectNodeType,
+		},
+		Attributes: Attributes{},
+	}
+
+	instructionIDNode := &ObjectNode{
+		BaseNode: BaseNode{
+			ID:       details.InstructionID.ID.Value,
+			Type:     base.LocatableRefItemType,
+			NodeType: ObjectNodeType,
+		},
+		Attributes: Attributes{},
+	}
+
+	instructionIDNode.addAttribute("id", newNode(details.InstructionID.ID))
+	instructionIDNode.addAttribute("namespace", newValueNode(details.InstructionID.Namespace))
+	instructionIDNode.addAttribute("type", newValueNode(details.InstructionID.Type))
+
+	if details.InstructionID.Path != "" {
+		instructionIDNode.addAttribute("path", newValueNode(details.InstructionID.Path))
+	}
+
+	node.addAttribute("instruction_id", instructionIDNode)
+	node.addAttribute("activity_id", newValueNode(details.ActivityID))
+
+	if details.WfDetails.Data != nil {
+		wfDetailsNode, err := walk(details.WfDetails)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot process INSTRUCTION_DETAILS.wf_details")
+		}
+
+		node.addAttribute("wf_details", wfDetailsNode)
+	}
 
 	return node, nil
 }
@@ -41,8 +238,6 @@ func processEvaluation(node Noder, evaluation *base.Evaluation) (Noder, error) {
 
 	node.addAttribute("data", dataNode)
 
-	//todo: add processing for ACTION struct fields
-
 	return node, nil
 }
 
@@ -52,7 +247,21 @@ func processInstruction(node Noder, instr *base.Instruction) (Noder, error) {
 		return nil, errors.Wrap(err, "cannot process INSTRUCTION.base")
 	}
 
-	//todo: add processing for INSTRUCTION struct fields
+	narrativeNode, err := walk(&instr.Narrative)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot process INSTRUCTION.narrative")
+	}
+
+	node.addAttribute("narrative", narrativeNode)
+
+	if instr.ExpiryTime != nil {
+		expiryTimeNode, err := walk(instr.ExpiryTime)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot process INSTRUCTION.expiry_time")
+		}
+
+		node.addAttribute("expiry_time", expiryTimeNode)
+	}
 
 	return node, nil
 }
@@ -79,14 +288,5 @@ func processObservation(node Noder, obs *base.Observation) (Noder, error) {
 		node.addAttribute("state", stateNode)
 	}
 
-	if obs.Protocol != nil && obs.Protocol.Data != nil {
-		protocolNode, err := walk(*obs.Protocol)
-		if err != nil {
-			return nil, errors.Wrap(err, "cannon process OBSERVATION.Protocol")
-		}
-
-		node.addAttribute("protocol", protocolNode)
-	}
-
 	return node, nil
 }
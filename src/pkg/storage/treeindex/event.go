@@ -9,6 +9,40 @@ import (
 )
 
 func processHistoryItemStructure(node Noder, obj base.History[base.ItemStructure]) (Noder, error) {
+	originNode, err := walk(&obj.Origin)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot process HISTORY.origin")
+	}
+
+	node.addAttribute("origin", originNode)
+
+	if obj.Period != nil {
+		periodNode, err := walk(obj.Period)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot process HISTORY.period")
+		}
+
+		node.addAttribute("period", periodNode)
+	}
+
+	if obj.Duration != nil {
+		durationNode, err := walk(obj.Duration)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot process HISTORY.duration")
+		}
+
+		node.addAttribute("duration", durationNode)
+	}
+
+	if obj.Summary != nil && obj.Summary.Data != nil {
+		summaryNode, err := walk(*obj.Summary)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot process HISTORY.summary")
+		}
+
+		node.addAttribute("summary", summaryNode)
+	}
+
 	eventsNode, err := walk(obj.Events)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot process HISTORY.Events item")
@@ -48,10 +82,39 @@ func proccessPointEventItemStructure(node Noder, obj *base.PointEvent[base.ItemS
 
 func proccessIntervalEventItemStructure(node Noder, obj *base.IntervalEvent[base.ItemStructure]) (Noder, error) {
 	node, err := proccessBaseEventItemStructure(node, &obj.BaseEvent)
-	return node, errors.Wrap(err, "not implemented")
+	if err != nil {
+		return nil, err
+	}
+
+	widthNode, err := walk(&obj.Width)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot handle INTERVAL_EVENT.width")
+	}
+
+	node.addAttribute("width", widthNode)
+
+	if obj.SampleCount != nil {
+		node.addAttribute("sample_count", newNode(*obj.SampleCount))
+	}
+
+	mathFunctionNode, err := walk(&obj.MathFunction)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot handle INTERVAL_EVENT.math_function")
+	}
+
+	node.addAttribute("math_function", mathFunctionNode)
+
+	return node, nil
 }
 
 func proccessBaseEventItemStructure(node Noder, obj *base.BaseEvent[base.ItemStructure]) (Noder, error) {
+	timeNode, err := walk(&obj.Time)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot handle event time")
+	}
+
+	node.addAttribute("time", timeNode)
+
 	dataNode, err := walk(obj.Data)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot handle event data")
@@ -59,5 +122,14 @@ func proccessBaseEventItemStructure(node Noder, obj *base.BaseEvent[base.ItemStr
 
 	node.addAttribute("data", dataNode)
 
+	if obj.State != nil && obj.State.Data != nil {
+		stateNode, err := walk(*obj.State)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot handle event state")
+		}
+
+		node.addAttribute("state", stateNode)
+	}
+
 	return node, nil
 }
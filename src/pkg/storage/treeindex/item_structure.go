@@ -52,14 +52,14 @@ func processItemSingle(node Noder, obj *base.ItemSingle) (Noder, error) {
 		return nil, errors.Wrap(err, "cannot process ITEM_SINGLE.base")
 	}
 
-	itemNode, err := walk(obj.Item)
+	itemNode, err := walk(&obj.Item)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot process ITEM_SINGLE.item")
 	}
 
 	node.addAttribute("item", itemNode)
 
-	return nil, errors.New("item single not implemented")
+	return node, nil
 }
 
 func processItemList(node Noder, obj *base.ItemList) (Noder, error) {
@@ -75,7 +75,7 @@ func processItemList(node Noder, obj *base.ItemList) (Noder, error) {
 
 	node.addAttribute("items", itemsNode)
 
-	return nil, errors.New("item list not implemented")
+	return node, nil
 }
 
 func processItemTable(node Noder, obj *base.ItemTable) (Noder, error) {
@@ -91,7 +91,7 @@ func processItemTable(node Noder, obj *base.ItemTable) (Noder, error) {
 
 	node.addAttribute("rows", rowsNode)
 
-	return nil, errors.New("item table not implemented")
+	return node, nil
 }
 
 func processItemTree(node Noder, obj *base.ItemTree) (Noder, error) {
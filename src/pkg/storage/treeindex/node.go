@@ -4,6 +4,9 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model"
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model/base"
@@ -64,12 +67,12 @@ func (node ObjectNode) GetID() string {
 }
 
 func (node ObjectNode) TryGetChild(key string) Noder {
-	n := node.BaseNode.TryGetChild(key)
-	if n != nil {
+	// RM attributes, e.g. OBJECT_REF.id, take precedence over the node id
+	if n, ok := node.Attributes[key]; ok {
 		return n
 	}
 
-	return node.Attributes[key]
+	return node.BaseNode.TryGetChild(key)
 }
 
 func (node *ObjectNode) addAttribute(key string, val Noder) {
@@ -100,6 +103,7 @@ func (node ObjectNode) MarshalJSON() ([]byte, error) {
 type SliceNode struct {
 	BaseNode
 	Data Attributes
+	Keys []string // the keys of Data in the order the items are added
 }
 
 func (node SliceNode) GetID() string {
@@ -119,8 +123,65 @@ func (node SliceNode) MarshalJSON() ([]byte, error) {
 	return json.Marshal(node.Data)
 }
 
+// addAttribute adds the item keyed by its id.
+// The items with the same id, e.g. the rows of ITEM_TABLE or the items without archetype_node_id, are keyed by the numbered ids.
 func (node *SliceNode) addAttribute(key string, val Noder) {
-	node.Data[val.GetID()] = val
+	key = val.GetID()
+
+	for i := 1; ; i++ {
+		if _, ok := node.Data[key]; !ok {
+			break
+		}
+
+		key = fmt.Sprintf("%s#%d", val.GetID(), i)
+	}
+
+	node.Data[key] = val
+	node.Keys = append(node.Keys, key)
+}
+
+// Items returns the items in the order they were added.
+// The nodes indexed without the order, e.g. restored from the older snapshot, return the items of the same id by their numbers.
+func (node *SliceNode) Items() []Noder {
+	keys := node.Keys
+	if len(keys) != len(node.Data) {
+		keys = sortedKeys(node.Data)
+
+		sort.SliceStable(keys, func(i, j int) bool {
+			idI, nI := splitItemKey(keys[i])
+			idJ, nJ := splitItemKey(keys[j])
+
+			if idI != idJ {
+				return idI < idJ
+			}
+
+			return nI < nJ
+		})
+	}
+
+	items := make([]Noder, 0, len(keys))
+	for _, key := range keys {
+		if item, ok := node.Data[key]; ok {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// splitItemKey returns the id and the number of the item key, e.g. "at0006" and 10 for "at0006#10".
+func splitItemKey(key string) (string, int) {
+	i := strings.LastIndex(key, "#")
+	if i < 0 {
+		return key, 0
+	}
+
+	n, err := strconv.Atoi(key[i+1:])
+	if err != nil {
+		return key, 0
+	}
+
+	return key[:i], n
 }
 
 type DataValueNode struct {
@@ -191,24 +252,21 @@ func (node *ValueNode) UnmarshalMsgpack(data []byte) error {
 	}
 
 	node.BaseNode = tmp.BaseNode
-	switch v := tmp.Data.(type) {
-	case int8:
-		node.Data = int(v)
-	case int16:
-		node.Data = int(v)
-	case uint16:
-		node.Data = int(v)
-	case int32:
-		node.Data = int(v)
-	case uint32:
-		node.Data = int(v)
-	default:
-		node.Data = tmp.Data
-	}
+	node.Data = normalizeValue(tmp.Data)
 
 	return nil
 }
 
+// normalizeValue converts the numbers of any width into int and float64, so the values of the documents,
+// such as the int64 DV_COUNT magnitudes, are equal to the ones decoded by msgpack in the smallest fitting type.
+func normalizeValue(val any) any {
+	if n, ok := Number(val); ok {
+		return n
+	}
+
+	return val
+}
+
 func newNode(obj any) Noder {
 	switch obj := obj.(type) {
 	case model.EHR:
@@ -239,7 +297,7 @@ func newNode(obj any) Noder {
 func newObjectNode(obj base.Root) Noder {
 	l := obj.GetLocatable()
 
-	return &ObjectNode{
+	node := &ObjectNode{
 		BaseNode: BaseNode{
 			ID:       l.ArchetypeNodeID,
 			Type:     l.Type,
@@ -247,10 +305,55 @@ func newObjectNode(obj base.Root) Noder {
 			NodeType: ObjectNodeType,
 		},
 		Attributes: Attributes{
-			"name":              newNode(l.Name),
+			"name":              nodeForName(l.Name),
 			"archetype_node_id": newNode(l.ArchetypeNodeID),
 		},
 	}
+
+	if l.ArchetypeDetails != nil {
+		node.addAttribute("archetype_details", nodeForArchetyped(*l.ArchetypeDetails))
+	}
+
+	return node
+}
+
+// nodeForArchetyped returns the node of the ARCHETYPED of the archetype root, e.g. c/archetype_details/template_id/value.
+func nodeForArchetyped(a base.Archetyped) Noder {
+	if a.Type == "" {
+		a.Type = base.ArchetypedItemType
+	}
+
+	node := &ObjectNode{
+		BaseNode: BaseNode{
+			Type:     a.Type,
+			NodeType: ObjectNodeType,
+		},
+		Attributes: Attributes{},
+	}
+
+	node.addAttribute("archetype_id", nodeForObjectID(a.ArchetypeID))
+
+	if a.TemplateID != nil {
+		node.addAttribute("template_id", nodeForObjectID(*a.TemplateID))
+	}
+
+	node.addAttribute("rm_version", newValueNode(a.RmVersion))
+
+	return node
+}
+
+// nodeForName returns the DV_TEXT node of the locatable name, so the name/value paths and predicates are resolved.
+func nodeForName(name base.DvText) Noder {
+	if name.Type == "" {
+		name.Type = base.DvTextItemType
+	}
+
+	node, err := processDvText(newDataValueNode(&name), &name)
+	if err != nil {
+		return newNode(name)
+	}
+
+	return node
 }
 
 func newSliceNode() Noder {
@@ -301,6 +404,6 @@ func newValueNode(val any) Noder {
 		BaseNode: BaseNode{
 			NodeType: ValueNodeType,
 		},
-		Data: val,
+		Data: normalizeValue(val),
 	}
 }
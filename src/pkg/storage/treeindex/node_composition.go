@@ -5,12 +5,37 @@ import (
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/errors"
 )
 
-func processComposition(cmp model.Composition) (Noder, error) {
+func processComposition(cmp model.Composition) (*CompositionNode, error) {
 	node := newCompositionNode(cmp)
 
+	if cmp.UID != nil {
+		node.addAttribute("uid", newNode(*cmp.UID))
+	}
+
+	node.addAttribute("name", nodeForName(cmp.Name))
+
+	if cmp.ArchetypeDetails != nil {
+		node.addAttribute("archetype_details", nodeForArchetyped(*cmp.ArchetypeDetails))
+	}
+
 	node.addAttribute("language", newNode(cmp.Language))
 	node.addAttribute("territory", newNode(cmp.Territory))
-	node.addAttribute("category", newNode(cmp.Category))
+
+	categoryNode, err := walk(&cmp.Category)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get node for Composition.Category")
+	}
+
+	node.addAttribute("category", categoryNode)
+
+	composerNode, err := nodeForPartyProxy(cmp.Composer)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get node for Composition.Composer")
+	}
+
+	if composerNode != nil {
+		node.addAttribute("composer", composerNode)
+	}
 
 	if cmp.Context != nil {
 		ctxNode, err := walk(*cmp.Context)
@@ -24,7 +49,6 @@ func processComposition(cmp model.Composition) (Noder, error) {
 	if err := node.processCompositionContent(cmp.Content); err != nil {
 		return nil, errors.Wrap(err, "cannot process Composition.Content")
 	}
-	// TODO: add Composition.Composer field handling
 
 	return node, nil
 }
@@ -55,7 +79,23 @@ func (cmp CompositionNode) GetID() string {
 	return cmp.ID
 }
 
+// GetUID returns composition OBJECT_VERSION_ID value or empty string if it is not set
+func (cmp CompositionNode) GetUID() string {
+	uidNode, ok := cmp.Attributes["uid"].(*ValueNode)
+	if !ok {
+		return ""
+	}
+
+	uid, _ := uidNode.GetData().(string)
+
+	return uid
+}
+
 func (cmp CompositionNode) TryGetChild(key string) Noder {
+	if key == "archetype_node_id" {
+		return newNode(cmp.ID)
+	}
+
 	n := cmp.BaseNode.TryGetChild(key)
 	if n != nil {
 		return n
@@ -10,6 +10,7 @@ import (
 	"github.com/vmihailenco/msgpack/v5"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func Test_processComposition(t *testing.T) {
@@ -35,6 +36,22 @@ func Test_processComposition(t *testing.T) {
 				},
 				Tree: *NewTree(),
 				Attributes: Attributes{
+					"uid": newNode(base.UIDBasedID{
+						ObjectID: base.ObjectID{
+							Type:  "OBJECT_VERSION_ID",
+							Value: "__COMPOSITION_ID__",
+						},
+					}),
+					"name": nodeForName(base.DvText{
+						DvValueBase: base.DvValueBase{Type: base.DvTextItemType},
+						Value:       "International Patient Summary",
+					}),
+					"archetype_details": nodeForArchetyped(base.Archetyped{
+						Type:        base.ArchetypedItemType,
+						ArchetypeID: base.ObjectID{Type: base.ArchetypeIDItemType, Value: "openEHR-EHR-COMPOSITION.health_summary.v1"},
+						TemplateID:  &base.ObjectID{Type: base.TemplateIDItemType, Value: "International Patient Summary"},
+						RmVersion:   "1.0.4",
+					}),
 					"language": newNode(&base.CodePhrase{
 						Type: base.CodePhraseItemType,
 						TerminologyID: base.ObjectID{
@@ -51,35 +68,39 @@ func Test_processComposition(t *testing.T) {
 						},
 						CodeString: "US",
 					}),
-					"category": newNode(base.NewDvCodedText("event", base.CodePhrase{
+					"category": nodeForCodedText("event", base.CodePhrase{
 						Type: base.CodePhraseItemType,
 						TerminologyID: base.ObjectID{
 							Type:  base.TerminologyIDItemType,
 							Value: "openehr",
 						},
-						CodeString: "443",
-					})),
+						CodeString: "433",
+					}),
+					"composer": mustNode(nodeForPartyProxy(base.NewPartyProxy(&base.PartyIdentified{
+						Name:           "Silvia Blake",
+						PartyProxyBase: base.PartyProxyBase{Type: base.PartyIdentifiedItemType},
+					}))),
 					"context": &EventContextNode{
 						BaseNode: BaseNode{
 							NodeType: EventContextNodeType,
 						},
 						Attributes: Attributes{
-							"start_time": newNode(&base.DvDateTime{
+							"start_time": mustNode(walk(&base.DvDateTime{
 								DvTemporal: base.DvTemporal{
 									DvValueBase: base.DvValueBase{
 										Type: base.DvDateTimeItemType,
 									},
 								},
 								Value: "2021-12-03T17:34:06.849379+01:00",
-							}),
-							"setting": newNode(base.NewDvCodedText("other care", base.CodePhrase{
+							})),
+							"setting": nodeForCodedText("other care", base.CodePhrase{
 								Type: base.CodePhraseItemType,
 								TerminologyID: base.ObjectID{
 									Type:  base.TerminologyIDItemType,
 									Value: "openehr",
 								},
 								CodeString: "238",
-							})),
+							}),
 						},
 					},
 				},
@@ -106,6 +127,108 @@ func Test_processComposition(t *testing.T) {
 	}
 }
 
+func Test_processComposition_RMCoverage(t *testing.T) {
+	t.Parallel()
+
+	cmp, err := loadComposition("./test_fixtures/rm_composition.json")
+	require.NoError(t, err)
+
+	node, err := processComposition(cmp)
+	require.NoError(t, err)
+
+	observation := node.Data[OBSERVATION]["openEHR-EHR-OBSERVATION.pulse.v2"][0]
+	action := node.Data[ACTION]["openEHR-EHR-ACTION.procedure.v1"][0]
+
+	tests := []struct {
+		name string
+		node Noder
+		path []string
+		want any
+	}{
+		{"1. composer", node, []string{"composer", "external_ref"}, nil},
+		{"2. other_context ITEM_SINGLE with DV_PARSABLE", node, []string{"context", "other_context", "item", "value", "formalism"}, "text/html"},
+		{"3. health_care_facility", node, []string{"context", "health_care_facility", "external_ref", "id"}, "999999-345"},
+		{"4. participation", node, []string{"context", "participations", "", "performer", "name"}, "Dr. Marcus Johnson"},
+		{"5. participation of the related party", node, []string{"context", "participations", "#1", "performer", "relationship", "value"}, "mother"},
+		{"6. participation time", node, []string{"context", "participations", "#1", "time", "lower", "value"}, "2022-03-01T10:00:00Z"},
+		{"7. start_time", node, []string{"context", "start_time", "value"}, "2022-03-01T10:00:00Z"},
+		{"8. history origin", observation, []string{"data", "origin", "value"}, "2022-03-01T10:00:00Z"},
+		{"9. interval event", observation, []string{"data", "events", "at0003", "math_function", "value"}, "maximum"},
+		{"10. interval event ITEM_LIST", observation, []string{"data", "events", "at0003", "data", "items", "at0004", "value", "magnitude"}, 92.0},
+		{"11. ITEM_TABLE rows with the same id", observation, []string{"data", "events", "at0026", "data", "rows", "at0010#1", "name", "value"}, "Row"},
+		{"12. DV_PARAGRAPH", observation, []string{"data", "events", "at0026", "data", "rows", "at0010", "items", "at0011", "value", "items", "#1", "value"}, "second"},
+		{"13. entry encoding", observation, []string{"encoding", "code_string"}, "UTF-8"},
+		{"14. action time", action, []string{"time", "value"}, "2022-03-01T11:00:00Z"},
+		{"15. ism_transition", action, []string{"ism_transition", "current_state", "defining_code", "code_string"}, "532"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.node
+			for _, key := range tt.path {
+				require.NotNil(t, got, "no node before %s", key)
+				got = got.TryGetChild(key)
+			}
+
+			if tt.want == nil {
+				assert.Nil(t, got)
+				return
+			}
+
+			valueNode, ok := got.(*ValueNode)
+			require.True(t, ok, "unexpected node %T", got)
+			assert.Equal(t, tt.want, valueNode.GetData())
+		})
+	}
+}
+
+func Test_processComposition_Content(t *testing.T) {
+	t.Parallel()
+
+	cmp, err := loadComposition("./test_fixtures/rm_composition.json")
+	require.NoError(t, err)
+
+	node, err := processComposition(cmp)
+	require.NoError(t, err)
+
+	counts := map[string]int{}
+	for name, container := range node.Data {
+		counts[name] = container.Len()
+	}
+
+	assert.Equal(t, map[string]int{
+		SECTION:       2,
+		OBSERVATION:   1,
+		ACTION:        1,
+		ADMIN_ENTRY:   1,
+		GENERIC_ENTRY: 1,
+	}, counts)
+
+	// the entries of the nested sections are shared with the collections of their types
+	sections := node.Data[SECTION]["openEHR-EHR-SECTION.adhoc.v1"]
+	require.Len(t, sections, 2)
+
+	action := node.Data[ACTION]["openEHR-EHR-ACTION.procedure.v1"][0]
+	assert.Contains(t, FindByType(nil, sections[1], ACTION), action)
+
+	assert.Len(t, FindByType(nil, node, GENERIC_ENTRY), 1)
+	assert.Len(t, FindByType(nil, node, INSTRUCTION), 0)
+	assert.Len(t, FindByType(nil, node, string(base.ElementItemType)), 4)
+}
+
+func mustNode(node Noder, err error) Noder {
+	if err != nil {
+		panic(err)
+	}
+
+	return node
+}
+
+func nodeForCodedText(value string, codePhrase base.CodePhrase) Noder {
+	dv := base.NewDvCodedText(value, codePhrase)
+	return mustNode(walk(&dv))
+}
+
 func Test_EncodeDecodeComposition(t *testing.T) {
 	t.Parallel()
 
@@ -131,7 +254,7 @@ func Test_EncodeDecodeComposition(t *testing.T) {
 			node, err := processComposition(composition)
 			assert.Nil(t, err)
 
-			origin := node.(*CompositionNode)
+			origin := node
 
 			data, err := msgpack.Marshal(node)
 			assert.Nil(t, err)
@@ -146,6 +269,29 @@ func Test_EncodeDecodeComposition(t *testing.T) {
 	}
 }
 
+func TestTree_processCompositionContent_SameArchetype(t *testing.T) {
+	cmp, err := loadComposition("./../../aqlquerier/test_fixtures/composition_2.json")
+	require.NoError(t, err)
+
+	section, ok := cmp.Content[0].(*base.Section)
+	require.True(t, ok)
+	require.NotEmpty(t, section.Items)
+
+	// two entries of the same archetype in one section
+	section.Items = append(section.Items[:1], section.Items[0])
+	id := section.Items[0].(*base.Observation).ArchetypeNodeID
+
+	tree := NewTree()
+	require.NoError(t, tree.processCompositionContent([]base.Root{section}))
+
+	assert.Len(t, tree.Data[OBSERVATION][id], 2)
+
+	sectionNode := tree.Data[SECTION][section.ArchetypeNodeID][0]
+	items, ok := sectionNode.TryGetChild("items").(*SliceNode)
+	require.True(t, ok)
+	assert.Len(t, items.Data, 2, "the items of the same archetype should not overwrite each other")
+}
+
 func loadComposition(name string) (model.Composition, error) {
 	data, err := os.ReadFile(name)
 	if err != nil {
@@ -21,8 +21,40 @@ func processEHR(ehr model.EHR) (*EHRNode, error) {
 
 	node.addAttribute("system_id", newNode(ehr.SystemID))
 	node.addAttribute("ehr_id", newNode(ehr.EhrID))
+	node.addAttribute("ehr_status", nodeForObjectRef(ehr.EhrStatus))
+	node.addAttribute("ehr_access", nodeForObjectRef(ehr.EhrAccess))
+
+	if ehr.TimeCreated.Value != "" {
+		timeCreatedNode, err := walk(&ehr.TimeCreated)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot get EHR.time_created node")
+		}
+
+		node.addAttribute("time_created", timeCreatedNode)
+	}
+
+	if len(ehr.Contributions) != 0 {
+		contributionsNode, err := walk(ehr.Contributions)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot get EHR.contributions node")
+		}
+
+		node.addAttribute("contributions", contributionsNode)
+	}
+
+	if ehr.Directory != nil {
+		node.addAttribute("directory", nodeForObjectRef(*ehr.Directory))
+	}
+
+	if len(ehr.Folders) != 0 {
+		foldersNode, err := walk(ehr.Folders)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot get EHR.folders node")
+		}
+
+		node.addAttribute("folders", foldersNode)
+	}
 
-	// TODO: add logic for other fields
 	return node, nil
 }
 
@@ -31,6 +63,13 @@ type EHRNode struct {
 
 	Attributes   Attributes `json:"-"`
 	Compositions Container
+	Folders      Container `json:"-"`
+
+	// Versions is the history of the composition versions keyed by the versioned object id
+	Versions Container `json:"-"`
+
+	// NotQueryable is set by EHR_STATUS with is_queryable=false, such EHR is not returned by the queries
+	NotQueryable bool `json:"-" msgpack:"not_queryable,omitempty"`
 }
 
 func newEHRNode(ehr model.EHR) *EHRNode {
@@ -53,10 +92,98 @@ func (ehr *EHRNode) addComposition(cmp model.Composition) error {
 		return errors.Wrap(err, "cannot add Composition node into EHRNode")
 	}
 
-	ehr.Compositions[cmpNode.GetID()] = append(ehr.Compositions[cmpNode.GetID()], cmpNode)
+	ehr.addCompositionNode(cmpNode)
 	return nil
 }
 
+func (ehr *EHRNode) addCompositionNode(cmpNode *CompositionNode) {
+	ehr.Compositions[cmpNode.GetID()] = append(ehr.Compositions[cmpNode.GetID()], cmpNode)
+}
+
+// removeComposition removes all versions of the composition with the given uid.
+// Returns false when the composition is not found.
+func (ehr *EHRNode) removeComposition(uid string) bool {
+	uid = baseUID(uid)
+	removed := false
+
+	for id, nodes := range ehr.Compositions {
+		kept := make([]Noder, 0, len(nodes))
+
+		for _, n := range nodes {
+			if cmpNode, ok := n.(*CompositionNode); ok && baseUID(cmpNode.GetUID()) == uid {
+				removed = true
+				continue
+			}
+
+			kept = append(kept, n)
+		}
+
+		if len(kept) == 0 {
+			delete(ehr.Compositions, id)
+		} else {
+			ehr.Compositions[id] = kept
+		}
+	}
+
+	return removed
+}
+
+// clone returns the copy of the EHR with the copies of its compositions and versions collections.
+// The writes change the copy and replace the indexed EHR with it, so the EHRs returned to the queries are never changed.
+// The nodes and the folders, which are replaced as a whole, are shared.
+func (ehr *EHRNode) clone() *EHRNode {
+	c := *ehr
+	c.Compositions = ehr.Compositions.clone()
+	c.Versions = ehr.Versions.clone()
+
+	return &c
+}
+
+// IsQueryable reports whether the EHR can be queried according to its EHR_STATUS.
+func (ehr EHRNode) IsQueryable() bool {
+	return !ehr.NotQueryable
+}
+
+// Restrict returns the view of the EHR with the compositions of the given uids only,
+// the uids are either the versioned object ids or the version ids.
+// The folders are not in the view, they may reference the compositions out of it.
+func (ehr *EHRNode) Restrict(uids map[string]bool) *EHRNode {
+	allowed := make(map[string]bool, len(uids))
+	for uid := range uids {
+		allowed[baseUID(uid)] = true
+	}
+
+	view := &EHRNode{
+		BaseNode:     ehr.BaseNode,
+		Attributes:   ehr.Attributes,
+		Compositions: Container{},
+		Folders:      Container{},
+		NotQueryable: ehr.NotQueryable,
+	}
+
+	for id, nodes := range ehr.Compositions {
+		for _, n := range nodes {
+			if cmp, ok := n.(*CompositionNode); ok && allowed[baseUID(cmp.GetUID())] {
+				view.Compositions[id] = append(view.Compositions[id], n)
+			}
+		}
+	}
+
+	for id, versions := range ehr.Versions {
+		if !allowed[id] {
+			continue
+		}
+
+		if view.Versions == nil {
+			view.Versions = Container{}
+		}
+
+		view.Versions[id] = versions
+	}
+
+	return view
+}
+
 func (ehr EHRNode) GetCompositions() Container {
 	return ehr.Compositions
 }
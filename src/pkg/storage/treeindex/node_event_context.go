@@ -2,47 +2,66 @@ package treeindex
 
 import (
 	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model/base"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/errors"
 )
 
 func processEventContext(ctx model.EventContext) (Noder, error) {
 	node := NewEventContextNode(ctx)
 
-	node.addAttribute("start_time", newNode(&ctx.StartTime))
+	startTimeNode, err := walk(&ctx.StartTime)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get EVENT_CONTEXT.start_time node")
+	}
+
+	node.addAttribute("start_time", startTimeNode)
 
 	if ctx.EndTime != nil {
-		node.addAttribute("end_time", newNode(ctx.EndTime))
+		endTimeNode, err := walk(ctx.EndTime)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot get EVENT_CONTEXT.end_time node")
+		}
+
+		node.addAttribute("end_time", endTimeNode)
 	}
 
 	if ctx.Location != nil {
 		node.addAttribute("location", newNode(*ctx.Location))
 	}
 
-	node.addAttribute("setting", newNode(ctx.Setting))
-
-	// TODO: add OtherContext handling
-	// if ctx.OtherContext != nil {
-	// 	node.addAttribute("other_context", newNode(ctx.OtherContext))
-	// }
-
-	// TODO: add HealthCareFacility handling
-	// if ctx.HealthCareFacility != nil {
-	// 	hcfNode, err := walk(ctx.HealthCareFacility)
-	// 	if err != nil {
-	// 		return nil, errors.Wrap(err, "cannot get EventContext.HealtCareFacility node")
-	// 	}
-	//
-	// 	node.addAttribute("health_care_facility", hcfNode)
-	// }
-
-	// TODO: add Participations handling
-	// if len(ctx.Participations) != 0 {
-	// 	pNode, err := walk(ctx.Participations)
-	// 	if err != nil {
-	// 		return nil, errors.Wrap(err, "cannot get EntentContext.Partisipations node")
-	// 	}
-
-	// 	node.addAttribute("participatios", pNode)
-	// }
+	settingNode, err := walk(&ctx.Setting)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get EVENT_CONTEXT.setting node")
+	}
+
+	node.addAttribute("setting", settingNode)
+
+	if ctx.OtherContext != nil && ctx.OtherContext.Data != nil {
+		otherContextNode, err := walk(*ctx.OtherContext)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot get EVENT_CONTEXT.other_context node")
+		}
+
+		node.addAttribute("other_context", otherContextNode)
+	}
+
+	if ctx.HealthCareFacility != nil {
+		hcfNode, err := nodeForPartyProxy(base.NewPartyProxy(ctx.HealthCareFacility))
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot get EVENT_CONTEXT.health_care_facility node")
+		}
+
+		node.addAttribute("health_care_facility", hcfNode)
+	}
+
+	if len(ctx.Participations) != 0 {
+		participationsNode, err := walk(ctx.Participations)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot get EVENT_CONTEXT.participations node")
+		}
+
+		node.addAttribute("participations", participationsNode)
+	}
 
 	return node, nil
 }
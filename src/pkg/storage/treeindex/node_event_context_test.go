@@ -25,31 +25,31 @@ func Test_processEventContext(t *testing.T) {
 					NodeType: EventContextNodeType,
 				},
 				Attributes: Attributes{
-					"start_time": newNode(&base.DvDateTime{
+					"start_time": mustNode(walk(&base.DvDateTime{
 						DvTemporal: base.DvTemporal{
 							DvValueBase: base.DvValueBase{
 								Type: base.DvDateTimeItemType,
 							},
 						},
 						Value: "2021-12-03T17:34:06.849379+01:00",
-					}),
-					"end_time": newNode(&base.DvDateTime{
+					})),
+					"end_time": mustNode(walk(&base.DvDateTime{
 						DvTemporal: base.DvTemporal{
 							DvValueBase: base.DvValueBase{
 								Type: base.DvDateTimeItemType,
 							},
 						},
 						Value: "2021-12-03T17:34:06.849379+01:00",
-					}),
+					})),
 					"location": newNode("some_text_here"),
-					"setting": newNode(base.NewDvCodedText("other care", base.CodePhrase{
+					"setting": nodeForCodedText("other care", base.CodePhrase{
 						Type: base.CodePhraseItemType,
 						TerminologyID: base.ObjectID{
 							Type:  base.TerminologyIDItemType,
 							Value: "openehr",
 						},
 						CodeString: "238",
-					})),
+					}),
 				},
 			},
 			false,
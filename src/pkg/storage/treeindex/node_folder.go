@@ -0,0 +1,122 @@
+package treeindex
+
+import (
+	"strings"
+
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model"
+)
+
+const folderPathSeparator = "/"
+
+// processDirectory returns the nodes of all folders of the EHR directory keyed by the folder path,
+// e.g. "root/episodes/2022". The items of a folder are kept as a list of the referenced object ids.
+func processDirectory(dir *model.Directory) Container {
+	result := Container{}
+	addFolderNodes(result, "", dir)
+
+	return result
+}
+
+func addFolderNodes(container Container, parentPath string, dir *model.Directory) {
+	if dir == nil {
+		return
+	}
+
+	path := dir.Name.Value
+	if parentPath != "" {
+		path = parentPath + folderPathSeparator + path
+	}
+
+	node := newNode(dir)
+
+	items := make([]string, 0, len(dir.Items))
+	for _, item := range dir.Items {
+		items = append(items, item.ID.Value)
+	}
+
+	node.addAttribute("items", newValueNode(items))
+
+	container[path] = append(container[path], node)
+
+	for _, sub := range dir.Folders {
+		addFolderNodes(container, path, sub)
+	}
+}
+
+// getFolderPath returns the path of the folder node in the EHR directory.
+func (ehr *EHRNode) getFolderPath(folder Noder) (string, bool) {
+	for path, nodes := range ehr.Folders {
+		for _, n := range nodes {
+			if n == folder {
+				return path, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// getSubFolders returns the folders nested into the folder at any depth.
+func (ehr *EHRNode) getSubFolders(folder Noder) []Noder {
+	path, ok := ehr.getFolderPath(folder)
+	if !ok {
+		return nil
+	}
+
+	result := []Noder{}
+
+	for p, nodes := range ehr.Folders {
+		if strings.HasPrefix(p, path+folderPathSeparator) {
+			result = append(result, nodes...)
+		}
+	}
+
+	return result
+}
+
+// getFolderCompositions returns the compositions referenced by the folder or by its sub-folders.
+func (ehr *EHRNode) getFolderCompositions(folder Noder) []Noder {
+	uids := map[string]bool{}
+
+	for _, f := range append([]Noder{folder}, ehr.getSubFolders(folder)...) {
+		for _, id := range getFolderItems(f) {
+			uids[baseUID(id)] = true
+		}
+	}
+
+	result := []Noder{}
+
+	for _, nodes := range ehr.Compositions {
+		for _, n := range nodes {
+			if cmp, ok := n.(*CompositionNode); ok && uids[baseUID(cmp.GetUID())] {
+				result = append(result, cmp)
+			}
+		}
+	}
+
+	return result
+}
+
+func getFolderItems(folder Noder) []string {
+	itemsNode, ok := folder.TryGetChild("items").(*ValueNode)
+	if !ok {
+		return nil
+	}
+
+	switch items := itemsNode.GetData().(type) {
+	case []string:
+		return items
+	case []any:
+		// restored from a snapshot
+		result := make([]string, 0, len(items))
+		for _, item := range items {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+
+		return result
+	default:
+		return nil
+	}
+}
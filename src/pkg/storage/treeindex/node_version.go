@@ -0,0 +1,291 @@
+package treeindex
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model/base"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/errors"
+)
+
+// newVersionNode returns the ORIGINAL_VERSION node of the composition.
+// The data is nil for the version recording the composition deletion.
+func newVersionNode(uid, precedingUID, lifecycleState string, audit model.AuditDetails, data *CompositionNode) (Noder, error) {
+	node := &ObjectNode{
+		BaseNode: BaseNode{
+			ID:       uid,
+			Type:     base.VersionOriginalItemType,
+			NodeType: ObjectNodeType,
+		},
+		Attributes: Attributes{},
+	}
+
+	node.addAttribute("uid", nodeForObjectID(base.ObjectID{Type: base.ObjectVersionIDItemType, Value: uid}))
+
+	if precedingUID != "" {
+		node.addAttribute("preceding_version_uid", nodeForObjectID(base.ObjectID{Type: base.ObjectVersionIDItemType, Value: precedingUID}))
+	}
+
+	lifecycle := model.NewOpenEHRCodedText(lifecycleState)
+
+	lifecycleNode, err := walk(&lifecycle)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get VERSION.lifecycle_state node")
+	}
+
+	node.addAttribute("lifecycle_state", lifecycleNode)
+
+	auditNode, err := processAuditDetails(audit)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get VERSION.commit_audit node")
+	}
+
+	node.addAttribute("commit_audit", auditNode)
+
+	if data != nil {
+		node.addAttribute("data", data)
+	}
+
+	return node, nil
+}
+
+func processAuditDetails(audit model.AuditDetails) (Noder, error) {
+	node := &ObjectNode{
+		BaseNode: BaseNode{
+			Type:     base.AuditDetailsType,
+			NodeType: ObjectNodeType,
+		},
+		Attributes: Attributes{},
+	}
+
+	node.addAttribute("system_id", newValueNode(audit.SystemID))
+
+	if audit.TimeCommitted.Value != "" {
+		timeNode, err := walk(&audit.TimeCommitted)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot get AUDIT_DETAILS.time_committed node")
+		}
+
+		node.addAttribute("time_committed", timeNode)
+	}
+
+	changeTypeNode, err := walk(&audit.ChangeType)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get AUDIT_DETAILS.change_type node")
+	}
+
+	node.addAttribute("change_type", changeTypeNode)
+
+	committer, err := nodeForPartyProxy(audit.Committer)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get AUDIT_DETAILS.committer node")
+	}
+
+	if committer != nil {
+		node.addAttribute("committer", committer)
+	}
+
+	if audit.Description.Value != "" {
+		descriptionNode, err := walk(&audit.Description)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot get AUDIT_DETAILS.description node")
+		}
+
+		node.addAttribute("description", descriptionNode)
+	}
+
+	return node, nil
+}
+
+// newVersionedObjectNode returns the VERSIONED_COMPOSITION node for the history of the composition versions.
+func newVersionedObjectNode(ehr *EHRNode, uid string, versions []Noder) Noder {
+	node := &ObjectNode{
+		BaseNode: BaseNode{
+			ID:       uid,
+			Type:     base.VersionCompositionItemType,
+			NodeType: ObjectNodeType,
+		},
+		Attributes: Attributes{},
+	}
+
+	node.addAttribute("uid", nodeForObjectID(base.ObjectID{Type: base.HierObjectIDItemType, Value: uid}))
+	node.addAttribute("owner_id", nodeForObjectID(base.ObjectID{Type: base.HierObjectIDItemType, Value: ehr.ID}))
+
+	if len(versions) > 0 {
+		if audit := versions[0].TryGetChild("commit_audit"); audit != nil {
+			if t := audit.TryGetChild("time_committed"); t != nil {
+				node.addAttribute("time_created", t)
+			}
+		}
+	}
+
+	return node
+}
+
+// addVersion appends the version of the composition into the history of its versioned object.
+// A version with the same uid, e.g. indexed again on the index restore, replaces the existing one.
+func (ehr *EHRNode) addVersion(cmp *CompositionNode, audit model.AuditDetails) error {
+	uid := cmp.GetUID()
+	objectID := baseUID(uid)
+
+	if ehr.Versions == nil {
+		ehr.Versions = Container{}
+	}
+
+	history := ehr.Versions[objectID]
+
+	idx := len(history)
+	for i, v := range history {
+		if v.GetID() == uid {
+			idx = i
+			break
+		}
+	}
+
+	precedingUID := ""
+	if idx > 0 {
+		precedingUID = history[idx-1].GetID()
+	}
+
+	if audit.ChangeType.DefiningCode.CodeString == "" {
+		if precedingUID == "" {
+			audit.ChangeType = model.NewOpenEHRCodedText(model.ChangeTypeCreation)
+		} else {
+			audit.ChangeType = model.NewOpenEHRCodedText(model.ChangeTypeModification)
+		}
+	}
+
+	node, err := newVersionNode(uid, precedingUID, model.LifecycleStateComplete, audit, cmp)
+	if err != nil {
+		return err
+	}
+
+	if idx < len(history) {
+		history[idx] = node
+	} else {
+		ehr.Versions[objectID] = append(history, node)
+	}
+
+	return nil
+}
+
+// addDeletedVersion appends the version recording the deletion of the composition version with the uid.
+// The deletion recorded again, e.g. on the index restore, replaces the existing one.
+func (ehr *EHRNode) addDeletedVersion(uid string, audit model.AuditDetails) error {
+	history := ehr.Versions[baseUID(uid)]
+	if len(history) == 0 {
+		return nil
+	}
+
+	precedingUID := history[len(history)-1].GetID()
+	for _, v := range history {
+		if v.GetID() == uid {
+			precedingUID = uid
+			break
+		}
+	}
+
+	if audit.ChangeType.DefiningCode.CodeString == "" {
+		audit.ChangeType = model.NewOpenEHRCodedText(model.ChangeTypeDeleted)
+	}
+
+	node, err := newVersionNode(nextVersionUID(precedingUID), precedingUID, model.LifecycleStateDeleted, audit, nil)
+	if err != nil {
+		return err
+	}
+
+	for i, v := range history {
+		if v.GetID() == node.GetID() {
+			history[i] = node
+			return nil
+		}
+	}
+
+	ehr.Versions[baseUID(uid)] = append(history, node)
+
+	return nil
+}
+
+// findVersions returns the versions of the compositions contained in the node.
+// Only the last version of every versioned object is returned when latest is true.
+func (ehr *EHRNode) findVersions(node Noder, latest bool) []Noder {
+	var objectIDs []string
+
+	switch node := node.(type) {
+	case *EHRNode:
+		objectIDs = sortedKeys(node.Versions)
+	case *ObjectNode:
+		switch {
+		case isVersionedObject(node):
+			objectIDs = []string{node.ID}
+		case node.Type == FOLDER:
+			ids := map[string]bool{}
+
+			for _, f := range append([]Noder{node}, ehr.getSubFolders(node)...) {
+				for _, id := range getFolderItems(f) {
+					ids[baseUID(id)] = true
+				}
+			}
+
+			objectIDs = sortedKeys(ids)
+		}
+	}
+
+	result := []Noder{}
+
+	for _, id := range objectIDs {
+		history := ehr.Versions[id]
+		if len(history) == 0 {
+			continue
+		}
+
+		if latest {
+			result = append(result, history[len(history)-1])
+		} else {
+			result = append(result, history...)
+		}
+	}
+
+	return result
+}
+
+func (ehr *EHRNode) getVersionedObjects() []Noder {
+	result := make([]Noder, 0, len(ehr.Versions))
+
+	for _, id := range sortedKeys(ehr.Versions) {
+		result = append(result, newVersionedObjectNode(ehr, id, ehr.Versions[id]))
+	}
+
+	return result
+}
+
+func isVersion(node Noder) bool {
+	obj, ok := node.(*ObjectNode)
+	return ok && obj.Type == base.VersionOriginalItemType
+}
+
+func isVersionedObject(node Noder) bool {
+	obj, ok := node.(*ObjectNode)
+	return ok && obj.Type == base.VersionCompositionItemType
+}
+
+// nextVersionUID increases the version tree id part of the OBJECT_VERSION_ID value, e.g. "uid::system::2" for "uid::system::1".
+func nextVersionUID(uid string) string {
+	parts := strings.Split(uid, "::")
+	if len(parts) != 3 {
+		return uid
+	}
+
+	ver := strings.Split(parts[2], ".")
+
+	n, err := strconv.Atoi(ver[len(ver)-1])
+	if err != nil {
+		return uid
+	}
+
+	ver[len(ver)-1] = strconv.Itoa(n + 1)
+	parts[2] = strings.Join(ver, ".")
+
+	return strings.Join(parts, "::")
+}
@@ -0,0 +1,166 @@
+package treeindex
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/common/iso8601"
+)
+
+// Number returns the numeric value as int for the integers of any width and as float64 for the floating point numbers,
+// false if the value is not a number.
+func Number(val any) (any, bool) {
+	switch v := val.(type) {
+	case int:
+		return v, true
+	case int8:
+		return int(v), true
+	case int16:
+		return int(v), true
+	case int32:
+		return int(v), true
+	case int64:
+		return int(v), true
+	case uint:
+		if v > math.MaxInt {
+			return float64(v), true
+		}
+
+		return int(v), true
+	case uint8:
+		return int(v), true
+	case uint16:
+		return int(v), true
+	case uint32:
+		return int(v), true
+	case uint64:
+		if v > math.MaxInt {
+			return float64(v), true
+		}
+
+		return int(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	default:
+		return nil, false
+	}
+}
+
+// OrderKey returns the comparable value: the numbers are converted to float64, the date/time and time strings to time.Time
+// and the ISO 8601 duration strings to time.Duration.
+func OrderKey(val any) any {
+	if n, ok := Number(val); ok {
+		if i, ok := n.(int); ok {
+			return float64(i)
+		}
+
+		return n
+	}
+
+	switch v := val.(type) {
+	case *string:
+		if v == nil {
+			return nil
+		}
+
+		return OrderKey(*v)
+	case string:
+		if t, ok := iso8601.ParseDateTime(v); ok {
+			return t
+		}
+
+		if t, ok := iso8601.ParseTime(v); ok {
+			return t
+		}
+
+		if d, ok := iso8601.ParseDuration(v); ok {
+			return d
+		}
+
+		return v
+	}
+
+	return val
+}
+
+// OrderKindRank returns the rank of the value kind, the values of different kinds are ordered by it.
+func OrderKindRank(val any) int {
+	switch val.(type) {
+	case bool:
+		return 0
+	case float64:
+		return 1
+	case time.Time:
+		return 2
+	case time.Duration:
+		return 3
+	case string:
+		return 4
+	default:
+		return 5
+	}
+}
+
+// CompareOrderKeys returns -1, 0 or +1 depending on whether x is less than, equal to or greater than y.
+func CompareOrderKeys(x, y any) int {
+	switch {
+	case x == nil && y == nil:
+		return 0
+	case x == nil:
+		return 1
+	case y == nil:
+		return -1
+	}
+
+	if rx, ry := OrderKindRank(x), OrderKindRank(y); rx != ry {
+		return compareOrdered(rx, ry)
+	}
+
+	switch x := x.(type) {
+	case bool:
+		y := y.(bool)
+		if x == y {
+			return 0
+		}
+
+		if !x {
+			return -1
+		}
+
+		return 1
+	case float64:
+		return compareOrdered(x, y.(float64))
+	case time.Time:
+		y := y.(time.Time)
+
+		switch {
+		case x.Before(y):
+			return -1
+		case x.After(y):
+			return 1
+		default:
+			return 0
+		}
+	case time.Duration:
+		return compareOrdered(x, y.(time.Duration))
+	case string:
+		return strings.Compare(x, y.(string))
+	default:
+		return strings.Compare(fmt.Sprint(x), fmt.Sprint(y))
+	}
+}
+
+func compareOrdered[T int | float64 | time.Duration](x, y T) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,35 @@
+package treeindex
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareOrderKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		x    any
+		y    any
+		want int
+	}{
+		{"1. numbers", OrderKey(10), OrderKey(9.5), 1},
+		{"2. strings", "abc", "abd", -1},
+		{"3. date times in different zones", OrderKey("2021-12-03T17:34:06.849379+01:00"), OrderKey("2021-12-03T17:00:00Z"), -1},
+		{"4. dates", OrderKey("2021-12-03"), OrderKey("2021-12-03"), 0},
+		{"5. NULL is greater than any value", nil, "abc", 1},
+		{"6. value is less than NULL", 1.0, nil, -1},
+		{"7. NULLs are equal", nil, nil, 0},
+		{"8. numbers before strings", 100.0, "1", -1},
+		{"9. durations", OrderKey("PT36H"), OrderKey("P1D"), 1},
+		{"10. times", OrderKey("10:00:00+02:00"), OrderKey("09:30:00Z"), -1},
+		{"11. compact dates", OrderKey("20250101"), OrderKey("2025-01-01T00:00:01Z"), -1},
+		{"12. durations before strings", OrderKey("P1D"), "P1D is a day", -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, CompareOrderKeys(tt.x, tt.y))
+		})
+	}
+}
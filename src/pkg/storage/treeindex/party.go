@@ -0,0 +1,167 @@
+package treeindex
+
+import (
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model/base"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/errors"
+)
+
+// nodeForPartyProxy returns the node of PARTY_SELF, PARTY_IDENTIFIED or PARTY_RELATED or nil if the party is not set.
+func nodeForPartyProxy(pp base.PartyProxy) (Noder, error) {
+	node := &ObjectNode{
+		BaseNode: BaseNode{
+			NodeType: ObjectNodeType,
+		},
+		Attributes: Attributes{},
+	}
+
+	var ref *base.ObjectRef
+
+	switch party := pp.GetData().(type) {
+	case *base.PartySelf:
+		node.Type, ref = party.Type, party.ExternalRef
+	case *base.PartyIdentified:
+		node.Type, ref = party.Type, party.ExternalRef
+
+		if party.Name != "" {
+			node.addAttribute("name", newValueNode(party.Name))
+		}
+
+		if len(party.Identifiers) > 0 {
+			identifiersNode := newSliceNode()
+
+			for i := range party.Identifiers {
+				idNode, err := walk(&party.Identifiers[i])
+				if err != nil {
+					return nil, errors.Wrap(err, "cannot get PARTY_IDENTIFIED.identifiers node")
+				}
+
+				identifiersNode.addAttribute(idNode.GetID(), idNode)
+			}
+
+			node.addAttribute("identifiers", identifiersNode)
+		}
+	case *base.PartyRelated:
+		node.Type, ref = party.Type, party.ExternalRef
+
+		if party.Name != "" {
+			node.addAttribute("name", newValueNode(party.Name))
+		}
+
+		relationshipNode, err := walk(&party.Relationship)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot get PARTY_RELATED.relationship node")
+		}
+
+		node.addAttribute("relationship", relationshipNode)
+	default:
+		return nil, nil
+	}
+
+	if ref != nil {
+		node.addAttribute("external_ref", nodeForObjectRef(*ref))
+	}
+
+	return node, nil
+}
+
+// nodeForObjectRef returns the node of OBJECT_REF, e.g. PARTY_REF of the party or the reference to EHR_STATUS.
+// The node id is the id of the referenced object, so the references are kept apart in the slices.
+func nodeForObjectRef(ref base.ObjectRef) Noder {
+	node := &ObjectNode{
+		BaseNode: BaseNode{
+			ID:       ref.ID.Value,
+			Type:     base.ObjectRefItemType,
+			NodeType: ObjectNodeType,
+		},
+		Attributes: Attributes{},
+	}
+
+	node.addAttribute("id", nodeForObjectID(ref.ID))
+	node.addAttribute("namespace", newValueNode(ref.Namespace))
+	node.addAttribute("type", newValueNode(ref.Type))
+
+	return node
+}
+
+// processParticipation returns the node of PARTICIPATION of the party in the event or the entry.
+func processParticipation(p base.Participation) (Noder, error) {
+	node := &ObjectNode{
+		BaseNode: BaseNode{
+			Type:     base.ParticipationItemType,
+			NodeType: ObjectNodeType,
+		},
+		Attributes: Attributes{},
+	}
+
+	functionNode, err := walk(&p.Function)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get PARTICIPATION.function node")
+	}
+
+	node.addAttribute("function", functionNode)
+
+	if p.Mode != nil {
+		modeNode, err := walk(p.Mode)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot get PARTICIPATION.mode node")
+		}
+
+		node.addAttribute("mode", modeNode)
+	}
+
+	performerNode, err := nodeForPartyProxy(p.Performer)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get PARTICIPATION.performer node")
+	}
+
+	if performerNode != nil {
+		node.addAttribute("performer", performerNode)
+	}
+
+	if p.Time != nil {
+		timeNode, err := nodeForDateTimeInterval(*p.Time)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot get PARTICIPATION.time node")
+		}
+
+		node.addAttribute("time", timeNode)
+	}
+
+	return node, nil
+}
+
+// nodeForDateTimeInterval returns the node of the interval of DV_DATE_TIME, the unbounded limits have no nodes.
+func nodeForDateTimeInterval(interval base.Interval[base.DvDateTime]) (Noder, error) {
+	node := &ObjectNode{
+		BaseNode: BaseNode{
+			Type:     base.IntervalItemType,
+			NodeType: ObjectNodeType,
+		},
+		Attributes: Attributes{},
+	}
+
+	if !interval.LowerUnbounded {
+		lowerNode, err := walk(&interval.Lower)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot get INTERVAL.lower node")
+		}
+
+		node.addAttribute("lower", lowerNode)
+	}
+
+	if !interval.UpperUnbounded {
+		upperNode, err := walk(&interval.Upper)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot get INTERVAL.upper node")
+		}
+
+		node.addAttribute("upper", upperNode)
+	}
+
+	node.addAttribute("lower_unbounded", newValueNode(interval.LowerUnbounded))
+	node.addAttribute("upper_unbounded", newValueNode(interval.UpperUnbounded))
+	node.addAttribute("lower_included", newValueNode(interval.LowerIncluded))
+	node.addAttribute("upper_included", newValueNode(interval.UpperIncluded))
+
+	return node, nil
+}
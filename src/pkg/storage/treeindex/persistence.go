@@ -0,0 +1,498 @@
+package treeindex
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/crypto/chachaPoly"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/errors"
+)
+
+const (
+	snapshotFileName = "ehr_index.snapshot"
+	journalFileName  = "ehr_index.journal"
+
+	// snapshotJournalLimit is the amount of journal records after which the journal is compacted into a new snapshot.
+	snapshotJournalLimit = 1000
+
+	frameHeaderLen = 4
+)
+
+type journalOp uint8
+
+const (
+	opAddEHR journalOp = iota + 1
+	opAddComposition
+	opUpdateComposition
+	opDeleteComposition
+	opUpdateDirectory
+	opUpdateEHRStatus
+	opAddDoc
+	opRemoveEHR
+	opSetStale
+)
+
+// journalRecord describes one index change. Documents are stored in their openEHR JSON form
+// and processed again on replay, so the journal does not depend on the node layout.
+type journalRecord struct {
+	Seq   uint64          `json:"seq"`
+	Op    journalOp       `json:"op"`
+	EhrID string          `json:"ehr_id,omitempty"`
+	UID   string          `json:"uid,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+	Audit json.RawMessage `json:"audit,omitempty"`
+}
+
+type snapshot struct {
+	Seq   uint64              `msgpack:"seq"`
+	Ehrs  map[string]*EHRNode `msgpack:"ehr"`
+	Docs  map[string]DocRef   `msgpack:"docs,omitempty"`
+	Stale map[string]bool     `msgpack:"stale,omitempty"`
+}
+
+type persistence struct {
+	mu      sync.Mutex // serialises the snapshots, which run under the index read lock
+	dir     string
+	key     *chachaPoly.Key
+	journal *os.File
+	seq     uint64
+	records int
+}
+
+// Persist loads the index from the encrypted snapshot and journal stored in dir
+// and makes all further changes of the index durable.
+func (idx *EHRIndex) Persist(dir string, key *chachaPoly.Key) error {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return fmt.Errorf("MkdirAll error: %w", err)
+	}
+
+	p := &persistence{
+		dir: dir,
+		key: key,
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if idx.persist != nil {
+		return fmt.Errorf("%w: index is already persisted", errors.ErrCustom)
+	}
+
+	snap, err := p.loadSnapshot()
+	if err != nil {
+		return fmt.Errorf("loadSnapshot error: %w", err)
+	}
+
+	if snap != nil {
+		idx.Ehrs = snap.Ehrs
+
+		if snap.Docs != nil {
+			idx.Docs = snap.Docs
+		}
+
+		if snap.Stale != nil {
+			idx.Stale = snap.Stale
+		}
+
+		idx.secondary.rebuild(idx.Ehrs)
+		p.seq = snap.Seq
+	}
+
+	journal, err := os.OpenFile(filepath.Join(dir, journalFileName), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("journal open error: %w", err)
+	}
+
+	if err := p.replay(idx, journal); err != nil {
+		journal.Close()
+		return fmt.Errorf("journal replay error: %w", err)
+	}
+
+	p.journal = journal
+	idx.persist = p
+
+	return nil
+}
+
+// Snapshot writes the whole index into the snapshot file and truncates the journal.
+// The index is only read locked, so the queries are served while the snapshot is written.
+func (idx *EHRIndex) Snapshot() error {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return idx.snapshot()
+}
+
+// Close writes the last snapshot and stops persisting the index changes.
+func (idx *EHRIndex) Close() error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if idx.persist == nil {
+		return nil
+	}
+
+	err := idx.snapshot()
+
+	if cerr := idx.persist.journal.Close(); cerr != nil && err == nil {
+		err = fmt.Errorf("journal close error: %w", cerr)
+	}
+
+	idx.persist = nil
+
+	return err
+}
+
+// snapshot must be called with the index lock held, at least for reading.
+func (idx *EHRIndex) snapshot() error {
+	p := idx.persist
+	if p == nil {
+		return nil
+	}
+
+	// the read lock does not exclude the concurrent snapshots
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	data, err := msgpack.Marshal(snapshot{Seq: p.seq, Ehrs: idx.Ehrs, Docs: idx.Docs, Stale: idx.Stale})
+	if err != nil {
+		return fmt.Errorf("snapshot marshal error: %w", err)
+	}
+
+	encrypted, err := p.key.Encrypt(data)
+	if err != nil {
+		return fmt.Errorf("snapshot encrypt error: %w", err)
+	}
+
+	// Write into a temporary file first, so a crash never leaves a broken snapshot behind
+	tmpPath := filepath.Join(p.dir, snapshotFileName+".tmp")
+
+	if err := writeFileSync(tmpPath, encrypted); err != nil {
+		return fmt.Errorf("snapshot write error: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, filepath.Join(p.dir, snapshotFileName)); err != nil {
+		return fmt.Errorf("snapshot rename error: %w", err)
+	}
+
+	// Records already covered by the snapshot are skipped on replay by their sequence number,
+	// so a crash before the truncation is harmless.
+	if err := p.truncate(0); err != nil {
+		return fmt.Errorf("journal truncate error: %w", err)
+	}
+
+	p.records = 0
+
+	return nil
+}
+
+// write journals the change and applies it to the index only when the record is durable,
+// so a restart never loses a change the index has already served. The record is cut off
+// the journal if the index rejects the change, and the EHR is marked stale, so the next restore
+// indexes it again from the committed data. The journal is compacted after the index lock is released.
+func (idx *EHRIndex) write(op journalOp, ehrID, uid string, doc interface{}, audit *model.AuditDetails, apply func() error) error {
+	idx.mu.Lock()
+	compact, err := idx.journalAndApply(op, ehrID, uid, doc, audit, apply)
+	idx.mu.Unlock()
+
+	if err != nil {
+		if op != opSetStale && ehrID != "" && !errors.Is(err, errors.ErrNotFound) {
+			if serr := idx.MarkStale(ehrID); serr != nil {
+				return fmt.Errorf("%w, EHR stale mark error: %v", err, serr)
+			}
+		}
+
+		return err
+	}
+
+	if compact {
+		// The change is already journaled, so a failed compaction is retried by the next write
+		if err := idx.Snapshot(); err != nil {
+			log.Println("EHR index journal compaction error:", err)
+		}
+	}
+
+	return nil
+}
+
+// journalAndApply must be called with the index lock held.
+func (idx *EHRIndex) journalAndApply(op journalOp, ehrID, uid string, doc interface{}, audit *model.AuditDetails, apply func() error) (compact bool, err error) {
+	p := idx.persist
+	if p == nil {
+		return false, apply()
+	}
+
+	rec := journalRecord{
+		Seq:   p.seq + 1,
+		Op:    op,
+		EhrID: ehrID,
+		UID:   uid,
+	}
+
+	if doc != nil {
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return false, fmt.Errorf("journal document marshal error: %w", err)
+		}
+
+		rec.Data = data
+	}
+
+	if audit != nil {
+		data, err := json.Marshal(audit)
+		if err != nil {
+			return false, fmt.Errorf("journal audit marshal error: %w", err)
+		}
+
+		rec.Audit = data
+	}
+
+	offset, err := p.journal.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return false, fmt.Errorf("journal seek error: %w", err)
+	}
+
+	if err := p.append(&rec); err != nil {
+		if rerr := p.truncate(offset); rerr != nil {
+			return false, fmt.Errorf("journal append error: %w, truncate error: %v", err, rerr)
+		}
+
+		return false, fmt.Errorf("journal append error: %w", err)
+	}
+
+	if err := apply(); err != nil {
+		if rerr := p.truncate(offset); rerr != nil {
+			return false, fmt.Errorf("%w, journal truncate error: %v", err, rerr)
+		}
+
+		return false, err
+	}
+
+	p.seq = rec.Seq
+	p.records++
+
+	return p.records >= snapshotJournalLimit, nil
+}
+
+// truncate cuts the journal off at the offset, dropping the records written after it.
+func (p *persistence) truncate(offset int64) error {
+	if err := p.journal.Truncate(offset); err != nil {
+		return err
+	}
+
+	if _, err := p.journal.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	return p.journal.Sync()
+}
+
+func (p *persistence) append(rec *journalRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("record marshal error: %w", err)
+	}
+
+	encrypted, err := p.key.Encrypt(data)
+	if err != nil {
+		return fmt.Errorf("record encrypt error: %w", err)
+	}
+
+	frame := make([]byte, frameHeaderLen, frameHeaderLen+len(encrypted))
+	binary.BigEndian.PutUint32(frame, uint32(len(encrypted)))
+	frame = append(frame, encrypted...)
+
+	if _, err := p.journal.Write(frame); err != nil {
+		return fmt.Errorf("record write error: %w", err)
+	}
+
+	return p.journal.Sync()
+}
+
+func (p *persistence) loadSnapshot() (*snapshot, error) {
+	encrypted, err := os.ReadFile(filepath.Join(p.dir, snapshotFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("ReadFile error: %w", err)
+	}
+
+	data, err := p.key.Decrypt(encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot decrypt error: %w", err)
+	}
+
+	snap := snapshot{Ehrs: map[string]*EHRNode{}}
+	if err := msgpack.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("snapshot unmarshal error: %w", err)
+	}
+
+	return &snap, nil
+}
+
+// replay applies the journal records on top of the loaded snapshot.
+// A partially written last record, left by a crash, is cut off.
+func (p *persistence) replay(idx *EHRIndex, journal *os.File) error {
+	var (
+		r      = bufio.NewReader(journal)
+		header = make([]byte, frameHeaderLen)
+		offset int64
+	)
+
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+
+			return fmt.Errorf("record header read error: %w", err)
+		}
+
+		encrypted := make([]byte, binary.BigEndian.Uint32(header))
+		if _, err := io.ReadFull(r, encrypted); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+
+			return fmt.Errorf("record read error: %w", err)
+		}
+
+		data, err := p.key.Decrypt(encrypted)
+		if err != nil {
+			return fmt.Errorf("record decrypt error: %w offset %d", err, offset)
+		}
+
+		var rec journalRecord
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return fmt.Errorf("record unmarshal error: %w offset %d", err, offset)
+		}
+
+		offset += int64(frameHeaderLen + len(encrypted))
+
+		if rec.Seq <= p.seq {
+			continue
+		}
+
+		if err := idx.apply(&rec); err != nil {
+			return fmt.Errorf("record %d apply error: %w", rec.Seq, err)
+		}
+
+		p.seq = rec.Seq
+		p.records++
+	}
+
+	if err := journal.Truncate(offset); err != nil {
+		return fmt.Errorf("journal truncate error: %w", err)
+	}
+
+	if _, err := journal.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("journal seek error: %w", err)
+	}
+
+	return nil
+}
+
+// apply performs the journaled change. It must be called with the index lock held.
+func (idx *EHRIndex) apply(rec *journalRecord) error {
+	// records written before the versions history have no audit
+	var audit model.AuditDetails
+
+	if len(rec.Audit) > 0 {
+		if err := json.Unmarshal(rec.Audit, &audit); err != nil {
+			return fmt.Errorf("AuditDetails unmarshal error: %w", err)
+		}
+	}
+
+	switch rec.Op {
+	case opAddEHR:
+		var ehr model.EHR
+		if err := json.Unmarshal(rec.Data, &ehr); err != nil {
+			return fmt.Errorf("EHR unmarshal error: %w", err)
+		}
+
+		return idx.addEHR(ehr)
+	case opAddComposition, opUpdateComposition:
+		var cmp model.Composition
+		if err := json.Unmarshal(rec.Data, &cmp); err != nil {
+			return fmt.Errorf("Composition unmarshal error: %w", err)
+		}
+
+		return idx.addComposition(rec.EhrID, cmp, audit, rec.Op == opUpdateComposition)
+	case opDeleteComposition:
+		err := idx.deleteComposition(rec.EhrID, rec.UID, audit)
+		if err != nil && !errors.Is(err, errors.ErrNotFound) {
+			return err
+		}
+
+		return nil
+	case opUpdateDirectory:
+		var dir model.Directory
+		if err := json.Unmarshal(rec.Data, &dir); err != nil {
+			return fmt.Errorf("Directory unmarshal error: %w", err)
+		}
+
+		return idx.updateDirectory(rec.EhrID, &dir)
+	case opUpdateEHRStatus:
+		var status model.EhrStatus
+		if err := json.Unmarshal(rec.Data, &status); err != nil {
+			return fmt.Errorf("EhrStatus unmarshal error: %w", err)
+		}
+
+		return idx.updateEHRStatus(rec.EhrID, &status)
+	case opAddDoc:
+		var CID string
+		if err := json.Unmarshal(rec.Data, &CID); err != nil {
+			return fmt.Errorf("CID unmarshal error: %w", err)
+		}
+
+		idx.Docs[CID] = DocRef{EhrID: rec.EhrID, UID: baseUID(rec.UID)}
+
+		return nil
+	case opRemoveEHR:
+		idx.removeEHR(rec.EhrID)
+
+		return nil
+	case opSetStale:
+		var stale bool
+		if err := json.Unmarshal(rec.Data, &stale); err != nil {
+			return fmt.Errorf("stale mark unmarshal error: %w", err)
+		}
+
+		idx.setStale(rec.EhrID, stale)
+
+		return nil
+	default:
+		return fmt.Errorf("%w: unexpected journal operation %d", errors.ErrCustom, rec.Op)
+	}
+}
+
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
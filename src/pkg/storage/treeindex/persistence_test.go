@@ -0,0 +1,134 @@
+package treeindex
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/crypto/chachaPoly"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model/base"
+)
+
+func TestEHRIndex_Persist(t *testing.T) {
+	ehr, err := loadEHRFromFile("./../../../../data/mock/ehr/ehr.json")
+	require.NoError(t, err)
+
+	cmp, err := loadComposition("./test_fixtures/simple_composition.json")
+	require.NoError(t, err)
+
+	cmp.UID = &base.UIDBasedID{ObjectID: base.ObjectID{Value: "8d5b2eb1-ad71-4ae8-8a9d-9b8d2f3b3b3a::openEHRSys.example.com::1"}}
+
+	var (
+		dir   = t.TempDir()
+		key   = chachaPoly.GenerateKey()
+		ehrID = ehr.EhrID.Value
+	)
+
+	idx := NewEHRIndex()
+	require.NoError(t, idx.Persist(dir, key))
+
+	require.NoError(t, idx.AddEHR(ehr))
+	require.NoError(t, idx.AddComposition(ehrID, cmp, model.AuditDetails{}))
+	require.NoError(t, idx.UpdateEHRStatus(ehrID, model.EhrStatus{IsQueryable: false}))
+	require.NoError(t, idx.AddDoc("cid1", ehrID, cmp.UID.Value))
+
+	// Restoring from the journal only, as after a crash
+	require.NoError(t, idx.persist.journal.Close())
+
+	got := NewEHRIndex()
+	require.NoError(t, got.Persist(dir, key))
+	assert.Equal(t, idx.Ehrs, got.Ehrs)
+	assert.Equal(t, idx.Docs, got.Docs)
+	assert.False(t, got.Ehrs[ehrID].IsQueryable())
+
+	// Restoring from the snapshot and the journal with a partially written last record
+	require.NoError(t, got.Snapshot())
+
+	cmp.UID.Value = "8d5b2eb1-ad71-4ae8-8a9d-9b8d2f3b3b3a::openEHRSys.example.com::2"
+	require.NoError(t, got.UpdateComposition(ehrID, cmp, model.AuditDetails{}))
+	require.NoError(t, got.persist.journal.Close())
+
+	f, err := os.OpenFile(filepath.Join(dir, journalFileName), os.O_WRONLY|os.O_APPEND, 0600)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{0, 0, 1, 0, 42})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	idx = got
+	got = NewEHRIndex()
+	require.NoError(t, got.Persist(dir, key))
+	assert.Equal(t, idx.Ehrs, got.Ehrs)
+
+	// Restoring after a graceful close
+	require.NoError(t, got.DeleteComposition(ehrID, cmp.UID.Value, model.AuditDetails{}))
+	require.NoError(t, got.Close())
+
+	got = NewEHRIndex()
+	require.NoError(t, got.Persist(dir, key))
+	assert.Equal(t, 0, got.Ehrs[ehrID].Compositions.Len())
+	assert.False(t, got.Ehrs[ehrID].IsQueryable())
+
+	ref, ok := got.GetDoc("cid1")
+	assert.True(t, ok)
+	assert.Equal(t, DocRef{EhrID: ehrID, UID: "8d5b2eb1-ad71-4ae8-8a9d-9b8d2f3b3b3a"}, ref)
+
+	versions := FindVersions(got.Ehrs[ehrID], got.Ehrs[ehrID], false)
+	if assert.Len(t, versions, 3) {
+		assert.Equal(t, "8d5b2eb1-ad71-4ae8-8a9d-9b8d2f3b3b3a::openEHRSys.example.com::3", versions[2].GetID())
+		assert.Nil(t, versions[2].TryGetChild("data"))
+	}
+
+	require.NoError(t, got.Close())
+
+	// Wrong key
+	got = NewEHRIndex()
+	assert.Error(t, got.Persist(dir, chachaPoly.GenerateKey()))
+}
+
+func TestEHRIndex_Persist_FailedWrite(t *testing.T) {
+	ehr, err := loadEHRFromFile("./../../../../data/mock/ehr/ehr.json")
+	require.NoError(t, err)
+
+	var (
+		dir   = t.TempDir()
+		key   = chachaPoly.GenerateKey()
+		ehrID = ehr.EhrID.Value
+	)
+
+	idx := NewEHRIndex()
+	require.NoError(t, idx.Persist(dir, key))
+	require.NoError(t, idx.AddEHR(ehr))
+
+	// The change rejected by the index is cut off the journal and the EHR is marked for the re-index
+	assert.Error(t, idx.UpdateEHRStatus("unknown", model.EhrStatus{}))
+	assert.True(t, idx.IsStale("unknown"))
+
+	// The change is not applied if the journal append fails
+	require.NoError(t, idx.persist.journal.Close())
+	assert.Error(t, idx.AddDoc("cid1", ehrID, ""))
+
+	_, ok := idx.GetDoc("cid1")
+	assert.False(t, ok)
+
+	got := NewEHRIndex()
+	require.NoError(t, got.Persist(dir, key))
+	assert.Equal(t, idx.Ehrs, got.Ehrs)
+	assert.True(t, got.IsStale("unknown"))
+	assert.Equal(t, uint64(2), got.persist.seq)
+
+	// The re-indexed EHR is removed and restored again
+	require.NoError(t, got.RemoveEHR(ehrID))
+	assert.False(t, got.IsIndexed(ehrID))
+	require.NoError(t, got.ClearStale("unknown"))
+	require.NoError(t, got.Close())
+
+	got = NewEHRIndex()
+	require.NoError(t, got.Persist(dir, key))
+	assert.False(t, got.IsIndexed(ehrID))
+	assert.False(t, got.IsStale("unknown"))
+	require.NoError(t, got.Close())
+}
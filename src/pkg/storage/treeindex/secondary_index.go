@@ -0,0 +1,650 @@
+package treeindex
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// CompareOperator is the comparison of the indexed values supported by FindByValue.
+type CompareOperator string
+
+const (
+	OpEQ CompareOperator = "="
+	OpLT CompareOperator = "<"
+	OpLE CompareOperator = "<="
+	OpGT CompareOperator = ">"
+	OpGE CompareOperator = ">="
+)
+
+// PathPart is the step of the path inside the archetyped node, e.g. items[at0004].
+// Empty NodeID matches the nodes with any archetype_node_id.
+type PathPart struct {
+	Attribute string
+	NodeID    string
+}
+
+// secondaryIndex keeps the inverted indexes of the composition nodes: the nodes by archetype_node_id
+// and the nodes of the archetypes by the values found at the paths inside them.
+// The entries are kept by the composition they are found in, the current one or the data of its version,
+// so a write changes the entries of the compositions of the written versioned object only.
+type secondaryIndex struct {
+	// mu guards the lazy sorting of the values, the lookups are done under the read lock of the EHR index
+	mu sync.Mutex
+
+	archetypes map[string]map[Noder]*archetypeNodes         // archetype_node_id -> composition -> nodes
+	values     map[string]*valueIndex                       // archetype id and attribute path -> values
+	roots      map[string]map[string]map[Noder]*indexedKeys // EHR id -> versioned object id -> composition -> keys of its entries
+}
+
+type archetypeNodes struct {
+	ehrID string
+	nodes []Noder
+
+	// content are the nodes found in the content of the composition, in the order FindByType returns them
+	content []Noder
+}
+
+type indexedKeys struct {
+	archetypes []string
+	values     []string
+}
+
+// valueIndex keeps the values found by the same attribute path inside the nodes of the archetype.
+// The values of all kinds are ordered as CompareOrderKeys does, so both the equality and the range
+// of numbers, date/times and strings are found by the binary search. The encrypted values follow them
+// ordered by their EHRs, the ciphertexts of one EHR keep the order of the numbers and date/times.
+type valueIndex struct {
+	// paths are the node ids of the path parts shared by the entries
+	paths   [][]string
+	pathIDs map[string]int
+
+	entries map[Noder][]valueEntry // composition -> entries
+	sorted  []valueEntry           // nil until the first lookup after the change
+}
+
+type valueEntry struct {
+	key   any
+	path  int
+	ehrID string
+	node  Noder
+}
+
+func newSecondaryIndex() *secondaryIndex {
+	return &secondaryIndex{
+		archetypes: map[string]map[Noder]*archetypeNodes{},
+		values:     map[string]*valueIndex{},
+		roots:      map[string]map[string]map[Noder]*indexedKeys{},
+	}
+}
+
+func (s *secondaryIndex) rebuild(ehrs map[string]*EHRNode) {
+	s.archetypes = map[string]map[Noder]*archetypeNodes{}
+	s.values = map[string]*valueIndex{}
+	s.roots = map[string]map[string]map[Noder]*indexedKeys{}
+
+	for _, ehr := range ehrs {
+		s.updateEHR(ehr)
+	}
+}
+
+// updateEHR brings the entries of the EHR in line with its current compositions and their versions.
+// The compositions indexed already are not walked again.
+func (s *secondaryIndex) updateEHR(ehr *EHRNode) {
+	objectIDs := map[string]bool{}
+
+	for objectID := range s.roots[ehr.ID] {
+		objectIDs[objectID] = true
+	}
+
+	for _, node := range ehr.Compositions.nodes() {
+		if cmp, ok := node.(*CompositionNode); ok {
+			objectIDs[baseUID(cmp.GetUID())] = true
+		}
+	}
+
+	for objectID := range ehr.Versions {
+		objectIDs[objectID] = true
+	}
+
+	for _, objectID := range sortedKeys(objectIDs) {
+		s.updateComposition(ehr, objectID)
+	}
+}
+
+// updateComposition brings the entries of the versioned object in line with its current composition and versions:
+// the compositions added by the write are indexed, the entries of the replaced or removed ones are removed.
+func (s *secondaryIndex) updateComposition(ehr *EHRNode, objectID string) {
+	roots := compositionRoots(ehr, objectID)
+
+	indexed := s.roots[ehr.ID][objectID]
+
+	for root := range indexed {
+		if !containsNode(roots, root) {
+			s.removeRoot(ehr.ID, objectID, root)
+		}
+	}
+
+	for _, root := range roots {
+		if _, ok := s.roots[ehr.ID][objectID][root]; !ok {
+			s.addRoot(ehr.ID, objectID, root)
+		}
+	}
+}
+
+// compositionRoots returns the current compositions of the versioned object and the data of its versions,
+// the compositions without uid are kept under the empty object id.
+func compositionRoots(ehr *EHRNode, objectID string) []Noder {
+	roots := []Noder{}
+
+	for _, node := range ehr.Compositions.nodes() {
+		if cmp, ok := node.(*CompositionNode); ok && baseUID(cmp.GetUID()) == objectID && !containsNode(roots, cmp) {
+			roots = append(roots, cmp)
+		}
+	}
+
+	for _, version := range ehr.Versions[objectID] {
+		if data, ok := version.TryGetChild("data").(*CompositionNode); ok && !containsNode(roots, data) {
+			roots = append(roots, data)
+		}
+	}
+
+	return roots
+}
+
+func containsNode(nodes []Noder, node Noder) bool {
+	for _, n := range nodes {
+		if n == node {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *secondaryIndex) addRoot(ehrID, objectID string, root Noder) {
+	objects, ok := s.roots[ehrID]
+	if !ok {
+		objects = map[string]map[Noder]*indexedKeys{}
+		s.roots[ehrID] = objects
+	}
+
+	keysByRoot, ok := objects[objectID]
+	if !ok {
+		keysByRoot = map[Noder]*indexedKeys{}
+		objects[objectID] = keysByRoot
+	}
+
+	keys := &indexedKeys{}
+	keysByRoot[root] = keys
+
+	s.addNode(ehrID, root, root, false, keys, map[Noder]bool{})
+}
+
+func (s *secondaryIndex) removeRoot(ehrID, objectID string, root Noder) {
+	keys, ok := s.roots[ehrID][objectID][root]
+	if !ok {
+		return
+	}
+
+	for _, key := range keys.archetypes {
+		delete(s.archetypes[key], root)
+
+		if len(s.archetypes[key]) == 0 {
+			delete(s.archetypes, key)
+		}
+	}
+
+	for _, key := range keys.values {
+		vi := s.values[key]
+		delete(vi.entries, root)
+		vi.sorted = nil
+
+		if len(vi.entries) == 0 {
+			delete(s.values, key)
+		}
+	}
+
+	delete(s.roots[ehrID][objectID], root)
+
+	if len(s.roots[ehrID][objectID]) == 0 {
+		delete(s.roots[ehrID], objectID)
+	}
+}
+
+func (s *secondaryIndex) removeEHR(ehrID string) {
+	for objectID, keysByRoot := range s.roots[ehrID] {
+		for root := range keysByRoot {
+			s.removeRoot(ehrID, objectID, root)
+		}
+	}
+
+	delete(s.roots, ehrID)
+}
+
+// addNode adds the archetyped nodes found in the node at any depth and the values of the archetypes.
+// The entries of the sections are visited once, though they are in the collections of their types as well.
+// The nodes of the content of the composition are told from the ones of its attributes, e.g. of the context.
+func (s *secondaryIndex) addNode(ehrID string, root, node Noder, content bool, keys *indexedKeys, visited map[Noder]bool) {
+	if visited[node] {
+		return
+	}
+
+	visited[node] = true
+
+	if id := archetypeNodeID(node); id != "" {
+		byRoot, ok := s.archetypes[id]
+		if !ok {
+			byRoot = map[Noder]*archetypeNodes{}
+			s.archetypes[id] = byRoot
+		}
+
+		nodes, ok := byRoot[root]
+		if !ok {
+			nodes = &archetypeNodes{ehrID: ehrID}
+			byRoot[root] = nodes
+			keys.archetypes = append(keys.archetypes, id)
+		}
+
+		nodes.nodes = append(nodes.nodes, node)
+
+		if content {
+			nodes.content = append(nodes.content, node)
+		}
+
+		if isArchetypeID(id) {
+			s.addValues(ehrID, id, root, node, node, nil, nil, keys)
+		}
+	}
+
+	if cmp, ok := node.(*CompositionNode); ok {
+		for _, name := range sortedKeys(cmp.Data) {
+			for _, n := range cmp.Data[name].nodes() {
+				s.addNode(ehrID, root, n, true, keys, visited)
+			}
+		}
+	}
+
+	children := nodeChildren(node)
+	for _, key := range sortedKeys(children) {
+		s.addNode(ehrID, root, children[key], content, keys, visited)
+	}
+}
+
+// addValues adds the values found inside the archetyped node by the paths the same way as they are resolved by the queries:
+// the items of the collection are stepped by the attribute of the collection.
+func (s *secondaryIndex) addValues(ehrID, archetypeID string, root, archetype, node Noder, attrs, ids []string, keys *indexedKeys) {
+	if valueNode, ok := node.(*ValueNode); ok {
+		s.addValue(ehrID, archetypeID, root, archetype, attrs, ids, valueNode.GetData(), keys)
+		return
+	}
+
+	children := nodeChildren(node)
+
+	if _, ok := node.(*SliceNode); !ok && len(attrs) > 0 {
+		// the id of the node is resolved by the path as well, unless the node has the attribute of the same name
+		if _, ok := children["id"]; !ok && node.GetID() != "" {
+			s.addValue(ehrID, archetypeID, root, archetype, append(attrs, "id"), append(ids, ""), node.GetID(), keys)
+		}
+	}
+
+	for _, key := range sortedKeys(children) {
+		child := children[key]
+		items := []Noder{child}
+
+		if slice, ok := child.(*SliceNode); ok {
+			items = slice.Items()
+		}
+
+		for _, item := range items {
+			// the slices are copied, so the paths of the siblings do not share the backing arrays
+			itemAttrs := append(attrs[:len(attrs):len(attrs)], key)
+			itemIDs := append(ids[:len(ids):len(ids)], archetypeNodeID(item))
+
+			s.addValues(ehrID, archetypeID, root, archetype, item, itemAttrs, itemIDs, keys)
+		}
+	}
+}
+
+func (s *secondaryIndex) addValue(ehrID, archetypeID string, root, archetype Noder, attrs, ids []string, val any, keys *indexedKeys) {
+	key := OrderKey(val)
+	if _, ok := key.(*EncryptedValue); !ok && (key == nil || OrderKindRank(key) > OrderKindRank("")) {
+		// the values of other kinds are never equal to the query values
+		return
+	}
+
+	indexKey := valueIndexKey(archetypeID, attrs)
+
+	vi, ok := s.values[indexKey]
+	if !ok {
+		vi = &valueIndex{
+			pathIDs: map[string]int{},
+			entries: map[Noder][]valueEntry{},
+		}
+		s.values[indexKey] = vi
+	}
+
+	if _, ok := vi.entries[root]; !ok {
+		keys.values = append(keys.values, indexKey)
+	}
+
+	pathKey := strings.Join(ids, "/")
+
+	path, ok := vi.pathIDs[pathKey]
+	if !ok {
+		path = len(vi.paths)
+		vi.paths = append(vi.paths, append([]string{}, ids...))
+		vi.pathIDs[pathKey] = path
+	}
+
+	vi.entries[root] = append(vi.entries[root], valueEntry{
+		key:   key,
+		path:  path,
+		ehrID: ehrID,
+		node:  archetype,
+	})
+	vi.sorted = nil
+}
+
+// findByArchetype returns the nodes with the archetype_node_id and the ids of their EHRs.
+func (s *secondaryIndex) findByArchetype(archetypeNodeID string) map[Noder]string {
+	result := map[Noder]string{}
+
+	for _, nodes := range s.archetypes[archetypeNodeID] {
+		for _, node := range nodes.nodes {
+			result[node] = nodes.ehrID
+		}
+	}
+
+	return result
+}
+
+// findInContent returns the nodes with the archetype_node_id found in the content of the composition of the EHR,
+// false if the composition is not indexed.
+func (s *secondaryIndex) findInContent(ehrID string, root Noder, archetypeNodeID string) ([]Noder, bool) {
+	cmp, ok := root.(*CompositionNode)
+	if !ok {
+		return nil, false
+	}
+
+	if _, ok := s.roots[ehrID][baseUID(cmp.GetUID())][root]; !ok {
+		return nil, false
+	}
+
+	if nodes, ok := s.archetypes[archetypeNodeID][root]; ok {
+		return nodes.content, true
+	}
+
+	return nil, true
+}
+
+// findByValue returns the nodes of the archetype having the value at the path for which the comparison is true.
+// A path resolved by a query stops on the first value, so the values found by the shorter paths are checked as well.
+// The encrypted values are found by the value encrypted with the keys of their EHRs, it is encrypted once per EHR.
+func (s *secondaryIndex) findByValue(archetypeID string, path []PathPart, op CompareOperator, val any, cipher *ValueCipher) (map[Noder]string, bool) {
+	key := OrderKey(val)
+	if !isArchetypeID(archetypeID) || key == nil || OrderKindRank(key) > OrderKindRank("") {
+		return nil, false
+	}
+
+	switch op {
+	case OpEQ, OpLT, OpLE, OpGT, OpGE:
+	default:
+		return nil, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// the data values compared as a whole, e.g. DV_QUANTITY with the units, are not indexed
+	if s.isInnerPath(archetypeID, path) {
+		return nil, false
+	}
+
+	result := map[Noder]string{}
+
+	attrs := make([]string, 0, len(path))
+	encrypted := map[string]*EncryptedValue{}
+
+	encrypt := func(ehrID string) *EncryptedValue {
+		ev, ok := encrypted[ehrID]
+		if !ok {
+			ev, _ = cipher.Encrypt(ehrID, val)
+			encrypted[ehrID] = ev
+		}
+
+		return ev
+	}
+
+	for i, part := range path {
+		attrs = append(attrs, part.Attribute)
+
+		vi, ok := s.values[valueIndexKey(archetypeID, attrs)]
+		if !ok {
+			continue
+		}
+
+		entries := vi.find(op, key)
+		if cipher != nil {
+			entries = append(entries[:len(entries):len(entries)], vi.findEncrypted(op, encrypt)...)
+		}
+
+		for _, e := range entries {
+			if vi.matchPath(e.path, path[:i+1]) {
+				result[e.node] = e.ehrID
+			}
+		}
+	}
+
+	return result, true
+}
+
+// isInnerPath checks the path addresses the nodes having the indexed values inside, but not the values.
+func (s *secondaryIndex) isInnerPath(archetypeID string, path []PathPart) bool {
+	attrs := make([]string, 0, len(path))
+	for _, part := range path {
+		attrs = append(attrs, part.Attribute)
+	}
+
+	prefix := valueIndexKey(archetypeID, attrs) + "/"
+
+	for key := range s.values {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// find returns the entries for which the comparison with the key is true.
+// The values of other kinds are never compared, so the range is limited by the kind of the key.
+func (vi *valueIndex) find(op CompareOperator, key any) []valueEntry {
+	entries := vi.sortedEntries()
+	rank := OrderKindRank(key)
+
+	search := func(f func(e valueEntry) bool) int {
+		return sort.Search(len(entries), func(i int) bool { return f(entries[i]) })
+	}
+
+	kindStart := search(func(e valueEntry) bool { return OrderKindRank(e.key) >= rank })
+	kindEnd := search(func(e valueEntry) bool { return OrderKindRank(e.key) > rank })
+	lower := search(func(e valueEntry) bool { return CompareOrderKeys(e.key, key) >= 0 })
+	upper := search(func(e valueEntry) bool { return CompareOrderKeys(e.key, key) > 0 })
+
+	switch op {
+	case OpEQ:
+		return entries[lower:upper]
+	case OpLT:
+		return entries[kindStart:lower]
+	case OpLE:
+		return entries[kindStart:upper]
+	case OpGT:
+		return entries[upper:kindEnd]
+	case OpGE:
+		return entries[lower:kindEnd]
+	default:
+		return nil
+	}
+}
+
+// findEncrypted returns the encrypted entries for which the comparison with the value encrypted by the key of their EHR is true.
+// The entries are ordered by their EHRs, the ciphertexts are compared within the EHR only.
+// The encrypted strings keep the equality only, so they are never less or greater than the value.
+func (vi *valueIndex) findEncrypted(op CompareOperator, encrypt func(ehrID string) *EncryptedValue) []valueEntry {
+	entries := vi.sortedEntries()
+
+	// search returns the first entry of entries[from:to] for which f is true, the plain values are never matched
+	search := func(from, to int, f func(ev *EncryptedValue) bool) int {
+		return from + sort.Search(to-from, func(i int) bool {
+			ev, ok := entries[from+i].key.(*EncryptedValue)
+			return ok && f(ev)
+		})
+	}
+
+	var result []valueEntry
+
+	for start := search(0, len(entries), func(*EncryptedValue) bool { return true }); start < len(entries); {
+		ehrID := entries[start].key.(*EncryptedValue).EhrID
+		end := search(start, len(entries), func(ev *EncryptedValue) bool { return ev.EhrID > ehrID })
+
+		key := encrypt(ehrID)
+		if key == nil || key.Hash != nil && op != OpEQ {
+			start = end
+			continue
+		}
+
+		kindStart := search(start, end, func(ev *EncryptedValue) bool { return ev.Kind >= key.Kind })
+		kindEnd := search(start, end, func(ev *EncryptedValue) bool { return ev.Kind > key.Kind })
+		lower := search(kindStart, kindEnd, func(ev *EncryptedValue) bool { return compareEncrypted(ev, key) >= 0 })
+		upper := search(kindStart, kindEnd, func(ev *EncryptedValue) bool { return compareEncrypted(ev, key) > 0 })
+
+		switch op {
+		case OpEQ:
+			result = append(result, entries[lower:upper]...)
+		case OpLT:
+			result = append(result, entries[kindStart:lower]...)
+		case OpLE:
+			result = append(result, entries[kindStart:upper]...)
+		case OpGT:
+			result = append(result, entries[upper:kindEnd]...)
+		case OpGE:
+			result = append(result, entries[lower:kindEnd]...)
+		}
+
+		start = end
+	}
+
+	return result
+}
+
+func (vi *valueIndex) sortedEntries() []valueEntry {
+	if vi.sorted != nil {
+		return vi.sorted
+	}
+
+	sorted := []valueEntry{}
+	for _, entries := range vi.entries {
+		sorted = append(sorted, entries...)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return compareEntryKeys(sorted[i].key, sorted[j].key) < 0
+	})
+
+	vi.sorted = sorted
+
+	return sorted
+}
+
+// compareEntryKeys orders the plain values as CompareOrderKeys does and the encrypted values after them
+// by their EHRs, kinds and ciphertexts.
+func compareEntryKeys(x, y any) int {
+	ex, xok := x.(*EncryptedValue)
+	ey, yok := y.(*EncryptedValue)
+
+	switch {
+	case !xok && !yok:
+		return CompareOrderKeys(x, y)
+	case !xok:
+		return -1
+	case !yok:
+		return 1
+	case ex.EhrID != ey.EhrID:
+		return strings.Compare(ex.EhrID, ey.EhrID)
+	case ex.Kind != ey.Kind:
+		return compareOrdered(ex.Kind, ey.Kind)
+	default:
+		return compareEncrypted(ex, ey)
+	}
+}
+
+// compareEncrypted compares the ciphertexts of the values of the same EHR and kind.
+func compareEncrypted(x, y *EncryptedValue) int {
+	if x.Order == nil || y.Order == nil {
+		return bytes.Compare(x.Hash, y.Hash)
+	}
+
+	if c := compareOrdered(*x.Order, *y.Order); c != 0 || x.Fraction == nil || y.Fraction == nil {
+		return c
+	}
+
+	return compareOrdered(*x.Fraction, *y.Fraction)
+}
+
+func (vi *valueIndex) matchPath(path int, parts []PathPart) bool {
+	ids := vi.paths[path]
+
+	for i, part := range parts {
+		if part.NodeID != "" && part.NodeID != ids[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func valueIndexKey(archetypeID string, attrs []string) string {
+	return archetypeID + "/" + strings.Join(attrs, "/")
+}
+
+// nodeChildren returns the child nodes resolved by the paths, the items of the slice are keyed by their ids.
+func nodeChildren(node Noder) Attributes {
+	switch node := node.(type) {
+	case *ObjectNode:
+		return node.Attributes
+	case *SliceNode:
+		return node.Data
+	case *DataValueNode:
+		return node.Values
+	case *CompositionNode:
+		return node.Attributes
+	case *EventContextNode:
+		return node.Attributes
+	default:
+		return nil
+	}
+}
+
+// archetypeNodeID returns the archetype_node_id of the locatable node or empty string.
+func archetypeNodeID(node Noder) string {
+	if _, ok := node.(*SliceNode); ok || node == nil {
+		return ""
+	}
+
+	valueNode, ok := node.TryGetChild("archetype_node_id").(*ValueNode)
+	if !ok {
+		return ""
+	}
+
+	id, _ := valueNode.GetData().(string)
+
+	return id
+}
+
+// isArchetypeID checks the archetype_node_id is the archetype id, e.g. openEHR-EHR-OBSERVATION.blood_pressure.v2,
+// but not the at-code of the node inside the archetype.
+func isArchetypeID(id string) bool {
+	return strings.Count(id, "-") >= 2 && strings.Contains(id, ".v")
+}
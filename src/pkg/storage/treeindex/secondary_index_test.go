@@ -0,0 +1,271 @@
+package treeindex
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model/base"
+	"github.com/vmihailenco/msgpack/v5"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEHRIndex_SecondaryIndexes(t *testing.T) {
+	ehr, err := loadEHRFromFile("./../../../../data/mock/ehr/ehr.json")
+	require.NoError(t, err)
+
+	cmp, err := loadComposition("./../../aqlquerier/test_fixtures/composition_2.json")
+	require.NoError(t, err)
+
+	cmp.UID = &base.UIDBasedID{ObjectID: base.ObjectID{Value: "8d5b2eb1-ad71-4ae8-8a9d-9b8d2f3b3b3a::openEHRSys.example.com::1"}}
+
+	idx := NewEHRIndex()
+	require.NoError(t, idx.AddEHR(ehr))
+	require.NoError(t, idx.AddComposition(ehr.EhrID.Value, cmp, model.AuditDetails{}))
+
+	const bp = "openEHR-EHR-OBSERVATION.blood_pressure.v2"
+
+	items := func(nodeID string, attrs ...string) []PathPart {
+		path := []PathPart{
+			{"data", "at0001"},
+			{"events", "at0006"},
+			{"data", "at0003"},
+			{"items", nodeID},
+		}
+
+		for _, attr := range attrs {
+			path = append(path, PathPart{Attribute: attr})
+		}
+
+		return path
+	}
+
+	nodes := idx.FindByArchetype(bp)
+	require.Len(t, nodes, 1)
+
+	for node, ehrID := range nodes {
+		assert.Equal(t, OBSERVATION, string(node.(*ObjectNode).Type))
+		assert.Equal(t, ehr.EhrID.Value, ehrID)
+	}
+
+	assert.Len(t, idx.FindByArchetype("openEHR-EHR-OBSERVATION.unknown.v1"), 0)
+
+	tests := []struct {
+		name string
+		path []PathPart
+		op   CompareOperator
+		val  any
+		want int
+	}{
+		{"1. systolic greater", items("at0004", "value", "magnitude"), OpGT, 200, 1},
+		{"2. systolic is not greater", items("at0004", "value", "magnitude"), OpGT, 300.0, 0},
+		{"3. diastolic equal", items("at0005", "value", "magnitude"), OpEQ, 756, 1},
+		{"4. diastolic less or equal", items("at0005", "value", "magnitude"), OpLE, 755.9, 0},
+		{"5. any item", items("", "value", "magnitude"), OpGE, 700, 1},
+		{"6. string value is not a number", items("", "value", "magnitude"), OpGE, "700", 0},
+		{"7. units", items("at0004", "value", "units"), OpEQ, "mm[Hg]", 1},
+		{"8. path after the value", items("at0004", "name", "value", "length"), OpEQ, "Systolic", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := idx.FindByValue(bp, tt.path, tt.op, tt.val)
+			require.True(t, ok)
+			assert.Len(t, got, tt.want)
+		})
+	}
+
+	_, ok := idx.FindByValue("at0004", []PathPart{{"value", ""}}, OpEQ, 1)
+	assert.False(t, ok, "the at-code is not indexed by values")
+
+	_, ok = idx.FindByValue(bp, items("at0004", "value"), OpGT, "140 mm[Hg]")
+	assert.False(t, ok, "the data values are not indexed as a whole")
+
+	data, err := msgpack.Marshal(idx)
+	require.NoError(t, err)
+
+	decoded := NewEHRIndex()
+	require.NoError(t, msgpack.Unmarshal(data, decoded))
+	assert.NotEmpty(t, decoded.FindByArchetype(bp), "the secondary indexes should be rebuilt on decoding")
+
+	require.NoError(t, idx.DeleteComposition(ehr.EhrID.Value, cmp.UID.Value, model.AuditDetails{}))
+
+	// the versions history keeps the deleted composition
+	assert.Len(t, idx.FindByArchetype(bp), 1)
+
+	idx.Ehrs[ehr.EhrID.Value].Versions = nil
+	idx.secondary.updateEHR(idx.Ehrs[ehr.EhrID.Value])
+
+	assert.Len(t, idx.FindByArchetype(bp), 0)
+
+	got, ok := idx.FindByValue(bp, items("at0004", "value", "magnitude"), OpGT, 200)
+	assert.True(t, ok)
+	assert.Len(t, got, 0)
+}
+
+func TestEHRIndex_SecondaryIndexes_CompositionWrites(t *testing.T) {
+	ehr, err := loadEHRFromFile("./../../../../data/mock/ehr/ehr.json")
+	require.NoError(t, err)
+
+	idx := NewEHRIndex()
+	require.NoError(t, idx.AddEHR(ehr))
+
+	ehrID := ehr.EhrID.Value
+
+	const (
+		bp    = "openEHR-EHR-OBSERVATION.blood_pressure.v2"
+		first = "8d5b2eb1-ad71-4ae8-8a9d-9b8d2f3b3b3a"
+		other = "5c3f5f0c-8d0e-4d2b-9b4a-1d6a1f4f2e11"
+	)
+
+	commit := func(uid string) {
+		cmp, err := loadComposition("./../../aqlquerier/test_fixtures/composition_2.json")
+		require.NoError(t, err)
+
+		cmp.UID = &base.UIDBasedID{ObjectID: base.ObjectID{Value: uid}}
+
+		require.NoError(t, idx.UpdateComposition(ehrID, cmp, model.AuditDetails{}))
+	}
+
+	commit(first + "::openEHRSys.example.com::1")
+
+	require.Len(t, idx.secondary.roots[ehrID][first], 1)
+
+	var firstKeys *indexedKeys
+	for _, keys := range idx.secondary.roots[ehrID][first] {
+		firstKeys = keys
+	}
+
+	// the write of another composition does not touch the entries of the first one
+	commit(other + "::openEHRSys.example.com::1")
+
+	assert.Len(t, idx.FindByArchetype(bp), 2)
+
+	for _, keys := range idx.secondary.roots[ehrID][first] {
+		assert.Same(t, firstKeys, keys)
+	}
+
+	// the new version is added, the previous one is kept by the versions history
+	commit(first + "::openEHRSys.example.com::2")
+
+	assert.Len(t, idx.secondary.roots[ehrID][first], 2)
+	assert.Len(t, idx.FindByArchetype(bp), 3)
+
+	// the version indexed again replaces the entries of the existing one
+	commit(first + "::openEHRSys.example.com::2")
+
+	assert.Len(t, idx.secondary.roots[ehrID][first], 2)
+	assert.Len(t, idx.FindByArchetype(bp), 3)
+
+	got, ok := idx.FindByValue(bp, []PathPart{
+		{"data", "at0001"},
+		{"events", "at0006"},
+		{"data", "at0003"},
+		{"items", "at0004"},
+		{"value", ""},
+		{"magnitude", ""},
+	}, OpGT, 200)
+	require.True(t, ok)
+	assert.Len(t, got, 3)
+
+	idx.Ehrs[ehrID].Versions[first] = nil
+	require.NoError(t, idx.DeleteComposition(ehrID, first+"::openEHRSys.example.com::2", model.AuditDetails{}))
+
+	assert.Empty(t, idx.secondary.roots[ehrID][first])
+	assert.Len(t, idx.FindByArchetype(bp), 1)
+
+	require.NoError(t, idx.RemoveEHR(ehrID))
+
+	assert.Empty(t, idx.secondary.roots)
+	assert.Empty(t, idx.secondary.archetypes)
+	assert.Empty(t, idx.secondary.values)
+}
+
+func TestEHRIndex_FindInContent(t *testing.T) {
+	ehr, err := loadEHRFromFile("./../../../../data/mock/ehr/ehr.json")
+	require.NoError(t, err)
+
+	cmp, err := loadComposition("./../../aqlquerier/test_fixtures/composition_1.json")
+	require.NoError(t, err)
+
+	cmp.UID = &base.UIDBasedID{ObjectID: base.ObjectID{Value: "8d5b2eb1-ad71-4ae8-8a9d-9b8d2f3b3b3a::openEHRSys.example.com::1"}}
+
+	idx := NewEHRIndex()
+	require.NoError(t, idx.AddEHR(ehr))
+	require.NoError(t, idx.AddComposition(ehr.EhrID.Value, cmp, model.AuditDetails{}))
+
+	ehrNode := idx.Ehrs[ehr.EhrID.Value]
+	root := FindByType(ehrNode, ehrNode, COMPOSITION)[0]
+
+	// the nodes of the content are found the same as FindByType finds them, the composition itself is not in its content
+	for id := range idx.secondary.archetypes {
+		found, ok := idx.FindInContent(ehrNode.ID, root, id)
+		require.True(t, ok)
+
+		for _, itemType := range []string{OBSERVATION, EVALUATION, INSTRUCTION, ACTION, SECTION, "CLUSTER", "ELEMENT"} {
+			want := []Noder{}
+
+			for _, node := range FindByType(ehrNode, root, itemType) {
+				if archetypeNodeID(node) == id {
+					want = append(want, node)
+				}
+			}
+
+			got := []Noder{}
+
+			for _, node := range found {
+				if obj, ok := node.(*ObjectNode); ok && string(obj.Type) == itemType {
+					got = append(got, node)
+				}
+			}
+
+			assert.ElementsMatch(t, want, got, "%s %s", itemType, id)
+		}
+	}
+
+	_, ok := idx.FindInContent(ehrNode.ID, &CompositionNode{}, "openEHR-EHR-OBSERVATION.blood_pressure.v2")
+	assert.False(t, ok, "the composition is not indexed")
+}
+
+func TestValueIndex_find(t *testing.T) {
+	vi := &valueIndex{entries: map[Noder][]valueEntry{}}
+
+	for i, val := range []any{"2021-12-03T17:34:06.849379+01:00", "2021-12-03", 5, 10.5, "abc", true} {
+		ehrID := fmt.Sprint(i)
+		vi.entries[&ObjectNode{}] = []valueEntry{{key: OrderKey(val), ehrID: ehrID}}
+	}
+
+	ehrIDs := func(entries []valueEntry) []string {
+		result := []string{}
+		for _, e := range entries {
+			result = append(result, e.ehrID)
+		}
+
+		sort.Strings(result)
+
+		return result
+	}
+
+	tests := []struct {
+		name string
+		op   CompareOperator
+		val  any
+		want []string
+	}{
+		{"1. numbers are not compared with other kinds", OpLT, 100, []string{"2", "3"}},
+		{"2. equal number of another type", OpEQ, 5.0, []string{"2"}},
+		{"3. date times in different zones", OpLT, "2021-12-03T17:00:00Z", []string{"0", "1"}},
+		{"4. date times greater or equal", OpGE, "2021-12-03T16:34:06.849379Z", []string{"0"}},
+		{"5. strings", OpGT, "a", []string{"4"}},
+		{"6. booleans", OpEQ, true, []string{"5"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ehrIDs(vi.find(tt.op, OrderKey(tt.val))))
+		})
+	}
+}
@@ -11,36 +11,54 @@ import (
 )
 
 const (
-	ACTION      = "ACTION"
-	EVALUATION  = "EVALUATION"
-	INSTRUCTION = "INSTRUCTION"
-	OBSERVATION = "OBSERVATION"
+	ACTION        = "ACTION"
+	ADMIN_ENTRY   = "ADMIN_ENTRY" //nolint
+	EVALUATION    = "EVALUATION"
+	GENERIC_ENTRY = "GENERIC_ENTRY" //nolint
+	INSTRUCTION   = "INSTRUCTION"
+	OBSERVATION   = "OBSERVATION"
+	SECTION       = "SECTION"
+	COMPOSITION   = "COMPOSITION"
+	FOLDER        = "FOLDER"
+
+	VERSION               = "VERSION"
+	VERSIONED_OBJECT      = "VERSIONED_OBJECT"      //nolint
+	VERSIONED_COMPOSITION = "VERSIONED_COMPOSITION" //nolint
 )
 
+// Tree keeps the content items of the composition in the collections of their RM types, e.g. OBSERVATION or SECTION.
+// The collections are created for the types found in the content, so any content item type is indexed.
 type Tree struct {
 	Data map[string]Container
 }
 
 func NewTree() *Tree {
 	return &Tree{
-		Data: map[string]Container{
-			ACTION:      {},
-			EVALUATION:  {},
-			INSTRUCTION: {},
-			OBSERVATION: {},
-		},
+		Data: map[string]Container{},
 	}
 }
 
+// GetDataSourceByName returns the collection of the content items of the RM type, it is empty if the composition has no such items.
 func (t *Tree) GetDataSourceByName(name string) (Container, error) {
 	c, ok := t.Data[name]
 	if !ok {
-		return nil, fmt.Errorf("unexpected source type: %v", name) //nolint
+		return Container{}, nil
 	}
 
 	return c, nil
 }
 
+// add adds the node of the content item into the collection of its type.
+func (t *Tree) add(itemType string, node Noder) {
+	container, ok := t.Data[itemType]
+	if !ok {
+		container = Container{}
+		t.Data[itemType] = container
+	}
+
+	container[node.GetID()] = append(container[node.GetID()], node)
+}
+
 func (t *Tree) AddComposition(com model.Composition) error {
 	return t.processCompositionContent(com.Content)
 }
@@ -66,6 +84,20 @@ func (c *Container) DecodeMsgpack(dec *msgpack.Decoder) error {
 	return nil
 }
 
+// clone returns the copy of the container with the copies of its node lists, the nodes are shared.
+func (c Container) clone() Container {
+	if c == nil {
+		return nil
+	}
+
+	result := make(Container, len(c))
+	for k, nodes := range c {
+		result[k] = append([]Noder(nil), nodes...)
+	}
+
+	return result
+}
+
 func (c Container) Len() int {
 	count := 0
 	for _, v := range c {
@@ -77,53 +109,54 @@ func (c Container) Len() int {
 
 func (t *Tree) processCompositionContent(objects []base.Root) error {
 	for _, obj := range objects {
-		switch obj := obj.(type) {
-		case *base.Section:
-			if err := t.processSection(obj); err != nil {
-				return errors.Wrap(err, "cannot process section object")
-			}
-		default:
-			return fmt.Errorf("unexpected node type in COMPOSITION.Content handler: %T", obj) //nolint
+		if _, err := t.processContentItem(obj); err != nil {
+			return errors.Wrapf(err, "cannot process %s in COMPOSITION.content", obj.GetType())
 		}
 	}
 
 	return nil
 }
 
-func (t *Tree) processSection(section *base.Section) error {
-	for _, item := range section.Items {
-		switch obj := item.(type) {
-		case *base.Action:
-			if err := addObjectIntoCollection(t.Data[ACTION], obj); err != nil {
-				return errors.Wrap(err, "cannot process ACTION in section")
-			}
-		case *base.Evaluation:
-			if err := addObjectIntoCollection(t.Data[EVALUATION], obj); err != nil {
-				return errors.Wrap(err, "cannot process EVALUATION in section")
-			}
-		case *base.Instruction:
-			if err := addObjectIntoCollection(t.Data[INSTRUCTION], obj); err != nil {
-				return errors.Wrap(err, "cannot process INSTRUCTION in section")
-			}
-		case *base.Observation:
-			if err := addObjectIntoCollection(t.Data[OBSERVATION], obj); err != nil {
-				return errors.Wrap(err, "cannot process OBSERVATION in section")
-			}
-		default:
-			return fmt.Errorf("unexpected node type in SECTION handler: %T", obj) //nolint
-		}
+// processContentItem adds the node of the section or the entry into the collection of its type.
+// The items of the sections are processed the same way at any depth, their nodes are shared between the section items and the collections.
+func (t *Tree) processContentItem(obj base.Root) (Noder, error) {
+	var (
+		node Noder
+		err  error
+	)
+
+	switch obj := obj.(type) {
+	case *base.Section:
+		node, err = t.processSection(obj)
+	case *base.Action, *base.AdminEntry, *base.Evaluation, *base.Instruction, *base.Observation, *base.GenericEntry:
+		node, err = walk(obj)
+	default:
+		return nil, fmt.Errorf("unexpected content item type: %T", obj) //nolint
 	}
 
-	return nil
+	if err != nil {
+		return nil, err
+	}
+
+	t.add(string(obj.GetType()), node)
+
+	return node, nil
 }
 
-func addObjectIntoCollection(container Container, obj base.Root) error {
-	node, err := walk(obj)
-	if err != nil {
-		return errors.Wrap(err, "cannot get node for collection")
+func (t *Tree) processSection(section *base.Section) (Noder, error) {
+	sectionNode := newNode(section)
+	itemsNode := newSliceNode()
+
+	for _, item := range section.Items {
+		node, err := t.processContentItem(item)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot process %s in section", item.GetType())
+		}
+
+		itemsNode.addAttribute(node.GetID(), node)
 	}
 
-	container[node.GetID()] = append(container[node.GetID()], node)
+	sectionNode.addAttribute("items", itemsNode)
 
-	return nil
+	return sectionNode, nil
 }
@@ -0,0 +1,308 @@
+package treeindex
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"golang.org/x/crypto/sha3"
+
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/crypto/chachaPoly"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/crypto/hm"
+)
+
+const (
+	encryptedValueExtID int8 = 1
+
+	// maxExactInt limits the integers encrypted by hm.EncryptInt, so the ciphertext stays exact in float64
+	maxExactInt = 1 << 36
+)
+
+func init() {
+	msgpack.RegisterExt(encryptedValueExtID, (*EncryptedValue)(nil))
+}
+
+// ValueCipher encrypts the leaf values of the indexed compositions with the homomorphic keys of their EHRs.
+// The numbers and the date/times keep their order and the strings keep their equality, so the comparisons
+// of the values of one EHR are evaluated over the ciphertexts with the query literals encrypted by the same keys.
+// It protects the persisted index, not the values read by the queries: the comparisons of different EHRs
+// and the operations the ciphertexts do not support, e.g. LIKE or ORDER BY, decrypt the values in memory.
+type ValueCipher struct {
+	master [32]byte
+}
+
+// EncryptedValue is the encrypted leaf value of the index.
+// Order is set for the ordered kinds, Hash for the strings. Data is the original value,
+// it is decrypted by the holder of the key only.
+// The date/times and the durations have the seconds in Order and the microseconds of the second in Fraction.
+type EncryptedValue struct {
+	EhrID    string   `msgpack:"e"`
+	Kind     int      `msgpack:"k"`
+	Order    *float64 `msgpack:"o,omitempty"`
+	Fraction *float64 `msgpack:"f,omitempty"`
+	Hash     []byte   `msgpack:"h,omitempty"`
+	Data     []byte   `msgpack:"d"`
+}
+
+func NewValueCipher(masterKey [32]byte) *ValueCipher {
+	return &ValueCipher{master: masterKey}
+}
+
+// key returns the hm key of the EHR. The multiplier of the affine encryption of the numbers, key[0:4], is limited
+// to 16 bits, so the encrypted integers up to maxExactInt do not overflow, and the offset, key[4:8], has 32 bits.
+// So the numbers are protected by a 48-bit key only, which is found from two known values of the EHR, and keep
+// their order anyway. The strings and the original values are encrypted by the keys derived from the remaining 240 bits.
+func (c *ValueCipher) key(ehrID string) *[32]byte {
+	key := sha3.Sum256(append(c.master[:], []byte(ehrID)...))
+
+	key[0], key[1] = 0, 0
+	if key[2] == 0 && key[3] == 0 {
+		key[3] = 1
+	}
+
+	return &key
+}
+
+func (c *ValueCipher) nonce(key *[32]byte) *[12]byte {
+	sum := sha3.Sum256(append(key[:], []byte("nonce")...))
+
+	var nonce [12]byte
+
+	copy(nonce[:], sum[:])
+
+	return &nonce
+}
+
+func (c *ValueCipher) dataKey(key *[32]byte) (*chachaPoly.Key, error) {
+	sum := sha3.Sum256(append(key[:], []byte("data")...))
+	return chachaPoly.NewKeyFromBytes(sum[:])
+}
+
+// Encrypt encrypts the value with the key of the EHR.
+// It returns nil for the values of the kinds which are never compared, e.g. NULL.
+func (c *ValueCipher) Encrypt(ehrID string, val any) (*EncryptedValue, error) {
+	if ev, ok := val.(*EncryptedValue); ok {
+		return ev, nil
+	}
+
+	orderKey := OrderKey(val)
+	if orderKey == nil || OrderKindRank(orderKey) > OrderKindRank("") {
+		return nil, nil
+	}
+
+	key := c.key(ehrID)
+
+	ev := &EncryptedValue{
+		EhrID: ehrID,
+		Kind:  OrderKindRank(orderKey),
+	}
+
+	switch v := orderKey.(type) {
+	case bool:
+		var x float64
+		if v {
+			x = 1
+		}
+
+		ev.Order = encryptNumber(x, key)
+	case float64:
+		ev.Order = encryptNumber(v, key)
+	case time.Time:
+		ev.Order, ev.Fraction = encryptMicroseconds(v.Unix(), int64(v.Nanosecond()/1000), key)
+	case time.Duration:
+		micro := v.Microseconds()
+		sec := micro / 1e6
+
+		if micro%1e6 < 0 {
+			sec--
+		}
+
+		ev.Order, ev.Fraction = encryptMicroseconds(sec, micro-sec*1e6, key)
+	case string:
+		ev.Hash = hm.EncryptString(v, key, c.nonce(key))
+	}
+
+	data, err := msgpack.Marshal(val)
+	if err != nil {
+		return nil, fmt.Errorf("value marshal error: %w", err)
+	}
+
+	dataKey, err := c.dataKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("dataKey error: %w", err)
+	}
+
+	ev.Data, err = dataKey.Encrypt(data)
+	if err != nil {
+		return nil, fmt.Errorf("value encrypt error: %w", err)
+	}
+
+	return ev, nil
+}
+
+func encryptNumber(x float64, key *[32]byte) *float64 {
+	var order float64
+
+	if x == math.Trunc(x) && math.Abs(x) < maxExactInt {
+		order = float64(hm.EncryptInt(int64(x), key))
+	} else {
+		order = hm.EncryptFloat(x, key)
+	}
+
+	return &order
+}
+
+// encryptMicroseconds encrypts the seconds and the microseconds of the second separately.
+// The whole number of microseconds multiplied by the key exceeds 2^53, so the neighbouring
+// microseconds would get the same ciphertext, the parts stay exact.
+func encryptMicroseconds(sec, micro int64, key *[32]byte) (order, fraction *float64) {
+	return encryptNumber(float64(sec), key), encryptNumber(float64(micro), key)
+}
+
+// Decrypt returns the original value.
+func (c *ValueCipher) Decrypt(ev *EncryptedValue) (any, error) {
+	dataKey, err := c.dataKey(c.key(ev.EhrID))
+	if err != nil {
+		return nil, fmt.Errorf("dataKey error: %w", err)
+	}
+
+	data, err := dataKey.Decrypt(ev.Data)
+	if err != nil {
+		return nil, fmt.Errorf("value decrypt error: %w", err)
+	}
+
+	var val any
+	if err := msgpack.Unmarshal(data, &val); err != nil {
+		return nil, fmt.Errorf("value unmarshal error: %w", err)
+	}
+
+	return normalizeValue(val), nil
+}
+
+// Compare compares the values when at least one of them is encrypted. The plain value is encrypted
+// with the key of the EHR of the other one, so the comparison runs over the ciphertexts.
+// The values of different EHRs have no common key, so they are decrypted and compared as CompareOrderKeys does.
+// It returns false if the values are of different kinds and ordered false for the strings,
+// which are only compared for equality: the result is 0 for equal strings and 1 otherwise.
+func (c *ValueCipher) Compare(x, y any) (result int, ordered, ok bool) {
+	ex, xok := x.(*EncryptedValue)
+	ey, yok := y.(*EncryptedValue)
+
+	switch {
+	case xok && yok && ex.EhrID != ey.EhrID:
+		return c.compareDecrypted(ex, ey)
+	case xok && !yok:
+		encrypted, err := c.Encrypt(ex.EhrID, y)
+		if err != nil || encrypted == nil {
+			return 0, false, false
+		}
+
+		ey = encrypted
+	case !xok && yok:
+		r, o, k := c.Compare(y, x)
+		return -r, o, k
+	case !xok && !yok:
+		kx, ky := OrderKey(x), OrderKey(y)
+		if kx == nil || ky == nil || OrderKindRank(kx) != OrderKindRank(ky) {
+			return 0, false, false
+		}
+
+		return CompareOrderKeys(kx, ky), true, true
+	}
+
+	if ex.Kind != ey.Kind {
+		return 0, false, false
+	}
+
+	if ex.Order != nil && ey.Order != nil {
+		result = compareOrdered(*ex.Order, *ey.Order)
+		if result == 0 && ex.Fraction != nil && ey.Fraction != nil {
+			result = compareOrdered(*ex.Fraction, *ey.Fraction)
+		}
+
+		return result, true, true
+	}
+
+	if bytes.Equal(ex.Hash, ey.Hash) {
+		return 0, false, true
+	}
+
+	return 1, false, true
+}
+
+func (c *ValueCipher) compareDecrypted(x, y *EncryptedValue) (int, bool, bool) {
+	vx, err := c.Decrypt(x)
+	if err != nil {
+		return 0, false, false
+	}
+
+	vy, err := c.Decrypt(y)
+	if err != nil {
+		return 0, false, false
+	}
+
+	return c.Compare(vx, vy)
+}
+
+// encryptNode encrypts the values of the data values found in the node at any depth.
+// The names of the locatables are kept, so the nodes are still found by the name predicates.
+func (c *ValueCipher) encryptNode(ehrID string, node Noder, inDataValue bool) error {
+	var children Attributes
+
+	switch node := node.(type) {
+	case *ValueNode:
+		if !inDataValue {
+			return nil
+		}
+
+		ev, err := c.Encrypt(ehrID, node.Data)
+		if err != nil {
+			return err
+		}
+
+		if ev != nil {
+			node.Data = ev
+		}
+
+		return nil
+	case *DataValueNode:
+		children = node.Values
+		inDataValue = true
+	case *CompositionNode:
+		for _, name := range sortedKeys(node.Data) {
+			for _, n := range node.Data[name].nodes() {
+				if err := c.encryptNode(ehrID, n, inDataValue); err != nil {
+					return err
+				}
+			}
+		}
+
+		children = node.Attributes
+	default:
+		children = nodeChildren(node)
+	}
+
+	for key, child := range children {
+		if key == "name" && !inDataValue {
+			continue
+		}
+
+		if err := c.encryptNode(ehrID, child, inDataValue); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ev *EncryptedValue) MarshalMsgpack() ([]byte, error) {
+	type plain EncryptedValue
+	return msgpack.Marshal((*plain)(ev))
+}
+
+func (ev *EncryptedValue) UnmarshalMsgpack(data []byte) error {
+	type plain EncryptedValue
+	return msgpack.Unmarshal(data, (*plain)(ev))
+}
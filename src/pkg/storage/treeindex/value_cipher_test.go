@@ -0,0 +1,204 @@
+package treeindex
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model"
+	"github.com/bsn-si/IPEHR-gateway/src/pkg/docs/model/base"
+	"github.com/vmihailenco/msgpack/v5"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValueCipher_EncryptCompare(t *testing.T) {
+	c := NewValueCipher([32]byte{1, 2, 3})
+
+	tests := []struct {
+		name        string
+		x, y        any
+		want        int
+		wantOrdered bool
+		wantOK      bool
+	}{
+		{"1. equal numbers", 120, 120.0, 0, true, true},
+		{"2. less number", 119.5, 120, -1, true, true},
+		{"3. greater number", -3, -4, 1, true, true},
+		{"4. date/times", "2022-10-24T12:00:00Z", "2022-10-24T12:00:01Z", -1, true, true},
+		{"4.1. durations", "PT36H", "P1D", 1, true, true},
+		{"5. equal strings", "mm[Hg]", "mm[Hg]", 0, false, true},
+		{"6. different strings", "mm[Hg]", "kg", 1, false, true},
+		{"7. booleans", false, true, -1, true, true},
+		{"8. different kinds", "120", 120, 0, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x, err := c.Encrypt("ehr1", tt.x)
+			require.NoError(t, err)
+
+			got, ordered, ok := c.Compare(x, tt.y)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.wantOrdered, ordered)
+			assert.Equal(t, tt.want, got)
+
+			// the plain value on the left side gives the reversed result
+			got, _, _ = c.Compare(tt.y, x)
+			assert.Equal(t, -tt.want, got)
+
+			decrypted, err := c.Decrypt(x)
+			require.NoError(t, err)
+			assert.Equal(t, tt.x, decrypted)
+		})
+	}
+
+	x, err := c.Encrypt("ehr1", 120)
+	require.NoError(t, err)
+
+	y, err := c.Encrypt("ehr2", 120)
+	require.NoError(t, err)
+
+	assert.NotEqual(t, *x.Order, *y.Order, "the EHRs should be encrypted with different keys")
+
+	got, _, ok := c.Compare(x, y)
+	assert.True(t, ok)
+	assert.Equal(t, 0, got)
+
+	null, err := c.Encrypt("ehr1", nil)
+	require.NoError(t, err)
+	assert.Nil(t, null)
+
+	// the numbers of other widths, such as the DV_COUNT magnitudes, are decrypted as int and float64
+	for val, want := range map[any]any{int64(300): 300, uint8(7): 7, float32(0.5): 0.5} {
+		ev, err := c.Encrypt("ehr1", val)
+		require.NoError(t, err)
+
+		decrypted, err := c.Decrypt(ev)
+		require.NoError(t, err)
+		assert.Equal(t, want, decrypted)
+	}
+}
+
+func TestValueCipher_EncryptMicroseconds(t *testing.T) {
+	c := NewValueCipher([32]byte{1, 2, 3})
+
+	tests := []struct {
+		name string
+		x, y any
+	}{
+		{"1. date/times", time.Date(2023, 3, 1, 12, 0, 0, 999000, time.UTC), time.Date(2023, 3, 1, 12, 0, 0, 1000000, time.UTC)},
+		{"2. date/times over the second", time.Date(2023, 3, 1, 12, 0, 0, 999999000, time.UTC), time.Date(2023, 3, 1, 12, 0, 1, 0, time.UTC)},
+		{"3. date/times before 1970", time.Date(1969, 12, 31, 23, 59, 59, 999999000, time.UTC), time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"4. durations", 36*time.Hour + time.Microsecond, 36*time.Hour + 2*time.Microsecond},
+		{"5. negative durations", -time.Microsecond, time.Duration(0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x, err := c.Encrypt("ehr1", tt.x)
+			require.NoError(t, err)
+
+			y, err := c.Encrypt("ehr1", tt.y)
+			require.NoError(t, err)
+
+			got, ordered, ok := c.Compare(x, y)
+			assert.True(t, ok)
+			assert.True(t, ordered)
+			assert.Equal(t, -1, got, "the values one microsecond apart should keep their order")
+
+			got, _, _ = c.Compare(x, tt.x)
+			assert.Equal(t, 0, got)
+		})
+	}
+}
+
+func TestEHRIndex_ValueCipher(t *testing.T) {
+	ehr, err := loadEHRFromFile("./../../../../data/mock/ehr/ehr.json")
+	require.NoError(t, err)
+
+	cmp, err := loadComposition("./../../aqlquerier/test_fixtures/composition_2.json")
+	require.NoError(t, err)
+
+	cmp.UID = &base.UIDBasedID{ObjectID: base.ObjectID{Value: "8d5b2eb1-ad71-4ae8-8a9d-9b8d2f3b3b3a::openEHRSys.example.com::1"}}
+
+	c := NewValueCipher([32]byte{1, 2, 3})
+
+	idx := NewEHRIndex()
+	idx.SetValueCipher(c)
+	require.NoError(t, idx.AddEHR(ehr))
+	require.NoError(t, idx.AddComposition(ehr.EhrID.Value, cmp, model.AuditDetails{}))
+
+	const bp = "openEHR-EHR-OBSERVATION.blood_pressure.v2"
+
+	nodes := idx.FindByArchetype(bp)
+	require.Len(t, nodes, 1, "the archetypes are not encrypted")
+
+	for node := range nodes {
+		systolic := childAt(node, "data", "events", "at0006", "data", "items", "at0004")
+		require.NotNil(t, systolic)
+
+		name, ok := childAt(systolic, "name", "value").(*ValueNode)
+		require.True(t, ok)
+		assert.Equal(t, "Systolic", name.GetData(), "the names of the locatables are not encrypted")
+
+		magnitude, ok := childAt(systolic, "value", "magnitude").(*ValueNode)
+		require.True(t, ok)
+
+		ev, ok := magnitude.GetData().(*EncryptedValue)
+		require.True(t, ok)
+
+		got, ordered, ok := c.Compare(ev, 200)
+		assert.True(t, ok && ordered)
+		assert.Equal(t, 1, got)
+
+		data, err := msgpack.Marshal(magnitude)
+		require.NoError(t, err)
+
+		decoded := &ValueNode{}
+		require.NoError(t, msgpack.Unmarshal(data, decoded))
+		assert.Equal(t, ev, decoded.GetData())
+	}
+
+	systolic := []PathPart{
+		{"data", "at0001"},
+		{"events", "at0006"},
+		{"data", "at0003"},
+		{"items", "at0004"},
+		{"value", ""},
+	}
+
+	tests := []struct {
+		name string
+		attr string
+		op   CompareOperator
+		val  any
+		want int
+	}{
+		{"1. encrypted magnitude greater", "magnitude", OpGT, 200, 1},
+		{"2. encrypted magnitude is not less", "magnitude", OpLT, 200.5, 0},
+		{"3. encrypted magnitude equal", "magnitude", OpEQ, 266, 1},
+		{"4. encrypted units equal", "units", OpEQ, "mm[Hg]", 1},
+		{"5. encrypted units are not ordered", "units", OpGT, "a", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := idx.FindByValue(bp, append(systolic[:len(systolic):len(systolic)], PathPart{Attribute: tt.attr}), tt.op, tt.val)
+			require.True(t, ok)
+			assert.Len(t, got, tt.want)
+		})
+	}
+}
+
+func childAt(node Noder, keys ...string) Noder {
+	for _, key := range keys {
+		if node == nil {
+			return nil
+		}
+
+		node = nodeChildren(node)[key]
+	}
+
+	return node
+}
@@ -16,6 +16,8 @@ func walk(obj any) (Noder, error) {
 		return processComposition(obj)
 	case model.EventContext:
 		return processEventContext(obj)
+	case base.Participation:
+		return processParticipation(obj)
 	case base.Root:
 		return walkRoot(obj)
 	case base.DataValue:
@@ -32,8 +34,12 @@ func walkRoot(obj base.Root) (Noder, error) {
 	switch obj := obj.(type) {
 	case *base.Action:
 		node, err = processAction(node, obj)
+	case *base.AdminEntry:
+		node, err = processAdminEntry(node, obj)
 	case *base.Evaluation:
 		node, err = processEvaluation(node, obj)
+	case *base.GenericEntry:
+		node, err = processGenericEntry(node, obj)
 	case *base.Instruction:
 		node, err = processInstruction(node, obj)
 	case *base.Observation:
@@ -99,6 +105,47 @@ func walkBySlice(slice any) (Noder, error) {
 				return nil, errors.Wrap(err, "cannot process EVENTS slice")
 			}
 
+			sliceNode.addAttribute(node.GetID(), node)
+		}
+	case []base.Element:
+		for i := range ss {
+			node, err := walk(&ss[i])
+			if err != nil {
+				return nil, errors.Wrap(err, "cannot process ELEMENT slice")
+			}
+
+			sliceNode.addAttribute(node.GetID(), node)
+		}
+	case []base.Cluster:
+		for i := range ss {
+			node, err := walk(&ss[i])
+			if err != nil {
+				return nil, errors.Wrap(err, "cannot process CLUSTER slice")
+			}
+
+			sliceNode.addAttribute(node.GetID(), node)
+		}
+	case []base.DvText:
+		for i := range ss {
+			node, err := walk(&ss[i])
+			if err != nil {
+				return nil, errors.Wrap(err, "cannot process DV_TEXT slice")
+			}
+
+			sliceNode.addAttribute(node.GetID(), node)
+		}
+	case []base.Participation:
+		for _, item := range ss {
+			node, err := walk(item)
+			if err != nil {
+				return nil, errors.Wrap(err, "cannot process PARTICIPATION slice")
+			}
+
+			sliceNode.addAttribute(node.GetID(), node)
+		}
+	case []base.ObjectRef:
+		for _, item := range ss {
+			node := nodeForObjectRef(item)
 			sliceNode.addAttribute(node.GetID(), node)
 		}
 	default:
@@ -250,6 +250,7 @@ func prepareTest(t *testing.T) (ts *httptest.Server, storager storage.Storager)
 	}
 
 	cfg.Storage.Localfile.Path += "/test_" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	cfg.DataPath = t.TempDir()
 
 	cfg.DefaultUserID = uuid.New().String()
 
@@ -260,7 +261,7 @@ func prepareTest(t *testing.T) (ts *httptest.Server, storager storage.Storager)
 	r := apiHandler.Build()
 	ts = httptest.NewServer(r)
 
-	return ts, storage.Storage()
+	return ts, infra.Storage
 }
 
 func tearDown(testWrap testWrap) {